@@ -0,0 +1,124 @@
+package apiserv
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/missionMeteora/apiserv/router"
+)
+
+// EnableAdmin is a shorthand for s.RegisterAdmin(s.Group("admin", prefix, mw...)).
+// example: s.EnableAdmin("/_admin", auth.CheckAuth)
+func (s *Server) EnableAdmin(prefix string, mw ...Handler) error {
+	return s.RegisterAdmin(s.Group("admin", prefix, mw...))
+}
+
+// RegisterAdmin adds the admin api to g, the group should be protected by an auth middleware.
+//
+//	GET    /log-level -> the current log level
+//	PUT    /log-level -> sets the log level, with ?level=debug or {"level": "debug"}
+//	GET    /drain     -> drain status and the number of in-flight requests
+//	POST   /drain     -> starts draining, new requests get a 503 (except for admin requests)
+//	DELETE /drain     -> stops draining, see Server.Resume
+//	GET    /stats     -> server, connection and route stats, see Server.EnableStats
+//	GET    /certs     -> the loaded certificates and their expiry, see Server.Certificates
+func (s *Server) RegisterAdmin(g Group) error {
+	if ag, ok := g.(*group); ok {
+		s.adminPrefixes = append(s.adminPrefixes, strings.TrimSuffix(ag.path, "/")+"/")
+	}
+
+	if err := g.GET("/log-level", s.adminGetLogLevel); err != nil {
+		return err
+	}
+
+	if err := g.AddRoute(http.MethodPut, "/log-level", s.adminSetLogLevel); err != nil {
+		return err
+	}
+
+	if err := g.GET("/drain", s.adminDrainStatus); err != nil {
+		return err
+	}
+
+	if err := g.POST("/drain", func(ctx *Context) Response {
+		s.startDrain()
+		return s.adminDrainStatus(ctx)
+	}); err != nil {
+		return err
+	}
+
+	if err := g.DELETE("/drain", func(ctx *Context) Response {
+		s.Resume()
+		return s.adminDrainStatus(ctx)
+	}); err != nil {
+		return err
+	}
+
+	if err := g.GET("/certs", func(ctx *Context) Response {
+		return NewJSONResponse(s.Certificates())
+	}); err != nil {
+		return err
+	}
+
+	return g.GET("/stats", func(ctx *Context) Response {
+		return NewJSONResponse(M{
+			"uptime":   time.Since(s.started).String(),
+			"inFlight": s.InFlight(),
+			"draining": s.Draining(),
+			"logLevel": s.LogLevel().String(),
+			"conns":    s.ConnStats(),
+			"routes":   s.Stats(),
+		})
+	})
+}
+
+func (s *Server) adminGetLogLevel(ctx *Context) Response {
+	return NewJSONResponse(M{"level": s.LogLevel().String()})
+}
+
+func (s *Server) adminSetLogLevel(ctx *Context) Response {
+	lvl := ctx.Query("level")
+	if lvl == "" {
+		var req struct {
+			Level string `json:"level"`
+		}
+		if err := ctx.BindJSON(&req); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		lvl = req.Level
+	}
+
+	l, err := ParseLogLevel(lvl)
+	if err != nil {
+		return NewJSONErrorResponse(http.StatusBadRequest, &Error{Field: "level", Message: err.Error()})
+	}
+
+	s.SetLogLevel(l)
+	return s.adminGetLogLevel(ctx)
+}
+
+func (s *Server) adminDrainStatus(ctx *Context) Response {
+	return NewJSONResponse(M{"draining": s.Draining(), "inFlight": s.InFlight()})
+}
+
+func (s *Server) isAdminRequest(req *http.Request) bool {
+	if fromAdminListener(req) {
+		return true
+	}
+
+	path := router.CleanPath(req.URL.Path)
+	for _, p := range s.adminPrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// startDrain marks the server as draining without waiting for the in-flight requests.
+func (s *Server) startDrain() {
+	if atomic.CompareAndSwapInt32(&s.draining, 0, 1) {
+		s.SetKeepAlivesEnabled(false)
+	}
+}
@@ -0,0 +1,122 @@
+package apiserv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/missionMeteora/apiserv/router"
+)
+
+type adminListenerKey struct{}
+
+// adminOnly holds the path prefixes of the groups served by RunAdmin, they're hidden from the other listeners.
+type adminOnly struct {
+	mux      sync.Mutex
+	prefixes atomic.Value // []string
+}
+
+func (ao *adminOnly) add(prefix string) {
+	ao.mux.Lock()
+	cur, _ := ao.prefixes.Load().([]string)
+	ao.prefixes.Store(append(cur[:len(cur):len(cur)], prefix))
+	ao.mux.Unlock()
+}
+
+func (ao *adminOnly) match(path string) bool {
+	for _, p := range ao.load() {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ao *adminOnly) load() []string {
+	v, _ := ao.prefixes.Load().([]string)
+	return v
+}
+
+// RunAdmin serves g on addr, and hides it from the other listeners which reply to its routes with a 404,
+// so internal endpoints (admin api, health checks, metrics, pprof) are only reachable on a private address.
+// Warmup doesn't block it, and its requests are served while draining.
+//
+//	admin := s.Group("admin", "/_admin")
+//	s.RegisterAdmin(admin)
+//	go s.RunAdmin("127.0.0.1:9090", admin)
+//	s.Run(":8080")
+func (s *Server) RunAdmin(addr string, g Group) error {
+	ag, ok := g.(*group)
+	if !ok {
+		return fmt.Errorf("apiserv: RunAdmin: unsupported group type %T", g)
+	}
+
+	prefix := strings.TrimSuffix(ag.path, "/") + "/"
+	s.adminOnly.add(prefix)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := s.newHTTPServer(ln.Addr().String())
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(router.CleanPath(req.URL.Path), prefix) {
+			RespNotFound.WriteToCtx(&Context{Req: req, ResponseWriter: w})
+			return
+		}
+
+		s.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), adminListenerKey{}, true)))
+	})
+
+	return s.serve(srv, ln)
+}
+
+// fromAdminListener returns true if req was received by RunAdmin's listener.
+func fromAdminListener(req *http.Request) bool {
+	v, _ := req.Context().Value(adminListenerKey{}).(bool)
+	return v
+}
+
+// hiddenRoute returns true if req is for a group served by RunAdmin but came from another listener.
+// The path is cleaned the same way the router does, so "//_admin" or "/x/../_admin" can't reach them.
+func (s *Server) hiddenRoute(req *http.Request) bool {
+	return len(s.adminOnly.load()) > 0 && !fromAdminListener(req) && s.adminOnly.match(router.CleanPath(req.URL.Path))
+}
+
+// isInternalRequest returns true if req came from the admin listener or arrived on a loopback or InternalNets address,
+// requests that didn't go through net/http (ex: tests) are checked using their RemoteAddr.
+func (s *Server) isInternalRequest(req *http.Request) bool {
+	if fromAdminListener(req) {
+		return true
+	}
+
+	var ip net.IP
+	if la, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if ta, ok := la.(*net.TCPAddr); ok {
+			ip = ta.IP
+		}
+	} else if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		ip = net.ParseIP(host)
+	}
+
+	if ip == nil {
+		return false
+	}
+
+	if ip.IsLoopback() {
+		return true
+	}
+
+	for _, n := range s.opts.InternalNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
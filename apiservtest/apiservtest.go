@@ -0,0 +1,261 @@
+// Package apiservtest provides a fluent request builder and response assertions for testing apiserv servers.
+//
+//	at := apiservtest.New(t, srv)
+//	var u User
+//	at.POST("/users").JSON(&req).Bearer(tok).Do().Status(201).Success().Data(&u)
+package apiservtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// New returns a new Tester that executes requests against h, usually an *apiserv.Server.
+func New(t testing.TB, h http.Handler) *Tester {
+	return &Tester{t: t, h: h, Header: http.Header{}}
+}
+
+// Tester builds requests against a handler.
+type Tester struct {
+	t testing.TB
+	h http.Handler
+
+	// Header is added to every request.
+	Header http.Header
+}
+
+// Request returns a new request builder, path can include a query string.
+func (at *Tester) Request(method, path string) *Request {
+	r := &Request{
+		at:     at,
+		method: method,
+		path:   path,
+		header: http.Header{},
+		query:  url.Values{},
+	}
+
+	for k, v := range at.Header {
+		r.header[k] = append([]string(nil), v...)
+	}
+
+	return r
+}
+
+// GET is an alias for Request(http.MethodGet, path).
+func (at *Tester) GET(path string) *Request { return at.Request(http.MethodGet, path) }
+
+// POST is an alias for Request(http.MethodPost, path).
+func (at *Tester) POST(path string) *Request { return at.Request(http.MethodPost, path) }
+
+// PUT is an alias for Request(http.MethodPut, path).
+func (at *Tester) PUT(path string) *Request { return at.Request(http.MethodPut, path) }
+
+// PATCH is an alias for Request(http.MethodPatch, path).
+func (at *Tester) PATCH(path string) *Request { return at.Request(http.MethodPatch, path) }
+
+// DELETE is an alias for Request(http.MethodDelete, path).
+func (at *Tester) DELETE(path string) *Request { return at.Request(http.MethodDelete, path) }
+
+// Request is a request builder, all the methods return the same request to allow chaining.
+type Request struct {
+	at      *Tester
+	body    io.Reader
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	method  string
+	path    string
+}
+
+// Header sets a request header.
+func (r *Request) Header(k, v string) *Request {
+	r.header.Set(k, v)
+	return r
+}
+
+// Bearer sets the Authorization header to "Bearer " + token.
+func (r *Request) Bearer(token string) *Request {
+	return r.Header("Authorization", "Bearer "+token)
+}
+
+// Query adds a query param.
+func (r *Request) Query(k, v string) *Request {
+	r.query.Add(k, v)
+	return r
+}
+
+// Cookie adds a cookie to the request.
+func (r *Request) Cookie(c *http.Cookie) *Request {
+	r.cookies = append(r.cookies, c)
+	return r
+}
+
+// Body sets the request body and its content type.
+func (r *Request) Body(body io.Reader, contentType string) *Request {
+	r.body = body
+	if contentType != "" {
+		r.header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+// JSON sets the body to v encoded as json.
+func (r *Request) JSON(v interface{}) *Request {
+	r.at.t.Helper()
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		r.at.t.Fatalf("%s %s: json: %v", r.method, r.path, err)
+	}
+
+	return r.Body(bytes.NewReader(j), apiserv.MimeJSON)
+}
+
+// Form sets the body to the url-encoded form values.
+func (r *Request) Form(vals url.Values) *Request {
+	return r.Body(strings.NewReader(vals.Encode()), "application/x-www-form-urlencoded")
+}
+
+// Do executes the request.
+func (r *Request) Do() *Response {
+	r.at.t.Helper()
+
+	p := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(p, "?") {
+			sep = "&"
+		}
+		p += sep + r.query.Encode()
+	}
+
+	req := httptest.NewRequest(r.method, p, r.body)
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	for _, c := range r.cookies {
+		req.AddCookie(c)
+	}
+
+	rec := httptest.NewRecorder()
+	r.at.h.ServeHTTP(rec, req)
+
+	return &Response{
+		Recorder: rec,
+		t:        r.at.t,
+		name:     r.method + " " + r.path,
+	}
+}
+
+// Response wraps the recorded response with assertions, failed assertions call t.Fatalf.
+type Response struct {
+	Recorder *httptest.ResponseRecorder
+
+	t    testing.TB
+	jr   *apiserv.JSONResponse
+	raw  json.RawMessage
+	name string
+}
+
+// Code returns the response status.
+func (r *Response) Code() int { return r.Recorder.Code }
+
+// Body returns the response body.
+func (r *Response) Body() []byte { return r.Recorder.Body.Bytes() }
+
+// Header returns the response headers.
+func (r *Response) Header() http.Header { return r.Recorder.Header() }
+
+// Status fails the test if the response status isn't code.
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.Recorder.Code != code {
+		r.t.Fatalf("%s: expected status %d, got %d: %s", r.name, code, r.Recorder.Code, r.Recorder.Body.Bytes())
+	}
+	return r
+}
+
+// HeaderEquals fails the test if the response header k isn't v.
+func (r *Response) HeaderEquals(k, v string) *Response {
+	r.t.Helper()
+	if hv := r.Recorder.Header().Get(k); hv != v {
+		r.t.Fatalf("%s: expected header %s to be %q, got %q", r.name, k, v, hv)
+	}
+	return r
+}
+
+// BodyContains fails the test if the response body doesn't contain s.
+func (r *Response) BodyContains(s string) *Response {
+	r.t.Helper()
+	if !strings.Contains(r.Recorder.Body.String(), s) {
+		r.t.Fatalf("%s: expected body to contain %q, got %s", r.name, s, r.Recorder.Body.Bytes())
+	}
+	return r
+}
+
+// JSON decodes the body as an apiserv.JSONResponse, Data is left as json.RawMessage.
+// It fails the test if the body isn't a valid JSONResponse.
+func (r *Response) JSON() *apiserv.JSONResponse {
+	r.t.Helper()
+
+	if r.jr != nil {
+		return r.jr
+	}
+
+	jr := &apiserv.JSONResponse{Data: &r.raw}
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), jr); err != nil {
+		r.t.Fatalf("%s: invalid JSONResponse (%v): %s", r.name, err, r.Recorder.Body.Bytes())
+	}
+
+	r.jr = jr
+	return jr
+}
+
+// Success fails the test if the JSONResponse isn't successful.
+func (r *Response) Success() *Response {
+	r.t.Helper()
+	if jr := r.JSON(); !jr.Success {
+		r.t.Fatalf("%s: expected a successful response, got %d: %+v", r.name, jr.Code, jr.Errors)
+	}
+	return r
+}
+
+// Failure fails the test if the JSONResponse is successful.
+func (r *Response) Failure() *Response {
+	r.t.Helper()
+	if jr := r.JSON(); jr.Success {
+		r.t.Fatalf("%s: expected a failed response, got %d: %s", r.name, jr.Code, r.raw)
+	}
+	return r
+}
+
+// ErrorField fails the test if the JSONResponse doesn't have an error for field.
+func (r *Response) ErrorField(field string) *Response {
+	r.t.Helper()
+	for _, e := range r.JSON().Errors {
+		if e.Field == field {
+			return r
+		}
+	}
+	r.t.Fatalf("%s: expected an error for field %q, got %+v", r.name, field, r.JSON().Errors)
+	return r
+}
+
+// Data decodes the JSONResponse's data into out.
+func (r *Response) Data(out interface{}) *Response {
+	r.t.Helper()
+	r.JSON()
+	if err := json.Unmarshal(r.raw, out); err != nil {
+		r.t.Fatalf("%s: error decoding data (%v): %s", r.name, err, r.raw)
+	}
+	return r
+}
@@ -0,0 +1,46 @@
+package apiservtest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestTester(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.POST("/users", func(ctx *apiserv.Context) apiserv.Response {
+		if ctx.Req.Header.Get("Authorization") != "Bearer tok" {
+			return apiserv.RespForbidden
+		}
+
+		var u user
+		if err := ctx.BindJSON(&u); err != nil || u.Name == "" {
+			return apiserv.NewJSONErrorResponse(http.StatusBadRequest, &apiserv.Error{Field: "name", IsMissing: true})
+		}
+
+		if c, err := ctx.Req.Cookie("sid"); err == nil {
+			u.Name += ":" + c.Value
+		}
+
+		ctx.Header().Set("X-Lang", ctx.Query("lang"))
+		return apiserv.NewJSONResponse(&u)
+	})
+
+	at := New(t, srv)
+	at.Header.Set("Authorization", "Bearer tok")
+
+	var u user
+	at.POST("/users").JSON(&user{Name: "x"}).Query("lang", "en").Cookie(&http.Cookie{Name: "sid", Value: "1"}).Do().
+		Status(http.StatusOK).Success().HeaderEquals("X-Lang", "en").Data(&u)
+	if u.Name != "x:1" {
+		t.Fatalf("unexpected data: %+v", u)
+	}
+
+	at.POST("/users").JSON(&user{}).Do().Status(http.StatusBadRequest).Failure().ErrorField("name")
+	at.POST("/users").Bearer("bad").Do().Status(http.StatusForbidden).Failure()
+}
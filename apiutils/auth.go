@@ -46,6 +46,25 @@ func (t Token) Set(k string, v interface{}) (ok bool) {
 	return
 }
 
+// Subject returns the token's "sub" claim for both MapClaims and StandardClaims.
+func (t Token) Subject() string {
+	switch c := t.Claims.(type) {
+	case MapClaims:
+		s, _ := c["sub"].(string)
+		return s
+	case *StandardClaims:
+		return c.Subject
+	}
+	return ""
+}
+
+// Actor returns the sub of the token's "act" claim (RFC 8693), set on impersonation tokens, only works with MapClaims.
+func (t Token) Actor() string {
+	act, _ := t.Get("act").(map[string]interface{})
+	s, _ := act["sub"].(string)
+	return s
+}
+
 // SetExpiry sets the expiry date of the token, ts is time.Time{}.Unix().
 func (t Token) SetExpiry(ts int64) (ok bool) {
 	return t.Set("exp", float64(ts))
@@ -71,6 +90,7 @@ const (
 // errors
 var (
 	ErrNoAuthHeader = errors.New("missing Authorization: Bearer header is not set")
+	ErrCSRF         = errors.New("missing or invalid csrf token")
 )
 
 // DefaultAuth has the default values for Auth
@@ -114,28 +134,85 @@ type Auth struct {
 	CookieHost  string
 	CookieHTTPS bool
 
+	// CSRF enables double-submit CSRF protection when AuthCookies are used:
+	// SignIn sets a CSRF cookie readable by js (and returns it as csrf_token), and CheckAuth requires
+	// state-changing requests authenticated by a cookie to send the same value in the CSRFHeader.
+	CSRF bool
+
+	// CSRFCookie and CSRFHeader default to "csrf_token" and "X-CSRF-Token".
+	CSRFCookie string
+	CSRFHeader string
+
 	NewClaims func() jwt.Claims
 
+	// Revocations is used by SignOut to revoke the presented token, and by CheckAuth to reject revoked tokens.
+	Revocations RevocationStore
+
 	// TokenKey is used inside the CheckAuth middleware.
 	CheckToken TokenKeyFunc
 
 	// AuthKeyFunc is used inside the SignIn middleware.
 	AuthToken TokenKeyFunc
+
+	// TOTPSecret enables two-factor auth on SignIn, it is called after AuthToken and returns the account's totp secret,
+	// or an empty string if the account doesn't use it. The code is read from the TOTPHeader (defaults to "X-TOTP-Code").
+	TOTPSecret func(ctx *apiserv.Context, tok Token) (secret string, err error)
+	TOTPHeader string
+
+	// TOTPRecovery is called with codes that aren't valid totp codes, it should return true if code is an unused
+	// recovery code for the account (and mark it as used), see totp.UseRecoveryCode.
+	TOTPRecovery func(ctx *apiserv.Context, tok Token, code string) bool
+
+	// TOTPUseStep is called with the time step of a valid code, it must atomically compare it to the last step accepted
+	// for the account and store it if it's newer, returning false otherwise, so a code can't be replayed within the skew window.
+	// Defaults to an in-memory record per process, set it to use a shared store when running multiple instances.
+	TOTPUseStep func(ctx *apiserv.Context, tok Token, step int64) (ok bool, err error)
 }
 
 // CheckAuth handles checking auth headers.
 // If the token is valid, it is set to the ctx using the TokenContextKey.
 func (a *Auth) CheckAuth(ctx *apiserv.Context) apiserv.Response {
+	return a.checkAuth(ctx, false)
+}
+
+// OptionalAuth is like CheckAuth, but requests without a token are let through anonymously,
+// so a handler can check for TokenContextKey to serve both. Requests with an invalid token still get a 401.
+func (a *Auth) OptionalAuth(ctx *apiserv.Context) apiserv.Response {
+	return a.checkAuth(ctx, true)
+}
+
+func (a *Auth) checkAuth(ctx *apiserv.Context, optional bool) apiserv.Response {
+	if !a.checkCSRF(ctx) {
+		return apiserv.NewJSONErrorResponse(http.StatusForbidden, ErrCSRF)
+	}
+
 	var extra apiserv.M
 	tok, err := jwtReq.ParseFromRequest(ctx.Req, a.Extractor, func(tok *jwt.Token) (key interface{}, err error) {
 		extra, key, err = a.CheckToken(ctx, Token{Token: tok})
 		return
 	}, jwtReq.WithClaims(a.NewClaims()), jwtReq.WithParser(DefaultParser))
+	if optional && errors.Is(err, jwtReq.ErrNoTokenInRequest) {
+		return nil
+	}
+
 	if err != nil {
 		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, err)
 	}
 
+	if revoked, err := a.isRevoked(Token{Token: tok}); err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+	} else if revoked {
+		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrRevokedToken)
+	}
+
 	ctx.Set(TokenContextKey, tok)
+	if sub := (Token{Token: tok}).Subject(); sub != "" {
+		ctx.Set(apiserv.AuditSubjectKey, sub)
+	}
+
+	if act := (Token{Token: tok}).Actor(); act != "" {
+		ctx.Set(apiserv.AuditActorKey, act)
+	}
 
 	if len(extra) > 0 {
 		return apiserv.NewJSONResponse(extra)
@@ -154,6 +231,10 @@ func (a *Auth) SignIn(ctx *apiserv.Context) apiserv.Response {
 		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, err)
 	}
 
+	if resp := a.checkTOTP(ctx, Token{Token: tok}); resp != nil {
+		return resp
+	}
+
 	signed, err := a.signAndSetHeaders(ctx, Token{Token: tok}, key)
 	if err != nil {
 		// only reason this would return an error is if there's something wrong with internal.Marshal
@@ -166,6 +247,10 @@ func (a *Auth) SignIn(ctx *apiserv.Context) apiserv.Response {
 
 	extra["access_token"] = signed
 
+	if v, ok := ctx.Get(csrfContextKey).(string); ok {
+		extra["csrf_token"] = v
+	}
+
 	return apiserv.NewJSONResponse(extra)
 }
 
@@ -188,5 +273,9 @@ func (a *Auth) signAndSetHeaders(ctx *apiserv.Context, tok Token, key interface{
 		}
 	}
 
+	if a.CSRF && len(a.AuthCookies) > 0 {
+		a.setCSRFCookie(ctx, time.Duration(exp))
+	}
+
 	return
 }
@@ -0,0 +1,63 @@
+package apiutils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	jwtReq "github.com/golang-jwt/jwt/v4/request"
+	"github.com/missionMeteora/apiserv"
+)
+
+var testKey = []byte("test-secret-key")
+
+// newTestAuth returns an Auth that signs tokens for "user-1" with testKey.
+func newTestAuth(extractors ...jwtReq.Extractor) *Auth {
+	return NewAuth(func(ctx *apiserv.Context, tok Token) (apiserv.M, interface{}, error) {
+		return nil, testKey, nil
+	}, func(ctx *apiserv.Context, tok Token) (apiserv.M, interface{}, error) {
+		tok.Set("sub", "user-1")
+		return nil, testKey, nil
+	}, extractors...)
+}
+
+func TestOptionalAuth(t *testing.T) {
+	a := newTestAuth()
+
+	var sub string
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.GET("/", a.OptionalAuth, func(ctx *apiserv.Context) apiserv.Response {
+		sub = ""
+		if jt, ok := ctx.Get(TokenContextKey).(*jwt.Token); ok {
+			sub = Token{Token: jt}.Subject()
+		}
+		return apiserv.RespOK
+	})
+
+	do := func(auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := do(""); code != http.StatusOK || sub != "" {
+		t.Fatalf("expected an anonymous request, got %d %q", code, sub)
+	}
+
+	tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, MapClaims{"sub": "user-1"}).SignedString(testKey)
+	if code := do("Bearer " + tok); code != http.StatusOK || sub != "user-1" {
+		t.Fatalf("expected an authenticated request, got %d %q", code, sub)
+	}
+
+	bad, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, MapClaims{"sub": "user-1"}).SignedString([]byte("other-key"))
+	for _, auth := range []string{"Bearer " + bad, "Bearer garbage"} {
+		if code := do(auth); code != http.StatusUnauthorized {
+			t.Fatalf("%q: invalid tokens should be rejected, got %d", auth, code)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package apiutils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// Common CSP sources
+const (
+	CSPSelf          = "'self'"
+	CSPNone          = "'none'"
+	CSPUnsafeInline  = "'unsafe-inline'"
+	CSPUnsafeEval    = "'unsafe-eval'"
+	CSPStrictDynamic = "'strict-dynamic'"
+	CSPHTTPS         = "https:"
+	CSPData          = "data:"
+)
+
+const (
+	// CSPNonceContextKey is the key used to store the current request's CSP nonce inside an apiserv.Context.
+	CSPNonceContextKey = ":CSPN:"
+)
+
+// NewCSP returns a new, empty, Content-Security-Policy builder.
+// example: NewCSP().Add("default-src", CSPSelf).Add("img-src", CSPSelf, CSPData).WithNonce("script-src")
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// CSP is a Content-Security-Policy builder, it should be fully built before being passed to SecurityHeaders.
+type CSP struct {
+	directives []cspDirective
+	nonces     []string
+
+	// ReportOnly uses Content-Security-Policy-Report-Only instead of enforcing the policy.
+	ReportOnly bool
+}
+
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// Add appends sources to directive, a directive without sources is valid (ex: upgrade-insecure-requests).
+func (c *CSP) Add(directive string, sources ...string) *CSP {
+	for i := range c.directives {
+		if d := &c.directives[i]; d.name == directive {
+			d.sources = append(d.sources, sources...)
+			return c
+		}
+	}
+
+	c.directives = append(c.directives, cspDirective{directive, sources})
+	return c
+}
+
+// WithNonce adds a per-request 'nonce-...' source to the passed directives, the nonce is available to handlers using CSPNonce.
+func (c *CSP) WithNonce(directives ...string) *CSP {
+	for _, d := range directives {
+		c.Add(d)
+	}
+	c.nonces = append(c.nonces, directives...)
+	return c
+}
+
+// HasNonce returns true if the policy uses per-request nonces.
+func (c *CSP) HasNonce() bool { return len(c.nonces) > 0 }
+
+// HeaderName returns the header name for the policy.
+func (c *CSP) HeaderName() string {
+	if c.ReportOnly {
+		return "Content-Security-Policy-Report-Only"
+	}
+	return "Content-Security-Policy"
+}
+
+// String returns the policy, if nonce isn't empty, it gets added to all the directives set by WithNonce.
+func (c *CSP) String(nonce string) string {
+	var sb strings.Builder
+	for i, d := range c.directives {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+
+		sb.WriteString(d.name)
+		for _, s := range d.sources {
+			sb.WriteByte(' ')
+			sb.WriteString(s)
+		}
+
+		if nonce == "" {
+			continue
+		}
+
+		for _, n := range c.nonces {
+			if n == d.name {
+				sb.WriteString(" 'nonce-")
+				sb.WriteString(nonce)
+				sb.WriteByte('\'')
+				break
+			}
+		}
+	}
+	return sb.String()
+}
+
+// SecurityHeaders returns a middleware that applies headers and the csp to every response.
+// If headers is nil, SecureHeaders is used without its static Content-Security-Policy.
+// If csp is nil or has no directives, no CSP header is set, other than what's in headers.
+func SecurityHeaders(headers SHM, csp *CSP) apiserv.Handler {
+	if headers == nil {
+		headers = SecureHeaders.Copy().Set("Content-Security-Policy", "")
+	}
+
+	if csp != nil && len(csp.directives) == 0 {
+		csp = nil
+	}
+
+	var static string
+	if csp != nil && !csp.HasNonce() {
+		static = csp.String("")
+	}
+
+	return func(ctx *apiserv.Context) apiserv.Response {
+		h := ctx.Header()
+		headers.Apply(h, false)
+
+		switch {
+		case csp == nil:
+		case static != "":
+			h.Set(csp.HeaderName(), static)
+		default:
+			nonce := newNonce()
+			ctx.Set(CSPNonceContextKey, nonce)
+			h.Set(csp.HeaderName(), csp.String(nonce))
+		}
+
+		return nil
+	}
+}
+
+// CSPNonce returns the current request's CSP nonce set by SecurityHeaders, or an empty string.
+func CSPNonce(ctx *apiserv.Context) string {
+	n, _ := ctx.Get(CSPNonceContextKey).(string)
+	return n
+}
+
+func newNonce() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return base64.StdEncoding.EncodeToString(b[:])
+}
@@ -0,0 +1,60 @@
+package apiutils
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestCSP(t *testing.T) {
+	csp := NewCSP().Add("default-src", CSPSelf).Add("img-src", CSPSelf, CSPData).Add("default-src", CSPHTTPS)
+	if s := csp.String(""); s != "default-src 'self' https:; img-src 'self' data:" {
+		t.Fatalf("unexpected policy: %q", s)
+	}
+
+	csp.WithNonce("script-src")
+	if s := csp.String("abc"); !strings.HasSuffix(s, "; script-src 'nonce-abc'") || !csp.HasNonce() {
+		t.Fatalf("unexpected policy: %q", s)
+	}
+
+	if (&CSP{ReportOnly: true}).HeaderName() != "Content-Security-Policy-Report-Only" {
+		t.Fatal("unexpected report-only header name")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	run := func(headers SHM, csp *CSP) (http.Header, string) {
+		ctx, rw := apiserv.NewTestContext(http.MethodGet, "/", nil)
+		if r := SecurityHeaders(headers, csp)(ctx); r != nil {
+			t.Fatalf("unexpected response: %v", r)
+		}
+		return rw.Header(), CSPNonce(ctx)
+	}
+
+	h, nonce := run(nil, nil)
+	if h.Get("X-Frame-Options") != "SAMEORIGIN" || h.Get("Content-Security-Policy") != "" || nonce != "" {
+		t.Fatalf("unexpected headers: %v %q", h, nonce)
+	}
+
+	h, _ = run(nil, NewCSP().Add("default-src", CSPSelf))
+	if h.Get("Content-Security-Policy") != "default-src 'self'" {
+		t.Fatalf("unexpected headers: %v", h)
+	}
+
+	csp := NewCSP().Add("default-src", CSPSelf).WithNonce("script-src")
+	h1, n1 := run(nil, csp)
+	h2, n2 := run(nil, csp)
+	if n1 == "" || n1 == n2 || !strings.Contains(h1.Get("Content-Security-Policy"), "'nonce-"+n1+"'") ||
+		!strings.Contains(h2.Get("Content-Security-Policy"), "'nonce-"+n2+"'") {
+		t.Fatalf("expected a fresh nonce per request: %q %v / %q %v", n1, h1, n2, h2)
+	}
+
+	for _, empty := range []*CSP{NewCSP(), {ReportOnly: true}} {
+		h, nonce = run(nil, empty)
+		if _, ok := h["Content-Security-Policy"]; ok || nonce != "" || h.Get("Content-Security-Policy-Report-Only") != "" {
+			t.Fatalf("empty policies shouldn't set a header or a nonce: %v %q", h, nonce)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package apiutils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	jwtReq "github.com/golang-jwt/jwt/v4/request"
+	"github.com/missionMeteora/apiserv"
+)
+
+const csrfContextKey = ":CSRF:"
+
+func (a *Auth) csrfNames() (cookie, header string) {
+	if cookie, header = a.CSRFCookie, a.CSRFHeader; cookie == "" {
+		cookie = "csrf_token"
+	}
+
+	if header == "" {
+		header = "X-CSRF-Token"
+	}
+
+	return
+}
+
+// setCSRFCookie sets a new csrf token, the cookie isn't HttpOnly since js has to send it back in a header.
+func (a *Auth) setCSRFCookie(ctx *apiserv.Context, exp time.Duration) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	tok := hex.EncodeToString(b[:])
+	name, _ := a.csrfNames()
+
+	c := &http.Cookie{
+		Name:     name,
+		Value:    tok,
+		Path:     "/",
+		Domain:   a.CookieHost,
+		Secure:   a.CookieHTTPS || ctx.Req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	// same prefix rules as ctx.SetCookie, browsers ignore prefixed cookies that don't follow them
+	if host := strings.HasPrefix(name, "__Host-"); host || strings.HasPrefix(name, "__Secure-") {
+		c.Secure = true
+		if host {
+			c.Domain = ""
+		}
+	}
+
+	if exp > 0 {
+		c.Expires = time.Now().Add(exp)
+	}
+
+	http.SetCookie(ctx, c)
+	ctx.Set(csrfContextKey, tok)
+}
+
+// checkCSRF returns false if the request is authenticated by a cookie, changes state and doesn't have a matching csrf header.
+func (a *Auth) checkCSRF(ctx *apiserv.Context) bool {
+	if !a.CSRF || len(a.AuthCookies) == 0 {
+		return true
+	}
+
+	switch ctx.Req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	// browsers can't add an Authorization header to a cross-site request, so only cookie auth needs the check
+	if !a.tokenFromCookie(ctx.Req) {
+		return true
+	}
+
+	name, header := a.csrfNames()
+	c, err := ctx.Req.Cookie(name)
+	if err != nil || c.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(ctx.Req.Header.Get(header))) == 1
+}
+
+// tokenFromCookie returns true if the token CheckAuth is going to use comes from a CookieExtractor,
+// it walks a.Extractor the same way jwtReq.MultiExtractor does.
+func (a *Auth) tokenFromCookie(req *http.Request) bool {
+	for _, e := range a.Extractor {
+		if tok, err := e.ExtractToken(req); tok != "" {
+			_, ok := e.(CookieExtractor)
+			return ok
+		} else if err != jwtReq.ErrNoTokenInRequest {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package apiutils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestCSRF(t *testing.T) {
+	a := newTestAuth(CookieExtractor{"auth"})
+	a.CSRF = true
+
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.POST("/login", a.SignIn)
+	api := srv.Group("", "/api", a.CheckAuth)
+	api.POST("/x", func(ctx *apiserv.Context) apiserv.Response { return apiserv.RespOK })
+	api.GET("/x", func(ctx *apiserv.Context) apiserv.Response { return apiserv.RespOK })
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/login", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("sign in failed: %d %s", rw.Code, rw.Body.String())
+	}
+
+	var authC, csrfC *http.Cookie
+	for _, c := range rw.Result().Cookies() {
+		switch c.Name {
+		case "auth":
+			authC = c
+		case "csrf_token":
+			csrfC = c
+		}
+	}
+
+	if authC == nil || csrfC == nil || csrfC.HttpOnly {
+		t.Fatalf("missing cookies: %v", rw.Header())
+	}
+
+	bearer := "Bearer " + authC.Value
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		cookies []*http.Cookie
+		header  map[string]string
+		code    int
+	}{
+		{"cookie without csrf", http.MethodPost, []*http.Cookie{authC, csrfC}, nil, http.StatusForbidden},
+		{"cookie with csrf", http.MethodPost, []*http.Cookie{authC, csrfC}, map[string]string{"X-CSRF-Token": csrfC.Value}, http.StatusOK},
+		{"cookie with wrong csrf", http.MethodPost, []*http.Cookie{authC, csrfC}, map[string]string{"X-CSRF-Token": "nope"}, http.StatusForbidden},
+		{"cookie without csrf cookie", http.MethodPost, []*http.Cookie{authC}, map[string]string{"X-CSRF-Token": csrfC.Value}, http.StatusForbidden},
+		{"cookie with a garbage authorization header", http.MethodPost, []*http.Cookie{authC, csrfC}, map[string]string{"Authorization": "x"}, http.StatusForbidden},
+		{"cookie with a bearer token", http.MethodPost, []*http.Cookie{authC, csrfC}, map[string]string{"Authorization": bearer}, http.StatusForbidden},
+		{"bearer token only", http.MethodPost, nil, map[string]string{"Authorization": bearer}, http.StatusOK},
+		{"cookie on a safe method", http.MethodGet, []*http.Cookie{authC}, nil, http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, "/api/x", nil)
+		for _, c := range tc.cookies {
+			req.AddCookie(c)
+		}
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		if rw.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d %s", tc.name, tc.code, rw.Code, rw.Body.String())
+		}
+	}
+}
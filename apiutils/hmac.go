@@ -0,0 +1,199 @@
+package apiutils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// errors
+var (
+	ErrMissingSignature = errors.New("missing signature headers")
+	ErrBadSignature     = errors.New("invalid signature")
+	ErrStaleSignature   = errors.New("signature timestamp is too old or in the future")
+	ErrReplayedRequest  = errors.New("request was already processed")
+)
+
+// HMACOptions controls VerifyHMAC and SignRequest, the zero value uses the defaults.
+type HMACOptions struct {
+	// SignatureHeader defaults to "X-Signature", the value is the hex encoded HMAC-SHA256 of
+	// method + "\n" + request uri + "\n" + timestamp + "\n" + body.
+	SignatureHeader string
+
+	// KeyIDHeader defaults to "X-Key-Id".
+	KeyIDHeader string
+
+	// TimestampHeader defaults to "X-Timestamp", the value is a unix timestamp in seconds.
+	TimestampHeader string
+
+	// MaxSkew is how old (or how far in the future) a request can be, defaults to 5 minutes.
+	MaxSkew time.Duration
+
+	// MaxBodySize defaults to 10MB, bigger requests are rejected with a 413.
+	MaxBodySize int64
+
+	// NoReplayCheck disables remembering signatures to reject duplicate requests within MaxSkew,
+	// the check is in-memory, so it only covers requests that hit the same instance.
+	NoReplayCheck bool
+}
+
+func (o *HMACOptions) withDefaults() HMACOptions {
+	var no HMACOptions
+	if o != nil {
+		no = *o
+	}
+
+	if no.SignatureHeader == "" {
+		no.SignatureHeader = "X-Signature"
+	}
+
+	if no.KeyIDHeader == "" {
+		no.KeyIDHeader = "X-Key-Id"
+	}
+
+	if no.TimestampHeader == "" {
+		no.TimestampHeader = "X-Timestamp"
+	}
+
+	if no.MaxSkew <= 0 {
+		no.MaxSkew = 5 * time.Minute
+	}
+
+	if no.MaxBodySize <= 0 {
+		no.MaxBodySize = 10 << 20
+	}
+
+	return no
+}
+
+// VerifyHMAC returns a middleware that authenticates server-to-server requests (ex: webhooks) signed with SignRequest.
+// secretLookup returns the secret for a key id, or nil if the key is unknown.
+// Failures return a 401, the body is still readable by the handlers.
+func VerifyHMAC(secretLookup func(keyID string) []byte, opts *HMACOptions) apiserv.Handler {
+	o := opts.withDefaults()
+	seen := &seenSigs{m: map[string]time.Time{}}
+
+	return func(ctx *apiserv.Context) apiserv.Response {
+		h := ctx.Req.Header
+		sig, keyID, ts := h.Get(o.SignatureHeader), h.Get(o.KeyIDHeader), h.Get(o.TimestampHeader)
+		if sig == "" || keyID == "" || ts == "" {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrMissingSignature)
+		}
+
+		t, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrBadSignature)
+		}
+
+		if d := time.Since(time.Unix(t, 0)); d > o.MaxSkew || d < -o.MaxSkew {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrStaleSignature)
+		}
+
+		secret := secretLookup(keyID)
+		if secret == nil {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrBadSignature)
+		}
+
+		body, err := readBody(ctx.Req, o.MaxBodySize)
+		if err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusRequestEntityTooLarge, err)
+		}
+
+		exp := signHMAC(secret, ctx.Req.Method, ctx.Req.URL.RequestURI(), ts, body)
+		if !hmac.Equal([]byte(sig), []byte(exp)) {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrBadSignature)
+		}
+
+		if !o.NoReplayCheck && !seen.add(sig, time.Now().Add(2*o.MaxSkew)) {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrReplayedRequest)
+		}
+
+		return nil
+	}
+}
+
+// SignRequest signs req for VerifyHMAC, it reads and restores req's body.
+func SignRequest(req *http.Request, keyID string, secret []byte, opts *HMACOptions) error {
+	o := opts.withDefaults()
+
+	body, err := readBody(req, -1)
+	if err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(o.KeyIDHeader, keyID)
+	req.Header.Set(o.TimestampHeader, ts)
+	req.Header.Set(o.SignatureHeader, signHMAC(secret, req.Method, req.URL.RequestURI(), ts, body))
+	return nil
+}
+
+func signHMAC(secret []byte, method, uri, ts string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	io.WriteString(h, method+"\n"+uri+"\n"+ts+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readBody(req *http.Request, max int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	r := io.Reader(req.Body)
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if max > 0 && int64(len(b)) > max {
+		return nil, errors.New("request body is too large")
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+type seenSigs struct {
+	mux    sync.Mutex
+	m      map[string]time.Time
+	lastGC time.Time
+}
+
+// add returns false if sig was already seen.
+func (s *seenSigs) add(sig string, exp time.Time) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastGC) > time.Minute {
+		for k, e := range s.m {
+			if now.After(e) {
+				delete(s.m, k)
+			}
+		}
+		s.lastGC = now
+	}
+
+	if e, ok := s.m[sig]; ok && now.Before(e) {
+		return false
+	}
+
+	s.m[sig] = exp
+	return true
+}
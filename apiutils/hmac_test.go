@@ -0,0 +1,97 @@
+package apiutils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestVerifyHMAC(t *testing.T) {
+	secret := []byte("hook-secret")
+	lookup := func(keyID string) []byte {
+		if keyID == "k1" {
+			return secret
+		}
+		return nil
+	}
+
+	var got string
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.POST("/hook", VerifyHMAC(lookup, &HMACOptions{MaxBodySize: 64}), func(ctx *apiserv.Context) apiserv.Response {
+		b, _ := ioutil.ReadAll(ctx.Req.Body)
+		got = string(b)
+		return apiserv.RespOK
+	})
+
+	do := func(req *http.Request) (int, string) {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code, rw.Body.String()
+	}
+
+	signed := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/hook?id=1", strings.NewReader(body))
+		if err := SignRequest(req, "k1", secret, nil); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	req := signed(`{"event":"a"}`)
+	replay := req.Clone(req.Context())
+	replay.Body = ioutil.NopCloser(strings.NewReader(`{"event":"a"}`))
+
+	if code, body := do(req); code != http.StatusOK || got != `{"event":"a"}` {
+		t.Fatalf("expected 200 with a readable body, got %d %s %q", code, body, got)
+	}
+
+	if code, body := do(replay); code != http.StatusUnauthorized || !strings.Contains(body, ErrReplayedRequest.Error()) {
+		t.Fatalf("expected ErrReplayedRequest, got %d %s", code, body)
+	}
+
+	req = signed(`{"event":"b"}`)
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"event":"c"}`))
+	if code, body := do(req); code != http.StatusUnauthorized || !strings.Contains(body, ErrBadSignature.Error()) {
+		t.Fatalf("expected ErrBadSignature for a tampered body, got %d %s", code, body)
+	}
+
+	req = signed(`{"event":"d"}`)
+	req.URL.RawQuery = "id=2"
+	if code, _ := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("expected a 401 for a tampered uri, got %d", code)
+	}
+
+	req = signed(`{"event":"e"}`)
+	req.Header.Set("X-Key-Id", "k2")
+	if code, _ := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("expected a 401 for an unknown key, got %d", code)
+	}
+
+	req = signed(`{"event":"f"}`)
+	req.Header.Del("X-Signature")
+	if code, body := do(req); code != http.StatusUnauthorized || !strings.Contains(body, ErrMissingSignature.Error()) {
+		t.Fatalf("expected ErrMissingSignature, got %d %s", code, body)
+	}
+
+	for _, d := range []time.Duration{-10 * time.Minute, 10 * time.Minute} {
+		body := `{"event":"g"}`
+		ts := strconv.FormatInt(time.Now().Add(d).Unix(), 10)
+		req = httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+		req.Header.Set("X-Key-Id", "k1")
+		req.Header.Set("X-Timestamp", ts)
+		req.Header.Set("X-Signature", signHMAC(secret, http.MethodPost, "/hook", ts, []byte(body)))
+		if code, body := do(req); code != http.StatusUnauthorized || !strings.Contains(body, ErrStaleSignature.Error()) {
+			t.Fatalf("%v: expected ErrStaleSignature, got %d %s", d, code, body)
+		}
+	}
+
+	if code, _ := do(signed(strings.Repeat("x", 65))); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected a 413, got %d", code)
+	}
+}
@@ -0,0 +1,126 @@
+package apiutils
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/missionMeteora/apiserv"
+)
+
+// ImpersonatorContextKey is the key used to access the original (admin) token inside an apiserv.Context
+// once ImpersonationMiddleware replaced the token at TokenContextKey.
+const ImpersonatorContextKey = ":JIMP:"
+
+// errors
+var (
+	ErrNoToken              = errors.New("impersonation requires an authenticated request")
+	ErrNestedImpersonation  = errors.New("impersonation tokens can't impersonate")
+	ErrImpersonationDenied  = errors.New("impersonation not allowed")
+	ErrNoImpersonationCheck = errors.New("ImpersonationOptions.Allow is required")
+)
+
+// ImpersonationOptions controls Auth.ImpersonationMiddleware.
+type ImpersonationOptions struct {
+	// Allow is called with the admin's token and the requested subject, returning an error denies the request with a 403.
+	// It is required.
+	Allow func(ctx *apiserv.Context, admin Token, subject string) error
+
+	// Claims returns extra claims for the derived token, ex: a reduced list of scopes.
+	Claims func(ctx *apiserv.Context, admin Token, subject string) MapClaims
+
+	// Key signs the derived tokens using Auth.SigningMethod, it must be a key CheckToken accepts.
+	Key interface{}
+
+	// Header is the request header with the subject to impersonate, defaults to "X-Impersonate".
+	Header string
+
+	// TokenHeader is the response header the derived token is returned in, defaults to "X-Impersonation-Token".
+	TokenHeader string
+
+	// TTL is the derived token's lifetime, defaults to 15 minutes.
+	TTL time.Duration
+}
+
+// ImpersonationMiddleware returns a middleware that lets an authenticated admin act as another subject by sending
+// the Header, it must run after CheckAuth.
+// It mints a short-lived token for the subject with an RFC 8693 "act" claim holding the admin's sub, replaces the token
+// at TokenContextKey with it (the admin's is kept at ImpersonatorContextKey), and returns it in the TokenHeader.
+// Both identities are set for Audit, and CheckAuth records the actor for requests made with the derived token.
+func (a *Auth) ImpersonationMiddleware(opts ImpersonationOptions) apiserv.Handler {
+	if opts.Header == "" {
+		opts.Header = "X-Impersonate"
+	}
+
+	if opts.TokenHeader == "" {
+		opts.TokenHeader = "X-Impersonation-Token"
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = 15 * time.Minute
+	}
+
+	return func(ctx *apiserv.Context) apiserv.Response {
+		subject := ctx.Req.Header.Get(opts.Header)
+		if subject == "" {
+			return nil
+		}
+
+		if opts.Allow == nil {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, ErrNoImpersonationCheck)
+		}
+
+		jt, _ := ctx.Get(TokenContextKey).(*jwt.Token)
+		if jt == nil {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, ErrNoToken)
+		}
+
+		admin := Token{Token: jt}
+		if admin.Actor() != "" {
+			return apiserv.NewJSONErrorResponse(http.StatusForbidden, ErrNestedImpersonation)
+		}
+
+		if err := opts.Allow(ctx, admin, subject); err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusForbidden, ErrImpersonationDenied, err)
+		}
+
+		now := time.Now()
+		claims := MapClaims{}
+		if opts.Claims != nil {
+			for k, v := range opts.Claims(ctx, admin, subject) {
+				claims[k] = v
+			}
+		}
+
+		if iss, ok := admin.GetOk("iss"); ok {
+			claims["iss"] = iss
+		}
+
+		claims["sub"] = subject
+		claims["act"] = map[string]interface{}{"sub": admin.Subject()}
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(opts.TTL).Unix()
+
+		dt := jwt.NewWithClaims(a.SigningMethod, claims)
+		signed, err := dt.SignedString(opts.Key)
+		if err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+		dt.Raw, dt.Valid = signed, true
+
+		ctx.Set(ImpersonatorContextKey, jt)
+		ctx.Set(TokenContextKey, dt)
+		ctx.Set(apiserv.AuditSubjectKey, subject)
+		ctx.Set(apiserv.AuditActorKey, admin.Subject())
+		ctx.Header().Set(opts.TokenHeader, signed)
+
+		return nil
+	}
+}
+
+// Impersonator returns the original token if the request is impersonating another subject.
+func Impersonator(ctx *apiserv.Context) (Token, bool) {
+	jt, ok := ctx.Get(ImpersonatorContextKey).(*jwt.Token)
+	return Token{Token: jt}, ok
+}
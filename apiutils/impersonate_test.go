@@ -0,0 +1,117 @@
+package apiutils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestImpersonation(t *testing.T) {
+	a := newTestAuth()
+
+	opts := ImpersonationOptions{
+		Allow: func(ctx *apiserv.Context, admin Token, subject string) error {
+			if admin.Get("admin") != true || subject == "root" {
+				return errors.New("nope")
+			}
+			return nil
+		},
+		Claims: func(ctx *apiserv.Context, admin Token, subject string) MapClaims {
+			return MapClaims{"scope": "read", "sub": "ignored"}
+		},
+		Key: testKey,
+		TTL: time.Minute,
+	}
+
+	var sub, imp, actor, scope string
+	handler := func(ctx *apiserv.Context) apiserv.Response {
+		tok := Token{Token: ctx.Get(TokenContextKey).(*jwt.Token)}
+		sub = tok.Subject()
+		scope, _ = tok.Get("scope").(string)
+		imp, actor = "", ""
+		if it, ok := Impersonator(ctx); ok {
+			imp = it.Subject()
+		}
+		actor, _ = ctx.Get(apiserv.AuditActorKey).(string)
+		return apiserv.RespOK
+	}
+
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.GET("/me", a.CheckAuth, a.ImpersonationMiddleware(opts), handler)
+	srv.GET("/noallow", a.CheckAuth, a.ImpersonationMiddleware(ImpersonationOptions{Key: testKey}), handler)
+
+	sign := func(claims MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	do := func(path, tok, subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		if subject != "" {
+			req.Header.Set("X-Impersonate", subject)
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	admin := sign(MapClaims{"sub": "admin-1", "iss": "test", "admin": true})
+
+	if rw := do("/me", admin, ""); rw.Code != http.StatusOK || sub != "admin-1" || imp != "" || rw.Header().Get("X-Impersonation-Token") != "" {
+		t.Fatalf("requests without the header shouldn't impersonate: %d %q %q", rw.Code, sub, imp)
+	}
+
+	rw := do("/me", admin, "user-2")
+	if rw.Code != http.StatusOK || sub != "user-2" || imp != "admin-1" || actor != "admin-1" || scope != "read" {
+		t.Fatalf("unexpected impersonation: %d %q %q %q %q", rw.Code, sub, imp, actor, scope)
+	}
+
+	derived := rw.Header().Get("X-Impersonation-Token")
+	dt, err := jwt.Parse(derived, func(*jwt.Token) (interface{}, error) { return testKey, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := dt.Claims.(jwt.MapClaims)
+	if exp := int64(claims["exp"].(float64)); exp > time.Now().Add(time.Minute).Unix() || claims["iss"] != "test" {
+		t.Fatalf("unexpected derived token claims: %v", claims)
+	}
+
+	// the derived token works on its own and carries the actor
+	if rw := do("/me", derived, ""); rw.Code != http.StatusOK || sub != "user-2" || imp != "" || actor != "admin-1" {
+		t.Fatalf("unexpected derived token request: %d %q %q %q", rw.Code, sub, imp, actor)
+	}
+
+	if rw := do("/me", derived, "user-3"); rw.Code != http.StatusForbidden || !strings.Contains(rw.Body.String(), ErrNestedImpersonation.Error()) {
+		t.Fatalf("expected ErrNestedImpersonation, got %d %s", rw.Code, rw.Body.String())
+	}
+
+	if rw := do("/me", admin, "root"); rw.Code != http.StatusForbidden || !strings.Contains(rw.Body.String(), ErrImpersonationDenied.Error()) {
+		t.Fatalf("expected ErrImpersonationDenied, got %d %s", rw.Code, rw.Body.String())
+	}
+
+	if rw := do("/me", sign(MapClaims{"sub": "user-4"}), "user-2"); rw.Code != http.StatusForbidden {
+		t.Fatalf("non-admins shouldn't impersonate, got %d", rw.Code)
+	}
+
+	if rw := do("/noallow", admin, "user-2"); rw.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a 500 without Allow, got %d", rw.Code)
+	}
+
+	ctx, _ := apiserv.NewTestContext(http.MethodGet, "/me", nil)
+	ctx.Req.Header.Set("X-Impersonate", "user-2")
+	if r, ok := a.ImpersonationMiddleware(opts)(ctx).(*apiserv.JSONResponse); !ok || r.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a 401 without CheckAuth, got %v", r)
+	}
+}
@@ -0,0 +1,135 @@
+package apiutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"strings"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// errors
+var (
+	ErrUnknownIssuer   = errors.New("unknown token issuer")
+	ErrUnknownKey      = errors.New("unknown token key id")
+	ErrInvalidAudience = errors.New("invalid token audience")
+	ErrInvalidAlg      = errors.New("unexpected token signing method")
+	ErrMissingClaim    = errors.New("missing required claim")
+)
+
+// Issuer is the validation rules for tokens from a single identity provider or tenant, see MultiIssuer.
+type Issuer struct {
+	// Keys maps key ids (the kid header) to verification keys, "" is used for tokens without a kid.
+	// Keys can be []byte for HMAC, *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+	Keys map[string]interface{}
+
+	// Methods is the list of allowed algs (ex: "RS256"), by default any alg that matches the key's type is allowed.
+	Methods []string
+
+	// Audience, if not empty, requires the token's aud to contain at least one of the values.
+	Audience []string
+
+	// RequiredClaims is a list of claims that must be present, ex: "sub", "email".
+	RequiredClaims []string
+
+	// Check is called after the built-in checks for anything else, ex: checking the tenant is active.
+	// The returned extra works the same as in TokenKeyFunc.
+	Check func(ctx *apiserv.Context, tok Token) (extra apiserv.M, err error)
+}
+
+// MultiIssuer returns a TokenKeyFunc for Auth.CheckToken that picks the validation rules based on the token's iss claim,
+// so one server can accept tokens from several providers or tenants. Tokens must use MapClaims (the default).
+//
+//	a := apiutils.NewAuth(apiutils.MultiIssuer(map[string]*apiutils.Issuer{
+//		"https://accounts.google.com": {Keys: googleKeys, Audience: []string{clientID}},
+//		"internal":                    {Keys: map[string]interface{}{"": secret}, Methods: []string{"HS256"}},
+//	}), nil)
+func MultiIssuer(issuers map[string]*Issuer) TokenKeyFunc {
+	return func(ctx *apiserv.Context, tok Token) (extra apiserv.M, key interface{}, err error) {
+		claims, _ := tok.Claims.(MapClaims)
+		iss, _ := claims["iss"].(string)
+
+		is := issuers[iss]
+		if is == nil {
+			return nil, nil, ErrUnknownIssuer
+		}
+
+		kid, _ := tok.Header["kid"].(string)
+		if key = is.Keys[kid]; key == nil {
+			return nil, nil, ErrUnknownKey
+		}
+
+		if !is.allowedAlg(tok.Method.Alg(), key) {
+			return nil, nil, ErrInvalidAlg
+		}
+
+		if len(is.Audience) > 0 && !hasAudience(claims["aud"], is.Audience) {
+			return nil, nil, ErrInvalidAudience
+		}
+
+		for _, c := range is.RequiredClaims {
+			if _, ok := claims[c]; !ok {
+				return nil, nil, errors.New(ErrMissingClaim.Error() + ": " + c)
+			}
+		}
+
+		if is.Check != nil {
+			if extra, err = is.Check(ctx, tok); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		return extra, key, nil
+	}
+}
+
+func (is *Issuer) allowedAlg(alg string, key interface{}) bool {
+	if len(is.Methods) > 0 {
+		for _, m := range is.Methods {
+			if m == alg {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the alg has to match the key type, otherwise a public key could be used as an HMAC secret.
+	switch key.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+
+	return false
+}
+
+func hasAudience(aud interface{}, allowed []string) bool {
+	var auds []string
+	switch v := aud.(type) {
+	case string:
+		auds = []string{v}
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+	}
+
+	for _, a := range auds {
+		for _, exp := range allowed {
+			if a == exp {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package apiutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestMultiIssuer(t *testing.T) {
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAuth(MultiIssuer(map[string]*Issuer{
+		"internal": {
+			Keys:           map[string]interface{}{"": testKey},
+			Methods:        []string{"HS256"},
+			Audience:       []string{"api"},
+			RequiredClaims: []string{"email"},
+		},
+		"rsa": {
+			Keys: map[string]interface{}{"k1": &rk.PublicKey},
+			Check: func(ctx *apiserv.Context, tok Token) (apiserv.M, error) {
+				if tok.Subject() == "suspended" {
+					return nil, errors.New("account suspended")
+				}
+				return nil, nil
+			},
+		},
+	}), nil)
+
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.GET("/", a.CheckAuth, func(ctx *apiserv.Context) apiserv.Response { return apiserv.RespOK })
+
+	sign := func(m jwt.SigningMethod, key interface{}, kid string, claims MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		tok := jwt.NewWithClaims(m, claims)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	pubDER, _ := x509.MarshalPKIXPublicKey(&rk.PublicKey)
+
+	for _, tc := range []struct {
+		name string
+		tok  string
+		err  error
+	}{
+		{"hmac", sign(jwt.SigningMethodHS256, testKey, "", MapClaims{"iss": "internal", "aud": "api", "email": "a@b.c"}), nil},
+		{"aud list", sign(jwt.SigningMethodHS256, testKey, "", MapClaims{"iss": "internal", "aud": []string{"x", "api"}, "email": "a@b.c"}), nil},
+		{"rsa", sign(jwt.SigningMethodRS256, rk, "k1", MapClaims{"iss": "rsa", "sub": "u1"}), nil},
+		{"unknown issuer", sign(jwt.SigningMethodHS256, testKey, "", MapClaims{"iss": "other"}), ErrUnknownIssuer},
+		{"no issuer", sign(jwt.SigningMethodHS256, testKey, "", MapClaims{}), ErrUnknownIssuer},
+		{"wrong audience", sign(jwt.SigningMethodHS256, testKey, "", MapClaims{"iss": "internal", "aud": "web", "email": "a@b.c"}), ErrInvalidAudience},
+		{"missing claim", sign(jwt.SigningMethodHS256, testKey, "", MapClaims{"iss": "internal", "aud": "api"}), ErrMissingClaim},
+		{"disallowed alg", sign(jwt.SigningMethodHS512, testKey, "", MapClaims{"iss": "internal", "aud": "api", "email": "a@b.c"}), ErrInvalidAlg},
+		{"unknown kid", sign(jwt.SigningMethodRS256, rk, "k2", MapClaims{"iss": "rsa"}), ErrUnknownKey},
+		{"public key as hmac secret", sign(jwt.SigningMethodHS256, pubDER, "k1", MapClaims{"iss": "rsa"}), ErrInvalidAlg},
+		{"issuer mismatch", sign(jwt.SigningMethodHS256, testKey, "k1", MapClaims{"iss": "rsa"}), ErrInvalidAlg},
+		{"check", sign(jwt.SigningMethodRS256, rk, "k1", MapClaims{"iss": "rsa", "sub": "suspended"}), errors.New("account suspended")},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.tok)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if tc.err == nil {
+			if rw.Code != http.StatusOK {
+				t.Fatalf("%s: expected 200, got %d %s", tc.name, rw.Code, rw.Body.String())
+			}
+			continue
+		}
+
+		if rw.Code != http.StatusUnauthorized || !strings.Contains(rw.Body.String(), tc.err.Error()) {
+			t.Fatalf("%s: expected a 401 with %q, got %d %s", tc.name, tc.err, rw.Code, rw.Body.String())
+		}
+	}
+}
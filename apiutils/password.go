@@ -0,0 +1,276 @@
+package apiutils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidHash is returned by VerifyPassword for hashes it doesn't understand.
+	ErrInvalidHash = errors.New("invalid password hash")
+
+	// ErrLoginLocked is returned by LoginLimiter.Check when there were too many failed attempts.
+	ErrLoginLocked = errors.New("too many failed login attempts")
+)
+
+// Argon2Params are the argon2id parameters, they are encoded in the hash so they can be changed without breaking old hashes.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2Params are the parameters used by HashPassword, based on the RFC 9106 second recommended option.
+var DefaultArgon2Params = Argon2Params{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 2,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+// DefaultBcryptCost is the cost used by HashPasswordBcrypt if cost is 0.
+const DefaultBcryptCost = 12
+
+// HashPassword hashes pw with argon2id using DefaultArgon2Params,
+// the output is in the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$salt$hash.
+func HashPassword(pw string) (string, error) {
+	return HashPasswordArgon2(pw, DefaultArgon2Params)
+}
+
+// HashPasswordArgon2 hashes pw with argon2id and the passed params.
+func HashPasswordArgon2(pw string, p Argon2Params) (string, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(pw), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	enc := base64.RawStdEncoding
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Time, p.Threads,
+		enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// HashPasswordBcrypt hashes pw with bcrypt, if cost is 0 DefaultBcryptCost is used.
+func HashPasswordBcrypt(pw string, cost int) (string, error) {
+	if cost == 0 {
+		cost = DefaultBcryptCost
+	}
+
+	h, err := bcrypt.GenerateFromPassword([]byte(pw), cost)
+	return string(h), err
+}
+
+// VerifyPassword checks pw against an argon2id or bcrypt hash in constant time.
+// needsRehash is true if the password matched but the hash doesn't use the current defaults (or is bcrypt),
+// so the caller can store a new HashPassword on a successful login.
+func VerifyPassword(hash, pw string) (ok, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		p, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, false, err
+		}
+
+		other := argon2.IDKey([]byte(pw), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+
+		p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(key))
+		return true, p != DefaultArgon2Params, nil
+
+	case strings.HasPrefix(hash, "$2"):
+		switch err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)); err {
+		case nil:
+			return true, true, nil
+		case bcrypt.ErrMismatchedHashAndPassword:
+			return false, false, nil
+		default:
+			return false, false, err
+		}
+	}
+
+	return false, false, ErrInvalidHash
+}
+
+func decodeArgon2(hash string) (p Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$") // "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	if len(parts) != 6 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var v int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &v); err != nil || v != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	enc := base64.RawStdEncoding
+	if salt, err = enc.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if key, err = enc.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
+
+// NewLoginLimiter returns a LoginLimiter that locks an account or ip out for lockout after maxAttempts failures within window.
+func NewLoginLimiter(maxAttempts int, window, lockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		MaxAttempts: maxAttempts,
+		Window:      window,
+		Lockout:     lockout,
+
+		m: map[string]*loginAttempts{},
+	}
+}
+
+// LoginLimiter tracks failed logins per account and per ip, it is safe to use from multiple goroutines.
+//
+//	if resp := ll.Check(ctx, req.Email); resp != nil {
+//		return resp
+//	}
+//	if !valid {
+//		ll.Failed(ctx, req.Email)
+//		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized)
+//	}
+//	ll.Succeeded(ctx, req.Email)
+type LoginLimiter struct {
+	MaxAttempts int
+	Window      time.Duration
+	Lockout     time.Duration
+
+	// IPMaxAttempts is the limit for a single ip across all accounts, defaults to MaxAttempts * 5.
+	IPMaxAttempts int
+
+	// IP returns the request's ip, defaults to ctx.RemoteIP, behind a proxy use apiserv.TrustedProxyIP,
+	// ctx.ClientIP trusts the client's X-Forwarded-For, which allows bypassing the limit or locking out other ips.
+	IP func(ctx *apiserv.Context) string
+
+	mux       sync.Mutex
+	m         map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+type loginAttempts struct {
+	start  time.Time
+	locked time.Time
+	n      int
+}
+
+// Check returns a 429 with a Retry-After header if the account or the request's ip are locked out.
+func (ll *LoginLimiter) Check(ctx *apiserv.Context, account string) apiserv.Response {
+	if d := ll.LockedFor(account, ll.ip(ctx)); d > 0 {
+		ctx.Header().Set("Retry-After", strconv.Itoa(int(d/time.Second)+1))
+		return apiserv.NewJSONErrorResponse(http.StatusTooManyRequests, ErrLoginLocked)
+	}
+	return nil
+}
+
+// Failed records a failed login for the account and the request's ip.
+func (ll *LoginLimiter) Failed(ctx *apiserv.Context, account string) {
+	ll.Fail(account, ll.ip(ctx))
+}
+
+func (ll *LoginLimiter) ip(ctx *apiserv.Context) string {
+	if ll.IP != nil {
+		return ll.IP(ctx)
+	}
+	return ctx.RemoteIP()
+}
+
+// Succeeded resets the account's failed attempts, the ip's are kept so it can't be used to reset the limit by logging into another account.
+func (ll *LoginLimiter) Succeeded(ctx *apiserv.Context, account string) {
+	ll.mux.Lock()
+	delete(ll.m, "a:"+account)
+	ll.mux.Unlock()
+}
+
+// LockedFor returns how long until either the account or ip can try again, 0 if they're not locked.
+func (ll *LoginLimiter) LockedFor(account, ip string) time.Duration {
+	now := time.Now()
+
+	ll.mux.Lock()
+	defer ll.mux.Unlock()
+
+	var d time.Duration
+	for _, k := range [...]string{"a:" + account, "ip:" + ip} {
+		if la := ll.m[k]; la != nil && now.Before(la.locked) {
+			if v := la.locked.Sub(now); v > d {
+				d = v
+			}
+		}
+	}
+
+	return d
+}
+
+// Fail records a failed login for account and ip, either can be empty.
+func (ll *LoginLimiter) Fail(account, ip string) {
+	now := time.Now()
+
+	ll.mux.Lock()
+	defer ll.mux.Unlock()
+
+	ll.sweep(now)
+
+	if account != "" {
+		ll.fail("a:"+account, ll.MaxAttempts, now)
+	}
+
+	if ip != "" {
+		max := ll.IPMaxAttempts
+		if max == 0 {
+			max = ll.MaxAttempts * 5
+		}
+		ll.fail("ip:"+ip, max, now)
+	}
+}
+
+func (ll *LoginLimiter) fail(key string, max int, now time.Time) {
+	la := ll.m[key]
+	if la == nil || now.Sub(la.start) > ll.Window {
+		la = &loginAttempts{start: now}
+		ll.m[key] = la
+	}
+
+	if la.n++; la.n >= max {
+		la.locked = now.Add(ll.Lockout)
+	}
+}
+
+// sweep removes stale entries once per window, must be called with the lock held.
+func (ll *LoginLimiter) sweep(now time.Time) {
+	if now.Sub(ll.lastSweep) < ll.Window {
+		return
+	}
+
+	ll.lastSweep = now
+	for k, la := range ll.m {
+		if now.Sub(la.start) > ll.Window && now.After(la.locked) {
+			delete(ll.m, k)
+		}
+	}
+}
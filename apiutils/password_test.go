@@ -0,0 +1,101 @@
+package apiutils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	fast := Argon2Params{Time: 1, Memory: 1024, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+	h, err := HashPasswordArgon2("hunter2", fast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(h, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash: %s", h)
+	}
+
+	if ok, rehash, err := VerifyPassword(h, "hunter2"); !ok || !rehash || err != nil {
+		t.Fatalf("expected a match that needs a rehash, got %v %v %v", ok, rehash, err)
+	}
+
+	if ok, _, err := VerifyPassword(h, "hunter3"); ok || err != nil {
+		t.Fatalf("wrong password matched: %v %v", ok, err)
+	}
+
+	if h2, _ := HashPasswordArgon2("hunter2", fast); h2 == h {
+		t.Fatal("hashes should be salted")
+	}
+
+	bh, err := HashPasswordBcrypt("hunter2", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, rehash, err := VerifyPassword(bh, "hunter2"); !ok || !rehash || err != nil {
+		t.Fatalf("bcrypt hashes should match and need a rehash, got %v %v %v", ok, rehash, err)
+	}
+
+	if ok, _, _ := VerifyPassword(bh, "nope"); ok {
+		t.Fatal("wrong bcrypt password matched")
+	}
+
+	for _, bad := range []string{"", "plain", "$argon2id$v=18$m=1,t=1,p=1$AA$AA", "$argon2id$v=19$m=x$AA$AA", h[:len(h)-44]} {
+		if _, _, err := VerifyPassword(bad, "hunter2"); err != ErrInvalidHash {
+			t.Fatalf("%q: expected ErrInvalidHash, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	ll := NewLoginLimiter(2, time.Minute, time.Minute)
+
+	ctxFor := func(remote, xff string) *apiserv.Context {
+		ctx, _ := apiserv.NewTestContext(http.MethodPost, "/login", nil)
+		ctx.Req.RemoteAddr = remote
+		if xff != "" {
+			ctx.Req.Header.Set("X-Forwarded-For", xff)
+		}
+		return ctx
+	}
+
+	ll.Failed(ctxFor("192.0.2.1:1", "203.0.113.1"), "alice")
+	if ll.Check(ctxFor("192.0.2.1:1", ""), "alice") != nil {
+		t.Fatal("shouldn't be locked after one failure")
+	}
+
+	ll.Failed(ctxFor("192.0.2.1:1", "203.0.113.2"), "alice")
+
+	ctx := ctxFor("192.0.2.2:1", "")
+	if r := ll.Check(ctx, "alice"); r == nil || ctx.Header().Get("Retry-After") == "" {
+		t.Fatalf("the account should be locked: %v %v", r, ctx.Header())
+	}
+
+	ll.Succeeded(ctxFor("192.0.2.1:1", ""), "alice")
+
+	// the ip is locked out after 10 failures, rotating X-Forwarded-For doesn't help
+	for i := 0; i < 10; i++ {
+		ll.Failed(ctxFor("192.0.2.3:1", fmt.Sprintf("203.0.113.%d", i)), fmt.Sprintf("user%d", i))
+	}
+
+	if ll.Check(ctxFor("192.0.2.3:1", "198.51.100.1"), "bob") == nil {
+		t.Fatal("the remote ip should be locked")
+	}
+
+	if ll.LockedFor("", "203.0.113.1") != 0 {
+		t.Fatal("spoofed X-Forwarded-For addresses shouldn't be locked")
+	}
+
+	ll.IP = apiserv.TrustedProxyIP("192.0.2.0/24")
+	if ll.Check(ctxFor("192.0.2.3:1", "198.51.100.1"), "bob") != nil {
+		t.Fatal("the forwarded client ip shouldn't be locked")
+	}
+}
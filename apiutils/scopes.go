@@ -0,0 +1,71 @@
+package apiutils
+
+import (
+	"net/http"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/missionMeteora/apiserv"
+)
+
+// Scopes returns the token's scopes from the space separated "scope" claim (RFC 8693),
+// or the "scopes" / "scp" list claims, only works with MapClaims.
+func (t Token) Scopes() []string {
+	if s, ok := t.Get("scope").(string); ok {
+		return strings.Fields(s)
+	}
+
+	for _, k := range [...]string{"scopes", "scp"} {
+		switch v := t.Get(k).(type) {
+		case string:
+			return strings.Fields(v)
+		case []interface{}:
+			out := make([]string, 0, len(v))
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					out = append(out, s)
+				}
+			}
+			return out
+		}
+	}
+
+	return nil
+}
+
+// EnforceScopes is a middleware that checks the current token has all the scopes declared in the route's
+// RouteMeta.Scopes (see Group.Scopes), it must run after CheckAuth:
+//
+//	api := s.Group("api", "/api", auth.CheckAuth, auth.EnforceScopes)
+//	api.Scopes("reports:read").GET("/reports", listReports)
+//
+// Routes without scopes are let through, missing scopes return a 403 listing them.
+func (a *Auth) EnforceScopes(ctx *apiserv.Context) apiserv.Response {
+	meta := ctx.RouteMeta()
+	if meta == nil || len(meta.Scopes) == 0 {
+		return nil
+	}
+
+	jt, _ := ctx.Get(TokenContextKey).(*jwt.Token)
+	if jt == nil {
+		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized)
+	}
+
+	have := map[string]bool{}
+	for _, s := range (Token{Token: jt}).Scopes() {
+		have[s] = true
+	}
+
+	var missing []string
+	for _, s := range meta.Scopes {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+
+	if len(missing) > 0 {
+		return apiserv.NewJSONErrorResponse(http.StatusForbidden, &apiserv.Error{Field: "scope", Message: "missing scopes: " + strings.Join(missing, " ")})
+	}
+
+	return nil
+}
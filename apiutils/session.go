@@ -0,0 +1,256 @@
+package apiutils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// SessionContextKey is the key used to store the current *Session in the ctx.
+const SessionContextKey = ":SESS:"
+
+var (
+	// ErrNoSession is returned when the request doesn't have a valid session.
+	ErrNoSession = errors.New("invalid or expired session")
+
+	// ErrNoSubject is returned by SessionAuth.SignIn if the login func returned an empty subject.
+	ErrNoSubject = errors.New("login didn't return a subject")
+)
+
+// Session is a server-side session, it is stored as json.
+type Session struct {
+	ID      string    `json:"-"`
+	Subject string    `json:"sub"`
+	Data    apiserv.M `json:"data,omitempty"`
+
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// GetSession returns the session set by SessionAuth.CheckAuth or nil.
+func GetSession(ctx *apiserv.Context) *Session {
+	s, _ := ctx.Get(SessionContextKey).(*Session)
+	return s
+}
+
+// SessionLoginFunc checks the request's credentials and returns the session's subject (ex: the user id) and any extra data.
+type SessionLoginFunc = func(ctx *apiserv.Context) (subject string, data apiserv.M, err error)
+
+// NewSessionAuth returns a SessionAuth using the passed store, which can be apiserv.NewMemoryStore() or a redisstore.Store.
+func NewSessionAuth(store apiserv.CacheStore, login SessionLoginFunc) *SessionAuth {
+	return &SessionAuth{
+		Store: store,
+		Login: login,
+
+		Cookie:          "session_id",
+		Prefix:          "sess:",
+		IdleTimeout:     30 * time.Minute,
+		AbsoluteTimeout: 24 * time.Hour,
+	}
+}
+
+// SessionAuth is an alternative to Auth that issues opaque session ids stored server-side,
+// so sessions can be revoked instantly by deleting them from the store.
+// The session id is read from the Cookie or an "Authorization: Bearer" header.
+type SessionAuth struct {
+	Store apiserv.CacheStore
+	Login SessionLoginFunc
+
+	// Prefix is prepended to the session id to build the store key.
+	Prefix string
+
+	Cookie      string
+	CookieHost  string
+	CookieHTTPS bool
+
+	// IdleTimeout expires sessions that weren't used for that long, it is refreshed on every request.
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout expires sessions that long after SignIn, regardless of activity.
+	// If both timeouts are 0, sessions are stored without a ttl and only end when revoked.
+	AbsoluteTimeout time.Duration
+}
+
+// SignIn calls Login, creates a new session and sets the session cookie.
+// The response contains the session id as session_id, along with any data returned by Login.
+func (sa *SessionAuth) SignIn(ctx *apiserv.Context) apiserv.Response {
+	sub, data, err := sa.Login(ctx)
+	if err == nil && sub == "" {
+		err = ErrNoSubject
+	}
+
+	if err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, err)
+	}
+
+	// drop any session the client already had, to prevent session fixation
+	if id := sa.sessionID(ctx); id != "" {
+		_ = sa.Revoke(id)
+	}
+
+	now := time.Now().UTC()
+	s := &Session{
+		ID:       newSessionID(),
+		Subject:  sub,
+		Data:     data,
+		Created:  now,
+		LastSeen: now,
+	}
+
+	if err = sa.save(s); err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+	}
+
+	if sa.Cookie != "" {
+		if err = ctx.SetCookie(sa.Cookie, s.ID, sa.CookieHost, sa.CookieHTTPS, sa.AbsoluteTimeout); err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+	}
+
+	ctx.Set(SessionContextKey, s)
+	ctx.Set(apiserv.AuditSubjectKey, sub)
+
+	out := apiserv.M{}
+	for k, v := range data {
+		out[k] = v
+	}
+	out["session_id"] = s.ID
+
+	return apiserv.NewJSONResponse(out)
+}
+
+// CheckAuth loads the request's session and sets it to the ctx using SessionContextKey,
+// returns a 401 if the session doesn't exist or timed out.
+func (sa *SessionAuth) CheckAuth(ctx *apiserv.Context) apiserv.Response {
+	s, err := sa.Load(sa.sessionID(ctx))
+	if err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, err)
+	}
+
+	s.LastSeen = time.Now().UTC()
+	if err = sa.save(s); err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+	}
+
+	ctx.Set(SessionContextKey, s)
+	ctx.Set(apiserv.AuditSubjectKey, s.Subject)
+	return nil
+}
+
+// SignOut revokes the current session and removes the session cookie.
+func (sa *SessionAuth) SignOut(ctx *apiserv.Context) apiserv.Response {
+	if id := sa.sessionID(ctx); id != "" {
+		if err := sa.Revoke(id); err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+	}
+
+	if sa.Cookie != "" {
+		removeCookie(ctx, sa.Cookie, sa.CookieHost, sa.CookieHTTPS)
+	}
+
+	return apiserv.RespOK
+}
+
+// Load returns the session with the specific id, or ErrNoSession if it doesn't exist or expired.
+func (sa *SessionAuth) Load(id string) (*Session, error) {
+	if id == "" {
+		return nil, ErrNoSession
+	}
+
+	b, ok, err := sa.Store.Get(sa.Prefix + id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrNoSession
+	}
+
+	var s Session
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	s.ID = id
+	if sa.ttl(&s, time.Now()) < 0 {
+		_ = sa.Revoke(id)
+		return nil, ErrNoSession
+	}
+
+	return &s, nil
+}
+
+// Revoke deletes the sessions with the passed ids.
+func (sa *SessionAuth) Revoke(ids ...string) error {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sa.Prefix + id
+	}
+	return sa.Store.Delete(keys...)
+}
+
+func (sa *SessionAuth) save(s *Session) error {
+	ttl := sa.ttl(s, time.Now())
+	if ttl < 0 {
+		return ErrNoSession
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return sa.Store.Set(sa.Prefix+s.ID, b, ttl)
+}
+
+// ttl returns how long s has left, the shortest of the idle and absolute timeouts,
+// -1 means it expired and 0 that it doesn't expire.
+func (sa *SessionAuth) ttl(s *Session, now time.Time) (ttl time.Duration) {
+	if sa.IdleTimeout > 0 {
+		if ttl = s.LastSeen.Add(sa.IdleTimeout).Sub(now); ttl <= 0 {
+			return -1
+		}
+	}
+
+	if sa.AbsoluteTimeout > 0 {
+		abs := s.Created.Add(sa.AbsoluteTimeout).Sub(now)
+		if abs <= 0 {
+			return -1
+		}
+
+		if ttl == 0 || abs < ttl {
+			ttl = abs
+		}
+	}
+
+	return
+}
+
+func (sa *SessionAuth) sessionID(ctx *apiserv.Context) string {
+	if sa.Cookie != "" {
+		if id, ok := ctx.GetCookie(sa.Cookie); ok && id != "" {
+			return id
+		}
+	}
+
+	if h := ctx.Req.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+
+	return ""
+}
+
+func newSessionID() string {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,132 @@
+package apiutils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func newSessionServer(sa *SessionAuth) *apiserv.Server {
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.POST("/login", sa.SignIn)
+	srv.POST("/logout", sa.SignOut)
+	srv.GET("/me", sa.CheckAuth, func(ctx *apiserv.Context) apiserv.Response {
+		return apiserv.NewJSONResponse(GetSession(ctx).Subject)
+	})
+	return srv
+}
+
+func sessionCookie(t *testing.T, rw *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, c := range rw.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("missing %s cookie: %v", name, rw.Header())
+	return nil
+}
+
+func TestSessionAuth(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		idle, absolute time.Duration
+	}{
+		{"default", 30 * time.Minute, 24 * time.Hour},
+		{"no expiry", 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sa := NewSessionAuth(apiserv.NewMemoryStore(), func(ctx *apiserv.Context) (string, apiserv.M, error) {
+				if ctx.Query("pw") != "ok" {
+					return "", nil, errors.New("bad password")
+				}
+				return "user-1", nil, nil
+			})
+			sa.IdleTimeout, sa.AbsoluteTimeout = tc.idle, tc.absolute
+			sa.CookieHost = "example.com"
+			srv := newSessionServer(sa)
+
+			rw := httptest.NewRecorder()
+			srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/login?pw=bad", nil))
+			if rw.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d", rw.Code)
+			}
+
+			rw = httptest.NewRecorder()
+			srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/login?pw=ok", nil))
+			if rw.Code != http.StatusOK {
+				t.Fatalf("sign in failed: %d %s", rw.Code, rw.Body.String())
+			}
+			c := sessionCookie(t, rw, sa.Cookie)
+
+			me := func(hdr, val string) int {
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				req.Header.Set(hdr, val)
+				rw := httptest.NewRecorder()
+				srv.ServeHTTP(rw, req)
+				return rw.Code
+			}
+
+			if code := me("Cookie", c.Name+"="+c.Value); code != http.StatusOK {
+				t.Fatalf("expected 200 with the session cookie, got %d", code)
+			}
+
+			if code := me("Authorization", "Bearer "+c.Value); code != http.StatusOK {
+				t.Fatalf("expected 200 with a bearer session id, got %d", code)
+			}
+
+			if code := me("Authorization", "Bearer nope"); code != http.StatusUnauthorized {
+				t.Fatalf("expected 401 with an unknown session id, got %d", code)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+			req.AddCookie(c)
+			rw = httptest.NewRecorder()
+			srv.ServeHTTP(rw, req)
+			if rc := sessionCookie(t, rw, sa.Cookie); rc.MaxAge >= 0 || rc.Domain != "example.com" {
+				t.Fatalf("session cookie wasn't removed: %v", rw.Header())
+			}
+
+			if code := me("Cookie", c.Name+"="+c.Value); code != http.StatusUnauthorized {
+				t.Fatalf("expected 401 after signing out, got %d", code)
+			}
+		})
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	sa := NewSessionAuth(apiserv.NewMemoryStore(), nil)
+	now := time.Now()
+
+	for _, tc := range []struct {
+		idle, absolute time.Duration
+		created, seen  time.Duration // ago
+		ok             bool
+	}{
+		{time.Minute, time.Hour, 0, 0, true},
+		{time.Minute, time.Hour, 10 * time.Minute, 2 * time.Minute, false},
+		{time.Minute, time.Hour, 2 * time.Hour, 0, false},
+		{0, time.Hour, 30 * time.Minute, 20 * time.Minute, true},
+		{0, 0, 1000 * time.Hour, 1000 * time.Hour, true},
+	} {
+		sa.IdleTimeout, sa.AbsoluteTimeout = tc.idle, tc.absolute
+		s := &Session{ID: newSessionID(), Subject: "x", Created: now.Add(-tc.created), LastSeen: now.Add(-tc.seen)}
+
+		err := sa.save(s)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%+v: unexpected save error: %v", tc, err)
+		}
+
+		if !tc.ok {
+			continue
+		}
+
+		if _, err = sa.Load(s.ID); err != nil {
+			t.Fatalf("%+v: %v", tc, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package apiutils
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestSignedURL(t *testing.T) {
+	key := []byte("url-key")
+
+	s, err := SignedURL(key, "https://example.com/dl/file.zip?name=a", time.Now().Add(time.Minute), map[string]string{"user": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(s)
+	if err := VerifyURL(key, u); err != nil {
+		t.Fatalf("expected a valid url, got %v: %s", err, s)
+	}
+
+	if u.Query().Get("user") != "1" || u.Query().Get("name") != "a" {
+		t.Fatalf("missing claims: %s", s)
+	}
+
+	// only the path and query are signed
+	moved := *u
+	moved.Host = "cdn.example.com"
+	if err := VerifyURL(key, &moved); err != nil {
+		t.Fatalf("expected the url to work on another host, got %v", err)
+	}
+
+	tamper := func(fn func(u *url.URL, q url.Values)) *url.URL {
+		cu := *u
+		q := cu.Query()
+		fn(&cu, q)
+		cu.RawQuery = q.Encode()
+		return &cu
+	}
+
+	for name, tu := range map[string]*url.URL{
+		"claim":       tamper(func(_ *url.URL, q url.Values) { q.Set("user", "2") }),
+		"added claim": tamper(func(_ *url.URL, q url.Values) { q.Set("admin", "1") }),
+		"exp":         tamper(func(_ *url.URL, q url.Values) { q.Set("exp", "99999999999") }),
+		"no sig":      tamper(func(_ *url.URL, q url.Values) { q.Del("sig") }),
+		"path":        tamper(func(u *url.URL, _ url.Values) { u.Path = "/dl/other.zip" }),
+	} {
+		if err := VerifyURL(key, tu); err != ErrInvalidSignature {
+			t.Fatalf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+
+	if err := VerifyURL([]byte("other-key"), u); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature with the wrong key, got %v", err)
+	}
+
+	s, _ = SignedURL(key, "/dl/file.zip", time.Now().Add(-time.Second), nil)
+	if u, _ = url.Parse(s); VerifyURL(key, u) != ErrExpiredURL {
+		t.Fatalf("expected ErrExpiredURL: %s", s)
+	}
+
+	for _, k := range []string{"exp", "sig"} {
+		if _, err := SignedURL(key, "/x", time.Now(), map[string]string{k: "1"}); err != ErrReservedClaim {
+			t.Fatalf("%s: expected ErrReservedClaim, got %v", k, err)
+		}
+	}
+}
+
+func TestVerifySignedURL(t *testing.T) {
+	key := []byte("url-key")
+	mw := VerifySignedURL(key)
+
+	s, _ := SignedURL(key, "/dl/file.zip", time.Now().Add(time.Minute), nil)
+	ctx, _ := apiserv.NewTestContext(http.MethodGet, s, nil)
+	if r := mw(ctx); r != nil {
+		t.Fatalf("unexpected response: %v", r)
+	}
+
+	ctx, _ = apiserv.NewTestContext(http.MethodGet, strings.Replace(s, "file.zip", "other.zip", 1), nil)
+	if r, ok := mw(ctx).(*apiserv.JSONResponse); !ok || r.Code != http.StatusForbidden {
+		t.Fatalf("expected a 403, got %v", r)
+	}
+}
@@ -0,0 +1,123 @@
+package apiutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	jwtReq "github.com/golang-jwt/jwt/v4/request"
+	"github.com/missionMeteora/apiserv"
+)
+
+// ErrRevokedToken is returned by CheckAuth for tokens revoked by SignOut.
+var ErrRevokedToken = errors.New("token has been revoked")
+
+// RevocationStore keeps track of revoked tokens, see Auth.Revocations.
+type RevocationStore interface {
+	// Revoke marks id as revoked, it can be forgotten once the token expires at exp, a zero exp means never.
+	Revoke(id string, exp time.Time) error
+
+	IsRevoked(id string) (bool, error)
+}
+
+// NewRevocationStore returns a RevocationStore using an apiserv.CacheStore, ex: apiserv.NewMemoryStore() or a redisstore.Store.
+func NewRevocationStore(store apiserv.CacheStore) RevocationStore {
+	return cacheRevocations{store}
+}
+
+type cacheRevocations struct {
+	s apiserv.CacheStore
+}
+
+func (cr cacheRevocations) Revoke(id string, exp time.Time) error {
+	var ttl time.Duration
+	if !exp.IsZero() {
+		if ttl = time.Until(exp); ttl <= 0 { // already expired
+			return nil
+		}
+	}
+	return cr.s.Set("revoked:"+id, []byte{1}, ttl)
+}
+
+func (cr cacheRevocations) IsRevoked(id string) (bool, error) {
+	_, ok, err := cr.s.Get("revoked:" + id)
+	return ok, err
+}
+
+// tokenID returns the token's jti claim, or a hash of the raw token if it doesn't have one.
+func tokenID(tok Token) string {
+	if id, ok := tok.Get("jti").(string); ok && id != "" {
+		return id
+	}
+
+	h := sha256.Sum256([]byte(tok.Raw))
+	return hex.EncodeToString(h[:])
+}
+
+// isRevoked returns true if a.Revocations is set and tok was revoked.
+func (a *Auth) isRevoked(tok Token) (bool, error) {
+	if a.Revocations == nil {
+		return false, nil
+	}
+	return a.Revocations.IsRevoked(tokenID(tok))
+}
+
+// SignOut deletes all the AuthCookies (and the CSRF cookie), and revokes the presented token if Revocations is set.
+// Invalid or missing tokens aren't an error, the cookies are cleared either way.
+func (a *Auth) SignOut(ctx *apiserv.Context) apiserv.Response {
+	if a.Revocations != nil {
+		tok, err := jwtReq.ParseFromRequest(ctx.Req, a.Extractor, func(tok *jwt.Token) (key interface{}, err error) {
+			_, key, err = a.CheckToken(ctx, Token{Token: tok})
+			return
+		}, jwtReq.WithClaims(a.NewClaims()), jwtReq.WithParser(DefaultParser))
+
+		if err == nil {
+			var exp time.Time
+			if ts, ok := (Token{Token: tok}).Expiry(); ok && ts > 0 {
+				exp = time.Unix(ts, 0)
+			}
+
+			if err = a.Revocations.Revoke(tokenID(Token{Token: tok}), exp); err != nil {
+				return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+			}
+		}
+	}
+
+	for _, c := range a.AuthCookies {
+		a.removeCookie(ctx, c)
+	}
+
+	if a.CSRF && len(a.AuthCookies) > 0 {
+		name, _ := a.csrfNames()
+		a.removeCookie(ctx, name)
+	}
+
+	return apiserv.RespOK
+}
+
+func (a *Auth) removeCookie(ctx *apiserv.Context, name string) {
+	removeCookie(ctx, name, a.CookieHost, a.CookieHTTPS)
+}
+
+// removeCookie is like ctx.RemoveCookie but uses domain, otherwise browsers keep cookies set with one.
+// It follows the same prefix rules as ctx.SetCookie: __Host- cookies never have a domain, and prefixed cookies are always Secure.
+func removeCookie(ctx *apiserv.Context, name, domain string, https bool) {
+	host := strings.HasPrefix(name, "__Host-")
+	if host {
+		domain = ""
+	}
+
+	http.SetCookie(ctx, &http.Cookie{
+		Path:    "/",
+		Name:    name,
+		Value:   "::deleted::",
+		Domain:  domain,
+		Secure:  https || host || strings.HasPrefix(name, "__Secure-") || ctx.Req.TLS != nil,
+		MaxAge:  -1,
+		Expires: time.Unix(0, 0),
+	})
+}
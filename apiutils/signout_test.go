@@ -0,0 +1,77 @@
+package apiutils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestSignOut(t *testing.T) {
+	a := newTestAuth(CookieExtractor{"auth"})
+	a.Revocations = NewRevocationStore(apiserv.NewMemoryStore())
+	a.CookieHost = "example.com"
+
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.POST("/login", a.SignIn)
+	srv.POST("/logout", a.SignOut)
+	srv.GET("/me", a.CheckAuth, func(ctx *apiserv.Context) apiserv.Response { return apiserv.RespOK })
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := rw.Result().Cookies()
+	if rw.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("sign in failed: %d %v", rw.Code, rw.Header())
+	}
+	auth := "Bearer " + cookies[0].Value
+
+	me := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", auth)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	if code := me(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", auth)
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+
+	cookies = rw.Result().Cookies()
+	if rw.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != "auth" || cookies[0].MaxAge >= 0 || cookies[0].Domain != "example.com" {
+		t.Fatalf("unexpected sign out response: %d %v", rw.Code, rw.Header())
+	}
+
+	if code := me(); code != http.StatusUnauthorized {
+		t.Fatalf("expected the token to be revoked, got %d", code)
+	}
+
+	// signing out without a token still clears the cookies
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/logout", nil))
+	if rw.Code != http.StatusOK || len(rw.Result().Cookies()) != 1 {
+		t.Fatalf("unexpected sign out response: %d %v", rw.Code, rw.Header())
+	}
+}
+
+func TestRemoveCookiePrefixes(t *testing.T) {
+	for name, domain := range map[string]string{
+		"plain":         "example.com",
+		"__Secure-auth": "example.com",
+		"__Host-auth":   "",
+	} {
+		ctx, rw := apiserv.NewTestContext(http.MethodPost, "/logout", nil)
+		removeCookie(ctx, name, "example.com", false)
+
+		c := rw.Result().Cookies()[0]
+		if c.Domain != domain || c.Secure != (name != "plain") || c.MaxAge >= 0 {
+			t.Fatalf("%s: unexpected cookie: %v", name, rw.Header())
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package apiutils
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+	"github.com/missionMeteora/apiserv/apiutils/totp"
+)
+
+var (
+	// ErrTOTPRequired is returned by SignIn when the account has two-factor auth enabled and the request didn't send a code.
+	ErrTOTPRequired = errors.New("two-factor code required")
+
+	// ErrInvalidTOTP is returned by SignIn for invalid two-factor codes.
+	ErrInvalidTOTP = errors.New("invalid two-factor code")
+
+	// ErrTOTPReused is returned by SignIn for codes with a time step at or before the last one used by the account.
+	ErrTOTPReused = errors.New("two-factor code already used")
+)
+
+// checkTOTP returns an error response if the account tok is for requires a second factor and the request doesn't have a valid one.
+func (a *Auth) checkTOTP(ctx *apiserv.Context, tok Token) apiserv.Response {
+	if a.TOTPSecret == nil {
+		return nil
+	}
+
+	secret, err := a.TOTPSecret(ctx, tok)
+	if err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, err)
+	}
+
+	if secret == "" { // not enabled for this account
+		return nil
+	}
+
+	header := a.TOTPHeader
+	if header == "" {
+		header = "X-TOTP-Code"
+	}
+
+	code := ctx.Req.Header.Get(header)
+	if code == "" {
+		return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, &apiserv.Error{Field: "totp", Message: ErrTOTPRequired.Error()})
+	}
+
+	if step, ok := totp.ValidateAt(secret, code, time.Now()); ok {
+		use := a.TOTPUseStep
+		if use == nil {
+			use = func(_ *apiserv.Context, _ Token, step int64) (bool, error) {
+				return defaultTOTPSteps.use(secret, step), nil
+			}
+		}
+
+		if ok, err := use(ctx, tok, step); err != nil {
+			return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+		} else if !ok {
+			return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, &apiserv.Error{Field: "totp", Message: ErrTOTPReused.Error()})
+		}
+
+		return nil
+	}
+
+	if a.TOTPRecovery != nil && a.TOTPRecovery(ctx, tok, code) {
+		return nil
+	}
+
+	return apiserv.NewJSONErrorResponse(http.StatusUnauthorized, &apiserv.Error{Field: "totp", Message: ErrInvalidTOTP.Error()})
+}
+
+var defaultTOTPSteps = &totpSteps{m: map[[sha256.Size]byte]int64{}}
+
+// totpSteps is the default Auth.TOTPUseStep, it keeps the last accepted step per secret.
+type totpSteps struct {
+	mux       sync.Mutex
+	m         map[[sha256.Size]byte]int64
+	lastSweep time.Time
+}
+
+func (ts *totpSteps) use(secret string, step int64) bool {
+	key, now := sha256.Sum256([]byte(secret)), time.Now()
+
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+
+	if last, ok := ts.m[key]; ok && step <= last {
+		return false
+	}
+
+	// steps outside the skew window can't be validated anymore, so there's no need to remember them
+	if now.Sub(ts.lastSweep) > totp.Period {
+		min := now.Unix()/int64(totp.Period/time.Second) - totp.Skew
+		for k, s := range ts.m {
+			if s < min {
+				delete(ts.m, k)
+			}
+		}
+		ts.lastSweep = now
+	}
+
+	ts.m[key] = step
+	return true
+}
@@ -0,0 +1,188 @@
+// Package totp implements RFC 6238 time-based one time passwords and recovery codes for two-factor auth,
+// see apiutils.Auth.TOTPSecret to require it on SignIn.
+//
+//	k, _ := totp.Generate("Example", user.Email)
+//	// store k.Secret, show k.URL() as a QR code, then confirm with totp.ValidateAt(k.Secret, code, time.Now())
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the length of the generated codes.
+	Digits = 6
+
+	// Period is how long each code is valid for.
+	Period = 30 * time.Second
+
+	// Skew is how many periods before and after the current one are accepted to allow for clock drift.
+	Skew = 1
+
+	secretSize = 20 // 160 bits, as recommended by RFC 4226
+)
+
+// ErrInvalidSecret is returned for secrets that aren't valid base32.
+var ErrInvalidSecret = errors.New("totp: invalid secret")
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Key is a provisioned totp secret.
+type Key struct {
+	Issuer  string
+	Account string
+
+	// Secret is base32 encoded (without padding), which is the format authenticator apps expect.
+	Secret string
+}
+
+// Generate returns a new Key with a random secret.
+func Generate(issuer, account string) (*Key, error) {
+	var b [secretSize]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Issuer:  issuer,
+		Account: account,
+		Secret:  b32.EncodeToString(b[:]),
+	}, nil
+}
+
+// URL returns the otpauth:// url for the key, which is also the payload of the QR code scanned by authenticator apps.
+func (k *Key) URL() string {
+	label := url.PathEscape(k.Account)
+	if k.Issuer != "" {
+		label = url.PathEscape(k.Issuer) + ":" + label
+	}
+
+	q := url.Values{}
+	q.Set("secret", k.Secret)
+	if k.Issuer != "" {
+		q.Set("issuer", k.Issuer)
+	}
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(Digits))
+	q.Set("period", strconv.Itoa(int(Period/time.Second)))
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Code returns the code for secret at t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(t.Unix()/int64(Period/time.Second))), nil
+}
+
+// Validate is a shorthand for ValidateAt(secret, code, time.Now()),
+// it doesn't prevent reusing a code within the skew window, use ValidateAt for that.
+func Validate(secret, code string) bool {
+	_, ok := ValidateAt(secret, code, time.Now())
+	return ok
+}
+
+// ValidateAt checks code against the periods around t (see Skew), and returns the matching time step.
+// Callers should store the last used step and reject codes with a step <= to it to prevent reuse, see apiutils.Auth.TOTPUseStep.
+func ValidateAt(secret, code string, t time.Time) (step int64, ok bool) {
+	key, err := decodeSecret(secret)
+	code = strings.TrimSpace(code)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	cur := t.Unix() / int64(Period/time.Second)
+	for i := int64(-Skew); i <= Skew; i++ {
+		s := cur + i
+		if s < 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(s))), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// hotp implements RFC 4226 with sha1.
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	h := hmac.New(sha1.New, key)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	off := sum[len(sum)-1] & 0xf
+	v := binary.BigEndian.Uint32(sum[off:]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, v%mod)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimRight(secret, "="), " ", ""))
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// RecoveryCodes returns n random one-time recovery codes (formatted as xxxxx-xxxxx) to show the user,
+// and their hashes to store, see UseRecoveryCode.
+func RecoveryCodes(n int) (codes, hashes []string, err error) {
+	codes, hashes = make([]string, n), make([]string, n)
+	for i := range codes {
+		var b [5]byte
+		if _, err = rand.Read(b[:]); err != nil {
+			return nil, nil, err
+		}
+
+		c := hex.EncodeToString(b[:])
+		codes[i] = c[:5] + "-" + c[5:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return
+}
+
+// HashRecoveryCode returns the hash of a recovery code, dashes, spaces and case are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
+
+// UseRecoveryCode returns hashes without the one matching code, ok is false if none matched.
+// The returned slice must be stored back so the code can't be used again.
+func UseRecoveryCode(hashes []string, code string) (remaining []string, ok bool) {
+	h := []byte(HashRecoveryCode(code))
+	for i, v := range hashes {
+		if subtle.ConstantTimeCompare([]byte(v), h) == 1 {
+			remaining = append(append(remaining, hashes[:i]...), hashes[i+1:]...)
+			return remaining, true
+		}
+	}
+	return hashes, false
+}
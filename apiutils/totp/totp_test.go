@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// base32 of the RFC 6238 sha1 test secret "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestRFC6238(t *testing.T) {
+	// https://datatracker.ietf.org/doc/html/rfc6238#appendix-B, the codes are the last Digits digits of the 8 digit ones.
+	for _, tc := range []struct {
+		ts   int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		at := time.Unix(tc.ts, 0)
+		want := tc.code[len(tc.code)-Digits:]
+
+		code, err := Code(rfcSecret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != want {
+			t.Fatalf("%d: expected %s, got %s", tc.ts, want, code)
+		}
+
+		step, ok := ValidateAt(rfcSecret, want, at)
+		if !ok || step != tc.ts/30 {
+			t.Fatalf("%d: expected step %d, got %d %v", tc.ts, tc.ts/30, step, ok)
+		}
+	}
+}
+
+func TestValidateAt(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, now)
+
+	for d, ok := range map[time.Duration]bool{
+		0:           true,
+		-Period:     true,
+		Period:      true,
+		-2 * Period: false,
+		2 * Period:  false,
+	} {
+		if _, v := ValidateAt(rfcSecret, code, now.Add(d)); v != ok {
+			t.Fatalf("%v: expected %v", d, ok)
+		}
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := ValidateAt(rfcSecret, bad, now); ok {
+			t.Fatalf("%q shouldn't validate", bad)
+		}
+	}
+
+	if _, ok := ValidateAt("not base32!", code, now); ok {
+		t.Fatal("invalid secrets shouldn't validate")
+	}
+
+	if _, ok := ValidateAt(strings.ToLower(rfcSecret), " "+code+" ", now); !ok {
+		t.Fatal("lowercase secrets and padded codes should validate")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	k, err := Generate("Example Co", "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(k.Secret) != 32 {
+		t.Fatalf("unexpected secret: %q", k.Secret)
+	}
+
+	u := k.URL()
+	if !strings.HasPrefix(u, "otpauth://totp/Example%20Co:user@example.com?") || !strings.Contains(u, "secret="+k.Secret) {
+		t.Fatalf("unexpected url: %s", u)
+	}
+
+	code, _ := Code(k.Secret, time.Now())
+	if !Validate(k.Secret, code) {
+		t.Fatal("expected the current code to validate")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := RecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining, ok := UseRecoveryCode(hashes, strings.ToUpper(codes[1]))
+	if !ok || len(remaining) != 2 {
+		t.Fatalf("expected the code to be used: %v %v", ok, remaining)
+	}
+
+	if _, ok = UseRecoveryCode(remaining, codes[1]); ok {
+		t.Fatal("recovery codes shouldn't be usable twice")
+	}
+}
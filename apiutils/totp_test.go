@@ -0,0 +1,84 @@
+package apiutils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+	"github.com/missionMeteora/apiserv/apiutils/totp"
+)
+
+func TestSignInTOTP(t *testing.T) {
+	k, err := totp.Generate("apiserv", "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes, hashes, _ := totp.RecoveryCodes(1)
+
+	a := newTestAuth()
+	a.TOTPSecret = func(ctx *apiserv.Context, tok Token) (string, error) { return k.Secret, nil }
+	a.TOTPRecovery = func(ctx *apiserv.Context, tok Token, code string) (ok bool) {
+		hashes, ok = totp.UseRecoveryCode(hashes, code)
+		return
+	}
+
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	srv.POST("/login", a.SignIn)
+
+	login := func(code string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		if code != "" {
+			req.Header.Set("X-TOTP-Code", code)
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code, rw.Body.String()
+	}
+
+	if code, body := login(""); code != http.StatusUnauthorized || !strings.Contains(body, ErrTOTPRequired.Error()) {
+		t.Fatalf("expected ErrTOTPRequired, got %d %s", code, body)
+	}
+
+	if code, body := login("000000x"); code != http.StatusUnauthorized || !strings.Contains(body, ErrInvalidTOTP.Error()) {
+		t.Fatalf("expected ErrInvalidTOTP, got %d %s", code, body)
+	}
+
+	cur, _ := totp.Code(k.Secret, time.Now())
+	if code, body := login(cur); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", code, body)
+	}
+
+	if code, body := login(cur); code != http.StatusUnauthorized || !strings.Contains(body, ErrTOTPReused.Error()) {
+		t.Fatalf("expected ErrTOTPReused, got %d %s", code, body)
+	}
+
+	prev, _ := totp.Code(k.Secret, time.Now().Add(-totp.Period))
+	if code, body := login(prev); code != http.StatusUnauthorized {
+		t.Fatalf("codes from an older step should be rejected after a newer one was used, got %d %s", code, body)
+	}
+
+	if code, _ := login(codes[0]); code != http.StatusOK {
+		t.Fatalf("expected the recovery code to work, got %d", code)
+	}
+
+	if code, _ := login(codes[0]); code != http.StatusUnauthorized {
+		t.Fatalf("recovery codes shouldn't work twice, got %d", code)
+	}
+
+	steps := map[string]int64{}
+	a.TOTPUseStep = func(ctx *apiserv.Context, tok Token, step int64) (bool, error) {
+		if step <= steps[k.Secret] {
+			return false, nil
+		}
+		steps[k.Secret] = step
+		return true, nil
+	}
+
+	if code, _ := login(cur); code != http.StatusOK || len(steps) != 1 {
+		t.Fatalf("expected the custom TOTPUseStep to be used, got %d %v", code, steps)
+	}
+}
@@ -0,0 +1,141 @@
+package apiserv
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditSubjectKey is the context key checked by Audit for the request's subject (user id, token sub, etc),
+// auth middleware should set it with ctx.Set(AuditSubjectKey, sub).
+const AuditSubjectKey = ":AUSUB:"
+
+// AuditActorKey is the context key for the identity acting on behalf of the subject, ex: an admin impersonating a user.
+const AuditActorKey = ":AUACT:"
+
+// AuditEvent is a single audit log entry.
+type AuditEvent struct {
+	Time      time.Time         `json:"time"`
+	Params    map[string]string `json:"params,omitempty"`
+	RequestID string            `json:"requestID,omitempty"`
+	Subject   string            `json:"subject,omitempty"`
+	Actor     string            `json:"actor,omitempty"`
+	RemoteIP  string            `json:"remoteIP,omitempty"`
+	Method    string            `json:"method"`
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Error     string            `json:"error,omitempty"`
+	Status    int               `json:"status"`
+	Duration  time.Duration     `json:"duration"`
+
+	// RequestBody and ResponseBody are set if the bodies were captured with CaptureBodies.
+	RequestBody  string `json:"requestBody,omitempty"`
+	ResponseBody string `json:"responseBody,omitempty"`
+}
+
+// AuditSink stores audit events, it's called after the response was written,
+// so slow sinks (DB, Kafka) should buffer internally to avoid holding the request's goroutine.
+type AuditSink interface {
+	Audit(e *AuditEvent) error
+}
+
+// AuditSinkFunc is a func that implements AuditSink.
+type AuditSinkFunc func(e *AuditEvent) error
+
+// Audit implements AuditSink.
+func (fn AuditSinkFunc) Audit(e *AuditEvent) error { return fn(e) }
+
+// NewAuditWriterSink returns a sink that writes events as json lines to w (ex: an *os.File), it is safe for concurrent use.
+func NewAuditWriterSink(w io.Writer) AuditSink {
+	ws := &auditWriterSink{}
+	ws.enc = json.NewEncoder(w)
+	return ws
+}
+
+type auditWriterSink struct {
+	mux sync.Mutex
+	enc *json.Encoder
+}
+
+func (ws *auditWriterSink) Audit(e *AuditEvent) error {
+	ws.mux.Lock()
+	defer ws.mux.Unlock()
+	return ws.enc.Encode(e)
+}
+
+// AuditOptions controls the Audit middleware.
+type AuditOptions struct {
+	// Subject returns the request's subject, defaults to the string value of AuditSubjectKey.
+	Subject func(ctx *Context) string
+
+	// Skip returns true for requests that shouldn't be audited.
+	Skip func(ctx *Context) bool
+
+	// NoParams disables recording the route's params.
+	NoParams bool
+}
+
+// Audit returns a middleware that records who made the request, the route and params, and the outcome into sink.
+// It can be used on the whole server or on specific groups:
+//
+//	admin := s.Group("admin", "/admin", auth.CheckAuth, apiserv.Audit(sink, nil))
+//
+// Events are recorded once the handler chain is done, so the status reflects the final response, including panics.
+// Sink errors are logged with the server's logger.
+func Audit(sink AuditSink, opts *AuditOptions) Handler {
+	if opts == nil {
+		opts = &AuditOptions{}
+	}
+
+	subject := opts.Subject
+	if subject == nil {
+		subject = func(ctx *Context) string {
+			s, _ := ctx.Get(AuditSubjectKey).(string)
+			return s
+		}
+	}
+
+	return func(ctx *Context) Response {
+		if opts.Skip != nil && opts.Skip(ctx) {
+			return nil
+		}
+
+		start, reqID := time.Now(), ctx.RequestID() // the id has to be set before the response is written
+
+		ctx.OnFinish(func(status int, _ int64, err error) {
+			e := &AuditEvent{
+				Time:      start.UTC(),
+				RequestID: reqID,
+				Subject:   subject(ctx),
+				RemoteIP:  ctx.ClientIP(),
+				Method:    ctx.Req.Method,
+				Route:     ctx.RoutePath(),
+				Path:      ctx.Req.URL.Path,
+				Status:    status,
+				Duration:  time.Since(start),
+			}
+
+			e.Actor, _ = ctx.Get(AuditActorKey).(string)
+
+			if err != nil {
+				e.Error = err.Error()
+			}
+
+			e.RequestBody, e.ResponseBody = string(ctx.CapturedRequestBody()), string(ctx.CapturedResponseBody())
+
+			if !opts.NoParams && len(ctx.Params) > 0 {
+				e.Params = make(map[string]string, len(ctx.Params))
+				for _, p := range ctx.Params {
+					e.Params[p.Name] = p.Value
+				}
+			}
+
+			if err := sink.Audit(e); err != nil {
+				ctx.s.Errorf("audit sink error (%s %s): %v", e.Method, e.Path, err)
+			}
+		})
+
+		return nil
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -16,8 +17,12 @@ import (
 
 // RunAutoCert enables automatic support for LetsEncrypt, using the optional passed domains list.
 // certCacheDir is where the certificates will be cached, defaults to "./autocert".
-// Note that it must always run on *BOTH* ":80" and ":443" so the addr param is omitted.
+// It listens on both ":80" and ":443" unless changed with SetAutoCertAddrs.
 func (s *Server) RunAutoCert(certCacheDir string, domains ...string) error {
+	if err := s.Warmup(context.Background()); err != nil {
+		return err
+	}
+
 	if certCacheDir == "" {
 		certCacheDir = "./autocert"
 	}
@@ -35,23 +40,36 @@ func (s *Server) RunAutoCert(certCacheDir string, domains ...string) error {
 		m.HostPolicy = autocert.HostWhitelist(domains...)
 	}
 
-	srv := s.newHTTPServer(":https")
+	httpAddr, tlsAddr := s.autoCertAddrs()
+	srv := s.newHTTPServer(tlsAddr)
 
 	tlsCfg := m.TLSConfig()
-	tlsCfg.MinVersion = tls.VersionTLS12
+	tlsCfg.GetCertificate = s.autoCertGetter(m)
+	s.applyTLSOptions(tlsCfg)
 	srv.TLSConfig = tlsCfg
+	s.rotateTicketKeys(tlsCfg)
 
-	s.serversMux.Lock()
-	s.servers = append(s.servers, srv)
-	s.serversMux.Unlock()
+	tlsLn, err := net.Listen("tcp", tlsAddr)
+	if err != nil {
+		return err
+	}
+	srv.Addr = tlsLn.Addr().String()
 
-	go func() {
-		if err := http.ListenAndServe(":80", m.HTTPHandler(nil)); err != nil {
-			s.Logf("apiserv: autocert on :80 error: %v", err)
-		}
-	}()
+	ln, err := listenACMEHTTP(httpAddr)
+	if err != nil {
+		tlsLn.Close()
+		return err
+	}
+
+	if ln != nil {
+		go func() {
+			if err := s.serveACMEHTTP(m, ln); err != nil && err != http.ErrServerClosed {
+				s.Errorf("apiserv: autocert on %s error: %v", httpAddr, err)
+			}
+		}()
+	}
 
-	return srv.ListenAndServeTLS("", "")
+	return s.serve(srv, tlsLn)
 }
 
 func NewAutoCertHosts(hosts ...string) *AutoCertHosts {
@@ -99,12 +117,18 @@ func (a *AutoCertHosts) IsAllowed(_ context.Context, host string) error {
 }
 
 // RunTLSAndAuto allows using custom certificates and autocert together.
-// It will always listen on both :80 and :443
+// It listens on both :80 and :443 unless changed with SetAutoCertAddrs.
+// Hosts that neither autocert nor the cert pairs can serve get Options.TLSFallbackCert if set, otherwise the first pair,
+// or a self-signed certificate if there are no pairs, so they can still reach an error page.
 func (s *Server) RunTLSAndAuto(certCacheDir string, certPairs []CertPair, hosts *AutoCertHosts) error {
 	if hosts == nil {
 		return fmt.Errorf("apiserve/autocert: hosts can't be nil")
 	}
 
+	if err := s.Warmup(context.Background()); err != nil {
+		return err
+	}
+
 	m := &autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
 		HostPolicy: hosts.IsAllowed,
@@ -122,10 +146,10 @@ func (s *Server) RunTLSAndAuto(certCacheDir string, certPairs []CertPair, hosts
 
 	m.Cache = autocert.DirCache(certCacheDir)
 
-	srv := s.newHTTPServer(":https")
+	httpAddr, tlsAddr := s.autoCertAddrs()
+	srv := s.newHTTPServer(tlsAddr)
 
 	cfg := &tls.Config{
-		MinVersion:               tls.VersionTLS12,
 		PreferServerCipherSuites: true,
 
 		NextProtos: []string{
@@ -143,38 +167,118 @@ func (s *Server) RunTLSAndAuto(certCacheDir string, certPairs []CertPair, hosts
 		}
 		cfg.Certificates = append(cfg.Certificates, cert)
 	}
+	s.trackCertPairs(certPairs, cfg.Certificates)
 
+	// without any cert pairs the handshake would fail for hosts autocert doesn't handle
+	fallback := s.opts.TLSFallbackCert
+	if fallback == nil && len(cfg.Certificates) == 0 {
+		fc, err := NewSelfSignedCert()
+		if err != nil {
+			return err
+		}
+		fallback = &fc
+	}
+
+	st := s.newOCSPStapler(cfg.Certificates)
+	if st != nil {
+		go st.run()
+	}
+
+	getCert := s.autoCertGetter(m)
 	cfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-		crt, err := m.GetCertificate(hello)
+		crt, err := getCert(hello)
 		if err == nil {
 			return crt, err
 		}
 
-		// fallback to default impl tls impl
-		return nil, nil
+		if st != nil {
+			if crt = st.match(hello); crt != nil {
+				return crt, nil
+			}
+		}
+
+		if fallback == nil { // fallback to default impl tls impl
+			return nil, nil
+		}
+
+		for i := range cfg.Certificates {
+			if hello.SupportsCertificate(&cfg.Certificates[i]) == nil {
+				return &cfg.Certificates[i], nil
+			}
+		}
+
+		return fallback, nil
 	}
 
+	s.applyTLSOptions(cfg)
 	srv.TLSConfig = cfg
+	s.rotateTicketKeys(cfg)
+
+	tlsLn, err := net.Listen("tcp", tlsAddr)
+	if err != nil {
+		return err
+	}
+	srv.Addr = tlsLn.Addr().String()
 
-	s.serversMux.Lock()
-	s.servers = append(s.servers, srv)
-	s.serversMux.Unlock()
+	ln, err := listenACMEHTTP(httpAddr)
+	if err != nil {
+		tlsLn.Close()
+		return err
+	}
 
 	ch := make(chan error, 2)
 
-	go func() {
-		if err := http.ListenAndServe(":80", m.HTTPHandler(nil)); err != nil {
-			s.Logf("apiserv: autocert on :80 error: %v", err)
-			ch <- err
-		}
-	}()
+	if ln != nil {
+		go func() {
+			if err := s.serveACMEHTTP(m, ln); err != nil {
+				if err != http.ErrServerClosed {
+					s.Errorf("apiserv: autocert on %s error: %v", httpAddr, err)
+				}
+				ch <- err
+			}
+		}()
+	}
 
 	go func() {
-		if err := srv.ListenAndServeTLS("", ""); err != nil {
-			s.Logf("apiserv: autocert on :443 error: %v", err)
+		if err := s.serve(srv, tlsLn); err != nil {
+			if err != http.ErrServerClosed {
+				s.Errorf("apiserv: autocert on %s error: %v", tlsAddr, err)
+			}
 			ch <- err
 		}
 	}()
 
 	return <-ch
 }
+
+// autoCertAddrs returns the http and tls addresses to use for autocert, httpAddr is empty if it is disabled.
+func (s *Server) autoCertAddrs() (httpAddr, tlsAddr string) {
+	switch httpAddr = s.opts.AutoCertHTTPAddr; httpAddr {
+	case "":
+		httpAddr = ":http"
+	case "-":
+		httpAddr = ""
+	}
+
+	if tlsAddr = s.opts.AutoCertTLSAddr; tlsAddr == "" {
+		tlsAddr = ":https"
+	}
+
+	return
+}
+
+// listenACMEHTTP returns a nil listener if addr is empty.
+func listenACMEHTTP(addr string) (net.Listener, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serveACMEHTTP serves the http-01 challenges on ln and redirects everything else to https,
+// it is registered with the other servers so it gets the same timeouts and is stopped by Close/Shutdown.
+func (s *Server) serveACMEHTTP(m *autocert.Manager, ln net.Listener) error {
+	srv := s.newHTTPServer(ln.Addr().String())
+	srv.Handler = m.HTTPHandler(nil)
+	return s.serve(srv, ln)
+}
@@ -0,0 +1,141 @@
+package apiserv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HostProvider returns the hosts allowed to get certificates, see AutoCertHosts.Watch.
+// Implementations can read them from a file, a database or an api.
+type HostProvider interface {
+	Hosts(ctx context.Context) ([]string, error)
+}
+
+// HostProviderFunc is a func that implements HostProvider.
+type HostProviderFunc func(ctx context.Context) ([]string, error)
+
+// Hosts implements HostProvider.
+func (fn HostProviderFunc) Hosts(ctx context.Context) ([]string, error) { return fn(ctx) }
+
+// FileHostProvider returns a HostProvider that reads one host per line from fp, empty lines and lines starting with # are ignored.
+func FileHostProvider(fp string) HostProvider {
+	return HostProviderFunc(func(context.Context) ([]string, error) {
+		f, err := os.Open(fp)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readHostLines(f)
+	})
+}
+
+// HTTPHostProvider returns a HostProvider that GETs url, which should return either a json array of hosts or one host per line.
+// hc defaults to a client with a 30 seconds timeout.
+func HTTPHostProvider(url string, hc *http.Client) HostProvider {
+	if hc == nil {
+		hc = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return HostProviderFunc(func(ctx context.Context) ([]string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := hc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("apiserv/autocert: %s: unexpected status %d", url, resp.StatusCode)
+		}
+
+		b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 16<<20))
+		if err != nil {
+			return nil, err
+		}
+
+		if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+			var hosts []string
+			err = json.Unmarshal(b, &hosts)
+			return hosts, err
+		}
+
+		return readHostLines(bytes.NewReader(b))
+	})
+}
+
+func readHostLines(r io.Reader) (hosts []string, err error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if h := strings.TrimSpace(sc.Text()); h != "" && h[0] != '#' {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts, sc.Err()
+}
+
+// Hosts returns a sorted copy of the allowed hosts.
+func (a *AutoCertHosts) Hosts() []string {
+	a.mux.RLock()
+	out := make([]string, 0, len(a.m))
+	for h := range a.m {
+		out = append(out, h)
+	}
+	a.mux.RUnlock()
+
+	sort.Strings(out)
+	return out
+}
+
+// Watch loads the hosts from p, then keeps refreshing them every interval (defaults to a minute) until ctx is done,
+// so new domains get certificates without a restart.
+// It returns the error of the first load, the refresh loop is started either way and keeps the last good hosts on errors,
+// which are passed to onErr if it isn't nil.
+func (a *AutoCertHosts) Watch(ctx context.Context, p HostProvider, interval time.Duration, onErr func(err error)) error {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	load := func() error {
+		hosts, err := p.Hosts(ctx)
+		if err != nil {
+			if onErr != nil {
+				onErr(err)
+			}
+			return err
+		}
+		a.Set(hosts...)
+		return nil
+	}
+
+	err := load()
+
+	go func() {
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tk.C:
+				_ = load()
+			}
+		}
+	}()
+
+	return err
+}
@@ -0,0 +1,368 @@
+package apiserv
+
+import (
+	"encoding"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mimeForm      = "application/x-www-form-urlencoded"
+	mimeMultipart = "multipart/form-data"
+)
+
+var (
+	// ErrUnsupportedContentType is returned from ctx.Bind if there's no codec registered for the request's content-type.
+	ErrUnsupportedContentType = errors.New("unsupported content-type")
+
+	// ErrInvalidBindTarget is returned when binding into something that isn't a pointer to a struct.
+	ErrInvalidBindTarget = errors.New("bind target must be a pointer to a struct")
+)
+
+// XMLCodec is an encoding/xml based codec.
+var XMLCodec Codec = xmlCodec{}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+func (xmlCodec) NewEncoder(w io.Writer) Encoder             { return xml.NewEncoder(w) }
+func (xmlCodec) NewDecoder(r io.Reader) Decoder             { return xml.NewDecoder(r) }
+
+// FormCodec decodes url-encoded forms into structs using `form` tags (falling back to the field name),
+// *url.Values or *map[string]string. It can only encode url.Values and map[string]string.
+var FormCodec Codec = formCodec{}
+
+type formCodec struct{}
+
+func (formCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case url.Values:
+		return []byte(v.Encode()), nil
+	case map[string]string:
+		vals := make(url.Values, len(v))
+		for k, s := range v {
+			vals.Set(k, s)
+		}
+		return []byte(vals.Encode()), nil
+	}
+	return nil, fmt.Errorf("apiserv: can't encode %T as a form", v)
+}
+
+func (formCodec) Unmarshal(data []byte, v interface{}) error {
+	vals, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	return bindForm(vals, v)
+}
+
+func (c formCodec) NewEncoder(w io.Writer) Encoder { return &codecEncoder{c, w} }
+func (c formCodec) NewDecoder(r io.Reader) Decoder { return &codecDecoder{c, r} }
+
+// codecEncoder and codecDecoder implement streaming for codecs that only work on []byte.
+type codecEncoder struct {
+	c Codec
+	w io.Writer
+}
+
+func (e *codecEncoder) Encode(v interface{}) error {
+	b, err := e.c.Marshal(v)
+	if err == nil {
+		_, err = e.w.Write(b)
+	}
+	return err
+}
+
+type codecDecoder struct {
+	c Codec
+	r io.Reader
+}
+
+func (d *codecDecoder) Decode(v interface{}) error {
+	b, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	return d.c.Unmarshal(b, v)
+}
+
+// RegisterCodec registers a codec used by ctx.Bind for requests with the specific content-type (ex: "application/msgpack"),
+// it replaces the built-in json, xml and form codecs if contentType matches.
+// it is NOT safe to call this once you call one of the run functions.
+func (s *Server) RegisterCodec(contentType string, c Codec) {
+	if s.codecs == nil {
+		s.codecs = map[string]Codec{}
+	}
+	s.codecs[mediaType(contentType)] = c
+}
+
+func (s *Server) codecFor(mt string) Codec {
+	if s != nil {
+		if c, ok := s.codecs[mt]; ok {
+			return c
+		}
+	}
+
+	switch {
+	case mt == "", mt == "application/json", strings.HasSuffix(mt, "+json"):
+		if s != nil && s.opts.JSONCodec != nil {
+			return s.opts.JSONCodec
+		}
+		return StdJSON
+	case mt == "application/xml", mt == "text/xml", strings.HasSuffix(mt, "+xml"):
+		return XMLCodec
+	case mt == mimeForm:
+		return FormCodec
+	}
+
+	return nil
+}
+
+// Bind decodes the request's body into out based on its Content-Type and closes the body.
+// json (the default for requests without a content-type), xml and forms (including multipart) are supported out of the box,
+// other formats can be added with Server.RegisterCodec.
+// Returns ErrUnsupportedContentType if there's no codec for the content-type.
+func (ctx *Context) Bind(out interface{}) error {
+	defer ctx.CloseBody()
+
+	mt := mediaType(ctx.ContentType())
+	c := ctx.s.codecFor(mt)
+
+	if c == nil && mt == mimeMultipart {
+		if err := ctx.Req.ParseMultipartForm(32 << 20); err != nil {
+			return err
+		}
+		return bindForm(ctx.Req.MultipartForm.Value, out)
+	}
+
+	if c == nil {
+		return ErrUnsupportedContentType
+	}
+
+	return c.NewDecoder(ctx).Decode(out)
+}
+
+// BindParams sets the fields of the struct out points to from the route's params using `param` tags,
+// example: `param:"id"` for "/users/:id".
+// Values are converted to the field's type, which can be any of the basic types, time.Duration,
+// time.Time (unix or RFC 3339) or anything that implements encoding.TextUnmarshaler (ex: uuid types).
+func (ctx *Context) BindParams(out interface{}) error {
+	return bindValues(out, "param", false, func(k string) []string {
+		for _, p := range ctx.Params {
+			if p.Name == k {
+				return []string{p.Value}
+			}
+		}
+		return nil
+	})
+}
+
+// BindQuery sets the fields of the struct out points to from the query string using `query` tags,
+// it supports the same types as BindParams, and slices for repeated keys.
+func (ctx *Context) BindQuery(out interface{}) error {
+	q := ctx.Req.URL.Query()
+	return bindValues(out, "query", false, func(k string) []string { return q[k] })
+}
+
+// BindAll binds the request's body (if any), query and params into out, in that order,
+// so params take priority over query values, which take priority over the body.
+func (ctx *Context) BindAll(out interface{}) error {
+	if ctx.Req.Body != nil && ctx.Req.Body != http.NoBody && ctx.Req.ContentLength != 0 {
+		if err := ctx.Bind(out); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.BindQuery(out); err != nil {
+		return err
+	}
+
+	return ctx.BindParams(out)
+}
+
+func mediaType(ct string) string {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(ct))
+	}
+	return mt
+}
+
+func bindForm(vals url.Values, out interface{}) error {
+	switch out := out.(type) {
+	case *url.Values:
+		*out = vals
+		return nil
+	case *map[string]string:
+		m := make(map[string]string, len(vals))
+		for k := range vals {
+			m[k] = vals.Get(k)
+		}
+		*out = m
+		return nil
+	}
+
+	return bindValues(out, "form", true, func(k string) []string { return vals[k] })
+}
+
+// bindValues sets the fields of the struct out points to using get, fields are matched by
+// their `tag` tag, or their name if they don't have one and useName is true. Fields tagged with "-" are skipped.
+func bindValues(out interface{}, tag string, useName bool, get func(key string) []string) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidBindTarget
+	}
+
+	return bindStruct(rv.Elem(), tag, useName, get)
+}
+
+func bindStruct(sv reflect.Value, tag string, useName bool, get func(key string) []string) error {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+
+		name := sf.Tag.Get(tag)
+		if idx := strings.IndexByte(name, ','); idx != -1 {
+			name = name[:idx]
+		}
+
+		if name == "-" {
+			continue
+		}
+
+		fv := sv.Field(i)
+
+		if sf.Anonymous && name == "" && fv.Kind() == reflect.Struct {
+			if err := bindStruct(fv, tag, useName, get); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" || !fv.CanSet() { // unexported embedded non-struct fields
+			continue
+		}
+
+		if name == "" {
+			if !useName {
+				continue
+			}
+			name = sf.Name
+		}
+
+		vals := get(name)
+		if len(vals) == 0 {
+			continue
+		}
+
+		if err := setValue(fv, vals); err != nil {
+			return &Error{Field: name, Message: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+func setValue(v reflect.Value, vals []string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), vals)
+	}
+
+	s := vals[0]
+
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+
+	case timeType: // unix timestamps or RFC 3339
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			v.Set(reflect.ValueOf(time.Unix(n, 0)))
+			return nil
+		}
+	}
+
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return tu.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+
+		sl := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, s := range vals {
+			if err := setValue(sl.Index(i), []string{s}); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
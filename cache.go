@@ -0,0 +1,455 @@
+package apiserv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/missionMeteora/apiserv/internal"
+)
+
+// DefaultCacheMaxBodySize is the largest response body ResponseCache stores if ResponseCache.MaxBodySize isn't set.
+const DefaultCacheMaxBodySize = 1 << 20 // 1mb
+
+// CacheKeyFunc returns the cache key for a request, returning an empty string skips caching.
+type CacheKeyFunc = func(ctx *Context) string
+
+// DefaultCacheKey returns the request's path and query, plus a hash of its Authorization and Cookie headers if it has any,
+// so responses are never shared between different users, and the credentials don't end up in the store's keys.
+func DefaultCacheKey(ctx *Context) string {
+	h := ctx.Req.Header
+	auth, cookie := h.Get("Authorization"), h.Get("Cookie")
+	if auth == "" && cookie == "" {
+		return ctx.Req.URL.RequestURI()
+	}
+
+	sum := sha256.Sum256([]byte(auth + "\x00" + cookie))
+	return ctx.Req.URL.RequestURI() + "\x00" + hex.EncodeToString(sum[:16])
+}
+
+// Cache is a shorthand for NewResponseCache(ttl, keyFn).Handler.
+func Cache(ttl time.Duration, keyFn CacheKeyFunc) Handler {
+	return NewResponseCache(ttl, keyFn).Handler
+}
+
+// NewResponseCache returns a new in-memory ResponseCache, if keyFn is nil, DefaultCacheKey is used.
+func NewResponseCache(ttl time.Duration, keyFn CacheKeyFunc) *ResponseCache {
+	return NewResponseCacheWithStore(NewMemoryStore(), ttl, keyFn)
+}
+
+// NewResponseCacheWithStore returns a new ResponseCache backed by store, if keyFn is nil, DefaultCacheKey is used.
+// Use a shared store (ex: apiserv/redisstore) to share the cache between multiple instances.
+func NewResponseCacheWithStore(store CacheStore, ttl time.Duration, keyFn CacheKeyFunc) *ResponseCache {
+	if keyFn == nil {
+		keyFn = DefaultCacheKey
+	}
+
+	return &ResponseCache{
+		store: store,
+		keyFn: keyFn,
+		ttl:   ttl,
+	}
+}
+
+// ResponseCache caches rendered GET responses (status, headers and body) until they expire.
+// Only 200 responses without cookies are stored, Cache-Control: private, no-store or no-cache and Vary: * responses are skipped,
+// and the values of the request headers listed in Vary must match for a cached response to be used.
+// If used with Gzip, Gzip must come first in the chain, otherwise responses don't get cached.
+// The X-Cache header is set to HIT, MISS or STALE.
+type ResponseCache struct {
+	// StaleWhileRevalidate serves expired responses for that long after the ttl,
+	// while a fresh copy is fetched in the background by running the request again through the server.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError serves expired responses for that long after the ttl if the handlers return a 5xx.
+	StaleIfError time.Duration
+
+	// MaxBodySize is the largest response body that gets cached, defaults to DefaultCacheMaxBodySize,
+	// bigger responses are passed through without being recorded.
+	MaxBodySize int
+
+	store CacheStore
+	keyFn CacheKeyFunc
+	ttl   time.Duration
+
+	mux          sync.Mutex
+	revalidating map[string]bool
+}
+
+type cachedResponse struct {
+	Header http.Header `json:"h,omitempty"`
+	Body   []byte      `json:"b,omitempty"`
+	Code   int         `json:"c"`
+	Time   int64       `json:"t,omitempty"` // unix nano, only set by ResponseCache
+
+	// Vary holds the values of the request headers listed in the response's Vary header.
+	Vary map[string]string `json:"v,omitempty"`
+}
+
+// revalidateKey is set on the requests started by ResponseCache.revalidate so they skip the cached copy.
+type revalidateKey struct{}
+
+// Handler is the caching middleware.
+func (rc *ResponseCache) Handler(ctx *Context) Response {
+	if m := ctx.Req.Method; m != http.MethodGet && m != http.MethodHead {
+		return nil
+	}
+
+	key := rc.keyFn(ctx)
+	if key == "" {
+		return nil
+	}
+
+	var stale *cachedResponse // only set if it can be used on errors
+
+	if cr := rc.get(ctx, key); cr != nil && cr.varyMatches(ctx.Req) && ctx.Req.Context().Value(revalidateKey{}) != rc {
+		age := time.Since(time.Unix(0, cr.Time))
+		switch {
+		case rc.ttl <= 0 || cr.Time == 0 || age < rc.ttl:
+			ctx.Header().Set("X-Cache", "HIT")
+			cr.writeToCtx(ctx)
+			return Break
+
+		case age < rc.ttl+rc.StaleWhileRevalidate:
+			rc.revalidate(ctx, key)
+			ctx.Header().Set("X-Cache", "STALE")
+			cr.writeToCtx(ctx)
+			return Break
+
+		case age < rc.ttl+rc.StaleIfError:
+			stale = cr
+		}
+	}
+
+	ctx.Header().Set("X-Cache", "MISS")
+
+	orig := ctx.ResponseWriter
+	crw := &cacheRW{ResponseWriter: orig, buffer: stale != nil, max: rc.MaxBodySize}
+	if crw.max <= 0 {
+		crw.max = DefaultCacheMaxBodySize
+	}
+	ctx.ResponseWriter = crw
+
+	ctx.Next()
+
+	wrapped := ctx.ResponseWriter != crw // something wrapped our writer, most likely Gzip.
+	if wrapped {
+		if g, ok := ctx.ResponseWriter.(*gzRW); ok {
+			g.Reset()
+		}
+	}
+
+	ctx.ResponseWriter = orig
+
+	if stale != nil {
+		if crw.buffer && crw.code >= http.StatusInternalServerError {
+			ctx.Header().Set("X-Cache", "STALE")
+			stale.writeToCtx(ctx)
+			return nil
+		}
+		crw.flush()
+	}
+
+	if wrapped || crw.skip || ctx.Req.Method == http.MethodHead || crw.code != http.StatusOK {
+		return nil
+	}
+
+	h := ctx.Header()
+	if _, ok := h["Set-Cookie"]; ok {
+		return nil
+	}
+
+	if cacheControlHas(h, "private", "no-store", "no-cache") {
+		return nil
+	}
+
+	vary, ok := varyValues(h, ctx.Req)
+	if !ok {
+		return nil
+	}
+
+	cr := newCachedResponse(h, crw)
+	cr.Time, cr.Vary = time.Now().UnixNano(), vary
+	rc.set(ctx, key, cr)
+
+	return nil
+}
+
+// revalidate runs a copy of the request through the server in the background to refresh the cached response for key,
+// only one revalidation per key runs at a time.
+func (rc *ResponseCache) revalidate(ctx *Context, key string) {
+	rc.mux.Lock()
+	if rc.revalidating[key] {
+		rc.mux.Unlock()
+		return
+	}
+
+	if rc.revalidating == nil {
+		rc.revalidating = map[string]bool{}
+	}
+	rc.revalidating[key] = true
+	rc.mux.Unlock()
+
+	// ctx gets reused once the handler returns, so nothing from it can be used inside the goroutine
+	s := ctx.s
+	req := ctx.Req.Clone(context.WithValue(context.Background(), revalidateKey{}, rc))
+	req.Method, req.Body = http.MethodGet, http.NoBody
+
+	go func() {
+		defer func() {
+			rc.mux.Lock()
+			delete(rc.revalidating, key)
+			rc.mux.Unlock()
+		}()
+
+		s.ServeHTTP(&discardRW{h: http.Header{}}, req)
+	}()
+}
+
+// newCachedResponse returns the response recorded by crw, without the headers that are specific to the request.
+func newCachedResponse(h http.Header, crw *cacheRW) *cachedResponse {
+	cr := &cachedResponse{
+		Header: make(http.Header, len(h)),
+		Body:   crw.buf.Bytes(),
+		Code:   crw.code,
+	}
+
+	for k, v := range h {
+		switch k {
+		case "Content-Encoding", "Content-Length", "X-Cache", CoalescedHeader, RequestIDHeader:
+			continue
+		}
+		cr.Header[k] = v
+	}
+
+	return cr
+}
+
+// Invalidate removes the cached response for key.
+func (rc *ResponseCache) Invalidate(key string) error {
+	return rc.store.Delete(key)
+}
+
+// InvalidatePrefix removes all the cached responses with keys starting with prefix.
+// Returns ErrCacheNoPrefix if the store doesn't implement CachePrefixDeleter.
+func (rc *ResponseCache) InvalidatePrefix(prefix string) error {
+	if pd, ok := rc.store.(CachePrefixDeleter); ok {
+		return pd.DeletePrefix(prefix)
+	}
+	return ErrCacheNoPrefix
+}
+
+func (rc *ResponseCache) get(ctx *Context, key string) *cachedResponse {
+	b, ok, err := rc.store.Get(key)
+	if err != nil {
+		ctx.s.Errorf("cache get (%s): %v", key, err)
+		return nil
+	}
+
+	if !ok {
+		return nil
+	}
+
+	var cr cachedResponse
+	if err = internal.Unmarshal(b, &cr); err != nil {
+		ctx.s.Errorf("cache get (%s): %v", key, err)
+		return nil
+	}
+
+	return &cr
+}
+
+func (rc *ResponseCache) set(ctx *Context, key string, cr *cachedResponse) {
+	ttl := rc.ttl
+	if ttl > 0 { // keep stale copies around
+		if rc.StaleWhileRevalidate > rc.StaleIfError {
+			ttl += rc.StaleWhileRevalidate
+		} else {
+			ttl += rc.StaleIfError
+		}
+	}
+
+	b, err := internal.Marshal(cr)
+	if err == nil {
+		err = rc.store.Set(key, b, ttl)
+	}
+
+	if err != nil {
+		ctx.s.Errorf("cache set (%s): %v", key, err)
+	}
+}
+
+// varyMatches returns true if req has the same values for the headers the cached response varies on.
+func (cr *cachedResponse) varyMatches(req *http.Request) bool {
+	for k, v := range cr.Vary {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// varyValues returns the request's values for the headers listed in h's Vary, ok is false for Vary: *.
+// Accept-Encoding is ignored since the cache stores the uncompressed response.
+func varyValues(h http.Header, req *http.Request) (m map[string]string, ok bool) {
+	for _, line := range h.Values("Vary") {
+		for _, f := range strings.Split(line, ",") {
+			switch f = http.CanonicalHeaderKey(strings.TrimSpace(f)); f {
+			case "":
+			case "*":
+				return nil, false
+			case "Accept-Encoding":
+			default:
+				if m == nil {
+					m = map[string]string{}
+				}
+				m[f] = req.Header.Get(f)
+			}
+		}
+	}
+	return m, true
+}
+
+// cacheControlHas returns true if h's Cache-Control has any of the directives.
+func cacheControlHas(h http.Header, directives ...string) bool {
+	for _, line := range h.Values("Cache-Control") {
+		for _, f := range strings.Split(line, ",") {
+			if i := strings.IndexByte(f, '='); i != -1 {
+				f = f[:i]
+			}
+
+			f = strings.TrimSpace(f)
+			for _, d := range directives {
+				if strings.EqualFold(f, d) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (cr *cachedResponse) writeToCtx(ctx *Context) {
+	h := ctx.Header()
+	for k, v := range cr.Header {
+		h[k] = v
+	}
+
+	if h.Get(encodingHeader) == "" {
+		h.Set("Content-Length", strconv.Itoa(len(cr.Body)))
+	}
+
+	ctx.WriteHeader(cr.Code)
+	ctx.Write(cr.Body)
+}
+
+// cacheRW records the response, if buffer is true nothing is written to the underlying writer until flush is called.
+// If the body grows past max (when set), the response is flushed or it is a text/event-stream, the recording is dropped,
+// skip is set, onSkip is called and the rest is passed through.
+type cacheRW struct {
+	http.ResponseWriter
+	buf    bytes.Buffer
+	code   int
+	max    int
+	buffer bool
+	skip   bool
+	onSkip func()
+}
+
+func (w *cacheRW) WriteHeader(code int) {
+	if code < http.StatusOK { // informational responses (ex: 103 Early Hints) aren't part of the response
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if w.code == 0 {
+		w.code = code
+		if isEventStream(w.Header()) {
+			buffered := w.buffer
+			w.stopRecording()
+			if buffered { // flush already wrote the header
+				return
+			}
+		}
+	}
+
+	if !w.buffer {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *cacheRW) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+		if isEventStream(w.Header()) {
+			w.stopRecording()
+		}
+	}
+
+	if !w.skip {
+		if w.max > 0 && w.buf.Len()+len(p) > w.max {
+			w.stopRecording()
+		} else {
+			w.buf.Write(p)
+		}
+	}
+
+	if w.buffer {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cacheRW) flush() {
+	if !w.buffer || w.code == 0 {
+		return
+	}
+
+	w.buffer = false
+	w.ResponseWriter.WriteHeader(w.code)
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
+
+// stopRecording writes out anything that was buffered and drops the recorded body.
+func (w *cacheRW) stopRecording() {
+	if w.skip {
+		return
+	}
+
+	w.flush()
+	w.skip, w.buffer, w.buf = true, false, bytes.Buffer{}
+
+	if w.onSkip != nil {
+		w.onSkip()
+	}
+}
+
+func (w *cacheRW) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Flush stops the recording, a flushed response is being streamed and can't be replayed.
+func (w *cacheRW) Flush() {
+	w.stopRecording()
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func isEventStream(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+// discardRW is used for requests that run in the background, where nobody reads the response.
+type discardRW struct {
+	h http.Header
+}
+
+func (w *discardRW) Header() http.Header         { return w.h }
+func (w *discardRW) WriteHeader(int)             {}
+func (w *discardRW) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,119 @@
+package apiserv
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCacheNoPrefix is returned when a prefix operation is used on a store that doesn't support it.
+var ErrCacheNoPrefix = errors.New("cache store doesn't support prefix deletes")
+
+// CacheStore is a key/value store with expiration, used by ResponseCache.
+// Implementations must be safe to use from multiple goroutines.
+type CacheStore interface {
+	// Get returns the value for key, ok is false if the key doesn't exist or expired.
+	Get(key string) (val []byte, ok bool, err error)
+
+	// Set sets key to val, if ttl is > 0 the key expires after it.
+	Set(key string, val []byte, ttl time.Duration) error
+
+	// Delete removes the passed keys.
+	Delete(keys ...string) error
+}
+
+// CachePrefixDeleter is an optional CacheStore interface to remove all the keys starting with prefix.
+type CachePrefixDeleter interface {
+	DeletePrefix(prefix string) error
+}
+
+// NewMemoryStore returns a new in-memory CacheStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		m: map[string]memEntry{},
+	}
+}
+
+// MemoryStore is an in-memory CacheStore, expired keys are removed lazily.
+type MemoryStore struct {
+	mux       sync.RWMutex
+	m         map[string]memEntry
+	lastSweep time.Time
+}
+
+type memEntry struct {
+	expires time.Time
+	val     []byte
+}
+
+func (e *memEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// Get implements CacheStore.
+func (ms *MemoryStore) Get(key string) (val []byte, ok bool, err error) {
+	ms.mux.RLock()
+	e, ok := ms.m[key]
+	ms.mux.RUnlock()
+
+	if !ok || e.expired(time.Now()) {
+		return nil, false, nil
+	}
+
+	return e.val, true, nil
+}
+
+// Set implements CacheStore.
+func (ms *MemoryStore) Set(key string, val []byte, ttl time.Duration) error {
+	now := time.Now()
+	e := memEntry{val: val}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+
+	ms.mux.Lock()
+	ms.m[key] = e
+
+	if now.Sub(ms.lastSweep) > time.Minute {
+		for k, e := range ms.m {
+			if e.expired(now) {
+				delete(ms.m, k)
+			}
+		}
+		ms.lastSweep = now
+	}
+	ms.mux.Unlock()
+
+	return nil
+}
+
+// Delete implements CacheStore.
+func (ms *MemoryStore) Delete(keys ...string) error {
+	ms.mux.Lock()
+	for _, k := range keys {
+		delete(ms.m, k)
+	}
+	ms.mux.Unlock()
+	return nil
+}
+
+// DeletePrefix implements CachePrefixDeleter.
+func (ms *MemoryStore) DeletePrefix(prefix string) error {
+	ms.mux.Lock()
+	for k := range ms.m {
+		if strings.HasPrefix(k, prefix) {
+			delete(ms.m, k)
+		}
+	}
+	ms.mux.Unlock()
+	return nil
+}
+
+// Len returns the number of keys in the store, including expired keys that weren't removed yet.
+func (ms *MemoryStore) Len() int {
+	ms.mux.RLock()
+	n := len(ms.m)
+	ms.mux.RUnlock()
+	return n
+}
@@ -0,0 +1,105 @@
+package apiserv
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Canary returns a handler that routes the requests pick returns true for to canary and the rest to primary,
+// pick is usually (*CanaryWeight).Pick:
+//
+//	cw := apiserv.NewCanaryWeight(5, "canary_bucket") // 5% of the clients
+//	s.GET("/search", apiserv.Canary(searchV1, searchV2, cw.Pick))
+//	// later: cw.Set(50) to ramp up, or cw.Set(0) to roll back
+func Canary(primary, canary Handler, pick func(ctx *Context) bool) Handler {
+	return func(ctx *Context) Response {
+		if pick(ctx) {
+			return canary(ctx)
+		}
+		return primary(ctx)
+	}
+}
+
+const canaryBuckets = 10000
+
+// NewCanaryWeight returns a CanaryWeight that sends percent of the clients to the canary, keeping them sticky with cookie.
+func NewCanaryWeight(percent float64, cookie string) *CanaryWeight {
+	cw := &CanaryWeight{Cookie: cookie, CookieTTL: 30 * 24 * time.Hour}
+	cw.Set(percent)
+	return cw
+}
+
+// CanaryWeight picks a stable bucket for every client and sends the ones below the current percentage to the canary,
+// so ramping up keeps the clients that were already on the canary there, and setting it to 0 rolls everyone back instantly.
+type CanaryWeight struct {
+	// Header, if set and present in the request, is hashed to pick the bucket (ex: a user or tenant id header)
+	// which takes priority over the cookie.
+	Header string
+
+	// Cookie stores the client's randomly assigned bucket, if empty and there's no Header every request is picked at random.
+	Cookie     string
+	CookieHost string
+	CookieTTL  time.Duration
+
+	// buckets is percent * 100.
+	buckets uint32
+}
+
+// Set changes the percentage of clients sent to the canary, it is safe to call concurrently with Pick.
+func (cw *CanaryWeight) Set(percent float64) {
+	switch {
+	case percent < 0:
+		percent = 0
+	case percent > 100:
+		percent = 100
+	}
+	atomic.StoreUint32(&cw.buckets, uint32(percent*canaryBuckets/100))
+}
+
+// Percent returns the current percentage of clients sent to the canary.
+func (cw *CanaryWeight) Percent() float64 {
+	return float64(atomic.LoadUint32(&cw.buckets)) * 100 / canaryBuckets
+}
+
+// Pick returns true if the request should go to the canary.
+func (cw *CanaryWeight) Pick(ctx *Context) bool {
+	n := atomic.LoadUint32(&cw.buckets)
+	switch n {
+	case 0:
+		return false
+	case canaryBuckets:
+		return true
+	}
+
+	return cw.bucket(ctx) < n
+}
+
+func (cw *CanaryWeight) bucket(ctx *Context) uint32 {
+	if cw.Header != "" {
+		if v := ctx.ReqHeader().Get(cw.Header); v != "" {
+			h := fnv.New32a()
+			h.Write([]byte(v))
+			return h.Sum32() % canaryBuckets
+		}
+	}
+
+	if cw.Cookie != "" {
+		if v, ok := ctx.GetCookie(cw.Cookie); ok {
+			if b, err := strconv.ParseUint(v, 10, 32); err == nil && b < canaryBuckets {
+				return uint32(b)
+			}
+		}
+	}
+
+	b := uint32(rand.Intn(canaryBuckets))
+	if cw.Cookie != "" {
+		if err := ctx.SetCookie(cw.Cookie, strconv.Itoa(int(b)), cw.CookieHost, false, cw.CookieTTL); err != nil {
+			ctx.s.Warnf("canary cookie (%s): %v", cw.Cookie, err)
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,107 @@
+package apiserv
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	capturedReqKey  = ":CRQ:"
+	capturedRespKey = ":CRS:"
+)
+
+// CaptureBodies returns a middleware that snapshots up to maxReq bytes of the request body and maxResp bytes
+// of the response body (either can be 0 to disable it), they're available with ctx.CapturedRequestBody and
+// ctx.CapturedResponseBody, including from OnFinish funcs and Audit sinks.
+// The handlers still see the full request body.
+func CaptureBodies(maxReq, maxResp int) Handler {
+	return func(ctx *Context) Response {
+		if maxReq > 0 {
+			b, err := teeRequestBody(ctx.Req, int64(maxReq))
+			if err != nil {
+				return NewJSONErrorResponse(http.StatusBadRequest, err)
+			}
+			ctx.Set(capturedReqKey, b)
+		}
+
+		if maxResp > 0 {
+			orig := ctx.ResponseWriter
+			cw := &captureRW{ResponseWriter: orig, max: maxResp}
+			ctx.ResponseWriter = cw
+			ctx.Set(capturedRespKey, cw)
+
+			// putCtx needs the real writer back
+			ctx.OnFinish(func(int, int64, error) { ctx.ResponseWriter = orig })
+		}
+
+		return nil
+	}
+}
+
+// CapturedRequestBody returns the request body captured by CaptureBodies or nil.
+func (ctx *Context) CapturedRequestBody() []byte {
+	b, _ := ctx.Get(capturedReqKey).([]byte)
+	return b
+}
+
+// CapturedResponseBody returns the response body captured by CaptureBodies so far or nil.
+func (ctx *Context) CapturedResponseBody() []byte {
+	if cw, ok := ctx.Get(capturedRespKey).(*captureRW); ok {
+		return cw.buf.Bytes()
+	}
+	return nil
+}
+
+// teeRequestBody reads up to max bytes (or all of it if max <= 0) of the request's body,
+// and replaces the body so it can be read again in full.
+func teeRequestBody(req *http.Request, max int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	r := io.Reader(req.Body)
+	if max > 0 {
+		r = io.LimitReader(r, max)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = &multiReadCloser{io.MultiReader(bytes.NewReader(b), req.Body), req.Body}
+	return b, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	c io.Closer
+}
+
+func (mrc *multiReadCloser) Close() error { return mrc.c.Close() }
+
+type captureRW struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+	max int
+}
+
+func (cw *captureRW) Write(p []byte) (int, error) {
+	if left := cw.max - cw.buf.Len(); left > 0 {
+		if left > len(p) {
+			left = len(p)
+		}
+		cw.buf.Write(p[:left])
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *captureRW) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
+
+func (cw *captureRW) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
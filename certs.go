@@ -0,0 +1,223 @@
+package apiserv
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ErrCertNotRenewed is passed to the OnCertError hooks when autocert keeps serving a certificate past its renewal window.
+var ErrCertNotRenewed = errors.New("certificate wasn't renewed")
+
+// CertInfo describes a certificate loaded by one of the TLS run functions.
+type CertInfo struct {
+	Domains  []string  `json:"domains"`
+	Issuer   string    `json:"issuer"`
+	Serial   string    `json:"serial"`
+	NotAfter time.Time `json:"notAfter"`
+
+	// Source is either "file" for CertPairs or "autocert".
+	Source string `json:"source"`
+	File   string `json:"file,omitempty"`
+}
+
+// ExpiresIn returns how long until the certificate expires.
+func (ci *CertInfo) ExpiresIn() time.Duration { return time.Until(ci.NotAfter) }
+
+// CertErrorHook gets called with the host and error when autocert fails to get or renew a certificate.
+type CertErrorHook = func(host string, err error)
+
+// OnCertError adds a hook that gets called when autocert fails to get a certificate for an allowed host,
+// or keeps serving one that should have been renewed a day ago, it is NOT safe to call this once you call one of the run functions.
+func (s *Server) OnCertError(fn CertErrorHook) {
+	s.certs.hooks = append(s.certs.hooks, fn)
+}
+
+// Certificates returns the certificates loaded from CertPairs and the ones autocert served so far, sorted by expiry.
+func (s *Server) Certificates() []CertInfo {
+	return s.certs.list()
+}
+
+type certEntry struct {
+	CertInfo
+	reported bool
+}
+
+type certRegistry struct {
+	mux   sync.Mutex
+	m     map[string]*certEntry
+	hooks []CertErrorHook
+}
+
+func (cr *certRegistry) list() []CertInfo {
+	cr.mux.Lock()
+	out := make([]CertInfo, 0, len(cr.m))
+	for _, e := range cr.m {
+		out = append(out, e.CertInfo)
+	}
+	cr.mux.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].NotAfter.Before(out[j].NotAfter) })
+	return out
+}
+
+// track records cert and returns its entry, it returns nil if the certificate can't be parsed.
+func (cr *certRegistry) track(source, file string, cert *tls.Certificate) *certEntry {
+	leaf, err := certLeaf(cert)
+	if err != nil {
+		return nil
+	}
+
+	key := leaf.Issuer.String() + "/" + hex.EncodeToString(leaf.SerialNumber.Bytes())
+
+	cr.mux.Lock()
+	defer cr.mux.Unlock()
+
+	if e := cr.m[key]; e != nil {
+		return e
+	}
+
+	if cr.m == nil {
+		cr.m = map[string]*certEntry{}
+	}
+
+	domains := leaf.DNSNames
+	if len(domains) == 0 && leaf.Subject.CommonName != "" {
+		domains = []string{leaf.Subject.CommonName}
+	}
+
+	e := &certEntry{CertInfo: CertInfo{
+		Domains:  domains,
+		Issuer:   leaf.Issuer.CommonName,
+		Serial:   hex.EncodeToString(leaf.SerialNumber.Bytes()),
+		NotAfter: leaf.NotAfter,
+		Source:   source,
+		File:     file,
+	}}
+
+	// drop stale autocert entries for the same domains once they get renewed
+	for k, o := range cr.m {
+		if source == "autocert" && o.Source == source && sameDomains(o.Domains, domains) {
+			delete(cr.m, k)
+		}
+	}
+
+	cr.m[key] = e
+	return e
+}
+
+// shouldReport returns true the first time it's called for an entry.
+func (cr *certRegistry) shouldReport(e *certEntry) bool {
+	cr.mux.Lock()
+	defer cr.mux.Unlock()
+	if e.reported {
+		return false
+	}
+	e.reported = true
+	return true
+}
+
+func (cr *certRegistry) report(host string, err error) {
+	for _, fn := range cr.hooks {
+		fn(host, err)
+	}
+}
+
+func sameDomains(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// trackCertPairs records the certificates loaded from CertPairs, certs and pairs must be in the same order.
+func (s *Server) trackCertPairs(pairs []CertPair, certs []tls.Certificate) {
+	for i := range certs {
+		s.certs.track("file", pairs[i].CertFile, &certs[i])
+	}
+}
+
+// autoCertGetter wraps m.GetCertificate to record the served certificates and report errors for allowed hosts.
+func (s *Server) autoCertGetter(m *autocert.Manager) func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	renewBefore := m.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = 30 * 24 * time.Hour // autocert's default
+	}
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		host := hello.ServerName
+		crt, err := m.GetCertificate(hello)
+		if err != nil {
+			if host != "" && (m.HostPolicy == nil || m.HostPolicy(context.Background(), host) == nil) {
+				s.Warnf("autocert (%s): %v", host, err)
+				s.certs.report(host, err)
+			}
+			return crt, err
+		}
+
+		e := s.certs.track("autocert", "", crt)
+		if e != nil && e.ExpiresIn() < renewBefore-24*time.Hour && s.certs.shouldReport(e) {
+			s.Warnf("autocert (%s): certificate expires at %v and wasn't renewed", host, e.NotAfter)
+			s.certs.report(host, fmt.Errorf("%w (expires %v)", ErrCertNotRenewed, e.NotAfter.Format(time.RFC3339)))
+		}
+
+		return crt, nil
+	}
+}
+
+// NewSelfSignedCert returns a self-signed certificate for hosts that is valid for a year,
+// it is meant as a fallback so clients that hit an unknown host get a certificate error instead of a handshake failure.
+func NewSelfSignedCert(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "apiserv fallback"},
+		DNSNames:     hosts,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -0,0 +1,259 @@
+package apiserv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/missionMeteora/apiserv/internal"
+)
+
+// DefaultClientRetryBackoff is the initial delay between retries, it doubles on every attempt.
+const DefaultClientRetryBackoff = 250 * time.Millisecond
+
+// NewClient returns a new Client for the api at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Header:  http.Header{},
+	}
+}
+
+// Client is a small JSON api client that understands JSONResponse.
+type Client struct {
+	// HTTPClient is used to perform the requests, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Header is added to every request, use for things like auth tokens.
+	Header http.Header
+
+	// BaseURL is prefixed to every request path.
+	BaseURL string
+
+	// Timeout is applied to every attempt if > 0.
+	Timeout time.Duration
+
+	// Retries is how many times a request is retried on 429 and 5xx responses.
+	// Non-idempotent requests (ex: POST) are only retried on 429 and 503, since the server didn't handle them.
+	Retries int
+
+	// RetryBackoff is the initial delay between retries, defaults to DefaultClientRetryBackoff.
+	// A Retry-After header from the server takes priority.
+	RetryBackoff time.Duration
+}
+
+// SetAuthToken sets the Authorization header to "Bearer " + token.
+func (c *Client) SetAuthToken(token string) {
+	if c.Header == nil {
+		c.Header = http.Header{}
+	}
+	c.Header.Set("Authorization", "Bearer "+token)
+}
+
+// Get is a shorthand for c.Do(ctx, http.MethodGet, path, nil, respData).
+func (c *Client) Get(ctx context.Context, path string, respData interface{}) (*JSONResponse, error) {
+	return c.Do(ctx, http.MethodGet, path, nil, respData)
+}
+
+// Post is a shorthand for c.Do(ctx, http.MethodPost, path, reqData, respData).
+func (c *Client) Post(ctx context.Context, path string, reqData, respData interface{}) (*JSONResponse, error) {
+	return c.Do(ctx, http.MethodPost, path, reqData, respData)
+}
+
+// Put is a shorthand for c.Do(ctx, http.MethodPut, path, reqData, respData).
+func (c *Client) Put(ctx context.Context, path string, reqData, respData interface{}) (*JSONResponse, error) {
+	return c.Do(ctx, http.MethodPut, path, reqData, respData)
+}
+
+// Delete is a shorthand for c.Do(ctx, http.MethodDelete, path, nil, respData).
+func (c *Client) Delete(ctx context.Context, path string, respData interface{}) (*JSONResponse, error) {
+	return c.Do(ctx, http.MethodDelete, path, nil, respData)
+}
+
+// Do sends reqData as json (if not nil) and decodes the JSONResponse's data into respData.
+// Unsuccessful responses return a *ClientError, along with the decoded JSONResponse if there was one.
+func (c *Client) Do(ctx context.Context, method, path string, reqData, respData interface{}) (*JSONResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var body []byte
+	if reqData != nil {
+		var err error
+		if body, err = internal.Marshal(reqData); err != nil {
+			return nil, err
+		}
+	}
+
+	u := path
+	if c.BaseURL != "" && !strings.Contains(path, "://") {
+		u = c.BaseURL + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	backoff := c.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultClientRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		r, retryAfter, err := c.do(ctx, method, u, body, respData)
+		if attempt >= c.Retries || !shouldRetry(method, err) {
+			return r, err
+		}
+
+		if retryAfter <= 0 {
+			retryAfter = backoff << uint(attempt)
+		}
+
+		t := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return r, err
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, u string, body []byte, respData interface{}) (_ *JSONResponse, retryAfter time.Duration, err error) {
+	if c.Timeout > 0 {
+		var cancelFn func()
+		ctx, cancelFn = context.WithTimeout(ctx, c.Timeout)
+		defer cancelFn()
+	}
+
+	var br io.Reader
+	if body != nil {
+		br = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, br)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Accept", MimeJSON)
+	if body != nil {
+		req.Header.Set("Content-Type", MimeJSON)
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		resp.Body.Close()
+		return &JSONResponse{Code: resp.StatusCode, Success: true}, 0, nil
+	}
+
+	// buffer the body so a non-json error page (ex: from a proxy) doesn't hide the status code.
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, retryAfter, err
+	}
+
+	r, err := ReadJSONResponse(ioutil.NopCloser(bytes.NewReader(b)), respData)
+	if err == nil {
+		return r, 0, nil
+	}
+
+	if r.Code == 0 {
+		r.Code = resp.StatusCode
+	}
+
+	if resp.StatusCode < http.StatusBadRequest && r.Code < http.StatusBadRequest { // decoding error on a successful response
+		return r, 0, err
+	}
+
+	ce := &ClientError{
+		Code:      r.Code,
+		Errors:    r.Errors,
+		RequestID: r.RequestID,
+	}
+
+	if ce.RequestID == "" {
+		ce.RequestID = resp.Header.Get(RequestIDHeader)
+	}
+
+	if len(ce.Errors) == 0 {
+		ce.Errors = []Error{{Message: http.StatusText(resp.StatusCode)}}
+	}
+
+	return r, retryAfter, ce
+}
+
+func shouldRetry(method string, err error) bool {
+	ce, ok := err.(*ClientError)
+	if !ok {
+		return false
+	}
+
+	switch ce.Code {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+
+	if ce.Code < 500 {
+		return false
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// ClientError is returned by Client for unsuccessful responses.
+type ClientError struct {
+	Errors    []Error
+	RequestID string
+	Code      int
+}
+
+func (e *ClientError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		if err.Field != "" {
+			msgs = append(msgs, err.Field+": "+err.Message)
+		} else {
+			msgs = append(msgs, err.Message)
+		}
+	}
+
+	return fmt.Sprintf("apiserv: %d: %s", e.Code, strings.Join(msgs, ", "))
+}
+
+// Field returns the first error for field or nil.
+func (e *ClientError) Field(field string) *Error {
+	for i := range e.Errors {
+		if e.Errors[i].Field == field {
+			return &e.Errors[i]
+		}
+	}
+	return nil
+}
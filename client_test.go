@@ -0,0 +1,59 @@
+package apiserv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	var hits int32
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/echo/:v", func(ctx *Context) Response {
+		if ctx.Req.Header.Get("Authorization") != "Bearer tok" {
+			return RespForbidden
+		}
+		return NewJSONResponse(ctx.Param("v"))
+	})
+	srv.POST("/validate", func(ctx *Context) Response {
+		return NewJSONErrorResponse(http.StatusBadRequest, &Error{Field: "name", Message: "required"})
+	})
+	srv.GET("/flaky", func(ctx *Context) Response {
+		if atomic.AddInt32(&hits, 1) < 3 {
+			return RespServiceUnavailable
+		}
+		return NewJSONResponse("ok")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.SetAuthToken("tok")
+	c.RetryBackoff = time.Millisecond
+
+	var s string
+	if _, err := c.Get(context.Background(), "/echo/hi", &s); err != nil || s != "hi" {
+		t.Fatalf("unexpected response: %q %v", s, err)
+	}
+
+	_, err := c.Post(context.Background(), "/validate", M{"x": 1}, nil)
+	var ce *ClientError
+	if !errors.As(err, &ce) || ce.Code != http.StatusBadRequest || ce.Field("name") == nil {
+		t.Fatalf("expected a field error, got %#v", err)
+	}
+
+	if _, err = c.Get(context.Background(), "/flaky", &s); err == nil {
+		t.Fatal("expected an error without retries")
+	}
+
+	c.Retries = 3
+	if _, err = c.Get(context.Background(), "/flaky", &s); err != nil || s != "ok" {
+		t.Fatalf("unexpected response: %q %v", s, err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package clientgen generates a typed Go client from an apiserv.Server's routes.
+//
+// Routes are read at runtime, so the usual setup is a small generator next to the server code:
+//
+//	//go:build ignore
+//
+//	package main
+//
+//	func main() {
+//		s := apiserv.New()
+//		api.Register(s) // the same func used by the real server
+//		if err := clientgen.WriteFile("client/client.go", s.RoutesInfo(), clientgen.Options{Package: "client"}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// and `//go:generate go run gen.go` in the api package.
+package clientgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// Options controls the generated package.
+type Options struct {
+	// Package is the generated package's name, defaults to "client".
+	Package string
+
+	// Filter returns false for routes that shouldn't be part of the client.
+	// By default the debug routes added by Server.EnableDebug and HEAD routes are skipped.
+	Filter func(r apiserv.RouteInfo) bool
+}
+
+// DefaultFilter skips HEAD routes and the "debug" group.
+func DefaultFilter(r apiserv.RouteInfo) bool {
+	return r.Method != http.MethodHead && r.Group != "debug"
+}
+
+// WriteFile is a helper to Generate directly into the file at fp.
+func WriteFile(fp string, routes []apiserv.RouteInfo, opts Options) error {
+	var buf bytes.Buffer
+	if err := Generate(&buf, routes, opts); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, buf.Bytes(), 0o644)
+}
+
+// Generate writes a gofmt'ed client package for routes to w.
+// Each route gets a method named after RouteMeta.Name, or derived from the method and path
+// (ex: GET /users/:id -> GetUsersByID) with path params as string args.
+// Catch-all extensions are added back to the url, and routes like /files/*name.* get an extra nameExt arg.
+func Generate(w io.Writer, routes []apiserv.RouteInfo, opts Options) error {
+	if opts.Package == "" {
+		opts.Package = "client"
+	}
+
+	if opts.Filter == nil {
+		opts.Filter = DefaultFilter
+	}
+
+	var (
+		eps   []*endpoint
+		names = map[string]string{}
+	)
+
+	for _, r := range routes {
+		if !opts.Filter(r) {
+			continue
+		}
+
+		ep := newEndpoint(r)
+		if prev, ok := names[ep.Name]; ok {
+			return fmt.Errorf("clientgen: %s %s and %s have the same method name (%s), set RouteMeta.Name", r.Method, r.Path, prev, ep.Name)
+		}
+
+		names[ep.Name] = r.Method + " " + r.Path
+		eps = append(eps, ep)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]interface{}{
+		"Package":   opts.Package,
+		"Endpoints": eps,
+		"NeedsURL":  needsURL(eps),
+	}); err != nil {
+		return err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("clientgen: %v\n%s", err, buf.Bytes())
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+type endpoint struct {
+	Name    string
+	Doc     []string
+	Method  string
+	Path    string
+	Params  []string
+	URLExpr string
+	HasBody bool
+}
+
+func newEndpoint(r apiserv.RouteInfo) *endpoint {
+	ep := &endpoint{
+		Method:  r.Method,
+		Path:    r.Path,
+		HasBody: r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch,
+	}
+
+	name := []string{exportName(strings.ToLower(r.Method))}
+	parts := []string{}
+	static := ""
+
+	for _, seg := range strings.Split(strings.Trim(r.Path, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+
+		switch seg[0] {
+		case ':', '*':
+			if static != "" {
+				parts = append(parts, fmt.Sprintf("%q", static+"/"))
+				static = ""
+			} else {
+				parts = append(parts, `"/"`)
+			}
+
+			pname, ext := seg[1:], ""
+			if seg[0] == '*' { // catch-alls can have an extension (*name.ext), split the same way the router does
+				if i := strings.IndexByte(pname, '.'); i != -1 {
+					pname, ext = pname[:i], pname[i+1:]
+				}
+			}
+
+			arg := argName(pname)
+			ep.Params = append(ep.Params, arg)
+			name = append(name, "By"+exportName(pname))
+
+			if seg[0] == '*' { // catch-all params can contain slashes
+				parts = append(parts, "strings.TrimPrefix("+arg+`, "/")`)
+				switch ext {
+				case "":
+				case "*": // any extension, the caller passes it
+					extArg := argName(pname + " ext")
+					ep.Params = append(ep.Params, extArg)
+					parts = append(parts, `"."`, extArg)
+				default:
+					parts = append(parts, fmt.Sprintf("%q", "."+ext))
+				}
+			} else {
+				parts = append(parts, "url.PathEscape("+arg+")")
+			}
+
+		default:
+			static += "/" + seg
+			name = append(name, exportName(seg))
+		}
+	}
+
+	if static != "" || len(parts) == 0 {
+		if static == "" {
+			static = "/"
+		}
+		parts = append(parts, fmt.Sprintf("%q", static))
+	}
+
+	ep.URLExpr = strings.Join(parts, " + ")
+	ep.Name = strings.Join(name, "")
+
+	if m := r.Meta; m != nil {
+		if m.Name != "" {
+			ep.Name = exportName(m.Name)
+		}
+
+		if m.Description != "" {
+			ep.Doc = append(ep.Doc, strings.Split(m.Description, "\n")...)
+		}
+
+		if m.Deprecated != "" {
+			ep.Doc = append(ep.Doc, "", "Deprecated: "+m.Deprecated)
+		}
+	}
+
+	return ep
+}
+
+func needsURL(eps []*endpoint) (out map[string]bool) {
+	out = map[string]bool{}
+	for _, ep := range eps {
+		if strings.Contains(ep.URLExpr, "url.PathEscape") {
+			out["net/url"] = true
+		}
+		if strings.Contains(ep.URLExpr, "strings.") {
+			out["strings"] = true
+		}
+	}
+	return
+}
+
+var initialisms = map[string]string{
+	"api": "API", "db": "DB", "html": "HTML", "http": "HTTP", "id": "ID", "ip": "IP",
+	"json": "JSON", "uid": "UID", "uri": "URI", "url": "URL", "uuid": "UUID",
+}
+
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func exportName(s string) string {
+	var b strings.Builder
+	for _, w := range splitWords(s) {
+		if v, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(v)
+			continue
+		}
+		rs := []rune(w)
+		rs[0] = unicode.ToUpper(rs[0])
+		b.WriteString(string(rs))
+	}
+
+	if b.Len() == 0 {
+		return "X"
+	}
+
+	n := b.String()
+	if unicode.IsDigit(rune(n[0])) {
+		n = "X" + n
+	}
+	return n
+}
+
+var reserved = map[string]bool{
+	"c": true, "ctx": true, "reqData": true, "respData": true, "url": true, "strings": true, "apiserv": true,
+}
+
+func argName(s string) string {
+	n := exportName(s)
+	if v, ok := initialisms[strings.ToLower(n)]; ok && v == n {
+		n = strings.ToLower(n)
+	} else {
+		rs := []rune(n)
+		rs[0] = unicode.ToLower(rs[0])
+		n = string(rs)
+	}
+
+	if reserved[n] || isKeyword(n) {
+		n += "Param"
+	}
+	return n
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func",
+		"go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct",
+		"switch", "type", "var":
+		return true
+	}
+	return false
+}
+
+var tmpl = template.Must(template.New("client").Parse(`// Code generated by apiserv/clientgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{- range $pkg, $_ := .NeedsURL}}
+	"{{$pkg}}"
+{{- end}}
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// Client is a typed client for the api, use the embedded *apiserv.Client to set headers, timeouts and retries.
+type Client struct {
+	*apiserv.Client
+}
+
+// New returns a new Client for the api at baseURL.
+func New(baseURL string) *Client {
+	return &Client{apiserv.NewClient(baseURL)}
+}
+{{range .Endpoints}}
+// {{.Name}} calls {{.Method}} {{.Path}}.
+{{- range .Doc}}
+//{{if .}} {{.}}{{end}}
+{{- end}}
+func (c *Client) {{.Name}}(ctx context.Context{{range .Params}}, {{.}} string{{end}}{{if .HasBody}}, reqData{{end}}, respData interface{}) (*apiserv.JSONResponse, error) {
+	return c.Do(ctx, "{{.Method}}", {{.URLExpr}}, {{if .HasBody}}reqData{{else}}nil{{end}}, respData)
+}
+{{end}}`))
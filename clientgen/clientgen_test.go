@@ -0,0 +1,63 @@
+package clientgen
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestGenerate(t *testing.T) {
+	h := func(ctx *apiserv.Context) apiserv.Response { return apiserv.RespOK }
+
+	s := apiserv.New()
+	s.GET("/", h)
+	s.GET("/users/:id", h)
+	s.POST("/users/:id/posts", h)
+	s.GET("/files/*path", h)
+	s.GET("/reports/*path.json", h)
+	s.GET("/raw/*name.*", h)
+	s.WithMeta(apiserv.RouteMeta{Name: "search", Description: "searches things", Deprecated: "use v2"}).GET("/q", h)
+	s.EnableDebug("/debug")
+
+	var buf bytes.Buffer
+	if err := Generate(&buf, s.RoutesInfo(), Options{Package: "api"}); err != nil {
+		t.Fatal(err)
+	}
+
+	src := buf.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "client.go", src, 0); err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+
+	for _, exp := range []string{
+		"package api",
+		`func (c *Client) Get(ctx context.Context, respData interface{})`,
+		`func (c *Client) GetUsersByID(ctx context.Context, id string, respData interface{})`,
+		`c.Do(ctx, "GET", "/users/"+url.PathEscape(id), nil, respData)`,
+		`func (c *Client) PostUsersByIDPosts(ctx context.Context, id string, reqData, respData interface{})`,
+		`"/users/"+url.PathEscape(id)+"/posts", reqData, respData)`,
+		`"/files/"+strings.TrimPrefix(path, "/")`,
+		`func (c *Client) GetReportsByPath(ctx context.Context, path string, respData interface{})`,
+		`"/reports/"+strings.TrimPrefix(path, "/")+".json"`,
+		`func (c *Client) GetRawByName(ctx context.Context, name string, nameExt string, respData interface{})`,
+		`"/raw/"+strings.TrimPrefix(name, "/")+"."+nameExt`,
+		"// Search calls GET /q.\n// searches things\n//\n// Deprecated: use v2\n",
+	} {
+		if !strings.Contains(src, exp) {
+			t.Errorf("missing %q in:\n%s", exp, src)
+		}
+	}
+
+	if strings.Contains(src, "pprof") {
+		t.Errorf("debug routes shouldn't be included:\n%s", src)
+	}
+
+	s.GET("/users/by/id", h) // GetUsersByID again
+	if err := Generate(&buf, s.RoutesInfo(), Options{}); err == nil {
+		t.Fatal("expected a duplicate name error")
+	}
+}
@@ -0,0 +1,102 @@
+package apiserv
+
+import (
+	"net/http"
+	"sync"
+)
+
+// CoalescedHeader is set to "true" on the responses of requests that were served by another request's handler, see Coalesce.
+const CoalescedHeader = "X-Coalesced"
+
+// DefaultCoalesceKey returns the request's path and query, plus its Authorization and Cookie headers
+// so responses are never shared between different users.
+func DefaultCoalesceKey(ctx *Context) string {
+	h := ctx.Req.Header
+	return ctx.Req.URL.RequestURI() + "\x00" + h.Get("Authorization") + "\x00" + h.Get("Cookie")
+}
+
+type flightCall struct {
+	done chan struct{}
+	cr   *cachedResponse
+}
+
+// Coalesce returns a middleware that runs the handlers once for concurrent identical GET requests,
+// and writes the rendered response to all the requests waiting on it, if keyFn is nil, DefaultCoalesceKey is used.
+// Responses setting cookies, streamed responses (flushed or text/event-stream) and bodies bigger than
+// DefaultCacheMaxBodySize aren't shared, the waiting requests are released as soon as that is known and run their own handlers instead.
+// Like ResponseCache, if used with Gzip, Gzip must come first in the chain.
+func Coalesce(keyFn CacheKeyFunc) Handler {
+	if keyFn == nil {
+		keyFn = DefaultCoalesceKey
+	}
+
+	var (
+		mux   sync.Mutex
+		calls = map[string]*flightCall{}
+	)
+
+	return func(ctx *Context) Response {
+		if ctx.Req.Method != http.MethodGet {
+			return nil
+		}
+
+		key := keyFn(ctx)
+		if key == "" {
+			return nil
+		}
+
+		mux.Lock()
+		if c := calls[key]; c != nil {
+			mux.Unlock()
+
+			select {
+			case <-c.done:
+			case <-ctx.Req.Context().Done():
+				return Break
+			}
+
+			if c.cr == nil { // the leader's response couldn't be shared
+				return nil
+			}
+
+			ctx.Header().Set(CoalescedHeader, "true")
+			c.cr.writeToCtx(ctx)
+			return Break
+		}
+
+		c := &flightCall{done: make(chan struct{})}
+		calls[key] = c
+		mux.Unlock()
+
+		var once sync.Once
+		release := func() {
+			once.Do(func() {
+				mux.Lock()
+				delete(calls, key)
+				mux.Unlock()
+				close(c.done)
+			})
+		}
+		defer release()
+
+		orig := ctx.ResponseWriter
+		crw := &cacheRW{ResponseWriter: orig, max: DefaultCacheMaxBodySize, onSkip: release}
+		ctx.ResponseWriter = crw
+
+		ctx.Next()
+
+		if ctx.ResponseWriter != crw {
+			ctx.ResponseWriter = orig
+			return nil
+		}
+
+		ctx.ResponseWriter = orig
+
+		if _, ok := ctx.Header()["Set-Cookie"]; ok || crw.code == 0 || crw.skip {
+			return nil
+		}
+
+		c.cr = newCachedResponse(ctx.Header(), crw)
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package apiserv
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Codec marshals and unmarshals request and response bodies, see SetJSONCodec.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Encoder is a streaming encoder returned by Codec.NewEncoder.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// IndentEncoder is an Encoder that supports indentation, indented responses are only indented
+// if the codec's encoder implements it.
+type IndentEncoder interface {
+	Encoder
+	SetIndent(prefix, indent string)
+}
+
+// Decoder is a streaming decoder returned by Codec.NewDecoder.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// StdJSON is the default encoding/json based codec.
+var StdJSON Codec = stdJSON{}
+
+type stdJSON struct{}
+
+func (stdJSON) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdJSON) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (stdJSON) NewEncoder(w io.Writer) Encoder             { return json.NewEncoder(w) }
+func (stdJSON) NewDecoder(r io.Reader) Decoder             { return json.NewDecoder(r) }
+
+var (
+	jsonCodecsMux sync.RWMutex
+	jsonCodecs    = map[string]Codec{"std": StdJSON}
+)
+
+// RegisterJSONCodec registers a named json codec, so it can be selected at runtime with LookupJSONCodec.
+// The optional sonic (-tags sonic) and go-json (-tags gojson) codecs register themselves as "sonic" and "gojson".
+func RegisterJSONCodec(name string, c Codec) {
+	jsonCodecsMux.Lock()
+	jsonCodecs[name] = c
+	jsonCodecsMux.Unlock()
+}
+
+// LookupJSONCodec returns the json codec registered as name or nil.
+// example: apiserv.New(apiserv.SetJSONCodec(apiserv.LookupJSONCodec(cfg.JSON)))
+func LookupJSONCodec(name string) Codec {
+	jsonCodecsMux.RLock()
+	c := jsonCodecs[name]
+	jsonCodecsMux.RUnlock()
+	return c
+}
+
+func (ctx *Context) jsonCodec() Codec {
+	if ctx.s != nil && ctx.s.opts.JSONCodec != nil {
+		return ctx.s.opts.JSONCodec
+	}
+	return StdJSON
+}
@@ -0,0 +1,24 @@
+//go:build gojson
+// +build gojson
+
+package apiserv
+
+import (
+	"io"
+
+	gojson "github.com/goccy/go-json"
+)
+
+// GoJSON is a codec using github.com/goccy/go-json, only available when building with `-tags gojson`.
+var GoJSON Codec = goJSON{}
+
+func init() {
+	RegisterJSONCodec("gojson", GoJSON)
+}
+
+type goJSON struct{}
+
+func (goJSON) Marshal(v interface{}) ([]byte, error)      { return gojson.Marshal(v) }
+func (goJSON) Unmarshal(data []byte, v interface{}) error { return gojson.Unmarshal(data, v) }
+func (goJSON) NewEncoder(w io.Writer) Encoder             { return gojson.NewEncoder(w) }
+func (goJSON) NewDecoder(r io.Reader) Decoder             { return gojson.NewDecoder(r) }
@@ -0,0 +1,26 @@
+//go:build sonic && amd64
+// +build sonic,amd64
+
+package apiserv
+
+import (
+	"io"
+
+	"github.com/bytedance/sonic"
+)
+
+// SonicJSON is a codec using github.com/bytedance/sonic, only available when building with `-tags sonic` on amd64.
+var SonicJSON Codec = sonicJSON{sonic.ConfigStd}
+
+func init() {
+	RegisterJSONCodec("sonic", SonicJSON)
+}
+
+type sonicJSON struct {
+	api sonic.API
+}
+
+func (c sonicJSON) Marshal(v interface{}) ([]byte, error)      { return c.api.Marshal(v) }
+func (c sonicJSON) Unmarshal(data []byte, v interface{}) error { return c.api.Unmarshal(data, v) }
+func (c sonicJSON) NewEncoder(w io.Writer) Encoder             { return c.api.NewEncoder(w) }
+func (c sonicJSON) NewDecoder(r io.Reader) Decoder             { return c.api.NewDecoder(r) }
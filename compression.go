@@ -2,6 +2,8 @@ package apiserv
 
 import (
 	"compress/gzip"
+	"compress/zlib"
+	"io"
 	"mime"
 	"net/http"
 	"os"
@@ -18,7 +20,13 @@ const (
 	gzEnc = "gzip"
 )
 
+// EnableGzip compresses the response with the specific level, unless it was disabled with DisableGzip.
+// The decision is made once the headers are written, responses that already have a Content-Encoding
+// or an already compressed Content-Type (see GzipSkipContentTypes) are passed through as is.
 func (ctx *Context) EnableGzip(level int) {
+	if ctx.noGzip {
+		return
+	}
 	if _, ok := ctx.ResponseWriter.(*gzRW); ok {
 		return
 	}
@@ -26,9 +34,27 @@ func (ctx *Context) EnableGzip(level int) {
 	g.init(ctx)
 }
 
+// DisableGzip disables compression for the rest of the request, it has no effect if the headers were already written.
+func (ctx *Context) DisableGzip() {
+	ctx.noGzip = true
+	if g, ok := ctx.ResponseWriter.(*gzRW); ok && g.state == gzPending {
+		g.state = gzPassthrough
+	}
+}
+
+// NoGzip is a middleware that disables compression for a route or a group, for example:
+//
+//	s.Use(apiserv.Gzip(6))
+//	files := s.Group("files", "/files", apiserv.NoGzip)
+func NoGzip(ctx *Context) Response {
+	ctx.DisableGzip()
+	return nil
+}
+
 // TryCompressed will try serving compressed files if they exist on the disk or use on the fly gzip.
 func TryCompressed(ctx *Context, fname string) error {
 	gz, br := accepts(ctx.ReqHeader().Get(acceptHeader))
+	addVary(ctx.Header(), acceptHeader)
 	ctx.SetContentType(mime.TypeByExtension(filepath.Ext(fname)))
 
 	if br {
@@ -66,16 +92,81 @@ func fileExists(fn string) bool {
 	return err == nil && !fi.IsDir() && fi.Mode().IsRegular()
 }
 
+// GzipSkipContentTypes are the already compressed content types that Gzip passes through,
+// a trailing / matches the whole type, except for image/svg+xml.
+var GzipSkipContentTypes = []string{
+	"image/", "video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2", "application/x-xz",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/zstd",
+}
+
+// GzipOptions are the options for GzipWithOptions.
+type GzipOptions struct {
+	Level int
+
+	// ExcludePaths are path prefixes that are never compressed.
+	ExcludePaths []string
+
+	// ExcludeContentTypes are checked along with GzipSkipContentTypes.
+	ExcludeContentTypes []string
+}
+
+// Gzip returns a middleware that compresses responses with the specific level if the client accepts gzip.
 func Gzip(level int) Handler {
+	return GzipWithOptions(GzipOptions{Level: level})
+}
+
+// GzipWithOptions is like Gzip with per-path and per-content-type exclusions.
+func GzipWithOptions(opts GzipOptions) Handler {
 	return func(ctx *Context) Response {
-		if strings.Contains(ctx.ReqHeader().Get(acceptHeader), "gzip") {
-			ctx.EnableGzip(level)
+		for _, p := range opts.ExcludePaths {
+			if strings.HasPrefix(ctx.Path(), p) {
+				return nil
+			}
+		}
+
+		// set even if the client doesn't accept gzip so shared caches don't serve it a compressed body
+		addVary(ctx.Header(), acceptHeader)
+
+		if !strings.Contains(ctx.ReqHeader().Get(acceptHeader), "gzip") {
+			return nil
+		}
+
+		ctx.EnableGzip(opts.Level)
+		if g, ok := ctx.ResponseWriter.(*gzRW); ok && g.state == gzPending {
+			g.skip = opts.ExcludeContentTypes
 		}
 
 		return nil
 	}
 }
 
+// skipContentType returns true if ct is already compressed or matches one of the extra types.
+func skipContentType(ct string, extra []string) bool {
+	if ct == "" {
+		return false
+	}
+
+	if i := strings.IndexByte(ct, ';'); i != -1 {
+		ct = ct[:i]
+	}
+	ct = strings.ToLower(strings.TrimSpace(ct))
+
+	if ct == "image/svg+xml" {
+		return false
+	}
+
+	for _, l := range [...][]string{GzipSkipContentTypes, extra} {
+		for _, t := range l {
+			if strings.HasSuffix(t, "/") && strings.HasPrefix(ct, t) || ct == t {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 var (
 	gzpools [gzip.BestCompression + 1]sync.Pool
 	gzonce  sync.Once
@@ -108,26 +199,75 @@ func newGzipRW(level int) *gzRW {
 	}
 }
 
+const (
+	gzPending uint8 = iota
+	gzCompress
+	gzPassthrough
+)
+
 type gzRW struct {
 	http.ResponseWriter
 	gw    *gzip.Writer
 	level int
+
+	// skip are extra content types that shouldn't be compressed.
+	skip []string
+
+	// state is gzPending until the headers are written.
+	state uint8
+
+	// hijacked is set by ctx.Hijack, the connection can't be written to anymore.
+	hijacked bool
 }
 
 func (g *gzRW) init(ctx *Context) {
 	g.ResponseWriter = ctx.ResponseWriter
 	g.gw.Reset(g.ResponseWriter)
-
-	ctx.Header().Set(encodingHeader, gzEnc)
 	ctx.ResponseWriter = g
 }
 
+// decide picks whether to compress the response based on the headers the handler set.
+func (g *gzRW) decide(code int) {
+	if g.state != gzPending {
+		return
+	}
+
+	h := g.ResponseWriter.Header()
+	if code == http.StatusNoContent || code == http.StatusNotModified ||
+		h.Get(encodingHeader) != "" || skipContentType(h.Get("Content-Type"), g.skip) {
+		g.state = gzPassthrough
+		return
+	}
+
+	g.state = gzCompress
+	addVary(h, acceptHeader)
+	h.Set(encodingHeader, gzEnc)
+	h.Del("Content-Length")
+}
+
+func (g *gzRW) WriteHeader(code int) {
+	if code >= http.StatusOK { // informational responses don't decide anything
+		g.decide(code)
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
 func (g *gzRW) Write(p []byte) (int, error) {
+	g.decide(http.StatusOK)
+	if g.state == gzPassthrough {
+		return g.ResponseWriter.Write(p)
+	}
 	return g.gw.Write(p)
 }
 
+// Unwrap returns the writer the compressed data is written to.
+func (g *gzRW) Unwrap() http.ResponseWriter { return g.ResponseWriter }
+
 func (g *gzRW) Flush() {
-	g.gw.Flush()
+	g.decide(http.StatusOK)
+	if g.state == gzCompress {
+		g.gw.Flush()
+	}
 
 	if hf, ok := g.ResponseWriter.(http.Flusher); ok {
 		hf.Flush()
@@ -135,11 +275,80 @@ func (g *gzRW) Flush() {
 }
 
 func (g *gzRW) Reset() {
-	g.gw.Close()
-	if hf, ok := g.ResponseWriter.(http.Flusher); ok {
-		hf.Flush()
+	if !g.hijacked && g.state == gzCompress {
+		g.gw.Close()
+		if hf, ok := g.ResponseWriter.(http.Flusher); ok {
+			hf.Flush()
+		}
 	}
 	g.gw.Reset(nil)
-	g.ResponseWriter = nil
+	g.ResponseWriter, g.hijacked = nil, false
+	g.skip, g.state = nil, gzPending
 	gzpools[g.level].Put(g)
 }
+
+// Decompressor returns a reader that decompresses r.
+type Decompressor = func(r io.Reader) (io.ReadCloser, error)
+
+var decompressors = map[string]Decompressor{
+	gzEnc:     func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	"deflate": func(r io.Reader) (io.ReadCloser, error) { return zlib.NewReader(r) },
+}
+
+// RegisterDecompressor adds support for a request Content-Encoding to DecompressBody, for example brotli:
+//
+//	RegisterDecompressor("br", func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(brotli.NewReader(r)), nil })
+//
+// It is NOT safe to call this once you call one of the run functions.
+func RegisterDecompressor(encoding string, fn Decompressor) {
+	decompressors[strings.ToLower(encoding)] = fn
+}
+
+// DecompressBody is a middleware that transparently decompresses request bodies sent with
+// Content-Encoding gzip or deflate (and any encoding added with RegisterDecompressor).
+// If maxSize is > 0, reading more than maxSize decompressed bytes returns an error.
+// Unsupported encodings are rejected with a 415.
+func DecompressBody(maxSize int64) Handler {
+	return func(ctx *Context) Response {
+		req := ctx.Req
+		enc := strings.ToLower(strings.TrimSpace(req.Header.Get(encodingHeader)))
+		if enc == "" || enc == "identity" || req.Body == nil || req.Body == http.NoBody {
+			return nil
+		}
+
+		fn := decompressors[enc]
+		if fn == nil {
+			return NewJSONErrorResponse(http.StatusUnsupportedMediaType, "unsupported content-encoding: "+enc)
+		}
+
+		dr, err := fn(req.Body)
+		if err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+
+		var body io.ReadCloser = &decompressedBody{ReadCloser: dr, orig: req.Body}
+		if maxSize > 0 {
+			body = http.MaxBytesReader(ctx.ResponseWriter, body, maxSize)
+		}
+
+		req.Body = body
+		req.ContentLength = -1
+		req.Header.Del(encodingHeader)
+		req.Header.Del("Content-Length")
+
+		return nil
+	}
+}
+
+type decompressedBody struct {
+	io.ReadCloser
+	orig io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if oerr := b.orig.Close(); err == nil {
+		err = oerr
+	}
+	return err
+}
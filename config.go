@@ -0,0 +1,258 @@
+package apiserv
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/missionMeteora/apiserv/router"
+)
+
+// Config is a file friendly version of Options, plus the listening addresses, see LoadOptions.
+type Config struct {
+	// Addr is used by RunConfig for plain http, defaults to ":http" if there's nothing else to run.
+	Addr string `json:"addr,omitempty" yaml:"addr,omitempty"`
+
+	// TLSAddr is used by RunConfig for https with CertPairs, defaults to ":https".
+	TLSAddr   string     `json:"tlsAddr,omitempty" yaml:"tlsAddr,omitempty"`
+	CertPairs []CertPair `json:"certPairs,omitempty" yaml:"certPairs,omitempty"`
+
+	// AutoCert enables LetsEncrypt if not nil, it listens on :80 and :443 unless its addresses are set.
+	AutoCert *AutoCertConfig `json:"autoCert,omitempty" yaml:"autoCert,omitempty"`
+
+	ReadTimeout     Duration `json:"readTimeout,omitempty" yaml:"readTimeout,omitempty"`
+	WriteTimeout    Duration `json:"writeTimeout,omitempty" yaml:"writeTimeout,omitempty"`
+	KeepAlivePeriod Duration `json:"keepAlivePeriod,omitempty" yaml:"keepAlivePeriod,omitempty"`
+	MaxHeaderBytes  int      `json:"maxHeaderBytes,omitempty" yaml:"maxHeaderBytes,omitempty"`
+
+	// TLSMinVersion is one of "1.0", "1.1", "1.2" or "1.3".
+	TLSMinVersion string `json:"tlsMinVersion,omitempty" yaml:"tlsMinVersion,omitempty"`
+
+	// LogLevel is one of debug, info, warn, error or off.
+	LogLevel string `json:"logLevel,omitempty" yaml:"logLevel,omitempty"`
+
+	// Gzip enables the Gzip middleware on the whole server with the specific level if > 0.
+	Gzip int `json:"gzip,omitempty" yaml:"gzip,omitempty"`
+
+	Router *router.Options `json:"router,omitempty" yaml:"router,omitempty"`
+}
+
+// AutoCertConfig is the autocert section of Config.
+type AutoCertConfig struct {
+	CacheDir string   `json:"cacheDir,omitempty" yaml:"cacheDir,omitempty"`
+	Hosts    []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+
+	// HTTPAddr and TLSAddr override the default :80 and :443, see Options.AutoCertHTTPAddr.
+	HTTPAddr string `json:"httpAddr,omitempty" yaml:"httpAddr,omitempty"`
+	TLSAddr  string `json:"tlsAddr,omitempty" yaml:"tlsAddr,omitempty"`
+}
+
+// ConfigDecoder decodes a config file's data into v, yaml.Unmarshal from either gopkg.in/yaml.v2 or v3 works.
+type ConfigDecoder = func(data []byte, v interface{}) error
+
+var (
+	configDecodersMux sync.RWMutex
+	configDecoders    = map[string]ConfigDecoder{".json": json.Unmarshal}
+)
+
+// RegisterConfigDecoder registers a decoder for config files with the specific extension,
+// json is supported out of the box, for yaml:
+//
+//	apiserv.RegisterConfigDecoder(".yaml", yaml.Unmarshal)
+//	apiserv.RegisterConfigDecoder(".yml", yaml.Unmarshal)
+func RegisterConfigDecoder(ext string, fn ConfigDecoder) {
+	configDecodersMux.Lock()
+	configDecoders[strings.ToLower(ext)] = fn
+	configDecodersMux.Unlock()
+}
+
+// LoadOptions loads the config file at path, the format is picked based on the file's extension.
+func LoadOptions(path string) (*Config, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	configDecodersMux.RLock()
+	dec := configDecoders[ext]
+	configDecodersMux.RUnlock()
+
+	if dec == nil {
+		return nil, fmt.Errorf("apiserv: no config decoder registered for %q (%s)", ext, path)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if err = dec(b, &c); err != nil {
+		return nil, fmt.Errorf("apiserv: %s: %v", path, err)
+	}
+
+	if _, err = c.Options(); err != nil {
+		return nil, fmt.Errorf("apiserv: %s: %v", path, err)
+	}
+
+	return &c, nil
+}
+
+// Options returns the Options set in the config, only non-zero values are returned so they can be applied on top of DefaultOpts.
+func (c *Config) Options() (opts []Option, err error) {
+	if c.ReadTimeout > 0 {
+		opts = append(opts, ReadTimeout(time.Duration(c.ReadTimeout)))
+	}
+
+	if c.WriteTimeout > 0 {
+		opts = append(opts, WriteTimeout(time.Duration(c.WriteTimeout)))
+	}
+
+	if c.KeepAlivePeriod != 0 {
+		opts = append(opts, SetKeepAlivePeriod(time.Duration(c.KeepAlivePeriod)))
+	}
+
+	if c.MaxHeaderBytes > 0 {
+		opts = append(opts, MaxHeaderBytes(c.MaxHeaderBytes))
+	}
+
+	if c.TLSMinVersion != "" {
+		v, ok := tlsVersions[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid tlsMinVersion: %q", c.TLSMinVersion)
+		}
+		opts = append(opts, SetTLSMinVersion(v))
+	}
+
+	if ac := c.AutoCert; ac != nil && (ac.HTTPAddr != "" || ac.TLSAddr != "") {
+		opts = append(opts, SetAutoCertAddrs(ac.HTTPAddr, ac.TLSAddr))
+	}
+
+	if c.LogLevel != "" {
+		if _, err = ParseLogLevel(c.LogLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Router != nil {
+		ro := *c.Router
+		opts = append(opts, SetRouterOptions(&ro))
+	}
+
+	return opts, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// FromConfig returns a new server using c's options, extra opts are applied after them.
+func FromConfig(c *Config, opts ...Option) (*Server, error) {
+	copts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	s := New(append(copts, opts...)...)
+
+	if c.LogLevel != "" {
+		l, _ := ParseLogLevel(c.LogLevel)
+		s.SetLogLevel(l)
+	}
+
+	if c.Gzip > 0 {
+		s.Use(Gzip(c.Gzip))
+	}
+
+	return s, nil
+}
+
+// RunConfig starts the listeners set in c and blocks until one of them returns an error.
+// Autocert takes priority over CertPairs, and Addr is only used for plain http if set or there's nothing else to run.
+func (s *Server) RunConfig(c *Config) error {
+	ch := make(chan error, 2)
+	n := 0
+
+	run := func(fn func() error) {
+		n++
+		go func() { ch <- fn() }()
+	}
+
+	switch {
+	case c.AutoCert != nil && len(c.CertPairs) > 0:
+		run(func() error {
+			return s.RunTLSAndAuto(c.AutoCert.CacheDir, c.CertPairs, NewAutoCertHosts(c.AutoCert.Hosts...))
+		})
+	case c.AutoCert != nil:
+		run(func() error { return s.RunAutoCert(c.AutoCert.CacheDir, c.AutoCert.Hosts...) })
+	case len(c.CertPairs) > 0:
+		run(func() error { return s.RunTLS(c.TLSAddr, c.CertPairs) })
+	}
+
+	if c.Addr != "" || n == 0 {
+		run(func() error { return s.Run(c.Addr) })
+	}
+
+	return <-ch
+}
+
+// Duration is a time.Duration that can be decoded from strings like "1m30s" or a number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		return d.UnmarshalText([]byte(s))
+	}
+
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return err
+	}
+	*d = Duration(secs * float64(time.Second))
+	return nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.v2 Unmarshaler interface, which yaml.v3 supports as well.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case string:
+		return d.UnmarshalText([]byte(v))
+	case int:
+		*d = Duration(time.Duration(v) * time.Second)
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration: %v", v)
+	}
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
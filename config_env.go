@@ -0,0 +1,171 @@
+package apiserv
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEnvPrefix is the default prefix used by Config.LoadEnv and EnvOptions.
+const DefaultEnvPrefix = "APISERV_"
+
+// LoadEnv overrides c's fields with the environment variables starting with prefix (defaults to DefaultEnvPrefix):
+//
+//	ADDR, PORT (shorthand for ADDR=:$PORT), TLS_ADDR
+//	READ_TIMEOUT, WRITE_TIMEOUT, KEEPALIVE_PERIOD  (durations like "30s", or a number of seconds)
+//	MAX_HEADER_BYTES, GZIP
+//	TLS_CERT_FILE, TLS_KEY_FILE (appended to CertPairs), TLS_MIN_VERSION
+//	AUTOCERT_DIR, AUTOCERT_HOSTS (comma separated), AUTOCERT_HTTP_ADDR, AUTOCERT_TLS_ADDR
+//	LOG_LEVEL
+//
+// All the invalid values are returned as a MultiError.
+func (c *Config) LoadEnv(prefix string) error {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+
+	var me MultiError
+
+	env := func(k string) (string, string, bool) {
+		k = prefix + k
+		v, ok := os.LookupEnv(k)
+		return k, strings.TrimSpace(v), ok && strings.TrimSpace(v) != ""
+	}
+
+	str := func(k string, dst *string) {
+		if _, v, ok := env(k); ok {
+			*dst = v
+		}
+	}
+
+	num := func(k string, dst *int) {
+		if k, v, ok := env(k); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				me.Push(fmt.Errorf("%s: invalid number: %q", k, v))
+				return
+			}
+			*dst = n
+		}
+	}
+
+	dur := func(k string, dst *Duration) {
+		if k, v, ok := env(k); ok {
+			d, err := parseEnvDuration(v)
+			if err != nil {
+				me.Push(fmt.Errorf("%s: %v", k, err))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("ADDR", &c.Addr)
+	if k, v, ok := env("PORT"); ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+			me.Push(fmt.Errorf("%s: invalid port: %q", k, v))
+		} else {
+			c.Addr = ":" + v
+		}
+	}
+	str("TLS_ADDR", &c.TLSAddr)
+
+	dur("READ_TIMEOUT", &c.ReadTimeout)
+	dur("WRITE_TIMEOUT", &c.WriteTimeout)
+	dur("KEEPALIVE_PERIOD", &c.KeepAlivePeriod)
+
+	num("MAX_HEADER_BYTES", &c.MaxHeaderBytes)
+	num("GZIP", &c.Gzip)
+
+	str("TLS_MIN_VERSION", &c.TLSMinVersion)
+	if c.TLSMinVersion != "" {
+		if _, ok := tlsVersions[c.TLSMinVersion]; !ok {
+			me.Push(fmt.Errorf("%sTLS_MIN_VERSION: invalid version: %q", prefix, c.TLSMinVersion))
+		}
+	}
+
+	var cp CertPair
+	str("TLS_CERT_FILE", &cp.CertFile)
+	str("TLS_KEY_FILE", &cp.KeyFile)
+	switch {
+	case cp.CertFile != "" && cp.KeyFile != "":
+		c.CertPairs = append(c.CertPairs, cp)
+	case cp.CertFile != "" || cp.KeyFile != "":
+		me.Push(fmt.Errorf("%sTLS_CERT_FILE and %sTLS_KEY_FILE must be both set", prefix, prefix))
+	}
+
+	if _, v, ok := env("AUTOCERT_DIR"); ok {
+		if c.AutoCert == nil {
+			c.AutoCert = &AutoCertConfig{}
+		}
+		c.AutoCert.CacheDir = v
+	}
+
+	if _, v, ok := env("AUTOCERT_HOSTS"); ok {
+		if c.AutoCert == nil {
+			c.AutoCert = &AutoCertConfig{}
+		}
+		c.AutoCert.Hosts = c.AutoCert.Hosts[:0]
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				c.AutoCert.Hosts = append(c.AutoCert.Hosts, h)
+			}
+		}
+	}
+
+	for k, fn := range map[string]func(ac *AutoCertConfig) *string{
+		"AUTOCERT_HTTP_ADDR": func(ac *AutoCertConfig) *string { return &ac.HTTPAddr },
+		"AUTOCERT_TLS_ADDR":  func(ac *AutoCertConfig) *string { return &ac.TLSAddr },
+	} {
+		if _, v, ok := env(k); ok {
+			if c.AutoCert == nil {
+				c.AutoCert = &AutoCertConfig{}
+			}
+			*fn(c.AutoCert) = v
+		}
+	}
+
+	str("LOG_LEVEL", &c.LogLevel)
+	if c.LogLevel != "" {
+		if _, err := ParseLogLevel(c.LogLevel); err != nil {
+			me.Push(fmt.Errorf("%sLOG_LEVEL: %v", prefix, err))
+		}
+	}
+
+	return me.Err()
+}
+
+// EnvOptions returns an Option that applies the timeouts, MaxHeaderBytes and TLS version set in the environment,
+// see Config.LoadEnv for the variable names.
+// Addresses and cert files aren't part of Options, use Config.LoadEnv with RunConfig for them.
+func EnvOptions(prefix string) (Option, error) {
+	var c Config
+	if err := c.LoadEnv(prefix); err != nil {
+		return nil, err
+	}
+
+	opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	return optionSetter(func(opt *Options) {
+		for _, o := range opts {
+			o.apply(opt)
+		}
+	}), nil
+}
+
+func parseEnvDuration(v string) (Duration, error) {
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return Duration(secs * float64(time.Second)), nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %q", v)
+	}
+	return Duration(d), nil
+}
@@ -0,0 +1,102 @@
+package apiserv
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnStats are the connection counters of a single listener, see Server.ConnStats.
+type ConnStats struct {
+	Addr string `json:"addr"`
+
+	// Accepted, Hijacked and Closed are totals since the listener started.
+	Accepted int64 `json:"accepted"`
+	Hijacked int64 `json:"hijacked"`
+	Closed   int64 `json:"closed"`
+
+	// Open is the number of currently open connections, Active ones are serving a request and Idle ones are waiting for one.
+	Open   int64 `json:"open"`
+	Active int64 `json:"active"`
+	Idle   int64 `json:"idle"`
+}
+
+type connCounters struct {
+	addr string
+
+	accepted, hijacked, closed int64
+	open, active, idle         int64
+
+	states sync.Map // net.Conn -> http.ConnState
+}
+
+// track is used as the http.Server.ConnState hook.
+func (cc *connCounters) track(c net.Conn, state http.ConnState) {
+	if prev, ok := cc.states.Load(c); ok {
+		switch prev.(http.ConnState) {
+		case http.StateActive:
+			atomic.AddInt64(&cc.active, -1)
+		case http.StateIdle:
+			atomic.AddInt64(&cc.idle, -1)
+		}
+	}
+
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&cc.accepted, 1)
+		atomic.AddInt64(&cc.open, 1)
+	case http.StateActive:
+		atomic.AddInt64(&cc.active, 1)
+	case http.StateIdle:
+		atomic.AddInt64(&cc.idle, 1)
+	case http.StateHijacked, http.StateClosed:
+		if state == http.StateHijacked {
+			atomic.AddInt64(&cc.hijacked, 1)
+		} else {
+			atomic.AddInt64(&cc.closed, 1)
+		}
+
+		if _, ok := cc.states.LoadAndDelete(c); ok {
+			atomic.AddInt64(&cc.open, -1)
+		}
+		return
+	}
+
+	cc.states.Store(c, state)
+}
+
+func (cc *connCounters) stats() ConnStats {
+	return ConnStats{
+		Addr:     cc.addr,
+		Accepted: atomic.LoadInt64(&cc.accepted),
+		Hijacked: atomic.LoadInt64(&cc.hijacked),
+		Closed:   atomic.LoadInt64(&cc.closed),
+		Open:     atomic.LoadInt64(&cc.open),
+		Active:   atomic.LoadInt64(&cc.active),
+		Idle:     atomic.LoadInt64(&cc.idle),
+	}
+}
+
+// newConnCounters returns the counters for a new http.Server listening on addr.
+func (s *Server) newConnCounters(addr string) *connCounters {
+	cc := &connCounters{addr: addr}
+
+	s.serversMux.Lock()
+	s.conns = append(s.conns, cc)
+	s.serversMux.Unlock()
+
+	return cc
+}
+
+// ConnStats returns the connection counters of every listener the server started, including closed ones.
+func (s *Server) ConnStats() []ConnStats {
+	s.serversMux.Lock()
+	defer s.serversMux.Unlock()
+
+	out := make([]ConnStats, len(s.conns))
+	for i, cc := range s.conns {
+		out[i] = cc.stats()
+	}
+	return out
+}
@@ -1,7 +1,6 @@
 package apiserv
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +30,9 @@ var (
 
 	// ErrEmptyData is returned when the data payload is empty
 	ErrEmptyData = errors.New("empty data")
+
+	// ErrCookiePrefix is returned from ctx.SetCookie when a __Host- cookie is set with a domain.
+	ErrCookiePrefix = errors.New("__Host- cookies can't have a domain")
 )
 
 // Context is the default context passed to handlers
@@ -40,11 +43,28 @@ type Context struct {
 	Req                *http.Request
 	data               M
 	s                  *Server
+	meta               *RouteMeta
 	next               func() Response
+	route              string
+	writeErr           error
+	onFinish           []FinishFunc
 	Params             router.Params
+	written            int64
 	status             int
 	hijackServeContent bool
 	done               bool
+	aborted            bool
+	noGzip             bool
+}
+
+// RouteMeta returns the metadata attached to the current route or nil.
+func (ctx *Context) RouteMeta() *RouteMeta {
+	return ctx.meta
+}
+
+// RoutePath returns the path pattern of the current route, ex: "/users/:id".
+func (ctx *Context) RoutePath() string {
+	return ctx.route
 }
 
 // Param is a shorthand for ctx.Params.Get(name).
@@ -52,6 +72,41 @@ func (ctx *Context) Param(key string) string {
 	return ctx.Params.Get(key)
 }
 
+// ParamInt is a shorthand for ctx.Params.Int(key), the error is a *router.ParamError.
+func (ctx *Context) ParamInt(key string) (int, error) {
+	return ctx.Params.Int(key)
+}
+
+// ParamInt64 is a shorthand for ctx.Params.Int64(key).
+func (ctx *Context) ParamInt64(key string) (int64, error) {
+	return ctx.Params.Int64(key)
+}
+
+// ParamUint is a shorthand for ctx.Params.Uint(key).
+func (ctx *Context) ParamUint(key string) (uint, error) {
+	return ctx.Params.Uint(key)
+}
+
+// ParamUint64 is a shorthand for ctx.Params.Uint64(key).
+func (ctx *Context) ParamUint64(key string) (uint64, error) {
+	return ctx.Params.Uint64(key)
+}
+
+// ParamBool is a shorthand for ctx.Params.Bool(key).
+func (ctx *Context) ParamBool(key string) (bool, error) {
+	return ctx.Params.Bool(key)
+}
+
+// ParamUUID is a shorthand for ctx.Params.UUID(key).
+func (ctx *Context) ParamUUID(key string) ([16]byte, error) {
+	return ctx.Params.UUID(key)
+}
+
+// ParamTime is a shorthand for ctx.Params.Time(key, layout).
+func (ctx *Context) ParamTime(key, layout string) (time.Time, error) {
+	return ctx.Params.Time(key, layout)
+}
+
 // Query is a shorthand for ctx.Req.URL.Query().Get(key).
 func (ctx *Context) Query(key string) string {
 	return ctx.Req.URL.Query().Get(key)
@@ -65,13 +120,20 @@ func (ctx *Context) QueryDefault(key, def string) string {
 	return def
 }
 
-// Get returns a context value
+// Get returns a context value, with Options.RequestContextValues it falls back to values
+// set on the same request by an outer server.
 func (ctx *Context) Get(key string) interface{} {
-	return ctx.data[key]
+	if v, ok := ctx.data[key]; ok || ctx.s == nil || !ctx.s.opts.RequestContextValues {
+		return v
+	}
+	return ContextValue(ctx.Req.Context(), key)
 }
 
 // Set sets a context value, useful in passing data to other handlers down the chain
 func (ctx *Context) Set(key string, val interface{}) {
+	if ctx.data == nil { // most requests never set anything
+		ctx.data = M{}
+	}
 	ctx.data[key] = val
 }
 
@@ -93,6 +155,14 @@ func (ctx *Context) File(fp string) error {
 	return nil
 }
 
+// ServeContent serves rs using http.ServeContent, so in-memory or remote content gets the same Range, HEAD and
+// conditional requests handling as files, errors are written as JSONResponses.
+// name is used to detect the content-type if it isn't set, and modtime for Last-Modified if it isn't zero.
+func (ctx *Context) ServeContent(name string, modtime time.Time, rs io.ReadSeeker) {
+	ctx.hijackServeContent = true
+	http.ServeContent(ctx, ctx.Req, name, modtime, rs)
+}
+
 // Path is a shorthand for ctx.Req.URL.EscapedPath().
 func (ctx *Context) Path() string {
 	return ctx.Req.URL.EscapedPath()
@@ -132,7 +202,7 @@ func (ctx *Context) CloseBody() error {
 // BindJSON parses the request's body as json, and closes the body.
 // Note that unlike gin.Context.Bind, this does NOT verify the fields using special tags.
 func (ctx *Context) BindJSON(out interface{}) error {
-	err := json.NewDecoder(ctx).Decode(out)
+	err := ctx.jsonCodec().NewDecoder(ctx).Decode(out)
 	ctx.CloseBody()
 	return err
 }
@@ -189,24 +259,37 @@ func (ctx *Context) Printf(code int, contentType, s string, args ...interface{})
 
 // JSON outputs a json object, it is highly recommended to return *Response rather than use this directly.
 // calling this function marks the Context as done, meaning any returned responses won't be written out.
+// The object is encoded into a pooled buffer first, so encoding errors can be reported properly and
+// Content-Length can be set when the response isn't compressed.
 func (ctx *Context) JSON(code int, indent bool, v interface{}) error {
 	ctx.done = true
-	ctx.SetContentType(MimeJSON)
 
-	enc := json.NewEncoder(ctx)
+	jb := getJSONBuffer(indent)
+	defer putJSONBuffer(jb)
+
+	if err := jb.encoder(ctx.jsonCodec(), indent).Encode(v); err != nil {
+		ctx.s.Errorf("json error: %v", err)
+		if code > 0 && code != http.StatusInternalServerError {
+			return ctx.JSON(http.StatusInternalServerError, false, NewJSONErrorResponse(http.StatusInternalServerError, err))
+		}
+		return err
+	}
+
+	if ctx.autoETag(code, jb.Bytes()) {
+		return nil
+	}
+
+	ctx.SetContentType(MimeJSON)
 
-	if indent {
-		enc.SetIndent("", "\t")
+	if h := ctx.Header(); h.Get(encodingHeader) == "" {
+		h.Set("Content-Length", strconv.Itoa(jb.Len()))
 	}
 
 	if code > 0 {
 		ctx.WriteHeader(code)
 	}
 
-	err := enc.Encode(v)
-	if err != nil {
-		ctx.s.Logf("json error: %v", err)
-	}
+	_, err := ctx.Write(jb.Bytes())
 	return err
 }
 
@@ -230,6 +313,8 @@ func (ctx *Context) JSONP(code int, callbackKey string, v interface{}) (err erro
 }
 
 // ClientIP returns the current client ip, accounting for X-Real-Ip and X-forwarded-For headers as well.
+// The headers are trusted as-is, so don't use it for security decisions unless a proxy always overwrites them,
+// see RemoteIP and TrustedProxyIP.
 func (ctx *Context) ClientIP() string {
 	h := ctx.Req.Header
 
@@ -250,6 +335,11 @@ func (ctx *Context) ClientIP() string {
 		}
 	}
 
+	return ctx.RemoteIP()
+}
+
+// RemoteIP returns the ip of the connection the request came from, ignoring any proxy headers.
+func (ctx *Context) RemoteIP() string {
 	if ip, _, err := net.SplitHostPort(strings.TrimSpace(ctx.Req.RemoteAddr)); err == nil {
 		return ip
 	}
@@ -257,6 +347,73 @@ func (ctx *Context) ClientIP() string {
 	return ""
 }
 
+// TrustedProxyIP returns a func that resolves the client ip of requests coming from the proxies in cidrs
+// using the right-most X-Forwarded-For address that isn't one of them, other requests get their RemoteIP.
+// It panics if one of the cidrs is invalid, like SetInternalNets.
+// example: RateLimitOptions{Key: apiserv.TrustedProxyIP("10.0.0.0/8"), ...}
+func TrustedProxyIP(cidrs ...string) func(ctx *Context) string {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic("apiserv: TrustedProxyIP: " + err.Error())
+		}
+		nets = append(nets, n)
+	}
+
+	trusted := func(s string) bool {
+		ip := net.ParseIP(s)
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(ctx *Context) string {
+		ip := ctx.RemoteIP()
+		if !trusted(ip) {
+			return ip
+		}
+
+		hops := ctx.Req.Header.Values("X-Forwarded-For")
+		for i := len(hops) - 1; i >= 0; i-- {
+			parts := strings.Split(hops[i], ",")
+			for j := len(parts) - 1; j >= 0; j-- {
+				if ip = strings.TrimSpace(parts[j]); !trusted(ip) {
+					return ip
+				}
+			}
+		}
+
+		return ctx.RemoteIP()
+	}
+}
+
+const requestIDKey = ":RID:"
+
+// RequestIDHeader is the header used to read and write request ids.
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID returns the current request's id, using the X-Request-Id header if the client sent one,
+// otherwise it generates a new one.
+// The id is also set on the response headers.
+func (ctx *Context) RequestID() string {
+	if id, ok := ctx.Get(requestIDKey).(string); ok {
+		return id
+	}
+
+	id := ctx.Req.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+
+	ctx.Set(requestIDKey, id)
+	ctx.Header().Set(RequestIDHeader, id)
+	return id
+}
+
 // NextMiddleware is a middleware-only func to execute all the other middlewares in the group and return before the handlers.
 // will panic if called from a handler.
 func (ctx *Context) NextMiddleware() Response {
@@ -274,6 +431,27 @@ func (ctx *Context) NextHandler() Response {
 	return nil
 }
 
+// Abort stops the chain, no middleware or handlers run after the current one returns, even if it returns nil.
+func (ctx *Context) Abort() {
+	ctx.aborted = true
+	ctx.nextMW, ctx.next = nil, nil
+}
+
+// AbortWithResponse writes r immediately, then aborts the chain, see Abort.
+// It always returns Break, so it can be used as `return ctx.AbortWithResponse(apiserv.RespForbidden)`.
+func (ctx *Context) AbortWithResponse(r Response) Response {
+	if r != nil {
+		ctx.writeResponse(r)
+	}
+	ctx.Abort()
+	return Break
+}
+
+// IsAborted returns true if Abort or AbortWithResponse was called.
+func (ctx *Context) IsAborted() bool {
+	return ctx.aborted
+}
+
 // Next is a QoL function that calls NextMiddleware() then NextHandler() if NextMiddleware() didn't return a response.
 func (ctx *Context) Next() Response {
 	if r := ctx.NextMiddleware(); r != nil {
@@ -282,6 +460,19 @@ func (ctx *Context) Next() Response {
 	return ctx.NextHandler()
 }
 
+// writeResponse writes r if the context isn't done yet and calls the server's error hooks if it was an error.
+func (ctx *Context) writeResponse(r Response) {
+	if ctx.done || r == Break {
+		return
+	}
+
+	r.WriteToCtx(ctx)
+
+	if ctx.status >= http.StatusBadRequest {
+		ctx.s.callErrorHooks(ctx, r)
+	}
+}
+
 // WriteHeader and Write are to implement ResponseWriter and allows ghetto hijacking of http.ServeContent errors,
 // without them we'd end up with plain text errors, we wouldn't want that, would we?
 // WriteHeader implements http.ResponseWriter
@@ -303,7 +494,32 @@ func (ctx *Context) Write(p []byte) (int, error) {
 
 	ctx.done = true
 
-	return ctx.ResponseWriter.Write(p)
+	n, err := ctx.ResponseWriter.Write(p)
+	ctx.written += int64(n)
+	if err != nil && ctx.writeErr == nil {
+		ctx.writeErr = err
+	}
+	return n, err
+}
+
+// FinishFunc is called by ctx.OnFinish, bytes is the number of bytes written through the Context (before compression),
+// err is the first write error or the recovered panic.
+type FinishFunc = func(status int, bytes int64, err error)
+
+// OnFinish adds a func that gets called once the handler chain is done and the response was written,
+// including after panics, useful for per-request cleanup, audit logs and metrics.
+func (ctx *Context) OnFinish(fn FinishFunc) {
+	ctx.onFinish = append(ctx.onFinish, fn)
+}
+
+func (ctx *Context) finish(err error) {
+	if err == nil {
+		err = ctx.writeErr
+	}
+
+	for _, fn := range ctx.onFinish {
+		fn(ctx.Status(), ctx.written, err)
+	}
 }
 
 // Status returns last value written using WriteHeader.
@@ -345,8 +561,14 @@ func (ctx *Context) Done() bool { return ctx.done }
 // if forceSecure is true, it will set the Secure flag to true, otherwise it sets it based on the connection.
 // if duration == -1, it sets expires to 10 years in the past, if 0 it gets ignored (aka session-only cookie),
 // if duration > 0, the expiration date gets set to now() + duration.
+// Cookies using the __Secure- or __Host- prefixes are always Secure, and __Host- cookies return ErrCookiePrefix if domain is set.
 // Note that for more complex options, you can use http.SetCookie(ctx, &http.Cookie{...}).
 func (ctx *Context) SetCookie(name string, value interface{}, domain string, forceHTTPS bool, duration time.Duration) (err error) {
+	secure, host := cookiePrefix(name)
+	if host && domain != "" {
+		return ErrCookiePrefix
+	}
+
 	var encValue string
 	if sc := GetSecureCookie(ctx); sc != nil {
 		if encValue, err = sc.Encode(name, value); err != nil {
@@ -368,7 +590,7 @@ func (ctx *Context) SetCookie(name string, value interface{}, domain string, for
 		Value:    encValue,
 		Domain:   domain,
 		HttpOnly: true,
-		Secure:   forceHTTPS || ctx.Req.TLS != nil,
+		Secure:   secure || forceHTTPS || ctx.Req.TLS != nil,
 	}
 
 	switch duration {
@@ -386,15 +608,24 @@ func (ctx *Context) SetCookie(name string, value interface{}, domain string, for
 
 // RemoveCookie deletes the given cookie and sets its expires date in the past.
 func (ctx *Context) RemoveCookie(name string) {
+	secure, _ := cookiePrefix(name)
 	http.SetCookie(ctx, &http.Cookie{
 		Path:     "/",
 		Name:     name,
 		Value:    "::deleted::",
 		HttpOnly: true,
+		Secure:   secure, // browsers ignore prefixed cookies without it, even when deleting
 		Expires:  nukeCookieDate,
 	})
 }
 
+// cookiePrefix returns whether name requires the Secure flag, and whether it's a __Host- cookie,
+// which also requires Path=/ and no Domain, see https://datatracker.ietf.org/doc/html/draft-ietf-httpbis-rfc6265bis#section-4.1.3
+func cookiePrefix(name string) (secure, host bool) {
+	host = strings.HasPrefix(name, "__Host-")
+	return host || strings.HasPrefix(name, "__Secure-"), host
+}
+
 // GetCookie returns the given cookie's value.
 func (ctx *Context) GetCookie(name string) (out string, ok bool) {
 	c, err := ctx.Req.Cookie(name)
@@ -424,9 +655,7 @@ func (ctx *Context) GetCookieValue(name string, valDst interface{}) error {
 
 var ctxPool = sync.Pool{
 	New: func() interface{} {
-		return &Context{
-			data: M{},
-		}
+		return &Context{}
 	},
 }
 
@@ -436,6 +665,10 @@ func getCtx(rw http.ResponseWriter, req *http.Request, p router.Params, s *Serve
 	ctx.ResponseWriter, ctx.Req = rw, req
 	ctx.Params, ctx.s = p, s
 
+	if s.opts.RequestContextValues {
+		ctx.Req = withReqValues(req, &ctx.data)
+	}
+
 	return ctx
 }
 
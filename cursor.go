@@ -0,0 +1,87 @@
+package apiserv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/missionMeteora/apiserv/internal"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or its signature doesn't match.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// NewCursorSigner returns a signer for opaque pagination cursors, key should be at least 32 random bytes
+// and shared between all the instances of the service.
+func NewCursorSigner(key []byte) *CursorSigner {
+	return &CursorSigner{key: append([]byte(nil), key...)}
+}
+
+// CursorSigner encodes any json-able value (ex: an offset or the last seen sort keys) into a url-safe,
+// HMAC-SHA256 signed string, so clients can pass it back but can't forge or modify it.
+// Cursors are signed, not encrypted, don't put anything secret in them.
+type CursorSigner struct {
+	key []byte
+}
+
+// Encode returns the signed cursor for v.
+func (cs *CursorSigner) Encode(v interface{}) (string, error) {
+	j, err := internal.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	b := append(cs.sign(j), j...)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Decode verifies cursor and decodes its value into out, returns ErrInvalidCursor if it was tampered with.
+func (cs *CursorSigner) Decode(cursor string, out interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) < sha256.Size {
+		return ErrInvalidCursor
+	}
+
+	sig, j := b[:sha256.Size], b[sha256.Size:]
+	if !hmac.Equal(sig, cs.sign(j)) {
+		return ErrInvalidCursor
+	}
+
+	if err = internal.Unmarshal(j, out); err != nil {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+func (cs *CursorSigner) sign(b []byte) []byte {
+	h := hmac.New(sha256.New, cs.key)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// DecodeCursor decodes the request's cursor into out, it returns false if there was no cursor.
+func (p *Pagination) DecodeCursor(cs *CursorSigner, out interface{}) (bool, error) {
+	if p.Cursor == "" {
+		return false, nil
+	}
+	return true, cs.Decode(p.Cursor, out)
+}
+
+// CursorResponse returns a success response with a signed cursor for the next page, next is ignored if nil.
+// The response has a Link header with rel="next" pointing to the cursor.
+func (p *Pagination) CursorResponse(cs *CursorSigner, data, next interface{}) (*JSONResponse, error) {
+	r := NewJSONResponse(data)
+	r.PerPage = p.PerPage
+
+	if next != nil {
+		c, err := cs.Encode(next)
+		if err != nil {
+			return nil, err
+		}
+		r.NextCursor = c
+	}
+
+	return r, nil
+}
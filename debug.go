@@ -0,0 +1,71 @@
+package apiserv
+
+import (
+	"expvar"
+	"net/http/pprof"
+	"strings"
+)
+
+// EnableDebug mounts net/http/pprof, expvar and a route dump under prefix, behind the passed middleware.
+//
+//	prefix/pprof/ -> pprof index and profiles
+//	prefix/vars   -> expvar
+//	prefix/routes -> all the registered routes
+//
+// example: s.EnableDebug("/debug", auth.CheckAuth)
+func (s *Server) EnableDebug(prefix string, mw ...Handler) error {
+	g := s.Group("debug", prefix, mw...)
+
+	pp := pprofHandler(joinPath(prefix, "/pprof/"))
+	if err := g.GET("/pprof/*name", pp); err != nil {
+		return err
+	}
+
+	// needed for go tool pprof's symbol lookups
+	if err := g.POST("/pprof/*name", pp); err != nil {
+		return err
+	}
+
+	if err := g.GET("/vars", FromHTTPHandler(expvar.Handler())); err != nil {
+		return err
+	}
+
+	return g.GET("/routes", s.routeDump)
+}
+
+// EnableRouteDump serves all the registered routes (group, method, path, handler name and metadata) as json on path,
+// behind the passed middleware.
+// example: s.EnableRouteDump("/_routes", auth.CheckAuth)
+func (s *Server) EnableRouteDump(path string, mw ...Handler) error {
+	return s.Group("debug", "", mw...).GET(path, s.routeDump)
+}
+
+func (s *Server) routeDump(ctx *Context) Response {
+	return NewJSONResponse(s.RoutesInfo())
+}
+
+func pprofHandler(indexPath string) Handler {
+	return func(ctx *Context) Response {
+		name := ctx.Param("name")
+		switch name {
+		case "":
+			if !strings.HasSuffix(ctx.Req.URL.Path, "/") {
+				// the index uses relative links
+				return Redirect(indexPath, false)
+			}
+			pprof.Index(ctx, ctx.Req)
+		case "cmdline":
+			pprof.Cmdline(ctx, ctx.Req)
+		case "profile":
+			pprof.Profile(ctx, ctx.Req)
+		case "symbol":
+			pprof.Symbol(ctx, ctx.Req)
+		case "trace":
+			pprof.Trace(ctx, ctx.Req)
+		default:
+			pprof.Handler(name).ServeHTTP(ctx, ctx.Req)
+		}
+
+		return Break
+	}
+}
@@ -0,0 +1,55 @@
+package apiserv
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDrainTimeout is returned from Drain if there are still active requests after the timeout.
+var ErrDrainTimeout = errors.New("drain timeout")
+
+// InFlight returns the number of requests currently being handled.
+func (s *Server) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// Draining returns true if Drain was called.
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Drain stops accepting new requests, responding to them with a 503 and Connection: close,
+// then waits for the active requests to finish.
+// If timeout is > 0 and there are still active requests after it, it returns ErrDrainTimeout.
+// Drain doesn't close the underlying servers, call Shutdown after it.
+func (s *Server) Drain(timeout time.Duration) error {
+	atomic.StoreInt32(&s.draining, 1)
+	s.SetKeepAlivesEnabled(false)
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		deadline = t.C
+	}
+
+	tk := time.NewTicker(10 * time.Millisecond)
+	defer tk.Stop()
+
+	for s.InFlight() > 0 {
+		select {
+		case <-tk.C:
+		case <-deadline:
+			return ErrDrainTimeout
+		}
+	}
+
+	return nil
+}
+
+// Resume undoes Drain and starts accepting requests again.
+func (s *Server) Resume() {
+	atomic.StoreInt32(&s.draining, 0)
+	s.SetKeepAlivesEnabled(true)
+}
@@ -0,0 +1,17 @@
+//go:build !go1.19
+// +build !go1.19
+
+package apiserv
+
+// EarlyHints adds a Link header for each link, see preloadLink for the accepted formats.
+// Informational responses need go1.19+, so the links are only sent with the final response.
+func (ctx *Context) EarlyHints(links ...string) {
+	if ctx.done {
+		return
+	}
+
+	h := ctx.Header()
+	for _, l := range links {
+		h.Add("Link", preloadLink(l))
+	}
+}
@@ -0,0 +1,24 @@
+//go:build go1.19
+// +build go1.19
+
+package apiserv
+
+import "net/http"
+
+// EarlyHints adds a Link header for each link, and sends them in a 103 Early Hints response so the client
+// can start fetching them while the handler is still running, see preloadLink for the accepted formats.
+// It is a no-op once the response was written, and HTTP/1.0 clients only get the Link headers on the final response.
+func (ctx *Context) EarlyHints(links ...string) {
+	if ctx.done || len(links) == 0 {
+		return
+	}
+
+	h := ctx.Header()
+	for _, l := range links {
+		h.Add("Link", preloadLink(l))
+	}
+
+	if ctx.Req.ProtoAtLeast(1, 1) {
+		ctx.ResponseWriter.WriteHeader(http.StatusEarlyHints)
+	}
+}
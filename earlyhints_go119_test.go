@@ -0,0 +1,53 @@
+//go:build go1.19
+// +build go1.19
+
+package apiserv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"testing"
+)
+
+func TestEarlyHints(t *testing.T) {
+	srv := New()
+	srv.GET("/", func(ctx *Context) Response {
+		ctx.EarlyHints("/app.css", "</app.js>; rel=preload; as=script")
+		return NewJSONResponse("ok")
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var hints []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, h textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				hints = h["Link"]
+			}
+			return nil
+		},
+	}
+
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, ts.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	if len(hints) != 2 || hints[0] != "</app.css>; rel=preload; as=style" || hints[1] != "</app.js>; rel=preload; as=script" {
+		t.Fatalf("unexpected hints: %q", hints)
+	}
+
+	if len(resp.Header["Link"]) != 2 {
+		t.Fatalf("expected the links on the final response too, got %q", resp.Header["Link"])
+	}
+}
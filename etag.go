@@ -0,0 +1,54 @@
+package apiserv
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// autoETag sets the ETag for body if Options.AutoETag is enabled, unless the handler already set one,
+// returns true if it wrote a 304 because the client's copy is still valid.
+func (ctx *Context) autoETag(code int, body []byte) bool {
+	if ctx.s == nil || !ctx.s.opts.AutoETag {
+		return false
+	}
+
+	if m := ctx.Req.Method; (m != http.MethodGet && m != http.MethodHead) || (code != 0 && code != http.StatusOK) {
+		return false
+	}
+
+	h := ctx.Header()
+	etag := h.Get("ETag")
+	if etag == "" {
+		sum := fnv.New128a()
+		sum.Write(body)
+		etag = `W/"` + hex.EncodeToString(sum.Sum(nil)) + `"` // weak since the body might get compressed
+		h.Set("ETag", etag)
+	}
+
+	if !etagMatch(ctx.Req.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	ctx.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch implements the weak comparison used for If-None-Match, see RFC 7232 section 3.2.
+func etagMatch(inm, etag string) bool {
+	if inm == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(inm, ",") {
+		if v = strings.TrimSpace(v); v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
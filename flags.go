@@ -0,0 +1,70 @@
+package apiserv
+
+const flagsKey = ":FLAGS:"
+
+// FeatureFlags decides which features are enabled for a request, implementations can wrap
+// a flag service or a config file, see SetFeatureFlags.
+type FeatureFlags interface {
+	IsEnabled(ctx *Context, flag string) bool
+}
+
+// FeatureFlagsFunc is a func that implements FeatureFlags.
+type FeatureFlagsFunc func(ctx *Context, flag string) bool
+
+// IsEnabled implements FeatureFlags.
+func (fn FeatureFlagsFunc) IsEnabled(ctx *Context, flag string) bool { return fn(ctx, flag) }
+
+// StaticFlags is a FeatureFlags with the same flags for every request.
+type StaticFlags map[string]bool
+
+// IsEnabled implements FeatureFlags.
+func (sf StaticFlags) IsEnabled(_ *Context, flag string) bool { return sf[flag] }
+
+// FlagEnabled returns true if the server's FeatureFlags enable flag for this request,
+// the result is cached for the rest of the request, without FeatureFlags every flag is disabled.
+func (ctx *Context) FlagEnabled(flag string) bool {
+	m := ctx.Flags()
+	if v, ok := m[flag]; ok {
+		return v
+	}
+
+	var v bool
+	if ctx.s != nil && ctx.s.opts.FeatureFlags != nil {
+		v = ctx.s.opts.FeatureFlags.IsEnabled(ctx, flag)
+	}
+
+	if m == nil {
+		m = map[string]bool{}
+		ctx.Set(flagsKey, m)
+	}
+	m[flag] = v
+	return v
+}
+
+// Flags returns the flags evaluated so far for this request, by EvalFlags or FlagEnabled.
+func (ctx *Context) Flags() map[string]bool {
+	m, _ := ctx.Get(flagsKey).(map[string]bool)
+	return m
+}
+
+// EvalFlags is a middleware that evaluates flags up front, so they're available from ctx.Flags()
+// (ex: to pass them to a template or include them in a response).
+func EvalFlags(flags ...string) Handler {
+	return func(ctx *Context) Response {
+		for _, f := range flags {
+			ctx.FlagEnabled(f)
+		}
+		return nil
+	}
+}
+
+// RequireFlag is a middleware that replies with a 404 unless flag is enabled for the request,
+// so experimental endpoints look like they don't exist, ex: s.GET("/v2/search", RequireFlag("search-v2"), h).
+func RequireFlag(flag string) Handler {
+	return func(ctx *Context) Response {
+		if !ctx.FlagEnabled(flag) {
+			return RespNotFound
+		}
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package apiserv
+
+import (
+	"net"
+	"sync"
+)
+
+// GeoContextKey is the context key GeoIP stores the client's *GeoInfo under.
+const GeoContextKey = ":GEO:"
+
+// GeoInfo is the location of a client ip.
+type GeoInfo struct {
+	// Country is the ISO 3166-1 alpha-2 code, ex: "US".
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+// GeoResolver resolves ips to locations, for example a MaxMind reader:
+//
+//	apiserv.GeoResolverFunc(func(ip net.IP) (*apiserv.GeoInfo, error) {
+//		rec, err := db.City(ip) // github.com/oschwald/geoip2-golang
+//		if err != nil {
+//			return nil, err
+//		}
+//		gi := &apiserv.GeoInfo{Country: rec.Country.IsoCode, City: rec.City.Names["en"]}
+//		if len(rec.Subdivisions) > 0 {
+//			gi.Region = rec.Subdivisions[0].IsoCode
+//		}
+//		return gi, nil
+//	})
+type GeoResolver interface {
+	Resolve(ip net.IP) (*GeoInfo, error)
+}
+
+// GeoResolverFunc is a func that implements GeoResolver.
+type GeoResolverFunc func(ip net.IP) (*GeoInfo, error)
+
+// Resolve implements GeoResolver.
+func (fn GeoResolverFunc) Resolve(ip net.IP) (*GeoInfo, error) { return fn(ip) }
+
+// GeoIP returns a middleware that resolves ctx.ClientIP with r and sets the result on the context, see ctx.Geo.
+// Lookups for private and loopback ips are skipped, and resolver errors are logged but don't fail the request.
+// If cacheSize > 0, the last cacheSize lookups are kept in memory.
+func GeoIP(r GeoResolver, cacheSize int) Handler {
+	var cache *geoCache
+	if cacheSize > 0 {
+		cache = &geoCache{m: make(map[string]*GeoInfo, cacheSize), max: cacheSize}
+	}
+
+	return func(ctx *Context) Response {
+		ipStr := ctx.ClientIP()
+		ip := net.ParseIP(ipStr)
+		if ip == nil || ip.IsLoopback() || isPrivateIP(ip) {
+			return nil
+		}
+
+		gi := cache.get(ipStr)
+		if gi == nil {
+			var err error
+			if gi, err = r.Resolve(ip); err != nil {
+				ctx.s.Warnf("geoip: %s: %v", ipStr, err)
+				return nil
+			}
+			cache.set(ipStr, gi)
+		}
+
+		if gi != nil {
+			ctx.Set(GeoContextKey, gi)
+		}
+
+		return nil
+	}
+}
+
+// Geo returns the client's location set by GeoIP or nil.
+func (ctx *Context) Geo() *GeoInfo {
+	gi, _ := ctx.Get(GeoContextKey).(*GeoInfo)
+	return gi
+}
+
+var privateNets = func() (out []*net.IPNet) {
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "fc00::/7", "fe80::/10"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		out = append(out, n)
+	}
+	return
+}()
+
+func isPrivateIP(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// geoCache is a tiny bounded cache, it drops everything once it's full, which is good enough for ip lookups.
+type geoCache struct {
+	mux sync.RWMutex
+	m   map[string]*GeoInfo
+	max int
+}
+
+func (c *geoCache) get(ip string) *GeoInfo {
+	if c == nil {
+		return nil
+	}
+	c.mux.RLock()
+	gi := c.m[ip]
+	c.mux.RUnlock()
+	return gi
+}
+
+func (c *geoCache) set(ip string, gi *GeoInfo) {
+	if c == nil || gi == nil {
+		return
+	}
+	c.mux.Lock()
+	if len(c.m) >= c.max {
+		c.m = make(map[string]*GeoInfo, c.max)
+	}
+	c.m[ip] = gi
+	c.mux.Unlock()
+}
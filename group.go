@@ -1,8 +1,11 @@
 package apiserv
 
 import (
+	"fmt"
 	"net/http"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/missionMeteora/apiserv/router"
 )
@@ -23,6 +26,25 @@ type Group interface {
 	// Routes returns the current routes set.
 	Routes() [][3]string
 
+	// RoutesInfo returns all the routes added to the server, with their metadata.
+	RoutesInfo() []RouteInfo
+
+	// WithMeta returns a view of the group, sharing its middleware, that attaches meta to every route added through it.
+	WithMeta(meta RouteMeta) Group
+
+	// Scopes returns a view of the group that adds the required scopes to the meta of every route added through it,
+	// ex: g.Scopes("reports:read").GET("/reports", h), see apiutils.Auth.EnforceScopes.
+	Scopes(scopes ...string) Group
+
+	// Internal returns a view of the group that marks every route added through it as internal-only, see RouteMeta.Internal.
+	Internal() Group
+
+	// MountServer adds all of sub's routes, with their groups' middleware, under prefix.
+	MountServer(prefix string, sub *Server) error
+
+	// SetPanicHandler overrides Server.PanicHandler for routes in this group and groups created from it afterwards.
+	SetPanicHandler(fn func(ctx *Context, v interface{}))
+
 	// AddRoute adds a handler (or more) to the specific method and path
 	// it is NOT safe to call this once you call one of the run functions
 	AddRoute(method, path string, handlers ...Handler) error
@@ -46,14 +68,28 @@ type Group interface {
 
 type group struct {
 	s    *Server
+	meta *RouteMeta
+	ph   func(ctx *Context, v interface{})
 	nm   string
 	path string
 	mw   []Handler
+
+	// base is the group a WithMeta view was created from, it owns mw and ph so views see middleware added to it later.
+	base *group
+}
+
+// owner returns the group holding g's middleware and panic handler.
+func (g *group) owner() *group {
+	if g.base != nil {
+		return g.base
+	}
+	return g
 }
 
 // Use adds more middleware to the current group.
 func (g *group) Use(mw ...Handler) {
-	g.mw = append(g.mw, mw...)
+	o := g.owner()
+	o.mw = append(o.mw, mw...)
 }
 
 // Routes returns the current routes set.
@@ -65,11 +101,107 @@ func (g *group) Routes() [][3]string {
 // AddRoute adds a handler (or more) to the specific method and path
 // it is NOT safe to call this once you call one of the run functions
 func (g *group) AddRoute(method, path string, handlers ...Handler) error {
-	ghc := groupHandlerChain{
-		hc: handlers,
-		g:  g,
+	ghc := &groupHandlerChain{
+		hc:   handlers,
+		g:    g.owner(),
+		meta: g.meta,
+	}
+
+	return g.addChain(g.nm, method, joinPath(g.path, path), ghc)
+}
+
+func (g *group) addChain(name, method, path string, ghc *groupHandlerChain) error {
+	ghc.path = path
+	if err := g.s.r.AddRoute(name, method, path, ghc.Serve); err != nil {
+		return err
+	}
+
+	ri := RouteInfo{Group: name, Method: method, Path: path, Meta: ghc.meta, chain: ghc}
+	if n := len(ghc.hc); n > 0 {
+		ri.Handler = funcName(ghc.hc[n-1])
 	}
-	return g.s.r.AddRoute(g.nm, method, joinPath(g.path, path), ghc.Serve)
+
+	g.s.routes = append(g.s.routes, ri)
+	return nil
+}
+
+// MountServer adds all of sub's routes under prefix, each route keeps its group name, metadata and middleware,
+// which run after this group's middleware.
+// Only the routes are mounted, sub's server-level settings (hooks, codecs, NotFoundHandler, etc) aren't used,
+// and routes or middleware added to sub after mounting it are ignored.
+// it is NOT safe to call this once you call one of the run functions
+func (g *group) MountServer(prefix string, sub *Server) error {
+	for _, ri := range sub.routes {
+		sc := ri.chain
+
+		hc := make([]Handler, 0, len(sc.g.mw)+len(sc.hc))
+		hc = append(append(hc, sc.g.mw...), sc.hc...)
+
+		ghc := &groupHandlerChain{
+			hc:   hc,
+			g:    g.owner(),
+			meta: ri.Meta,
+		}
+
+		if ghc.meta == nil {
+			ghc.meta = g.meta
+		}
+
+		name := ri.Group
+		if name == "" {
+			name = g.nm
+		}
+
+		if err := g.addChain(name, ri.Method, joinPath(joinPath(g.path, prefix), ri.Path), ghc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RoutesInfo returns all the routes added to the server, with their metadata, in the order they were added.
+func (g *group) RoutesInfo() []RouteInfo {
+	out := make([]RouteInfo, len(g.s.routes))
+	copy(out, g.s.routes)
+	return out
+}
+
+// WithMeta returns a view of the group that attaches meta to every route added through it,
+// the view shares the group's middleware, including any added later with Use on either of them.
+// example: g.WithMeta(RouteMeta{Description: "returns a user", Tags: []string{"users"}}).GET("/user/:id", h)
+func (g *group) WithMeta(meta RouteMeta) Group {
+	return &group{
+		s:    g.s,
+		meta: &meta,
+		nm:   g.nm,
+		path: g.path,
+		base: g.owner(),
+	}
+}
+
+// Scopes returns a view of the group that adds scopes to the RouteMeta of every route added through it,
+// any existing meta (from WithMeta) is kept.
+func (g *group) Scopes(scopes ...string) Group {
+	var meta RouteMeta
+	if g.meta != nil {
+		meta = *g.meta
+	}
+
+	meta.Scopes = append(append([]string(nil), meta.Scopes...), scopes...)
+	return g.WithMeta(meta)
+}
+
+// Internal returns a view of the group that marks the routes added through it as internal-only,
+// ex: s.Group("debug", "/_debug").Internal().GET("/state", h).
+func (g *group) Internal() Group {
+	var meta RouteMeta
+	if g.meta != nil {
+		meta = *g.meta
+	}
+
+	meta.Internal = true
+	return g.WithMeta(meta)
 }
 
 // GET is an alias for AddRoute("GET", path, handlers...).
@@ -107,14 +239,24 @@ func (g *group) StaticFile(path, localPath string) error {
 
 // group returns a sub-handler group based on the current group's middleware
 func (g *group) Group(name, path string, mw ...Handler) Group {
+	o := g.owner()
 	return &group{
 		nm:   name,
-		mw:   append(g.mw[:len(g.mw):len(g.mw)], mw...),
+		mw:   append(o.mw[:len(o.mw):len(o.mw)], mw...),
 		path: joinPath(g.path, path),
+		meta: g.meta,
+		ph:   o.ph,
 		s:    g.s,
 	}
 }
 
+// SetPanicHandler overrides Server.PanicHandler for routes in this group and groups created from it afterwards.
+// Panic hooks still run, and debug.Stack() called from fn includes the panicking frames.
+// example: admin.SetPanicHandler(func(ctx *Context, v interface{}) { ctx.Printf(500, MimePlain, "%v\n%s", v, debug.Stack()) })
+func (g *group) SetPanicHandler(fn func(ctx *Context, v interface{})) {
+	g.owner().ph = fn
+}
+
 func joinPath(p1, p2 string) string {
 	if p2 == "" {
 		return p1
@@ -131,11 +273,19 @@ func joinPath(p1, p2 string) string {
 }
 
 type groupHandlerChain struct {
-	g  *group
-	hc []Handler
+	g     *group
+	meta  *RouteMeta
+	path  string
+	hc    []Handler
+	stats routeStats
 }
 
 func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p router.Params) {
+	if ghc.meta != nil && ghc.meta.Internal && !ghc.g.s.isInternalRequest(req) { // look like any other unknown route
+		ghc.g.s.handleNoRoute(rw, req, p, ghc.g.s.NotFoundHandler, RespNotFound)
+		return
+	}
+
 	var (
 		ctx = getCtx(rw, req, p, ghc.g.s)
 
@@ -143,14 +293,38 @@ func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p
 	)
 	defer putCtx(ctx)
 
+	var start time.Time
+	if ghc.g.s.statsEnabled() {
+		start = time.Now()
+	}
+
+	defer func() {
+		var err error
+		if s := ghc.g.s; !s.noCatchPanics() {
+			if v := recover(); v != nil {
+				ph := ghc.g.ph
+				if ph == nil {
+					ph = s.PanicHandler
+				}
+				s.recoverPanic(ctx, v, debug.Stack(), ph)
+				err = fmt.Errorf("panic (%T): %v", v, v)
+			}
+		}
+		ctx.finish(err)
+
+		if !start.IsZero() {
+			ghc.stats.record(ctx.Status(), time.Since(start))
+		}
+	}()
+
+	ctx.meta, ctx.route = ghc.meta, ghc.path
+
 	ctx.next = func() (r Response) {
-		for hIdx < len(ghc.hc) {
+		for hIdx < len(ghc.hc) && !ctx.aborted {
 			h := ghc.hc[hIdx]
 			hIdx++
 			if r = h(ctx); r != nil {
-				if !ctx.done && r != Break {
-					r.WriteToCtx(ctx)
-				}
+				ctx.writeResponse(r)
 				break
 			}
 		}
@@ -159,19 +333,16 @@ func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p
 	}
 
 	ctx.nextMW = func() (r Response) {
-		for mwIdx < len(ghc.g.mw) {
+		for mwIdx < len(ghc.g.mw) && !ctx.aborted {
 			h := ghc.g.mw[mwIdx]
 			mwIdx++
 			if r = h(ctx); r != nil {
-				if !ctx.done && r != Break {
-					r.WriteToCtx(ctx)
-				}
-
+				ctx.writeResponse(r)
 				break
 			}
 		}
 		ctx.nextMW = nil
-		if ctx.done {
+		if ctx.done || ctx.aborted {
 			ctx.next = nil
 		}
 		return
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// HTTPCheck returns a check that fails unless a GET to url returns a 2xx or 3xx status, if hc is nil http.DefaultClient is used.
+func HTTPCheck(url string, hc *http.Client) CheckFunc {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := hc.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096)) // allows reusing the connection
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("%s: unexpected status %d", url, resp.StatusCode)
+		}
+
+		return nil
+	}
+}
+
+// TCPCheck returns a check that fails if it can't open a tcp connection to addr.
+func TCPCheck(addr string) CheckFunc {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+}
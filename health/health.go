@@ -0,0 +1,212 @@
+// Package health implements named liveness and readiness checks that can be served by apiserv.Server.EnableHealth.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the default timeout used for each check if Checks.Timeout isn't set.
+const DefaultTimeout = 5 * time.Second
+
+// CheckFunc is a health check, returning a non-nil error marks the check as failed.
+type CheckFunc func(ctx context.Context) error
+
+// Kind is the kind of the check.
+type Kind uint8
+
+const (
+	// Readiness checks are only used for readiness reports.
+	Readiness Kind = iota
+	// Liveness checks are used for both liveness and readiness reports.
+	Liveness
+)
+
+// Status is the result of a single check.
+type Status struct {
+	Name    string        `json:"name"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency"`
+	OK      bool          `json:"ok"`
+
+	// Cached is set for dependency checks if the result is from a previous run, Age is how old it is.
+	Cached bool          `json:"cached,omitempty"`
+	Age    time.Duration `json:"age,omitempty"`
+}
+
+// Report is the aggregated result of running all the checks of a specific kind.
+type Report struct {
+	Checks []Status `json:"checks,omitempty"`
+	OK     bool     `json:"ok"`
+}
+
+type check struct {
+	fn   CheckFunc
+	dep  *dependency
+	kind Kind
+}
+
+// New returns a new, empty, Checks.
+func New() *Checks {
+	return &Checks{
+		m: map[string]check{},
+	}
+}
+
+// Checks is a set of named health checks, it is safe to use from multiple goroutines.
+type Checks struct {
+	mux sync.RWMutex
+	m   map[string]check
+
+	// Timeout is the max duration each check is allowed to take, defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Register adds a readiness check, replacing any existing check with the same name.
+func (c *Checks) Register(name string, fn CheckFunc) {
+	c.RegisterKind(name, Readiness, fn)
+}
+
+// RegisterLiveness adds a liveness check, replacing any existing check with the same name.
+// Liveness checks should be cheap and only fail when the process needs to be restarted.
+func (c *Checks) RegisterLiveness(name string, fn CheckFunc) {
+	c.RegisterKind(name, Liveness, fn)
+}
+
+// RegisterKind adds a check of the specific kind, replacing any existing check with the same name.
+func (c *Checks) RegisterKind(name string, kind Kind, fn CheckFunc) {
+	c.mux.Lock()
+	c.m[name] = check{fn: fn, kind: kind}
+	c.mux.Unlock()
+}
+
+// RegisterDependency adds a readiness check for an external dependency (ex: a database, see HTTPCheck and TCPCheck),
+// its result is cached for ttl so frequent readiness probes don't hammer it.
+func (c *Checks) RegisterDependency(name string, ttl time.Duration, fn CheckFunc) {
+	c.mux.Lock()
+	c.m[name] = check{fn: fn, kind: Readiness, dep: &dependency{ttl: ttl}}
+	c.mux.Unlock()
+}
+
+// Unregister removes a check.
+func (c *Checks) Unregister(name string) {
+	c.mux.Lock()
+	delete(c.m, name)
+	c.mux.Unlock()
+}
+
+// Live runs all the liveness checks.
+func (c *Checks) Live(ctx context.Context) Report {
+	return c.run(ctx, Liveness)
+}
+
+// Ready runs all the checks.
+func (c *Checks) Ready(ctx context.Context) Report {
+	return c.run(ctx, Readiness)
+}
+
+func (c *Checks) run(ctx context.Context, kind Kind) (r Report) {
+	c.mux.RLock()
+	names := make([]string, 0, len(c.m))
+	cks := make([]check, 0, len(c.m))
+	for name, ck := range c.m {
+		if kind == Liveness && ck.kind != Liveness {
+			continue
+		}
+		names = append(names, name)
+		cks = append(cks, ck)
+	}
+	timeout := c.Timeout
+	c.mux.RUnlock()
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	r.OK = true
+	r.Checks = make([]Status, len(names))
+
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if ck := cks[i]; ck.dep != nil {
+				r.Checks[i] = ck.dep.run(ctx, names[i], ck.fn, timeout)
+			} else {
+				r.Checks[i] = runCheck(ctx, names[i], ck.fn, timeout)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(r.Checks, func(i, j int) bool { return r.Checks[i].Name < r.Checks[j].Name })
+
+	for _, st := range r.Checks {
+		if !st.OK {
+			r.OK = false
+			break
+		}
+	}
+
+	return
+}
+
+func runCheck(ctx context.Context, name string, fn CheckFunc, timeout time.Duration) (st Status) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	st.Name = name
+	start := time.Now()
+
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				ch <- fmt.Errorf("panic (%T): %v", v, v)
+			}
+		}()
+		ch <- fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-ch:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	st.Latency = time.Since(start)
+	if st.OK = err == nil; !st.OK {
+		st.Error = err.Error()
+	}
+
+	return
+}
+
+// dependency caches the last result of a check.
+type dependency struct {
+	mux  sync.Mutex
+	last Status
+	at   time.Time
+	ttl  time.Duration
+}
+
+// run returns the cached status if it's still fresh, otherwise it runs the check,
+// concurrent reports wait for the same run instead of starting their own.
+func (d *dependency) run(ctx context.Context, name string, fn CheckFunc, timeout time.Duration) Status {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if age := time.Since(d.at); !d.at.IsZero() && age < d.ttl {
+		st := d.last
+		st.Cached, st.Age = true, age
+		return st
+	}
+
+	d.last, d.at = runCheck(ctx, name, fn, timeout), time.Now()
+	return d.last
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChecks(t *testing.T) {
+	c := New()
+	c.Timeout = 50 * time.Millisecond
+
+	c.RegisterLiveness("ping", func(context.Context) error { return nil })
+	c.Register("db", func(context.Context) error { return errors.New("down") })
+	c.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if r := c.Live(context.Background()); !r.OK || len(r.Checks) != 1 {
+		t.Fatalf("unexpected liveness report: %+v", r)
+	}
+
+	r := c.Ready(context.Background())
+	if r.OK || len(r.Checks) != 3 {
+		t.Fatalf("unexpected readiness report: %+v", r)
+	}
+
+	if st := r.Checks[0]; st.Name != "db" || st.OK || st.Error != "down" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	if st := r.Checks[2]; st.Name != "slow" || st.OK || st.Latency < c.Timeout {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	c.Unregister("db")
+	c.Unregister("slow")
+
+	if r := c.Ready(context.Background()); !r.OK {
+		t.Fatalf("unexpected readiness report: %+v", r)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	var calls int32
+	c := New()
+	c.RegisterDependency("api", time.Minute, HTTPCheck(ts.URL+"/ok", nil))
+	c.RegisterDependency("broken", time.Minute, HTTPCheck(ts.URL+"/fail", nil))
+	c.RegisterDependency("tcp", time.Minute, TCPCheck(ts.Listener.Addr().String()))
+	c.RegisterDependency("counted", time.Minute, func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	r := c.Ready(context.Background())
+	if r.OK || len(r.Checks) != 4 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+
+	for _, st := range r.Checks {
+		if st.Cached || st.OK != (st.Name != "broken") {
+			t.Fatalf("unexpected status: %+v", st)
+		}
+	}
+
+	r = c.Ready(context.Background())
+	for _, st := range r.Checks {
+		if !st.Cached {
+			t.Fatalf("expected a cached status: %+v", st)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
@@ -0,0 +1,56 @@
+package apiserv
+
+import (
+	"net/http"
+
+	"github.com/missionMeteora/apiserv/health"
+)
+
+// errShuttingDown is returned in readiness reports once the server starts draining or shutting down.
+const errShuttingDown = "server is shutting down"
+
+// Health returns the server's health checks, use it to register checks before calling EnableHealth.
+func (s *Server) Health() *health.Checks {
+	return s.hc
+}
+
+// EnableHealth adds `path/healthz` and `path/readyz` handlers that serve the results of the server's health checks.
+// readyz also reports the server as not ready until Warmup is done and once Drain or Shutdown have been called.
+// Failing checks return a 503 with the report as the data.
+func (s *Server) EnableHealth(path string) error {
+	if err := s.GET(joinPath(path, "/healthz"), s.healthHandler(false)); err != nil {
+		return err
+	}
+	return s.GET(joinPath(path, "/readyz"), s.healthHandler(true))
+}
+
+func (s *Server) healthHandler(ready bool) Handler {
+	return func(ctx *Context) Response {
+		var r health.Report
+		if ready {
+			r = s.hc.Ready(ctx.Req.Context())
+		} else {
+			r = s.hc.Live(ctx.Req.Context())
+		}
+
+		if ready && (s.Closed() || s.Draining()) {
+			r.OK = false
+			r.Checks = append(r.Checks, health.Status{Name: "server", Error: errShuttingDown})
+		} else if ready && !s.Warm() {
+			r.OK = false
+			r.Checks = append(r.Checks, health.Status{Name: "server", Error: errWarmingUp})
+		}
+
+		ctx.Header().Set("Cache-Control", "no-cache")
+
+		if r.OK {
+			return NewJSONResponse(r)
+		}
+
+		return &JSONResponse{
+			Code:   http.StatusServiceUnavailable,
+			Data:   r,
+			Errors: []Error{{Message: http.StatusText(http.StatusServiceUnavailable)}},
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package apiserv
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/missionMeteora/apiserv/internal"
+)
+
+const (
+	localeKey = ":LOC:"
+	bundleKey = ":BDL:"
+)
+
+// AcceptedLanguages returns the languages in the request's Accept-Language header, ordered by preference.
+// Tags are lower-cased, and languages with q=0 are omitted.
+func (ctx *Context) AcceptedLanguages() []string {
+	return parseAcceptLanguage(ctx.Req.Header.Get("Accept-Language"))
+}
+
+// Locale returns the locale selected by the Localizer middleware or an empty string.
+func (ctx *Context) Locale() string {
+	l, _ := ctx.Get(localeKey).(string)
+	return l
+}
+
+// T translates key using the bundle and locale set by the Localizer middleware.
+// If there's no bundle, it returns fmt.Sprintf(key, args...).
+func (ctx *Context) T(key string, args ...interface{}) string {
+	b, _ := ctx.Get(bundleKey).(*Bundle)
+	if b == nil {
+		b = emptyBundle
+	}
+	return b.T(ctx.Locale(), key, args...)
+}
+
+// Localizer returns a middleware that picks the best locale supported by b for the request
+// and stores it on the Context, see Context.Locale and Context.T.
+// The `lang` query param takes priority over the Accept-Language header.
+func Localizer(b *Bundle) Handler {
+	return func(ctx *Context) Response {
+		accepted := ctx.AcceptedLanguages()
+		if l := ctx.Query("lang"); l != "" {
+			accepted = append([]string{normalizeLang(l)}, accepted...)
+		}
+
+		l := b.Match(accepted...)
+		ctx.Set(localeKey, l)
+		ctx.Set(bundleKey, b)
+		ctx.Header().Set("Content-Language", l)
+		addVary(ctx.Header(), "Accept-Language")
+		return nil
+	}
+}
+
+var emptyBundle = NewBundle("")
+
+// NewBundle returns a new message bundle, defaultLang is used when there's no better match.
+func NewBundle(defaultLang string) *Bundle {
+	return &Bundle{
+		def:  normalizeLang(defaultLang),
+		msgs: map[string]map[string]string{},
+	}
+}
+
+// Bundle is a set of translated messages keyed by language, it is safe to use from multiple goroutines.
+type Bundle struct {
+	mux  sync.RWMutex
+	msgs map[string]map[string]string
+	def  string
+}
+
+// Add adds messages for lang, replacing existing keys.
+func (b *Bundle) Add(lang string, msgs map[string]string) {
+	lang = normalizeLang(lang)
+
+	b.mux.Lock()
+	m := b.msgs[lang]
+	if m == nil {
+		m = make(map[string]string, len(msgs))
+		b.msgs[lang] = m
+	}
+	for k, v := range msgs {
+		m[k] = v
+	}
+	b.mux.Unlock()
+}
+
+// LoadJSON loads a flat json object of key -> message for lang.
+func (b *Bundle) LoadJSON(lang string, r io.Reader) error {
+	j, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var msgs map[string]string
+	if err = internal.Unmarshal(j, &msgs); err != nil {
+		return fmt.Errorf("%s: %v", lang, err)
+	}
+
+	b.Add(lang, msgs)
+	return nil
+}
+
+// LoadDir loads all the `{lang}.json` files in dir, for example: en.json, en-gb.json, fr.json.
+func (b *Bundle) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, fp := range files {
+		f, err := os.Open(fp)
+		if err != nil {
+			return err
+		}
+
+		err = b.LoadJSON(strings.TrimSuffix(filepath.Base(fp), ".json"), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Languages returns the bundle's languages.
+func (b *Bundle) Languages() []string {
+	b.mux.RLock()
+	out := make([]string, 0, len(b.msgs))
+	for l := range b.msgs {
+		out = append(out, l)
+	}
+	b.mux.RUnlock()
+	sort.Strings(out)
+	return out
+}
+
+// Match returns the best supported language for the accepted list, in order of preference.
+// An exact match wins, then a base language match (en-us -> en, en -> en-gb), otherwise the default language.
+func (b *Bundle) Match(accepted ...string) string {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+
+	for _, l := range accepted {
+		if _, ok := b.msgs[l]; ok {
+			return l
+		}
+
+		base := baseLang(l)
+		if _, ok := b.msgs[base]; ok {
+			return base
+		}
+
+		for sl := range b.msgs {
+			if baseLang(sl) == base {
+				return sl
+			}
+		}
+	}
+
+	return b.def
+}
+
+// T returns the message for key in lang, falling back to the default language then the key itself.
+// If args are passed, the message is used as a fmt.Sprintf format.
+func (b *Bundle) T(lang, key string, args ...interface{}) string {
+	b.mux.RLock()
+	msg, ok := b.msgs[lang][key]
+	if !ok {
+		if msg, ok = b.msgs[b.def][key]; !ok {
+			msg = key
+		}
+	}
+	b.mux.RUnlock()
+
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+func parseAcceptLanguage(h string) []string {
+	if h == "" {
+		return nil
+	}
+
+	type lq struct {
+		l string
+		q float64
+	}
+
+	parts := strings.Split(h, ",")
+	ls := make([]lq, 0, len(parts))
+
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		l, q := p, 1.0
+		if idx := strings.IndexByte(p, ';'); idx != -1 {
+			l = strings.TrimSpace(p[:idx])
+			if qs := strings.TrimSpace(p[idx+1:]); strings.HasPrefix(qs, "q=") {
+				if v, err := strconv.ParseFloat(qs[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if l == "" || l == "*" || q <= 0 {
+			continue
+		}
+
+		ls = append(ls, lq{normalizeLang(l), q})
+	}
+
+	sort.SliceStable(ls, func(i, j int) bool { return ls[i].q > ls[j].q })
+
+	out := make([]string, len(ls))
+	for i, v := range ls {
+		out[i] = v.l
+	}
+	return out
+}
+
+func normalizeLang(l string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(l), "_", "-", -1))
+}
+
+func baseLang(l string) string {
+	if idx := strings.IndexByte(l, '-'); idx != -1 {
+		return l[:idx]
+	}
+	return l
+}
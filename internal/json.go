@@ -1,5 +1,5 @@
-//xgo:build !amd64 || go1.18
-// +xbuild !amd64 go1.18
+//go:build !sonic || !amd64
+// +build !sonic !amd64
 
 package internal
 
@@ -1,7 +1,5 @@
-//go:build ignore
-// +build ignore
-
-// amd64,!go1.18
+//go:build sonic
+// +build sonic
 
 package internal
 
@@ -2,29 +2,134 @@ package apiserv
 
 import (
 	"net"
+	"sync"
 	"time"
 )
 
-// tcpKeepAliveListener copied from net/http to allow a custom keepalive period, useful for testing
+// tcpKeepAliveListener copied from net/http to allow a custom keepalive period, useful for testing.
+// It also handles TCP_NODELAY, Options.MaxConns and backs off on temporary accept errors.
 type tcpKeepAliveListener struct {
 	*net.TCPListener
-	period time.Duration
+	period  time.Duration
+	noDelay bool
+
+	// sem is nil unless there's a max connections limit.
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func (ln *tcpKeepAliveListener) Accept() (c net.Conn, err error) {
-	var tc *net.TCPConn
+// wrapListener returns ln wrapped with the listener Options, or as is if it isn't a tcp listener.
+func (s *Server) wrapListener(ln net.Listener) net.Listener {
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		return ln
+	}
+
+	kl := &tcpKeepAliveListener{
+		TCPListener: tl,
+		period:      s.opts.KeepAlivePeriod,
+		noDelay:     !s.opts.TCPDelay,
+		done:        make(chan struct{}),
+	}
 
-	if tc, err = ln.AcceptTCP(); err != nil {
-		return
+	if s.opts.MaxConns > 0 {
+		kl.sem = make(chan struct{}, s.opts.MaxConns)
 	}
 
-	if err = tc.SetKeepAlive(true); err != nil {
-		return
+	return kl
+}
+
+const maxAcceptDelay = time.Second
+
+func (ln *tcpKeepAliveListener) Accept() (net.Conn, error) {
+	if ln.sem != nil {
+		select {
+		case ln.sem <- struct{}{}:
+		case <-ln.done:
+			return nil, net.ErrClosed
+		}
 	}
 
-	if err = tc.SetKeepAlivePeriod(ln.period); err != nil {
-		return
+	var delay time.Duration
+	for {
+		tc, err := ln.AcceptTCP()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() { //nolint:staticcheck // same check as net/http
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+
+				select {
+				case <-time.After(delay):
+					continue
+				case <-ln.done:
+				}
+			}
+
+			ln.release()
+			return nil, err
+		}
+
+		// the client might have gone away already, which shouldn't stop the server
+		if err = ln.setup(tc); err != nil {
+			tc.Close()
+			continue
+		}
+
+		if ln.sem == nil {
+			return tc, nil
+		}
+
+		return &limitedConn{TCPConn: tc, release: ln.release}, nil
 	}
+}
+
+func (ln *tcpKeepAliveListener) setup(tc *net.TCPConn) error {
+	switch {
+	case ln.period < 0:
+		if err := tc.SetKeepAlive(false); err != nil {
+			return err
+		}
+	case ln.period > 0:
+		if err := tc.SetKeepAlive(true); err != nil {
+			return err
+		}
+
+		if err := tc.SetKeepAlivePeriod(ln.period); err != nil {
+			return err
+		}
+	}
+
+	if !ln.noDelay { // go defaults to TCP_NODELAY
+		return tc.SetNoDelay(false)
+	}
+
+	return nil
+}
+
+func (ln *tcpKeepAliveListener) release() {
+	if ln.sem != nil {
+		<-ln.sem
+	}
+}
+
+func (ln *tcpKeepAliveListener) Close() error {
+	ln.closeOnce.Do(func() { close(ln.done) })
+	return ln.TCPListener.Close()
+}
+
+// limitedConn frees its slot in the listener once closed.
+type limitedConn struct {
+	*net.TCPConn
+	once    sync.Once
+	release func()
+}
 
-	return tc, nil
+func (c *limitedConn) Close() error {
+	err := c.TCPConn.Close()
+	c.once.Do(c.release)
+	return err
 }
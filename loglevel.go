@@ -0,0 +1,128 @@
+package apiserv
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel is the minimum level of messages the server logs.
+type LogLevel int32
+
+// Log levels, LogInfo is the default.
+const (
+	LogDebug LogLevel = iota - 1
+	LogInfo
+	LogWarn
+	LogError
+	LogOff
+)
+
+var logLevelNames = [...]string{"debug", "info", "warn", "error", "off"}
+
+func (l LogLevel) String() string {
+	if l < LogDebug || l > LogOff {
+		return fmt.Sprintf("LogLevel(%d)", l)
+	}
+	return logLevelNames[l-LogDebug]
+}
+
+// ParseLogLevel parses a level name (debug, info, warn, error or off).
+func ParseLogLevel(s string) (LogLevel, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, n := range logLevelNames {
+		if n == s {
+			return LogLevel(i) + LogDebug, nil
+		}
+	}
+
+	if s == "warning" {
+		return LogWarn, nil
+	}
+
+	return LogOff, fmt.Errorf("invalid log level: %q", s)
+}
+
+// SetLogLevel sets the server's minimum log level, it is safe to call at any time.
+func (s *Server) SetLogLevel(l LogLevel) {
+	atomic.StoreInt32(&s.logLevel, int32(l))
+}
+
+// LogLevel returns the server's minimum log level, defaults to LogInfo.
+func (s *Server) LogLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(&s.logLevel))
+}
+
+func (s *Server) logEnabled(l LogLevel) bool {
+	return l >= s.LogLevel() && l < LogOff
+}
+
+// Debugf logs at LogDebug, see Logf.
+func (s *Server) Debugf(f string, args ...interface{}) {
+	s.logf(LogDebug, f, args...)
+}
+
+// Infof logs at LogInfo, see Logf.
+func (s *Server) Infof(f string, args ...interface{}) {
+	s.logf(LogInfo, f, args...)
+}
+
+// Warnf logs at LogWarn, see Logf.
+func (s *Server) Warnf(f string, args ...interface{}) {
+	s.logf(LogWarn, f, args...)
+}
+
+// Errorf logs at LogError, see Logf.
+func (s *Server) Errorf(f string, args ...interface{}) {
+	s.logf(LogError, f, args...)
+}
+
+// logf must be called directly by the exported funcs so the caller's file is reported.
+func (s *Server) logf(l LogLevel, f string, args ...interface{}) {
+	if !s.logEnabled(l) {
+		return
+	}
+
+	tag := "[" + logLevelTags[l-LogDebug] + "] "
+	iv := s.opts.ErrorLogInterval
+	if iv <= 0 || l < LogWarn {
+		s.logfStack(4, tag+f, args...)
+		return
+	}
+
+	msg := fmt.Sprintf(f, args...)
+	ok, dropped := s.logLimits.allow(msg, iv)
+	if !ok {
+		return
+	}
+
+	if dropped > 0 {
+		s.logfStack(4, tag+"%s (%d identical messages suppressed)", msg, dropped)
+	} else {
+		s.logfStack(4, tag+"%s", msg)
+	}
+}
+
+var logLevelTags = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// httpErrorLog returns a logger for http.Server.ErrorLog that logs at LogError,
+// nil keeps the default of using the log package if the server doesn't have a logger.
+func (s *Server) httpErrorLog() *log.Logger {
+	if s.opts.Logger == nil {
+		return nil
+	}
+	return log.New(levelWriter{s, LogError}, "", 0)
+}
+
+type levelWriter struct {
+	s *Server
+	l LogLevel
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	if lg := w.s.opts.Logger; lg != nil && w.s.logEnabled(w.l) {
+		lg.Printf("[%s] %s", logLevelTags[w.l-LogDebug], p)
+	}
+	return len(p), nil
+}
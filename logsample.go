@@ -0,0 +1,52 @@
+package apiserv
+
+import (
+	"sync"
+	"time"
+)
+
+// logLimiter drops repeated identical messages, allowing one per interval.
+type logLimiter struct {
+	mux       sync.Mutex
+	m         map[string]*logLimit
+	lastSweep time.Time
+}
+
+type logLimit struct {
+	last    time.Time
+	dropped int
+}
+
+// allow returns true if msg wasn't logged in the last interval, along with how many copies were dropped since.
+func (ll *logLimiter) allow(msg string, interval time.Duration) (ok bool, dropped int) {
+	now := time.Now()
+
+	ll.mux.Lock()
+	defer ll.mux.Unlock()
+
+	if ll.m == nil {
+		ll.m = map[string]*logLimit{}
+	}
+
+	l := ll.m[msg]
+	switch {
+	case l == nil:
+		ll.m[msg] = &logLimit{last: now}
+		ok = true
+	case now.Sub(l.last) < interval:
+		l.dropped++
+	default:
+		ok, dropped, l.dropped, l.last = true, l.dropped, 0, now
+	}
+
+	if now.Sub(ll.lastSweep) > interval {
+		for k, l := range ll.m {
+			if now.Sub(l.last) > interval {
+				delete(ll.m, k)
+			}
+		}
+		ll.lastSweep = now
+	}
+
+	return
+}
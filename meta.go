@@ -0,0 +1,48 @@
+package apiserv
+
+// RouteMeta is optional metadata attached to a route using Group.WithMeta,
+// meant for documentation generation, policy enforcement and route-dump tooling.
+type RouteMeta struct {
+	Extra M `json:"extra,omitempty"`
+
+	// Name is an optional identifier for the route, used by apiserv/clientgen as the method name.
+	Name string `json:"name,omitempty"`
+
+	Description string `json:"description,omitempty"`
+
+	// Deprecated is a deprecation message, a non-empty value marks the route as deprecated.
+	Deprecated string `json:"deprecated,omitempty"`
+
+	Tags   []string `json:"tags,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Internal routes reply with a 404 unless the request arrived on a loopback or Options.InternalNets address, or RunAdmin's listener.
+	Internal bool `json:"internal,omitempty"`
+}
+
+// HasTag returns true if the meta has the specific tag.
+func (m *RouteMeta) HasTag(tag string) bool {
+	if m == nil {
+		return false
+	}
+
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteInfo is a route's group, method, path and optional metadata.
+type RouteInfo struct {
+	Meta   *RouteMeta `json:"meta,omitempty"`
+	Group  string     `json:"group,omitempty"`
+	Method string     `json:"method"`
+	Path   string     `json:"path"`
+
+	// Handler is the name of the route's last handler.
+	Handler string `json:"handler,omitempty"`
+
+	chain *groupHandlerChain
+}
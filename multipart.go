@@ -0,0 +1,293 @@
+package apiserv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Multipart errors, wrapped with the part's field name.
+var (
+	ErrPartTooLarge   = errors.New("part is too large")
+	ErrTooManyFiles   = errors.New("too many files")
+	ErrMimeNotAllowed = errors.New("file type not allowed")
+	ErrEmptyMultipart = errors.New("no files were uploaded")
+	ErrTooManyValues  = errors.New("too many form values")
+	ErrFormTooLarge   = errors.New("form values are too large")
+)
+
+const (
+	defaultMaxValueLen = 1 << 20
+	defaultMaxValues   = 1000
+	defaultMaxMemory   = 10 << 20
+)
+
+// MultipartOptions controls ctx.SaveMultipart.
+type MultipartOptions struct {
+	// Progress is called after every write to disk with the part's total number of bytes so far.
+	Progress func(field, filename string, written int64)
+
+	// Dir is where the files are saved, defaults to os.TempDir().
+	Dir string
+
+	// AllowedTypes is a list of allowed sniffed mime-types (ex: "image/png") or prefixes ending with "/" (ex: "image/"),
+	// if empty, all types are allowed.
+	AllowedTypes []string
+
+	// MaxPartSize is the max size of a single file if > 0.
+	MaxPartSize int64
+
+	// MaxValueSize is the max size of a single non-file field, defaults to 1MB.
+	MaxValueSize int64
+
+	// MaxValues is the max number of non-file fields, defaults to 1000.
+	MaxValues int
+
+	// MaxMemory is the max total size of the non-file fields kept in memory, defaults to 10MB.
+	MaxMemory int64
+
+	// MaxFiles is the max number of files if > 0.
+	MaxFiles int
+
+	// RequireFiles returns ErrEmptyMultipart if the request didn't have any files.
+	RequireFiles bool
+}
+
+// SavedFile is a file part saved by ctx.SaveMultipart.
+type SavedFile struct {
+	Field    string
+	Filename string // as sent by the client, not safe to use as a path
+	Path     string
+
+	// ContentType is sniffed from the content, DeclaredType is what the client sent.
+	ContentType  string
+	DeclaredType string
+
+	Size int64
+}
+
+// MultipartManifest is the result of ctx.SaveMultipart.
+type MultipartManifest struct {
+	Values url.Values
+	Files  []*SavedFile
+}
+
+// Remove deletes all the saved files, returns the first error.
+func (m *MultipartManifest) Remove() (err error) {
+	for _, f := range m.Files {
+		if rerr := os.Remove(f.Path); rerr != nil && err == nil && !os.IsNotExist(rerr) {
+			err = rerr
+		}
+	}
+	return
+}
+
+// SaveMultipart streams the parts of a multipart request directly to disk without buffering them in memory,
+// files go to opts.Dir and other fields are returned in the manifest's Values.
+// On error all the files saved so far are removed, and the error wraps one of the Err* vars with the field name.
+// It's up to the caller to move or remove the files once done.
+func (ctx *Context) SaveMultipart(opts *MultipartOptions) (_ *MultipartManifest, err error) {
+	if opts == nil {
+		opts = &MultipartOptions{}
+	}
+
+	mr, err := ctx.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.CloseBody()
+
+	m := &MultipartManifest{Values: url.Values{}}
+	defer func() {
+		if err != nil {
+			m.Remove()
+		}
+	}()
+
+	maxVal := opts.MaxValueSize
+	if maxVal <= 0 {
+		maxVal = defaultMaxValueLen
+	}
+
+	maxValues := opts.MaxValues
+	if maxValues <= 0 {
+		maxValues = defaultMaxValues
+	}
+
+	maxMem := opts.MaxMemory
+	if maxMem <= 0 {
+		maxMem = defaultMaxMemory
+	}
+
+	var (
+		nValues int
+		memUsed int64
+	)
+
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		field := p.FormName()
+
+		if p.FileName() == "" {
+			if nValues++; nValues > maxValues {
+				p.Close()
+				return nil, fmt.Errorf("%s: %w", field, ErrTooManyValues)
+			}
+
+			// never read past what's left of MaxMemory
+			lim := maxVal
+			if rem := maxMem - memUsed; rem < lim {
+				lim = rem
+			}
+
+			b, err := ioutil.ReadAll(io.LimitReader(p, lim+1))
+			p.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			if n := int64(len(b)); n > maxVal {
+				return nil, fmt.Errorf("%s: %w", field, ErrPartTooLarge)
+			} else if n > lim {
+				return nil, fmt.Errorf("%s: %w", field, ErrFormTooLarge)
+			}
+
+			memUsed += int64(len(b))
+			m.Values.Add(field, string(b))
+			continue
+		}
+
+		if opts.MaxFiles > 0 && len(m.Files) == opts.MaxFiles {
+			p.Close()
+			return nil, fmt.Errorf("%s: %w", field, ErrTooManyFiles)
+		}
+
+		sf, err := savePart(p, opts)
+		p.Close()
+
+		if sf != nil {
+			m.Files = append(m.Files, sf)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+	}
+
+	if opts.RequireFiles && len(m.Files) == 0 {
+		return nil, ErrEmptyMultipart
+	}
+
+	return m, nil
+}
+
+func savePart(p *multipart.Part, opts *MultipartOptions) (*SavedFile, error) {
+	sf := &SavedFile{
+		Field:        p.FormName(),
+		Filename:     p.FileName(),
+		DeclaredType: p.Header.Get("Content-Type"),
+	}
+
+	// sniff the type before touching the disk
+	head := make([]byte, 512)
+	n, err := io.ReadFull(p, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	sf.ContentType = http.DetectContentType(head)
+	if !mimeAllowed(sf.ContentType, opts.AllowedTypes) {
+		return nil, ErrMimeNotAllowed
+	}
+
+	f, err := ioutil.TempFile(opts.Dir, "upload-*"+safeExt(sf.Filename))
+	if err != nil {
+		return nil, err
+	}
+
+	sf.Path = f.Name()
+
+	var r io.Reader = io.MultiReader(bytes.NewReader(head), p)
+	if opts.MaxPartSize > 0 {
+		r = io.LimitReader(r, opts.MaxPartSize+1)
+	}
+
+	w := &progressWriter{w: f}
+	if opts.Progress != nil {
+		w.fn = func(n int64) { opts.Progress(sf.Field, sf.Filename, n) }
+	}
+
+	sf.Size, err = io.Copy(w, r)
+	if err == nil && opts.MaxPartSize > 0 && sf.Size > opts.MaxPartSize {
+		err = ErrPartTooLarge
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return sf, err
+}
+
+func mimeAllowed(ct string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	ct = mediaType(ct)
+	for _, a := range allowed {
+		if a == ct || (strings.HasSuffix(a, "/") && strings.HasPrefix(ct, a)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// safeExt returns the file's extension if it's short and alphanumeric, so temp files keep it.
+func safeExt(fn string) string {
+	ext := filepath.Ext(filepath.Base(fn))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return ""
+		}
+	}
+
+	return ext
+}
+
+type progressWriter struct {
+	w  io.Writer
+	fn func(n int64)
+	n  int64
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.n += int64(n)
+	if pw.fn != nil {
+		pw.fn(pw.n)
+	}
+	return n, err
+}
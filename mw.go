@@ -1,11 +1,9 @@
 package apiserv
 
 import (
-	"bytes"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -15,8 +13,9 @@ import (
 
 // LogRequests is a request logger middleware.
 // If logJSONRequests is true, it'll attempt to parse the incoming request's body and output it to the log.
+// Successful requests can be sampled with Options.LogSampleRate.
 func LogRequests(logJSONRequests bool) Handler {
-	var reqID uint64
+	var reqID, okCount uint64
 	return func(ctx *Context) Response {
 		var (
 			req   = ctx.Req
@@ -29,17 +28,17 @@ func LogRequests(logJSONRequests bool) Handler {
 		if logJSONRequests {
 			switch m := req.Method; m {
 			case http.MethodPost, http.MethodPut, http.MethodDelete:
-				var buf bytes.Buffer
-				io.Copy(&buf, req.Body)
-				req.Body.Close()
-				req.Body = ioutil.NopCloser(&buf)
+				b := ctx.CapturedRequestBody()
+				if b == nil {
+					b, _ = teeRequestBody(req, -1)
+				}
 				j, _ := internal.Marshal(req.Header)
-				if ln := buf.Len(); ln > 0 {
-					switch buf.Bytes()[0] {
+				if ln := len(b); ln > 0 {
+					switch b[0] {
 					case '[', '{', 'n': // [], {} and nullable
-						extra = fmt.Sprintf("\n\tHeaders: %s\n\tRequest (%d): %s", j, ln, buf.String())
+						extra = fmt.Sprintf("\n\tHeaders: %s\n\tRequest (%d): %s", j, ln, b)
 					default:
-						extra = fmt.Sprintf("\n\tHeaders: %s\n\tRequest (%d): <binary>", j, buf.Len())
+						extra = fmt.Sprintf("\n\tHeaders: %s\n\tRequest (%d): <binary>", j, ln)
 					}
 				}
 			}
@@ -48,6 +47,12 @@ func LogRequests(logJSONRequests bool) Handler {
 		ctx.NextMiddleware()
 		ctx.Next()
 
+		if n := ctx.s.opts.LogSampleRate; n > 1 && ctx.Status() < http.StatusBadRequest {
+			if atomic.AddUint64(&okCount, 1)%uint64(n) != 1 {
+				return nil
+			}
+		}
+
 		ct := req.Header.Get("Content-Type")
 
 		switch ct {
@@ -60,7 +65,7 @@ func LogRequests(logJSONRequests bool) Handler {
 			ct = "[" + ct + "] "
 		}
 
-		ctx.s.Logf("[reqID:%05d] [%s] [%s] %s[%d] %s %s [%s]%s",
+		ctx.s.Infof("[reqID:%05d] [%s] [%s] %s[%d] %s %s [%s]%s",
 			id, ctx.ClientIP(), req.UserAgent(), ct, ctx.Status(), req.Method, url.Path, time.Since(start), extra)
 		return nil
 	}
@@ -85,3 +90,48 @@ func GetSecureCookie(ctx *Context) *securecookie.SecureCookie {
 	}
 	return nil
 }
+
+// MaxConcurrent is a middleware that limits the number of requests being handled at the same time to n.
+// Requests over the limit wait up to queueTimeout for a slot, then get a 503 with a Retry-After header.
+// Each call returns a new limiter, so using it on a group limits that group only.
+// It panics if n isn't positive.
+func MaxConcurrent(n int, queueTimeout time.Duration) Handler {
+	if n <= 0 {
+		panic("apiserv: MaxConcurrent: n must be > 0")
+	}
+
+	var (
+		sem = make(chan struct{}, n)
+		e   struct{}
+
+		retryAfter = strconv.Itoa(int(queueTimeout/time.Second) + 1)
+	)
+
+	return func(ctx *Context) Response {
+		select {
+		case sem <- e:
+		default:
+			if queueTimeout <= 0 {
+				ctx.Header().Set("Retry-After", retryAfter)
+				return RespServiceUnavailable
+			}
+
+			t := time.NewTimer(queueTimeout)
+			select {
+			case sem <- e:
+				t.Stop()
+			case <-t.C:
+				ctx.Header().Set("Retry-After", retryAfter)
+				return RespServiceUnavailable
+			case <-ctx.Req.Context().Done():
+				t.Stop()
+				return Break
+			}
+		}
+
+		defer func() { <-sem }()
+
+		ctx.Next()
+		return nil
+	}
+}
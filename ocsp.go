@@ -0,0 +1,180 @@
+package apiserv
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var errNoOCSP = errors.New("no ocsp server or issuer")
+
+// ocspStapler keeps the OCSP responses of the certificates loaded from CertPairs fresh,
+// certs is replaced as a whole on every refresh so handshakes never see a certificate being modified.
+type ocspStapler struct {
+	s  *Server
+	hc *http.Client
+
+	mux   sync.RWMutex
+	certs []tls.Certificate
+}
+
+// newOCSPStapler returns nil if none of the certs has an OCSP server.
+func (s *Server) newOCSPStapler(certs []tls.Certificate) *ocspStapler {
+	if !s.opts.OCSPStapling {
+		return nil
+	}
+
+	for i := range certs {
+		if leaf, _ := certLeaf(&certs[i]); leaf != nil && len(leaf.OCSPServer) > 0 && len(certs[i].Certificate) > 1 {
+			return &ocspStapler{
+				s:     s,
+				hc:    &http.Client{Timeout: 10 * time.Second},
+				certs: append([]tls.Certificate(nil), certs...),
+			}
+		}
+	}
+
+	return nil
+}
+
+// match returns the certificate that supports hello, or nil if none do.
+func (st *ocspStapler) match(hello *tls.ClientHelloInfo) *tls.Certificate {
+	st.mux.RLock()
+	certs := st.certs
+	st.mux.RUnlock()
+
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i]
+		}
+	}
+	return nil
+}
+
+// getCertificate is used as the tls.Config.GetCertificate by RunTLS, it falls back to the first certificate like crypto/tls.
+func (st *ocspStapler) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if c := st.match(hello); c != nil {
+		return c, nil
+	}
+
+	st.mux.RLock()
+	defer st.mux.RUnlock()
+	return &st.certs[0], nil
+}
+
+// run refreshes the staples halfway through their validity until the server is closed.
+func (st *ocspStapler) run() {
+	stop := st.s.stopped()
+	for {
+		t := time.NewTimer(time.Until(st.refresh(time.Now())))
+		select {
+		case <-stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// refresh fetches new responses for all the certificates and returns when the next refresh is due.
+func (st *ocspStapler) refresh(now time.Time) (next time.Time) {
+	st.mux.RLock()
+	certs := append([]tls.Certificate(nil), st.certs...)
+	st.mux.RUnlock()
+
+	for i := range certs {
+		staple, exp, err := st.fetch(&certs[i])
+		if err == errNoOCSP {
+			continue
+		}
+
+		at := now.Add(time.Hour) // retry failures hourly, keeping the old staple until it's replaced
+		if err != nil {
+			st.s.Warnf("ocsp: %v", err)
+		} else {
+			certs[i].OCSPStaple = staple
+			at = now.Add(exp.Sub(now) / 2)
+		}
+
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+
+	if min := now.Add(time.Minute); next.Before(min) {
+		next = min
+	}
+
+	st.mux.Lock()
+	st.certs = certs
+	st.mux.Unlock()
+
+	return
+}
+
+// fetch asks cert's OCSP server for its status, only good responses are returned.
+func (st *ocspStapler) fetch(cert *tls.Certificate) (staple []byte, nextUpdate time.Time, err error) {
+	leaf, err := certLeaf(cert)
+	if err != nil || len(leaf.OCSPServer) == 0 || len(cert.Certificate) < 2 {
+		return nil, nextUpdate, errNoOCSP
+	}
+
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nextUpdate, err
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nextUpdate, err
+	}
+
+	url := leaf.OCSPServer[0]
+	resp, err := st.hc.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nextUpdate, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nextUpdate, fmt.Errorf("%s: unexpected status %d", url, resp.StatusCode)
+	}
+
+	if staple, err = ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+		return nil, nextUpdate, err
+	}
+
+	or, err := ocsp.ParseResponseForCert(staple, leaf, issuer)
+	if err != nil {
+		return nil, nextUpdate, fmt.Errorf("%s: %v", url, err)
+	}
+
+	if or.Status != ocsp.Good {
+		return nil, nextUpdate, fmt.Errorf("%s: certificate %v status is %d", url, leaf.DNSNames, or.Status)
+	}
+
+	if nextUpdate = or.NextUpdate; nextUpdate.IsZero() {
+		nextUpdate = time.Now().Add(24 * time.Hour)
+	}
+
+	return staple, nextUpdate, nil
+}
+
+func certLeaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errNoOCSP
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
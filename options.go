@@ -1,7 +1,9 @@
 package apiserv
 
 import (
+	"crypto/tls"
 	"log"
+	"net"
 	"time"
 
 	"github.com/missionMeteora/apiserv/router"
@@ -15,6 +17,68 @@ type Options struct {
 	WriteTimeout    time.Duration
 	KeepAlivePeriod time.Duration
 	MaxHeaderBytes  int
+
+	// MaxConns caps the number of open connections per listener, new ones wait in the accept backlog until a slot frees up.
+	MaxConns int
+
+	// InternalNets are the local networks, besides loopback, that internal routes can be reached on, see RouteMeta.Internal.
+	InternalNets []*net.IPNet
+
+	// TCPDelay disables TCP_NODELAY on the accepted connections, batching small writes at the cost of latency.
+	TCPDelay bool
+
+	// TLS settings used by RunTLS, RunAutoCert and RunTLSAndAuto.
+	TLSMinVersion       uint16
+	TLSCipherSuites     []uint16
+	TLSCurvePreferences []tls.CurveID
+
+	// AutoCertHTTPAddr and AutoCertTLSAddr are the addresses RunAutoCert and RunTLSAndAuto listen on,
+	// they default to ":http" and ":https". Setting AutoCertHTTPAddr to "-" disables the http-01 listener,
+	// certificates can still be issued using tls-alpn-01 challenges as long as the tls address is reachable on port 443.
+	AutoCertHTTPAddr string
+	AutoCertTLSAddr  string
+
+	// TLSFallbackCert is served by RunTLSAndAuto for hosts that don't match autocert or any of the cert pairs,
+	// NewSelfSignedCert can be used to create one.
+	TLSFallbackCert *tls.Certificate
+
+	// OCSPStapling makes RunTLS and RunTLSAndAuto fetch and staple OCSP responses for the cert pairs that have an OCSP server,
+	// it is off by default since it makes outbound requests to the CA's responder.
+	OCSPStapling bool
+
+	// SessionTicketRotation is how often the TLS session ticket keys are rotated, it is 12h in DefaultOpts,
+	// 0 disables the rotation and keeps crypto/tls's default keys.
+	// SessionTicketKeys defaults to NewTicketKeys(3), set it to a shared source when running multiple instances.
+	SessionTicketRotation time.Duration
+	SessionTicketKeys     TicketKeysFunc
+
+	// NotFoundHandler and MethodNotAllowedHandler replace the default JSON 404 and 405 responses.
+	NotFoundHandler         func(ctx *Context)
+	MethodNotAllowedHandler func(ctx *Context)
+
+	// JSONCodec is used by Context.BindJSON, Context.JSON and JSONResponse, defaults to StdJSON.
+	JSONCodec Codec
+
+	// AutoETag makes Context.JSON (and JSONResponse) set an ETag based on the encoded body for successful GET and HEAD requests,
+	// and reply with a 304 if it matches If-None-Match.
+	AutoETag bool
+
+	// RequestContextValues makes the values set with Context.Set available through the request's context,
+	// so they survive going through http.Handlers (see ContextValue), and Context.Get falls back to them.
+	RequestContextValues bool
+
+	// LogSampleRate makes LogRequests only log 1 in LogSampleRate successful (< 400) requests, errors are always logged.
+	LogSampleRate int
+
+	// ErrorLogInterval limits identical messages logged at LogWarn and above to one per interval,
+	// the next one logged after it includes how many were dropped.
+	ErrorLogInterval time.Duration
+
+	// FeatureFlags is used by Context.FlagEnabled and RequireFlag.
+	FeatureFlags FeatureFlags
+
+	// ShutdownTimeout is how long RunUntilSignal waits for the active requests to finish, 0 waits forever.
+	ShutdownTimeout time.Duration
 }
 
 // Option is a func to set internal server Options.
@@ -68,6 +132,159 @@ func SetKeepAlivePeriod(p time.Duration) Option {
 	})
 }
 
+// SetMaxConns sets the maximum number of open connections per listener, 0 means no limit.
+// see Options.MaxConns
+func SetMaxConns(n int) Option {
+	return optionSetter(func(opt *Options) {
+		opt.MaxConns = n
+	})
+}
+
+// SetTCPDelay toggles Nagle's algorithm on the accepted connections, go disables it by default.
+// see Options.TCPDelay
+func SetTCPDelay(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.TCPDelay = enable
+	})
+}
+
+// SetInternalNets sets the local networks internal routes are served on, ex: SetInternalNets("10.0.0.0/8").
+// It panics if one of the cidrs is invalid, like regexp.MustCompile.
+// see Options.InternalNets
+func SetInternalNets(cidrs ...string) Option {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic("apiserv: SetInternalNets: " + err.Error())
+		}
+		nets = append(nets, n)
+	}
+
+	return optionSetter(func(opt *Options) {
+		opt.InternalNets = nets
+	})
+}
+
+// SetTLSMinVersion sets the minimum TLS version accepted by the TLS servers, defaults to tls.VersionTLS12.
+func SetTLSMinVersion(v uint16) Option {
+	return optionSetter(func(opt *Options) {
+		opt.TLSMinVersion = v
+	})
+}
+
+// SetTLSCipherSuites sets the enabled TLS 1.0-1.2 cipher suites, TLS 1.3 suites aren't configurable.
+// see tls.Config.CipherSuites
+func SetTLSCipherSuites(ids ...uint16) Option {
+	return optionSetter(func(opt *Options) {
+		opt.TLSCipherSuites = ids
+	})
+}
+
+// SetTLSCurvePreferences sets the elliptic curves used in an ECDHE handshake, in preference order.
+// see tls.Config.CurvePreferences
+func SetTLSCurvePreferences(curves ...tls.CurveID) Option {
+	return optionSetter(func(opt *Options) {
+		opt.TLSCurvePreferences = curves
+	})
+}
+
+// SetAutoCertAddrs sets the addresses used by RunAutoCert and RunTLSAndAuto, empty values keep the defaults.
+// see Options.AutoCertHTTPAddr
+func SetAutoCertAddrs(httpAddr, tlsAddr string) Option {
+	return optionSetter(func(opt *Options) {
+		opt.AutoCertHTTPAddr, opt.AutoCertTLSAddr = httpAddr, tlsAddr
+	})
+}
+
+// SetTLSFallbackCert sets the certificate RunTLSAndAuto serves for unknown hosts.
+// see Options.TLSFallbackCert
+func SetTLSFallbackCert(cert *tls.Certificate) Option {
+	return optionSetter(func(opt *Options) {
+		opt.TLSFallbackCert = cert
+	})
+}
+
+// SetOCSPStapling enables or disables OCSP stapling for the cert pairs.
+// see Options.OCSPStapling
+func SetOCSPStapling(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.OCSPStapling = enable
+	})
+}
+
+// SetSessionTicketKeys sets how often the session ticket keys are rotated and where they come from, fn can be nil.
+// see Options.SessionTicketRotation
+func SetSessionTicketKeys(every time.Duration, fn TicketKeysFunc) Option {
+	return optionSetter(func(opt *Options) {
+		opt.SessionTicketRotation, opt.SessionTicketKeys = every, fn
+	})
+}
+
+// SetNotFoundHandler sets the handler called when no route matches a GET request.
+// see Server.NotFoundHandler
+func SetNotFoundHandler(fn func(ctx *Context)) Option {
+	return optionSetter(func(opt *Options) {
+		opt.NotFoundHandler = fn
+	})
+}
+
+// SetMethodNotAllowedHandler sets the handler called when no route matches a non-GET request.
+// see Server.MethodNotAllowedHandler
+func SetMethodNotAllowedHandler(fn func(ctx *Context)) Option {
+	return optionSetter(func(opt *Options) {
+		opt.MethodNotAllowedHandler = fn
+	})
+}
+
+// SetJSONCodec sets the json codec used for requests and responses, passing nil uses StdJSON.
+func SetJSONCodec(c Codec) Option {
+	return optionSetter(func(opt *Options) {
+		opt.JSONCodec = c
+	})
+}
+
+// SetAutoETag enables or disables automatic ETags for json responses.
+// see Options.AutoETag
+func SetAutoETag(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.AutoETag = enable
+	})
+}
+
+// SetRequestContextValues enables or disables exposing Context values through the request's context.
+// see Options.RequestContextValues
+func SetRequestContextValues(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.RequestContextValues = enable
+	})
+}
+
+// SetLogSampling sets how many successful requests LogRequests logs (1 in sampleRate),
+// and the interval used to rate limit repeated warnings and errors.
+// see Options.LogSampleRate and Options.ErrorLogInterval
+func SetLogSampling(sampleRate int, errorInterval time.Duration) Option {
+	return optionSetter(func(opt *Options) {
+		opt.LogSampleRate, opt.ErrorLogInterval = sampleRate, errorInterval
+	})
+}
+
+// SetFeatureFlags sets the FeatureFlags used to evaluate Context.FlagEnabled.
+// see Options.FeatureFlags
+func SetFeatureFlags(ff FeatureFlags) Option {
+	return optionSetter(func(opt *Options) {
+		opt.FeatureFlags = ff
+	})
+}
+
+// SetShutdownTimeout sets how long RunUntilSignal waits for the active requests once it gets a signal.
+// see Options.ShutdownTimeout
+func SetShutdownTimeout(v time.Duration) Option {
+	return optionSetter(func(opt *Options) {
+		opt.ShutdownTimeout = v
+	})
+}
+
 // SetRouterOptions sets apiserv/router.Options on the server.
 func SetRouterOptions(v *router.Options) Option {
 	return optionSetter(func(opt *Options) {
@@ -78,21 +295,43 @@ func SetRouterOptions(v *router.Options) Option {
 // SetNoCatchPanics toggles catching panics in handlers.
 func SetNoCatchPanics(enable bool) Option {
 	return optionSetter(func(opt *Options) {
-		if opt.RouterOptions == nil {
-			opt.RouterOptions = &router.Options{}
-		}
-		opt.RouterOptions.NoCatchPanics = enable
+		opt.routerOptions().NoCatchPanics = enable
+	})
+}
+
+// SetUnescapeParams toggles unescaping path param values, requests with invalid escapes get a 400.
+// see router.Options.UnescapeParams
+func SetUnescapeParams(enable bool) Option {
+	return optionSetter(func(opt *Options) {
+		opt.routerOptions().UnescapeParams = enable
 	})
 }
 
+// SetProfileLabels toggles setting pprof labels (group, method and uri) on the goroutines serving requests.
 func SetProfileLabels(enable bool) Option {
 	return optionSetter(func(opt *Options) {
-		opt.RouterOptions.ProfileLabels = enable
+		opt.routerOptions().ProfileLabels = enable
 	})
 }
 
-func SetOnReqDone(fn router.OnRequestDone) Option {
+// SetOnRequestDone sets a func that gets called with the group, method, path and duration of every routed request.
+// example: SetOnRequestDone(func(_ context.Context, group, method, uri string, d time.Duration) { latency.Observe(group, d) })
+func SetOnRequestDone(fn router.OnRequestDone) Option {
 	return optionSetter(func(opt *Options) {
-		opt.RouterOptions.OnRequestDone = fn
+		opt.routerOptions().OnRequestDone = fn
 	})
 }
+
+// SetOnReqDone is an alias for SetOnRequestDone.
+//
+// Deprecated: use SetOnRequestDone.
+func SetOnReqDone(fn router.OnRequestDone) Option {
+	return SetOnRequestDone(fn)
+}
+
+func (opt *Options) routerOptions() *router.Options {
+	if opt.RouterOptions == nil {
+		opt.RouterOptions = &router.Options{}
+	}
+	return opt.RouterOptions
+}
@@ -0,0 +1,147 @@
+package apiserv
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Pagination defaults used by ctx.Pagination.
+var (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+const maxInt = int(^uint(0) >> 1)
+
+// Pagination is the parsed page state of a list request, see ctx.Pagination.
+type Pagination struct {
+	// Cursor is the raw ?cursor= value, if any.
+	Cursor string
+
+	// Page starts at 1.
+	Page    int
+	PerPage int
+}
+
+// Offset returns the offset of the first item in the current page, capped at the max int value.
+func (p *Pagination) Offset() int {
+	if p.PerPage > 0 && p.Page-1 > maxInt/p.PerPage {
+		return maxInt
+	}
+	return (p.Page - 1) * p.PerPage
+}
+
+// Limit is an alias for p.PerPage.
+func (p *Pagination) Limit() int {
+	return p.PerPage
+}
+
+// Response returns a success response for the current page, total is the total number of items or -1 if it isn't known.
+// The response writes RFC 5988 Link headers for the first, previous, next and last pages.
+func (p *Pagination) Response(data interface{}, total int64) *JSONResponse {
+	r := NewJSONResponse(data)
+	r.Page, r.PerPage = p.Page, p.PerPage
+	if total >= 0 {
+		r.Total = &total
+	}
+	return r
+}
+
+// Pagination parses the page, limit (or per_page) and cursor query params using DefaultPerPage and MaxPerPage.
+// Invalid values fall back to the defaults instead of failing the request.
+func (ctx *Context) Pagination() *Pagination {
+	return ctx.PaginationWithLimits(DefaultPerPage, MaxPerPage)
+}
+
+// PaginationWithLimits is like Pagination with custom limits, maxPerPage <= 0 means no cap.
+func (ctx *Context) PaginationWithLimits(defPerPage, maxPerPage int) *Pagination {
+	q := ctx.Req.URL.Query()
+
+	p := &Pagination{
+		Cursor:  q.Get("cursor"),
+		Page:    1,
+		PerPage: defPerPage,
+	}
+
+	if n, err := strconv.Atoi(q.Get("page")); err == nil && n > 0 {
+		p.Page = n
+	}
+
+	lim := q.Get("limit")
+	if lim == "" {
+		lim = q.Get("per_page")
+	}
+
+	if n, err := strconv.Atoi(lim); err == nil && n > 0 {
+		p.PerPage = n
+	}
+
+	if maxPerPage > 0 && p.PerPage > maxPerPage {
+		p.PerPage = maxPerPage
+	}
+
+	return p
+}
+
+// setLinkHeader adds the Link header for paginated responses.
+func (r *JSONResponse) setLinkHeader(ctx *Context) {
+	if ctx.Req == nil {
+		return
+	}
+
+	if r.NextCursor != "" {
+		u := *ctx.Req.URL
+		q := u.Query()
+		q.Del("page")
+		q.Set("cursor", r.NextCursor)
+		u.RawQuery = q.Encode()
+		ctx.Header().Set("Link", `<`+u.RequestURI()+`>; rel="next"`)
+		return
+	}
+
+	if r.Page < 1 || r.PerPage < 1 {
+		return
+	}
+
+	last := 0
+	if r.Total != nil {
+		if last = int((*r.Total + int64(r.PerPage) - 1) / int64(r.PerPage)); last < 1 {
+			last = 1
+		}
+	}
+
+	u := *ctx.Req.URL
+	q := u.Query()
+	q.Del("per_page")
+	q.Del("cursor")
+	q.Set("limit", strconv.Itoa(r.PerPage))
+
+	var links []string
+	link := func(page int, rel string) {
+		q.Set("page", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+		links = append(links, `<`+u.RequestURI()+`>; rel="`+rel+`"`)
+	}
+
+	link(1, "first")
+
+	if r.Page > 1 {
+		link(r.Page-1, "prev")
+	}
+
+	if (last == 0 && r.Page < maxInt) || r.Page < last { // unknown total, assume there's a next page
+		link(r.Page+1, "next")
+	}
+
+	if last > 0 {
+		link(last, "last")
+	}
+
+	ctx.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// paginated returns true if the response is a successful paginated response.
+func (r *JSONResponse) paginated() bool {
+	return (r.Page > 0 || r.NextCursor != "") && r.Code < http.StatusBadRequest
+}
@@ -0,0 +1,181 @@
+package apiserv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyOptions controls how ProxyPass forwards requests.
+type ProxyOptions struct {
+	// Transport is used to perform the proxied requests, defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// ModifyResponse is an optional hook to change the upstream response before it gets written out.
+	ModifyResponse func(*http.Response) error
+
+	// StripPrefix is removed from the request path before it gets joined with the target's path.
+	StripPrefix string
+
+	// FlushInterval is passed to httputil.ReverseProxy, see its documentation.
+	FlushInterval time.Duration
+
+	// PreserveHost keeps the original Host header instead of using the target's host.
+	PreserveHost bool
+
+	// NoForwardedHeaders disables setting the X-Forwarded-{For,Host,Proto} headers
+	// and strips any that were sent by the client.
+	NoForwardedHeaders bool
+}
+
+// ProxyOption is a func to set ProxyOptions.
+type ProxyOption func(po *ProxyOptions)
+
+// ProxyStripPrefix removes prefix from the request path before forwarding it.
+// example: s.GET("/legacy/*p", ProxyPass(u, ProxyStripPrefix("/legacy")))
+func ProxyStripPrefix(prefix string) ProxyOption {
+	return func(po *ProxyOptions) {
+		po.StripPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// ProxyPreserveHost keeps the client's Host header when forwarding requests.
+func ProxyPreserveHost(v bool) ProxyOption {
+	return func(po *ProxyOptions) {
+		po.PreserveHost = v
+	}
+}
+
+// ProxyNoForwardedHeaders disables X-Forwarded-* headers.
+func ProxyNoForwardedHeaders(v bool) ProxyOption {
+	return func(po *ProxyOptions) {
+		po.NoForwardedHeaders = v
+	}
+}
+
+// ProxyTransport sets the http.RoundTripper used to talk to the backend.
+func ProxyTransport(rt http.RoundTripper) ProxyOption {
+	return func(po *ProxyOptions) {
+		po.Transport = rt
+	}
+}
+
+// ProxyFlushInterval sets the flush interval used while copying the backend's response body.
+func ProxyFlushInterval(d time.Duration) ProxyOption {
+	return func(po *ProxyOptions) {
+		po.FlushInterval = d
+	}
+}
+
+// ProxyModifyResponse sets a hook to modify the backend's response.
+func ProxyModifyResponse(fn func(*http.Response) error) ProxyOption {
+	return func(po *ProxyOptions) {
+		po.ModifyResponse = fn
+	}
+}
+
+// ProxyPass returns a handler that forwards requests to target using httputil.ReverseProxy.
+// Backend errors are returned as a JSONResponse, 504 for timeouts and 502 for everything else.
+func ProxyPass(target *url.URL, opts ...ProxyOption) Handler {
+	var po ProxyOptions
+	for _, opt := range opts {
+		opt(&po)
+	}
+
+	rp := &httputil.ReverseProxy{
+		Director:       proxyDirector(target, &po),
+		Transport:      po.Transport,
+		FlushInterval:  po.FlushInterval,
+		ModifyResponse: po.ModifyResponse,
+		ErrorHandler:   proxyErrorHandler,
+	}
+
+	return func(ctx *Context) Response {
+		rp.ServeHTTP(ctx, ctx.Req)
+		return Break
+	}
+}
+
+func proxyDirector(target *url.URL, po *ProxyOptions) func(req *http.Request) {
+	tq := target.RawQuery
+	return func(req *http.Request) {
+		origHost, isTLS := req.Host, req.TLS != nil
+
+		p := req.URL.Path
+		// only strip whole segments, /legacyfoo doesn't match /legacy
+		if pre := po.StripPrefix; pre != "" && strings.HasPrefix(p, pre) && (len(p) == len(pre) || p[len(pre)] == '/') {
+			if p = p[len(pre):]; p == "" {
+				p = "/"
+			}
+		}
+
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		req.URL.Path, req.URL.RawPath = singleJoiningSlash(target.Path, p), ""
+
+		if tq == "" || req.URL.RawQuery == "" {
+			req.URL.RawQuery = tq + req.URL.RawQuery
+		} else {
+			req.URL.RawQuery = tq + "&" + req.URL.RawQuery
+		}
+
+		if !po.PreserveHost {
+			req.Host = ""
+		}
+
+		h := req.Header
+		if po.NoForwardedHeaders {
+			h.Del("X-Forwarded-Host")
+			h.Del("X-Forwarded-Proto")
+			h["X-Forwarded-For"] = nil // nil tells ReverseProxy not to set it
+			return
+		}
+
+		if h.Get("X-Forwarded-Host") == "" {
+			h.Set("X-Forwarded-Host", origHost)
+		}
+
+		if h.Get("X-Forwarded-Proto") == "" {
+			if isTLS {
+				h.Set("X-Forwarded-Proto", "https")
+			} else {
+				h.Set("X-Forwarded-Proto", "http")
+			}
+		}
+	}
+}
+
+func proxyErrorHandler(w http.ResponseWriter, req *http.Request, err error) {
+	ctx, ok := w.(*Context)
+	if !ok {
+		ctx = &Context{Req: req, ResponseWriter: w}
+	}
+
+	code := http.StatusBadGateway
+	if ne, ok := err.(net.Error); (ok && ne.Timeout()) || errors.Is(err, context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+
+	if ctx.s != nil {
+		ctx.s.Errorf("proxy error (%s %s): %v", req.Method, req.URL, err)
+	}
+
+	NewJSONErrorResponse(code, http.StatusText(code)).WriteToCtx(ctx)
+}
+
+// copied from net/http/httputil
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,66 @@
+package apiserv
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxyPass(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Seen-Host", req.Header.Get("X-Forwarded-Host"))
+		w.Write([]byte(req.URL.Path + "?" + req.URL.RawQuery))
+	}))
+	defer backend.Close()
+
+	u, _ := url.Parse(backend.URL + "/v1?key=x")
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/legacy/*p", ProxyPass(u, ProxyStripPrefix("/legacy/")))
+	srv.GET("/legacyfoo", ProxyPass(u, ProxyStripPrefix("/legacy")))
+
+	dead, _ := url.Parse("http://127.0.0.1:1")
+	srv.GET("/dead", ProxyPass(dead))
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/legacy/users/1?q=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(b) != "/v1/users/1?key=x&q=2" {
+		t.Fatalf("unexpected proxied path: %s", b)
+	}
+
+	if h := resp.Header.Get("X-Seen-Host"); h != ts.Listener.Addr().String() {
+		t.Fatalf("unexpected X-Forwarded-Host: %q", h)
+	}
+
+	resp, err = http.Get(ts.URL + "/legacyfoo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(b) != "/v1/legacyfoo?key=x" {
+		t.Fatalf("the prefix should only be stripped on a segment boundary: %s", b)
+	}
+
+	resp, err = http.Get(ts.URL + "/dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s string
+	r, _ := ReadJSONResponse(resp.Body, &s)
+	if r == nil || r.Code != http.StatusBadGateway || len(r.Errors) != 1 {
+		t.Fatalf("unexpected response: %+v", r)
+	}
+}
@@ -0,0 +1,124 @@
+package apiserv
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SortField is a single ?sort= field.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery is the parsed ?sort= and ?filter[field]= params of a request, see ctx.ListQuery.
+type ListQuery struct {
+	Sort    []SortField
+	Filters map[string][]string
+}
+
+// Filter returns the first value of the filter for field or "".
+func (q *ListQuery) Filter(field string) string {
+	if vs := q.Filters[field]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// ListQuerySpec is the whitelist of fields a list endpoint supports.
+type ListQuerySpec struct {
+	// Sort is the list of fields that can be sorted by.
+	Sort []string
+
+	// Filter is the list of fields that can be filtered by.
+	Filter []string
+
+	// DefaultSort is used if the request doesn't have a sort param, ex: "-created_at".
+	DefaultSort string
+}
+
+// ListQuery parses ?sort=-created_at,name&filter[status]=active style params using the whitelist in spec.
+// Fields prefixed with "-" are sorted in descending order, filters can be repeated.
+// On invalid input it returns a 400 response with an Error for each bad field, otherwise the response is nil.
+func (ctx *Context) ListQuery(spec *ListQuerySpec) (*ListQuery, *JSONResponse) {
+	return spec.Parse(ctx.Req.URL.Query())
+}
+
+// Parse is the standalone version of ctx.ListQuery.
+func (spec *ListQuerySpec) Parse(vals url.Values) (*ListQuery, *JSONResponse) {
+	var (
+		q    = &ListQuery{Filters: map[string][]string{}}
+		errs []interface{}
+	)
+
+	sp := vals.Get("sort")
+	if _, ok := vals["sort"]; !ok {
+		sp = spec.DefaultSort
+	}
+
+	seen := map[string]bool{}
+	for _, f := range strings.Split(sp, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+
+		sf := SortField{Field: f}
+		switch f[0] {
+		case '-':
+			sf.Field, sf.Desc = f[1:], true
+		case '+':
+			sf.Field = f[1:]
+		}
+
+		switch {
+		case !contains(spec.Sort, sf.Field):
+			errs = append(errs, &Error{Field: "sort", Message: "unsupported sort field: " + sf.Field})
+		case seen[sf.Field]:
+			errs = append(errs, &Error{Field: "sort", Message: "duplicate sort field: " + sf.Field})
+		default:
+			seen[sf.Field] = true
+			q.Sort = append(q.Sort, sf)
+		}
+	}
+
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		if strings.HasPrefix(k, "filter[") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys) // stable error order
+
+	for _, k := range keys {
+
+		f := strings.TrimPrefix(k, "filter[")
+		if !strings.HasSuffix(f, "]") || len(f) == 1 {
+			errs = append(errs, &Error{Field: k, Message: "malformed filter"})
+			continue
+		}
+
+		if f = f[:len(f)-1]; !contains(spec.Filter, f) {
+			errs = append(errs, &Error{Field: k, Message: "unsupported filter field: " + f})
+			continue
+		}
+
+		q.Filters[f] = append(q.Filters[f], vals[k]...)
+	}
+
+	if len(errs) > 0 {
+		return nil, NewJSONErrorResponse(http.StatusBadRequest, errs...)
+	}
+
+	return q, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
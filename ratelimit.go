@@ -0,0 +1,165 @@
+package apiserv
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LimitStore holds the counters used by RateLimit, implementations must be safe to use from multiple goroutines.
+// Use a shared store (ex: redisstore.Store) so limits hold across multiple instances.
+type LimitStore interface {
+	// Incr increments key and returns the new value, if the key doesn't exist it is created with the ttl.
+	Incr(key string, ttl time.Duration) (n int64, err error)
+
+	// Count returns the current value of key, or 0 if it doesn't exist.
+	Count(key string) (n int64, err error)
+}
+
+// NewMemoryLimitStore returns an in-memory LimitStore, limits are per process.
+func NewMemoryLimitStore() LimitStore {
+	return &memLimitStore{m: map[string]*memCounter{}}
+}
+
+type memCounter struct {
+	expires time.Time
+	n       int64
+}
+
+type memLimitStore struct {
+	mux       sync.Mutex
+	m         map[string]*memCounter
+	lastSweep time.Time
+}
+
+func (ms *memLimitStore) Incr(key string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	if now.Sub(ms.lastSweep) > time.Minute {
+		for k, c := range ms.m {
+			if now.After(c.expires) {
+				delete(ms.m, k)
+			}
+		}
+		ms.lastSweep = now
+	}
+
+	c := ms.m[key]
+	if c == nil || now.After(c.expires) {
+		c = &memCounter{expires: now.Add(ttl)}
+		ms.m[key] = c
+	}
+
+	c.n++
+	return c.n, nil
+}
+
+func (ms *memLimitStore) Count(key string) (int64, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	if c := ms.m[key]; c != nil && time.Now().Before(c.expires) {
+		return c.n, nil
+	}
+	return 0, nil
+}
+
+// RateLimitOptions are the options for RateLimit.
+type RateLimitOptions struct {
+	// Store defaults to NewMemoryLimitStore().
+	Store LimitStore
+
+	// Key returns the key to limit the request by, defaults to ctx.ClientIP(),
+	// returning an empty string skips the limit for the request.
+	// ClientIP trusts the X-Real-Ip and X-Forwarded-For headers, so unless a proxy always overwrites them,
+	// clients can bypass the limit by rotating them, use RemoteIP or TrustedProxyIP instead.
+	Key func(ctx *Context) string
+
+	// Prefix is prepended to the store keys, useful when using multiple limits with the same store.
+	Prefix string
+
+	Limit  int
+	Window time.Duration
+
+	// Sliding uses a sliding window, which is approximated by weighting the previous fixed window's count,
+	// it avoids allowing twice the limit around the window boundary.
+	Sliding bool
+}
+
+// RateLimit returns a middleware that allows opts.Limit requests per opts.Window for each key,
+// it sets the X-RateLimit-* headers, and returns a 429 with Retry-After once the limit is reached.
+// Store errors are logged and the request is let through.
+func RateLimit(opts RateLimitOptions) Handler {
+	if opts.Store == nil {
+		opts.Store = NewMemoryLimitStore()
+	}
+
+	if opts.Key == nil {
+		opts.Key = func(ctx *Context) string { return ctx.ClientIP() }
+	}
+
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+
+	limit := strconv.Itoa(opts.Limit)
+
+	return func(ctx *Context) Response {
+		key := opts.Key(ctx)
+		if key == "" {
+			return nil
+		}
+
+		n, reset, err := opts.hit(opts.Prefix+key, time.Now())
+		if err != nil {
+			ctx.s.Warnf("rate limit (%s): %v", key, err)
+			return nil
+		}
+
+		rem := int64(opts.Limit) - n
+		if rem < 0 {
+			rem = 0
+		}
+
+		h := ctx.Header()
+		h.Set("X-RateLimit-Limit", limit)
+		h.Set("X-RateLimit-Remaining", strconv.FormatInt(rem, 10))
+		h.Set("X-RateLimit-Reset", strconv.Itoa(int(reset/time.Second)+1))
+
+		if n > int64(opts.Limit) {
+			h.Set("Retry-After", strconv.Itoa(int(reset/time.Second)+1))
+			return NewJSONErrorResponse(http.StatusTooManyRequests)
+		}
+
+		return nil
+	}
+}
+
+// hit counts a request for key at now and returns the (weighted for sliding windows) count and when the current window resets.
+func (opts *RateLimitOptions) hit(key string, now time.Time) (n int64, reset time.Duration, err error) {
+	w := int64(opts.Window)
+	idx := now.UnixNano() / w
+	elapsed := now.UnixNano() - idx*w
+	reset = time.Duration(w - elapsed)
+
+	ttl := opts.Window
+	if opts.Sliding { // the previous window is needed for the whole next one
+		ttl *= 2
+	}
+
+	if n, err = opts.Store.Incr(key+":"+strconv.FormatInt(idx, 10), ttl); err != nil || !opts.Sliding {
+		return
+	}
+
+	prev, err := opts.Store.Count(key + ":" + strconv.FormatInt(idx-1, 10))
+	if err != nil {
+		return
+	}
+
+	n += int64(float64(prev) * float64(w-elapsed) / float64(w))
+	return
+}
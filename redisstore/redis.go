@@ -0,0 +1,392 @@
+// Package redisstore implements apiserv.CacheStore on top of redis, using a minimal built-in RESP client.
+package redisstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errors
+var (
+	ErrClosed   = errors.New("redisstore: closed")
+	ErrBadReply = errors.New("redisstore: invalid reply")
+)
+
+// Error is an error reply returned by the redis server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// DefaultPoolSize is the default number of idle connections kept around.
+const DefaultPoolSize = 8
+
+// New returns a new Store connecting to addr with the default options.
+func New(addr string) *Store {
+	return &Store{Addr: addr}
+}
+
+// Store is a redis-backed apiserv.CacheStore, it is safe to use from multiple goroutines.
+// Options must be set before the first call.
+type Store struct {
+	Addr     string
+	Password string
+
+	// Prefix is prepended to every key, useful when sharing a redis db between multiple services.
+	Prefix string
+
+	DB int
+
+	// PoolSize is the max number of idle connections, defaults to DefaultPoolSize.
+	PoolSize int
+
+	// Timeout is used for dialing and for every command, defaults to 5 seconds.
+	Timeout time.Duration
+
+	mux    sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// Get implements apiserv.CacheStore.
+func (s *Store) Get(key string) (val []byte, ok bool, err error) {
+	v, err := s.Do("GET", s.Prefix+key)
+	if err != nil || v == nil {
+		return nil, false, err
+	}
+
+	if val, ok = v.([]byte); !ok {
+		return nil, false, ErrBadReply
+	}
+
+	return val, true, nil
+}
+
+// Set implements apiserv.CacheStore.
+func (s *Store) Set(key string, val []byte, ttl time.Duration) (err error) {
+	if ttl > 0 {
+		_, err = s.Do("SET", s.Prefix+key, val, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	} else {
+		_, err = s.Do("SET", s.Prefix+key, val)
+	}
+	return
+}
+
+// Delete implements apiserv.CacheStore.
+func (s *Store) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, k := range keys {
+		args = append(args, s.Prefix+k)
+	}
+
+	_, err := s.Do(args...)
+	return err
+}
+
+// DeletePrefix implements apiserv.CachePrefixDeleter using SCAN, it is not atomic.
+func (s *Store) DeletePrefix(prefix string) error {
+	match := escapeGlob(s.Prefix+prefix) + "*"
+	cursor := "0"
+
+	for {
+		v, err := s.Do("SCAN", cursor, "MATCH", match, "COUNT", "250")
+		if err != nil {
+			return err
+		}
+
+		arr, ok := v.([]interface{})
+		if !ok || len(arr) != 2 {
+			return ErrBadReply
+		}
+
+		next, _ := arr[0].([]byte)
+		keys, _ := arr[1].([]interface{})
+
+		if len(keys) > 0 {
+			args := make([]interface{}, 0, len(keys)+1)
+			args = append(args, "DEL")
+			args = append(args, keys...)
+			if _, err = s.Do(args...); err != nil {
+				return err
+			}
+		}
+
+		if cursor = string(next); cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// incrScript increments KEYS[1] and sets its ttl to ARGV[1] ms if it doesn't have one, in a single atomic step.
+const incrScript = `local n = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) == -1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`
+
+// Incr implements apiserv.LimitStore, the INCR and the PEXPIRE run in one script so the key can't be left without a ttl.
+func (s *Store) Incr(key string, ttl time.Duration) (int64, error) {
+	v, err := s.Do("EVAL", incrScript, "1", s.Prefix+key, strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := v.(int64)
+	if !ok {
+		return 0, ErrBadReply
+	}
+
+	return n, nil
+}
+
+// Count implements apiserv.LimitStore.
+func (s *Store) Count(key string) (int64, error) {
+	v, err := s.Do("GET", s.Prefix+key)
+	if err != nil || v == nil {
+		return 0, err
+	}
+
+	b, ok := v.([]byte)
+	if !ok {
+		return 0, ErrBadReply
+	}
+
+	return strconv.ParseInt(string(b), 10, 64)
+}
+
+// Do executes a raw redis command, args can be string, []byte or int.
+// Replies are returned as nil, string (status), int64, []byte or []interface{}.
+func (s *Store) Do(args ...interface{}) (interface{}, error) {
+	c, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := c.do(s.timeout(), args...)
+	if _, ok := err.(Error); err != nil && !ok {
+		c.Close()
+		return nil, err
+	}
+
+	s.put(c)
+	return v, err
+}
+
+// Close closes all the idle connections, the store can't be used after it.
+func (s *Store) Close() error {
+	s.mux.Lock()
+	idle := s.idle
+	s.idle, s.closed = nil, true
+	s.mux.Unlock()
+
+	for _, c := range idle {
+		c.Close()
+	}
+
+	return nil
+}
+
+func (s *Store) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return 5 * time.Second
+}
+
+func (s *Store) get() (*conn, error) {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return nil, ErrClosed
+	}
+
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mux.Unlock()
+		return c, nil
+	}
+	s.mux.Unlock()
+
+	return s.dial()
+}
+
+func (s *Store) put(c *conn) {
+	max := s.PoolSize
+	if max <= 0 {
+		max = DefaultPoolSize
+	}
+
+	s.mux.Lock()
+	if !s.closed && len(s.idle) < max {
+		s.idle = append(s.idle, c)
+		c = nil
+	}
+	s.mux.Unlock()
+
+	if c != nil {
+		c.Close()
+	}
+}
+
+func (s *Store) dial() (*conn, error) {
+	to := s.timeout()
+	nc, err := net.DialTimeout("tcp", s.Addr, to)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if s.Password != "" {
+		if _, err = c.do(to, "AUTH", s.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if s.DB != 0 {
+		if _, err = c.do(to, "SELECT", s.DB); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *conn) do(timeout time.Duration, args ...interface{}) (interface{}, error) {
+	if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := writeCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.r)
+}
+
+func writeCommand(w *bufio.Writer, args ...interface{}) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var b []byte
+		switch v := arg.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		case int:
+			b = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		default:
+			return fmt.Errorf("redisstore: unsupported argument type %T", arg)
+		}
+
+		fmt.Fprintf(w, "$%d\r\n", len(b))
+		w.Write(b)
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrBadReply
+	}
+
+	typ, rest := line[0], string(line[1:len(line)-2])
+	switch typ {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, Error(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, ErrBadReply
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, ErrBadReply
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		// error replies inside the array don't stop the read, the rest of it has to be consumed
+		// so the connection can be reused, the first one is returned.
+		var rerr error
+		arr := make([]interface{}, n)
+		for i := range arr {
+			v, err := readReply(r)
+			if _, ok := err.(Error); err != nil && !ok {
+				return nil, err
+			} else if err != nil && rerr == nil {
+				rerr = err
+			}
+			arr[i] = v
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+		return arr, nil
+	}
+
+	return nil, ErrBadReply
+}
+
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
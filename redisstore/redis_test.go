@@ -0,0 +1,203 @@
+package redisstore
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+var (
+	_ apiserv.CacheStore         = (*Store)(nil)
+	_ apiserv.CachePrefixDeleter = (*Store)(nil)
+	_ apiserv.LimitStore         = (*Store)(nil)
+)
+
+// fakeRedis implements just enough of redis to test the store.
+func fakeRedis(t *testing.T) (addr string, closeFn func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mux  sync.Mutex
+		m    = map[string][]byte{}
+		ttls = map[string]string{}
+	)
+
+	handle := func(c net.Conn) {
+		defer c.Close()
+		r, w := bufio.NewReader(c), bufio.NewWriter(c)
+		for {
+			v, err := readReply(r)
+			if err != nil {
+				return
+			}
+
+			args := v.([]interface{})
+			cmd := strings.ToUpper(string(args[0].([]byte)))
+
+			mux.Lock()
+			switch cmd {
+			case "GET":
+				if v, ok := m[string(args[1].([]byte))]; ok {
+					fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+				} else {
+					w.WriteString("$-1\r\n")
+				}
+			case "SET":
+				m[string(args[1].([]byte))] = args[2].([]byte)
+				w.WriteString("+OK\r\n")
+			case "EVAL":
+				// only incrScript is supported
+				if string(args[1].([]byte)) != incrScript {
+					w.WriteString("-ERR unknown script\r\n")
+					break
+				}
+				k := string(args[3].([]byte))
+				n, _ := strconv.ParseInt(string(m[k]), 10, 64)
+				n++
+				m[k] = []byte(strconv.FormatInt(n, 10))
+				if _, ok := ttls[k]; !ok {
+					ttls[k] = string(args[4].([]byte))
+				}
+				fmt.Fprintf(w, ":%d\r\n", n)
+			case "PTTL":
+				if ttl, ok := ttls[string(args[1].([]byte))]; ok {
+					fmt.Fprintf(w, ":%s\r\n", ttl)
+				} else {
+					w.WriteString(":-1\r\n")
+				}
+			case "DEL":
+				for _, k := range args[1:] {
+					delete(m, string(k.([]byte)))
+				}
+				fmt.Fprintf(w, ":%d\r\n", len(args)-1)
+			case "SCAN":
+				prefix := strings.TrimSuffix(string(args[3].([]byte)), "*")
+				var keys []string
+				for k := range m {
+					if strings.HasPrefix(k, prefix) {
+						keys = append(keys, k)
+					}
+				}
+				fmt.Fprintf(w, "*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+				for _, k := range keys {
+					fmt.Fprintf(w, "$%d\r\n%s\r\n", len(k), k)
+				}
+			case "ERRARR":
+				w.WriteString("*3\r\n:1\r\n-ERR in array\r\n$3\r\nabc\r\n")
+			default:
+				fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", cmd)
+			}
+			mux.Unlock()
+			w.Flush()
+		}
+	}
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(c)
+		}
+	}()
+
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func TestStore(t *testing.T) {
+	addr, closeFn := fakeRedis(t)
+	defer closeFn()
+
+	s := New(addr)
+	s.Prefix = "test:"
+	defer s.Close()
+
+	if _, ok, err := s.Get("a"); ok || err != nil {
+		t.Fatalf("unexpected get: %v %v", ok, err)
+	}
+
+	for _, k := range []string{"a", "u/1", "u/2"} {
+		if err := s.Set(k, []byte("val:"+k), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v, ok, err := s.Get("a"); !ok || err != nil || string(v) != "val:a" {
+		t.Fatalf("unexpected get: %q %v %v", v, ok, err)
+	}
+
+	if err := s.DeletePrefix("u/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := s.Get("u/1"); ok {
+		t.Fatal("u/1 should have been deleted")
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := s.Get("a"); ok {
+		t.Fatal("a should have been deleted")
+	}
+
+	if _, err := s.Do("NOPE"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("expected a redis error, got %v", err)
+	}
+
+	// make sure the connection is still usable after an error reply
+	if _, _, err := s.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Do("ERRARR"); err == nil || !strings.Contains(err.Error(), "in array") {
+		t.Fatalf("expected the array's error, got %v", err)
+	}
+
+	// the rest of the array must have been read
+	if err := s.Set("b", []byte("b"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok, err := s.Get("b"); !ok || err != nil || string(v) != "b" {
+		t.Fatalf("unexpected get after an array error: %q %v %v", v, ok, err)
+	}
+}
+
+func TestLimitStore(t *testing.T) {
+	addr, closeFn := fakeRedis(t)
+	defer closeFn()
+
+	s := New(addr)
+	defer s.Close()
+
+	for i := int64(1); i <= 3; i++ {
+		if n, err := s.Incr("rl", time.Minute); err != nil || n != i {
+			t.Fatalf("unexpected incr: %v %v", n, err)
+		}
+	}
+
+	if n, err := s.Count("rl"); err != nil || n != 3 {
+		t.Fatalf("unexpected count: %v %v", n, err)
+	}
+
+	if v, err := s.Do("PTTL", "rl"); err != nil || v != int64(60000) {
+		t.Fatalf("expected the key to have a ttl, got %v %v", v, err)
+	}
+
+	if n, err := s.Count("nope"); err != nil || n != 0 {
+		t.Fatalf("unexpected count: %v %v", n, err)
+	}
+}
@@ -0,0 +1,38 @@
+package apiserv
+
+import (
+	"context"
+	"net/http"
+)
+
+type reqValuesKey struct{}
+
+// reqValues links a Context's data to the request's context, parent is set if the request
+// went through another server first (ex: an http.Handler wrapping a mounted server).
+type reqValues struct {
+	m      *M // Context.data is allocated on the first Set
+	parent *reqValues
+}
+
+func (rv *reqValues) get(key string) (interface{}, bool) {
+	for ; rv != nil; rv = rv.parent {
+		if v, ok := (*rv.m)[key]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// ContextValue returns the value set with Context.Set on the request that owns c, or nil,
+// it allows plain http.Handlers to read them, requires Options.RequestContextValues.
+func ContextValue(c context.Context, key string) interface{} {
+	rv, _ := c.Value(reqValuesKey{}).(*reqValues)
+	v, _ := rv.get(key)
+	return v
+}
+
+// withReqValues returns a copy of req with m attached to its context.
+func withReqValues(req *http.Request, m *M) *http.Request {
+	parent, _ := req.Context().Value(reqValuesKey{}).(*reqValues)
+	return req.WithContext(context.WithValue(req.Context(), reqValuesKey{}, &reqValues{m: m, parent: parent}))
+}
@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package apiserv
+
+import "net/http"
+
+// WithResource returns a middleware that acquires a per-request resource (ex: a db transaction), stores it in the ctx using key,
+// then runs the rest of the chain and calls release once it's done, which can commit or roll back based on ctx.Status().
+// If acquire fails the request gets a 500, if a handler panics, release gets a 500 response before the panic is passed on.
+//
+//	s.Use(apiserv.WithResource("tx", func(ctx *apiserv.Context) (*sql.Tx, error) {
+//		return db.BeginTx(ctx.Req.Context(), nil)
+//	}, func(ctx *apiserv.Context, tx *sql.Tx, _ apiserv.Response) {
+//		if ctx.Status() < http.StatusBadRequest {
+//			tx.Commit()
+//		} else {
+//			tx.Rollback()
+//		}
+//	}))
+//
+// Note that responses are written as soon as a handler returns them, so release runs after the response was sent.
+func WithResource[T any](key string, acquire func(ctx *Context) (T, error), release func(ctx *Context, res T, resp Response)) Handler {
+	return func(ctx *Context) Response {
+		res, err := acquire(ctx)
+		if err != nil {
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+
+		ctx.Set(key, res)
+
+		defer func() {
+			if v := recover(); v != nil {
+				if !ctx.done {
+					ctx.status = http.StatusInternalServerError
+				}
+				release(ctx, res, NewJSONErrorResponse(http.StatusInternalServerError))
+				panic(v)
+			}
+		}()
+
+		release(ctx, res, ctx.Next())
+		return Break
+	}
+}
+
+// GetResource returns the resource stored by WithResource using key, or T's zero value.
+func GetResource[T any](ctx *Context, key string) T {
+	v, _ := ctx.Get(key).(T)
+	return v
+}
@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package apiserv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testTx struct {
+	committed, rolledBack bool
+}
+
+func TestWithResource(t *testing.T) {
+	var last *testTx
+	srv := New(SetErrLogger(nil))
+	srv.Use(WithResource("tx", func(ctx *Context) (*testTx, error) {
+		last = &testTx{}
+		return last, nil
+	}, func(ctx *Context, tx *testTx, _ Response) {
+		if ctx.Status() < http.StatusBadRequest {
+			tx.committed = true
+		} else {
+			tx.rolledBack = true
+		}
+	}))
+
+	srv.GET("/ok", func(ctx *Context) Response {
+		if GetResource[*testTx](ctx, "tx") != last {
+			t.Error("unexpected resource")
+		}
+		return RespOK
+	})
+	srv.GET("/fail", func(ctx *Context) Response { return RespBadRequest })
+	srv.GET("/panic", func(ctx *Context) Response { panic("boom") })
+
+	for path, commit := range map[string]bool{"/ok": true, "/fail": false, "/panic": false} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+		if last == nil || last.committed != commit || last.rolledBack == commit {
+			t.Fatalf("%s: unexpected tx: %+v", path, last)
+		}
+		last = nil
+	}
+}
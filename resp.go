@@ -1,13 +1,21 @@
 package apiserv
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/missionMeteora/apiserv/internal"
 	tkErrors "github.com/missionMeteora/toolkit/errors"
@@ -18,16 +26,65 @@ var EnableCacheResponse bool
 
 var bufPool otk.BufferPool
 
+// maxPooledJSONBuffer is the max capacity of a json buffer that gets returned to the pool,
+// anything bigger gets dropped so one huge response doesn't pin memory forever.
+const maxPooledJSONBuffer = 64 << 10
+
+type jsonBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+// encoder returns the pooled stdlib encoder, or a new encoder for custom codecs.
+func (jb *jsonBuffer) encoder(c Codec, indent bool) Encoder {
+	if c == StdJSON {
+		return jb.enc
+	}
+
+	enc := c.NewEncoder(&jb.Buffer)
+	if ie, ok := enc.(IndentEncoder); ok && indent {
+		ie.SetIndent("", "\t")
+	}
+	return enc
+}
+
+var jsonBufPool = sync.Pool{
+	New: func() interface{} {
+		var jb jsonBuffer
+		jb.enc = json.NewEncoder(&jb.Buffer)
+		return &jb
+	},
+}
+
+func getJSONBuffer(indent bool) *jsonBuffer {
+	jb := jsonBufPool.Get().(*jsonBuffer)
+	if indent {
+		jb.enc.SetIndent("", "\t")
+	} else {
+		jb.enc.SetIndent("", "")
+	}
+	return jb
+}
+
+func putJSONBuffer(jb *jsonBuffer) {
+	if jb.Cap() > maxPooledJSONBuffer {
+		return
+	}
+	jb.Reset()
+	jsonBufPool.Put(jb)
+}
+
 // Common responses
 var (
-	RespMethodNotAllowed Response = NewJSONErrorResponse(http.StatusMethodNotAllowed)
-	RespNotFound         Response = NewJSONErrorResponse(http.StatusNotFound)
-	RespForbidden        Response = NewJSONErrorResponse(http.StatusForbidden)
-	RespBadRequest       Response = NewJSONErrorResponse(http.StatusBadRequest)
-	RespOK               Response = NewJSONResponse("OK")
-	RespEmpty            Response = &simpleResp{code: http.StatusNoContent}
-	RespPlainOK          Response = &simpleResp{code: http.StatusOK}
-	RespRedirectRoot              = Redirect("/", false)
+	RespMethodNotAllowed   Response = NewJSONErrorResponse(http.StatusMethodNotAllowed)
+	RespNotFound           Response = NewJSONErrorResponse(http.StatusNotFound)
+	RespForbidden          Response = NewJSONErrorResponse(http.StatusForbidden)
+	RespBadRequest         Response = NewJSONErrorResponse(http.StatusBadRequest)
+	RespServiceUnavailable Response = NewJSONErrorResponse(http.StatusServiceUnavailable)
+	RespOK                 Response = NewJSONResponse("OK")
+	RespEmpty              Response = &simpleResp{code: http.StatusNoContent}
+	RespPlainOK            Response = &simpleResp{code: http.StatusOK}
+	RespRedirectRoot                = Redirect("/", false)
 
 	// Break can be returned from a handler to break a handler chain.
 	// It doesn't write anything to the connection.
@@ -94,8 +151,8 @@ func ReadJSONResponse(rc io.ReadCloser, dataValue interface{}) (r *JSONResponse,
 	}
 
 	var me MultiError
-	for _, v := range r.Errors {
-		me.Push(&v)
+	for i := range r.Errors {
+		me.Push(&r.Errors[i])
 	}
 
 	if err = me.Err(); err == nil {
@@ -105,6 +162,83 @@ func ReadJSONResponse(rc io.ReadCloser, dataValue interface{}) (r *JSONResponse,
 	return
 }
 
+// ReadJSONStream reads a stream of json values from rc and calls fn with each of them, then closes rc.
+// Both ndjson (or any whitespace separated values) and a top-level array (see StreamJSONArray) are supported,
+// so large responses can be processed without buffering all of them, returning an error from fn stops reading.
+// A truncated array returns io.ErrUnexpectedEOF.
+func ReadJSONStream(rc io.ReadCloser, fn func(raw json.RawMessage) error) error {
+	defer rc.Close()
+
+	er := &eofReader{r: rc}
+	br := bufio.NewReader(er)
+	array := false
+
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if c := b[0]; c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			br.ReadByte()
+			continue
+		}
+
+		array = b[0] == '['
+		break
+	}
+
+	dec := json.NewDecoder(br)
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if array && !dec.More() {
+			if _, err := dec.Token(); err != nil { // the closing bracket
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			switch {
+			case err == io.EOF && !array:
+				return nil
+			case array && er.eof:
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// eofReader records if the underlying reader returned io.EOF.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (er *eofReader) Read(p []byte) (n int, err error) {
+	n, err = er.r.Read(p)
+	if err == io.EOF {
+		er.eof = true
+	}
+	return
+}
+
+// JSONRequest is a one-off json request helper, see Client for base urls, headers, timeouts and retries.
 func JSONRequest(method, url string, reqData, respData interface{}) (err error) {
 	return otk.Request(method, "", url, reqData, func(r *http.Response) error {
 		_, err := ReadJSONResponse(r.Body, respData)
@@ -114,11 +248,20 @@ func JSONRequest(method, url string, reqData, respData interface{}) (err error)
 
 // JSONResponse is the default standard api response
 type JSONResponse struct {
-	Data    interface{} `json:"data,omitempty"`
-	Errors  []Error     `json:"errors,omitempty"`
-	Code    int         `json:"code"`
-	Success bool        `json:"success"`
-	Indent  bool        `json:"-"`
+	Data      interface{} `json:"data,omitempty"`
+	Errors    []Error     `json:"errors,omitempty"`
+	RequestID string      `json:"requestID,omitempty"`
+	Code      int         `json:"code"`
+	Success   bool        `json:"success"`
+	Indent    bool        `json:"-"`
+
+	// Page, PerPage and Total are set for paginated responses, see Pagination.Response.
+	Page    int    `json:"page,omitempty"`
+	PerPage int    `json:"perPage,omitempty"`
+	Total   *int64 `json:"total,omitempty"`
+
+	// NextCursor is set for cursor paginated responses, see Pagination.CursorResponse.
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // WriteToCtx writes the response to a ResponseWriter
@@ -141,6 +284,11 @@ func (r *JSONResponse) WriteToCtx(ctx *Context) error {
 		defer bufPool.Put(bp)
 		r.Data = json.RawMessage(bp.Bytes())
 	}
+
+	if r.paginated() {
+		r.setLinkHeader(ctx)
+	}
+
 	return ctx.JSON(r.Code, r.Indent, r)
 }
 
@@ -303,20 +451,132 @@ func (r redirResp) WriteToCtx(ctx *Context) error {
 
 // File returns a file response.
 // example: return File("plain/html", "index.html")
-func File(contentType, fp string) Response {
-	return fileResp{contentType, fp}
+// opts can control the Content-Disposition and Last-Modified headers:
+//
+//	return File("", fp, FileAttachment("report.pdf"), FileModTime(r.UpdatedAt))
+func File(contentType, fp string, opts ...FileOption) Response {
+	fr := fileResp{ct: contentType, fp: fp}
+	for _, fn := range opts {
+		fn(&fr.opts)
+	}
+	return fr
+}
+
+// FileOptions are the options for a File response.
+type FileOptions struct {
+	// ModTime overrides the file's modification time, used for Last-Modified and conditional requests.
+	ModTime time.Time
+
+	// Disposition is either "inline" or "attachment", Content-Disposition isn't set if empty.
+	Disposition string
+
+	// Filename is the name the client sees, defaults to the file's base name.
+	Filename string
+}
+
+// FileOption is a func to set FileOptions.
+type FileOption func(fo *FileOptions)
+
+// FileInline sets Content-Disposition to inline with an optional filename.
+func FileInline(filename string) FileOption {
+	return func(fo *FileOptions) {
+		fo.Disposition, fo.Filename = "inline", filename
+	}
+}
+
+// FileAttachment sets Content-Disposition to attachment, so browsers download the file as filename instead of showing it.
+// Non-ascii filenames are RFC 5987 encoded.
+func FileAttachment(filename string) FileOption {
+	return func(fo *FileOptions) {
+		fo.Disposition, fo.Filename = "attachment", filename
+	}
+}
+
+// FileModTime overrides the file's modification time.
+func FileModTime(t time.Time) FileOption {
+	return func(fo *FileOptions) {
+		fo.ModTime = t
+	}
 }
 
 type fileResp struct {
-	ct string
-	fp string
+	ct   string
+	fp   string
+	opts FileOptions
 }
 
 func (f fileResp) WriteToCtx(ctx *Context) error {
 	if f.ct != "" {
 		ctx.SetContentType(f.ct)
 	}
-	return ctx.File(f.fp)
+
+	if d := f.opts.Disposition; d != "" {
+		fn := f.opts.Filename
+		if fn == "" {
+			fn = filepath.Base(f.fp)
+		}
+		ctx.Header().Set("Content-Disposition", contentDisposition(d, fn))
+	}
+
+	if f.opts.ModTime.IsZero() {
+		return ctx.File(f.fp)
+	}
+
+	fp, err := os.Open(f.fp)
+	if err != nil {
+		return ctx.File(f.fp) // let ServeFile handle the error response
+	}
+	defer fp.Close()
+
+	ctx.ServeContent(f.fp, f.opts.ModTime, fp)
+	return nil
+}
+
+// Attachment returns a response that streams r as a download with the given filename.
+// if contentType is empty, it defaults to MimeBinary.
+// if r implements io.Closer, it gets closed after the response is written.
+// example: return Attachment("report.csv", "text/csv", f)
+func Attachment(filename, contentType string, r io.Reader) Response {
+	return attachmentResp{filename, contentType, r}
+}
+
+type attachmentResp struct {
+	fn string
+	ct string
+	r  io.Reader
+}
+
+func (a attachmentResp) WriteToCtx(ctx *Context) error {
+	if c, ok := a.r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	ct := a.ct
+	if ct == "" {
+		ct = MimeBinary
+	}
+
+	ctx.SetContentType(ct)
+	ctx.Header().Set("Content-Disposition", contentDisposition("attachment", a.fn))
+	ctx.WriteHeader(http.StatusOK)
+
+	_, err := io.Copy(ctx, a.r)
+	return err
+}
+
+// contentDisposition returns a Content-Disposition header value for the given type and filename,
+// non-ascii filenames get RFC 2231 encoded by mime.FormatMediaType.
+func contentDisposition(typ, filename string) string {
+	if filename == "" {
+		return typ
+	}
+
+	filename = filepath.Base(strings.Replace(filename, "\\", "/", -1))
+	if v := mime.FormatMediaType(typ, map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+
+	return typ
 }
 
 // PlainResponse returns SimpleResponse(200, contentType, val).
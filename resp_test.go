@@ -0,0 +1,408 @@
+package apiserv
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/missionMeteora/apiserv/internal"
+)
+
+func TestJSONResponseContentLength(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/ping", func(ctx *Context) Response {
+		return NewJSONResponse("pong")
+	})
+	srv.GET("/bad", func(ctx *Context) Response {
+		return NewJSONResponse(func() {})
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	if cl := rw.Header().Get("Content-Length"); cl != strconv.Itoa(rw.Body.Len()) {
+		t.Fatalf("unexpected content-length: %q (%d)", cl, rw.Body.Len())
+	}
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/bad", nil))
+
+	if rw.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a 500, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/dl/:name", func(ctx *Context) Response {
+		return Attachment(ctx.Param("name"), "text/csv", strings.NewReader("a,b,c\n"))
+	})
+
+	for name, exp := range map[string]string{
+		"report.csv":           `attachment; filename=report.csv`,
+		"my report.csv":        `attachment; filename="my report.csv"`,
+		"r\u00e9sum\u00e9.csv": `attachment; filename*=utf-8''r%C3%A9sum%C3%A9.csv`,
+	} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/dl/"+url.PathEscape(name), nil))
+
+		if cd := rw.Header().Get("Content-Disposition"); cd != exp {
+			t.Fatalf("%s: expected %q, got %q", name, exp, cd)
+		}
+
+		if ct := rw.Header().Get("Content-Type"); ct != "text/csv" {
+			t.Fatalf("unexpected content-type: %q", ct)
+		}
+
+		if body := rw.Body.String(); body != "a,b,c\n" {
+			t.Fatalf("unexpected body: %q", body)
+		}
+	}
+}
+
+func BenchmarkJSONResponse(b *testing.B) {
+	srv := New(SetErrLogger(nil))
+	data := M{"id": 42, "name": "apiserv", "tags": []string{"a", "b", "c"}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		rw := httptest.NewRecorder()
+		for pb.Next() {
+			rw.Body.Reset()
+			ctx := getCtx(rw, req, nil, srv)
+			NewJSONResponse(data).WriteToCtx(ctx)
+			putCtx(ctx)
+		}
+	})
+}
+
+func BenchmarkJSONResponseIndent(b *testing.B) {
+	srv := New(SetErrLogger(nil))
+	data := M{"id": 42, "name": "apiserv", "tags": []string{"a", "b", "c"}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		rw := httptest.NewRecorder()
+		for pb.Next() {
+			rw.Body.Reset()
+			ctx := getCtx(rw, req, nil, srv)
+			r := NewJSONResponse(data)
+			r.Indent = true
+			r.WriteToCtx(ctx)
+			putCtx(ctx)
+		}
+	})
+}
+
+type countingCodec struct {
+	Codec
+	enc, dec int
+}
+
+func (c *countingCodec) NewEncoder(w io.Writer) Encoder { c.enc++; return c.Codec.NewEncoder(w) }
+func (c *countingCodec) NewDecoder(r io.Reader) Decoder { c.dec++; return c.Codec.NewDecoder(r) }
+
+func TestJSONCodec(t *testing.T) {
+	cc := &countingCodec{Codec: StdJSON}
+	srv := New(SetJSONCodec(cc))
+	srv.POST("/", func(ctx *Context) Response {
+		var v M
+		if err := ctx.BindJSON(&v); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(v)
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"a":1}`)))
+	if rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), `"a":1`) {
+		t.Fatalf("unexpected response: %d %s", rw.Code, rw.Body.String())
+	}
+
+	if cc.enc != 1 || cc.dec != 1 {
+		t.Fatalf("codec wasn't used: %+v", cc)
+	}
+
+	if LookupJSONCodec("std") != StdJSON {
+		t.Fatal("std codec isn't registered")
+	}
+}
+
+func TestPagination(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/items", func(ctx *Context) Response {
+		p := ctx.Pagination()
+		return p.Response([]int{p.Offset()}, 95)
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/items?page=2&per_page=500&q=x", nil))
+
+	var (
+		items []int
+		r     = JSONResponse{Data: &items}
+	)
+
+	if err := internal.Unmarshal(rw.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Page != 2 || r.PerPage != MaxPerPage || r.Total == nil || *r.Total != 95 || items[0] != MaxPerPage {
+		t.Fatalf("unexpected response: %s", rw.Body.Bytes())
+	}
+
+	exp := `</items?limit=100&page=1&q=x>; rel="first", </items?limit=100&page=1&q=x>; rel="prev", </items?limit=100&page=1&q=x>; rel="last"`
+	if l := rw.Header().Get("Link"); l != exp {
+		t.Fatalf("unexpected link header:\nwant %s\ngot  %s", exp, l)
+	}
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/items?page=-1&limit=x", nil))
+
+	if l := rw.Header().Get("Link"); !strings.Contains(l, `</items?limit=20&page=2>; rel="next"`) {
+		t.Fatalf("unexpected link header: %s", l)
+	}
+
+	p := &Pagination{Page: maxInt, PerPage: MaxPerPage}
+	if o := p.Offset(); o != maxInt {
+		t.Fatalf("expected the offset to be capped, got %d", o)
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	type keyset struct {
+		LastID int `json:"lastID"`
+	}
+
+	cs := NewCursorSigner([]byte("0123456789abcdef0123456789abcdef"))
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/items", func(ctx *Context) Response {
+		p := ctx.Pagination()
+
+		var ks keyset
+		if _, err := p.DecodeCursor(cs, &ks); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, &Error{Field: "cursor", Message: err.Error()})
+		}
+
+		r, err := p.CursorResponse(cs, []int{ks.LastID + 1}, &keyset{ks.LastID + 1})
+		if err != nil {
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+		return r
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	var r JSONResponse
+	if err := internal.Unmarshal(rw.Body.Bytes(), &r); err != nil || r.NextCursor == "" {
+		t.Fatalf("unexpected response (%v): %s", err, rw.Body.Bytes())
+	}
+
+	if l := rw.Header().Get("Link"); l != `</items?cursor=`+r.NextCursor+`>; rel="next"` {
+		t.Fatalf("unexpected link header: %s", l)
+	}
+
+	var ks keyset
+	if err := cs.Decode(r.NextCursor, &ks); err != nil || ks.LastID != 1 {
+		t.Fatalf("unexpected cursor (%v): %+v", err, ks)
+	}
+
+	tampered := []byte(r.NextCursor)
+	tampered[len(tampered)-2] ^= 1
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/items?cursor="+string(tampered), nil))
+
+	if rw.Code != http.StatusBadRequest {
+		t.Fatalf("expected a 400 for a tampered cursor, got %d: %s", rw.Code, rw.Body.Bytes())
+	}
+}
+
+func TestFileOptions(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "r.pdf")
+	if err := ioutil.WriteFile(fp, []byte("%PDF-"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/inline", func(ctx *Context) Response { return File("", fp, FileInline("")) })
+	srv.GET("/dl", func(ctx *Context) Response {
+		return File("application/pdf", fp, FileAttachment("résumé.pdf"), FileModTime(mod))
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/inline", nil))
+	if cd := rw.Header().Get("Content-Disposition"); cd != "inline; filename=r.pdf" || rw.Body.String() != "%PDF-" {
+		t.Fatalf("unexpected response: %q %q", cd, rw.Body.String())
+	}
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/dl", nil))
+	if cd := rw.Header().Get("Content-Disposition"); cd != `attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf` {
+		t.Fatalf("unexpected disposition: %q", cd)
+	}
+
+	if lm := rw.Header().Get("Last-Modified"); lm != mod.Format(http.TimeFormat) || rw.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("unexpected headers: %v", rw.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dl", nil)
+	req.Header.Set("If-Modified-Since", mod.Format(http.TimeFormat))
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNotModified {
+		t.Fatalf("expected a 304, got %d", rw.Code)
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/gen.txt", func(ctx *Context) Response {
+		ctx.ServeContent("gen.txt", time.Time{}, strings.NewReader("generated content"))
+		return Break
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/gen.txt", nil)
+	req.Header.Set("Range", "bytes=10-")
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusPartialContent || rw.Body.String() != "content" || !strings.HasPrefix(rw.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected response %d: %q %v", rw.Code, rw.Body.String(), rw.Header())
+	}
+
+	req.Header.Set("Range", "bytes=100-")
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusRequestedRangeNotSatisfiable || !strings.Contains(rw.Body.String(), `"code":416`) {
+		t.Fatalf("expected a json 416, got %d: %s", rw.Code, rw.Body.String())
+	}
+}
+
+func TestAutoETag(t *testing.T) {
+	srv := New(SetAutoETag(true))
+	srv.GET("/x", func(ctx *Context) Response { return NewJSONResponse("hello") })
+	srv.POST("/x", func(ctx *Context) Response { return NewJSONResponse("hello") })
+
+	do := func(method, inm string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/x", nil)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := do(http.MethodGet, "")
+	etag := rw.Header().Get("ETag")
+	if rw.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("unexpected response: %d %q", rw.Code, etag)
+	}
+
+	if rw = do(http.MethodGet, `"nope", `+strings.TrimPrefix(etag, "W/")); rw.Code != http.StatusNotModified || rw.Body.Len() != 0 {
+		t.Fatalf("expected a 304, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	if rw = do(http.MethodGet, `"nope"`); rw.Code != http.StatusOK {
+		t.Fatalf("expected a 200, got %d", rw.Code)
+	}
+
+	if rw = do(http.MethodPost, etag); rw.Code != http.StatusOK || rw.Header().Get("ETag") != "" {
+		t.Fatalf("POST requests shouldn't get an etag: %d %v", rw.Code, rw.Header())
+	}
+}
+
+func TestStreamJSONArray(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/cb/:n", func(ctx *Context) Response {
+		n, _ := strconv.Atoi(ctx.Param("n"))
+		return StreamJSONArray(func(send func(v interface{}) error) error {
+			for i := 0; i < n; i++ {
+				if err := send(M{"i": i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+
+	srv.GET("/ch", func(ctx *Context) Response {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 0; i < 3; i++ {
+				ch <- i
+			}
+		}()
+		return StreamJSONArrayChan(ch)
+	})
+
+	for p, exp := range map[string]string{
+		"/cb/0": "[]\n",
+		"/cb/2": `[{"i":0},{"i":1}]` + "\n",
+		"/ch":   "[0,1,2]\n",
+	} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, p, nil))
+		if rw.Body.String() != exp || rw.Header().Get("Content-Type") != MimeJSON {
+			t.Fatalf("%s: expected %q, got %q (%s)", p, exp, rw.Body.String(), rw.Header().Get("Content-Type"))
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/cb/200", nil))
+
+	var out []M
+	if err := internal.Unmarshal(rw.Body.Bytes(), &out); err != nil || len(out) != 200 {
+		t.Fatalf("unexpected output (%v): %d", err, len(out))
+	}
+}
+
+func TestReadJSONStream(t *testing.T) {
+	read := func(s string) (out []string, err error) {
+		err = ReadJSONStream(ioutil.NopCloser(strings.NewReader(s)), func(raw json.RawMessage) error {
+			out = append(out, string(raw))
+			return nil
+		})
+		return
+	}
+
+	for in, exp := range map[string]string{
+		"":                         "",
+		"{\"a\":1}\n\n{\"a\":2}\n": `{"a":1}|{"a":2}`,
+		" [1, {\"b\":[2]}, \"x\"]": `1|{"b":[2]}|"x"`,
+		"[]":                       "",
+	} {
+		out, err := read(in)
+		if err != nil || strings.Join(out, "|") != exp {
+			t.Fatalf("%q: expected %q, got %q (%v)", in, exp, out, err)
+		}
+	}
+
+	if _, err := read("[1, 2"); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	errStop := errors.New("stop")
+	n := 0
+	if err := ReadJSONStream(ioutil.NopCloser(strings.NewReader("1 2 3")), func(json.RawMessage) error { n++; return errStop }); err != errStop || n != 1 {
+		t.Fatalf("expected fn's error after 1 value, got %v after %d", err, n)
+	}
+}
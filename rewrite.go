@@ -0,0 +1,93 @@
+package apiserv
+
+import (
+	"context"
+	"strings"
+)
+
+// RewriteRule describes how the Rewrite middleware modifies a request.
+type RewriteRule struct {
+	// Path returns the new request path, if it returns an empty string the path is left as is.
+	Path func(path string) string
+
+	// Host replaces the request's Host if not empty.
+	Host string
+
+	// SetHeaders are set on the request, replacing any existing values.
+	SetHeaders map[string]string
+
+	// AddHeaders are added to the request.
+	AddHeaders map[string]string
+
+	// StripHeaders are removed from the request.
+	StripHeaders []string
+
+	// Rematch dispatches the rewritten request through the router again, so it gets handled by
+	// whatever route matches the new path rather than the rest of the current chain.
+	// A request is only ever rematched once.
+	Rematch bool
+}
+
+type rewriteCtxKey struct{}
+
+// RewritePrefix returns a RewriteRule.Path func that replaces the from prefix with to.
+// example: Rewrite(RewriteRule{Path: RewritePrefix("/v1/", "/v2/"), Rematch: true})
+func RewritePrefix(from, to string) func(string) string {
+	return func(p string) string {
+		if !strings.HasPrefix(p, from) {
+			return ""
+		}
+		return to + p[len(from):]
+	}
+}
+
+// Rewrite returns a middleware that applies rule to the request before calling the rest of the chain.
+func Rewrite(rule RewriteRule) Handler {
+	return func(ctx *Context) Response {
+		req := ctx.Req
+
+		if rule.Host != "" {
+			req.Host = rule.Host
+		}
+
+		h := req.Header
+		for _, k := range rule.StripHeaders {
+			h.Del(k)
+		}
+
+		for k, v := range rule.SetHeaders {
+			h.Set(k, v)
+		}
+
+		for k, v := range rule.AddHeaders {
+			h.Add(k, v)
+		}
+
+		if rule.Path == nil {
+			return nil
+		}
+
+		np := rule.Path(req.URL.Path)
+		if np == "" || np == req.URL.Path {
+			return nil
+		}
+
+		req.URL.Path, req.URL.RawPath = np, ""
+		req.RequestURI = req.URL.RequestURI()
+
+		if !rule.Rematch || req.Context().Value(rewriteCtxKey{}) != nil {
+			return nil
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), rewriteCtxKey{}, true))
+		ctx.s.r.ServeHTTP(ctx.ResponseWriter, req)
+		ctx.done = true
+
+		return Break
+	}
+}
+
+// RewriteHeaders is a shorthand for Rewrite(RewriteRule{SetHeaders: set, StripHeaders: strip}).
+func RewriteHeaders(set map[string]string, strip ...string) Handler {
+	return Rewrite(RewriteRule{SetHeaders: set, StripHeaders: strip})
+}
@@ -1,7 +1,10 @@
 package router
 
 import (
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 )
 
@@ -18,3 +21,99 @@ func TestBugGithub3(t *testing.T) {
 	}
 	h(nil, nil, p)
 }
+
+func TestExplicitHead(t *testing.T) {
+	r := New(nil)
+	_ = r.AddRoute("", "GET", "/x/:id", func(w http.ResponseWriter, req *http.Request, p Params) { w.WriteHeader(http.StatusOK) })
+	_ = r.AddRoute("", "HEAD", "/x/:id", func(w http.ResponseWriter, req *http.Request, p Params) { w.WriteHeader(http.StatusAccepted) })
+
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, httptest.NewRequest("HEAD", "/x/1", nil))
+	if rw.Code != http.StatusAccepted {
+		t.Fatalf("the HEAD handler wasn't used: %d", rw.Code)
+	}
+}
+
+func TestParamsTyped(t *testing.T) {
+	p := Params{{"id", "42"}, {"neg", "-1"}, {"big", "9223372036854775808"}, {"on", "true"}, {"uid", "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}, {"ts", "1600000000"}, {"bad", "x"}}
+
+	if n, err := p.Int("id"); err != nil || n != 42 {
+		t.Fatalf("unexpected int: %v %v", n, err)
+	}
+
+	if n, err := p.Uint("id"); err != nil || n != 42 {
+		t.Fatalf("unexpected uint: %v %v", n, err)
+	}
+
+	if _, err := p.Uint("neg"); !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := p.Uint64("neg"); !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := p.Int64("big"); !errors.Is(err, strconv.ErrRange) {
+		t.Fatalf("expected a range error, got %v", err)
+	}
+
+	if _, err := p.Int("big"); !errors.Is(err, strconv.ErrRange) {
+		t.Fatalf("expected a range error, got %v", err)
+	}
+
+	if n, err := p.Uint64("big"); err != nil || n != 1<<63 {
+		t.Fatalf("unexpected uint: %v %v", n, err)
+	}
+
+	if b, err := p.Bool("on"); err != nil || !b {
+		t.Fatalf("unexpected bool: %v %v", b, err)
+	}
+
+	if id, err := p.UUID("uid"); err != nil || id[0] != 0x6b || id[15] != 0xc8 {
+		t.Fatalf("unexpected uuid: %x %v", id, err)
+	}
+
+	if ts, err := p.Time("ts", ""); err != nil || ts.Unix() != 1600000000 {
+		t.Fatalf("unexpected time: %v %v", ts, err)
+	}
+
+	var pe *ParamError
+	if _, err := p.Int("missing"); !errors.As(err, &pe) || !errors.Is(err, ErrMissingParam) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := p.Int64("bad"); !errors.As(err, &pe) || pe.Name != "bad" || pe.Value != "x" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := p.UUID("bad"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestUnescapeParams(t *testing.T) {
+	r := New(&Options{UnescapeParams: true})
+	_ = r.AddRoute("", "GET", "/users/:email/files/:name", func(w http.ResponseWriter, req *http.Request, p Params) {
+		w.Write([]byte(p.Get("email") + "|" + p.Get("name")))
+	})
+
+	for path, exp := range map[string]string{
+		"/users/a%40b.com/files/x%2Fy.txt": "a@b.com|x/y.txt",
+		"/users/bob/files/report.csv":      "bob|report.csv",
+		"/users/bob/files/%2E%2E":          "",
+		"/users/bob/files/..%2Fetc":        "",
+	} {
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, httptest.NewRequest("GET", path, nil))
+		if exp == "" {
+			if rw.Code != http.StatusBadRequest {
+				t.Fatalf("%s: expected 400, got %d", path, rw.Code)
+			}
+			continue
+		}
+		if rw.Body.String() != exp {
+			t.Fatalf("%s: expected %q, got %q (%d)", path, exp, rw.Body.String(), rw.Code)
+		}
+	}
+
+}
@@ -1,3 +1,4 @@
+//go:build httprouter
 // +build httprouter
 
 package router
@@ -12,7 +13,7 @@ import (
 
 func BenchmarkHttpRouter5Params(b *testing.B) {
 	req, _ := http.NewRequest("GET", "/campaignReport/:id/:cid/:start-date/:end-date/:filename", nil)
-	r := buildMeteoraApiHttpRouter(b, false)
+	r := buildMeteoraAPIHttpRouter(b, false)
 	b.ResetTimer()
 	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
@@ -24,7 +25,7 @@ func BenchmarkHttpRouter5Params(b *testing.B) {
 
 func BenchmarkHttpRouterStatic(b *testing.B) {
 	req, _ := http.NewRequest("GET", "/dashboard", nil)
-	r := buildMeteoraApiHttpRouter(b, false)
+	r := buildMeteoraAPIHttpRouter(b, false)
 	b.ResetTimer()
 	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
@@ -34,9 +35,9 @@ func BenchmarkHttpRouterStatic(b *testing.B) {
 	})
 }
 
-func buildMeteoraApiHttpRouter(l errorer, print bool) (r *httprouter.Router) {
+func buildMeteoraAPIHttpRouter(l testing.TB, print bool) (r *httprouter.Router) {
 	r = httprouter.New()
-	for _, m := range meteoraApi[5:] { // httprouter can't handle it
+	for _, m := range meteoraAPI[5:] { // httprouter can't handle it
 		ep := m.url
 		cnt := strings.Count(ep, ":")
 		fn := func(_ http.ResponseWriter, req *http.Request, p httprouter.Params) {
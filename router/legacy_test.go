@@ -0,0 +1,222 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// legacyRouter is the map + linear scan matcher the trie replaced, it's only kept to benchmark against.
+type legacyRouter struct {
+	m routeMap
+}
+
+type node struct {
+	g     string
+	h     Handler
+	parts []nodePart
+}
+
+func (n node) hasStar() bool {
+	return len(n.parts) > 0 && n.parts[len(n.parts)-1].Type() == '*'
+}
+
+type routeMap map[string][]node
+
+func (lr *legacyRouter) AddRoute(route string, h Handler) {
+	if lr.m == nil {
+		lr.m = routeMap{}
+	}
+
+	p, rest, _, _ := splitPathToParts(route)
+	if n := len(p) - 1; len(p) > 1 && p[n] == '/' {
+		p = p[:n]
+	}
+
+	lr.m[p] = append(lr.m[p], node{h: h, parts: rest})
+}
+
+func (lr *legacyRouter) Match(r *Router, path string) (Handler, *paramsWrapper) {
+	var (
+		nn   []node
+		rn   node
+		nsep int
+	)
+
+	if !revSplitPathFn(path, '/', func(p string, pidx, idx int) bool {
+		if nn = lr.m[path[:idx]]; nn != nil {
+			path, nsep = path[idx:], pidx
+			return true
+		}
+		return false
+	}) {
+		if nn = lr.m["/"]; nn == nil {
+			return nil, nil
+		}
+		nsep = strings.Count(path, "/")
+	}
+
+	for _, n := range nn {
+		if len(n.parts) == nsep || n.hasStar() {
+			rn = n
+			break
+		}
+	}
+
+	if len(rn.parts) == 0 {
+		return rn.h, nil
+	}
+
+	params := r.getParams(len(rn.parts))
+	splitPathFn(path, '/', func(p string, pidx, idx int) bool {
+		np := rn.parts[pidx]
+		switch np.Type() {
+		case ':':
+			params.p = append(params.p, Param{np.Name(), p[1:]})
+		case '*':
+			params.p = append(params.p, Param{np.Name(), path[1:]})
+			return true
+		}
+		return false
+	})
+
+	return rn.h, params
+}
+
+type nodePart string
+
+func (np nodePart) Name() string { return string(np[1:]) }
+func (np nodePart) Type() uint8  { return np[0] }
+func (np nodePart) String() string {
+	if np.Type() == '/' {
+		return fmt.Sprintf("{%s}", np.Name())
+	}
+	return fmt.Sprintf("{%s '%c'}", np.Name(), np.Type())
+}
+
+var legacyRe = regexp.MustCompile(`([:*/]?[^:*]+)`)
+
+// splitPathToParts takes in a path (ex: /api/v1/someEndpoint/:id/*any) and returns:
+//
+//	pp -> the longest part before the first param (/api/v1/someEndpoint/:)
+//	rest -> all the params (id, any)
+//	num -> number of params (probably not needed...)
+//	stars -> number of stars, basically a sanity check, if it's not 0 or 1 then it's an invalid path
+func splitPathToParts(p string) (pp string, rest []nodePart, num, stars int) {
+	parts := legacyRe.FindAllString(p, -1)
+	if len(parts) < 2 {
+		pp = p
+		return
+	}
+
+	pp = parts[0]
+	for _, part := range parts[1:] {
+		splitPathFn(part, '/', func(sp string, _, _ int) bool {
+			switch c := sp[0]; c {
+			case '*':
+				stars++
+				fallthrough
+			case ':':
+				num++
+				fallthrough
+			case '/':
+				rest = append(rest, nodePart(sp))
+			}
+			return false
+		})
+	}
+	return
+}
+
+func splitPathFn(s string, sep uint8, fn func(p string, pidx, idx int) bool) bool {
+	for i, pi, last := 0, 0, 0; i < len(s); i++ {
+		if s[i] != sep {
+			if i < len(s)-1 {
+				continue
+			}
+			i = len(s)
+		}
+
+		if ss := s[last:i]; ss != "" {
+			if fn(ss, pi, i) {
+				return true
+			}
+			last = i
+			pi++
+		}
+	}
+
+	return false
+}
+
+func revSplitPathFn(s string, sep uint8, fn func(p string, pidx, idx int) bool) bool {
+	for i, pi, last := len(s)-1, 0, len(s); i > -1; i-- {
+		if s[i] != sep {
+			continue
+		}
+		if ss := s[i:last]; ss != "" {
+			if fn(ss, pi, last) {
+				return true
+			}
+			last = i
+			pi++
+		}
+	}
+
+	return false
+}
+
+// largeRoutes returns a route table similar to our biggest services, n services with 7 routes each.
+func largeRoutes(n int) (routes []string) {
+	for i := 0; i < n; i++ {
+		svc := fmt.Sprintf("/svc%03d", i)
+		routes = append(routes,
+			svc,
+			svc+"/list",
+			svc+"/items/:id",
+			svc+"/items/:id/history",
+			svc+"/items/:id/history/:rev",
+			svc+"/reports/:id/:start/:end/:filename",
+			svc+"/files/*path",
+		)
+	}
+	return
+}
+
+func BenchmarkLargeTable(b *testing.B) {
+	routes := largeRoutes(100)
+	fn := func(http.ResponseWriter, *http.Request, Params) {}
+
+	r := New(nil)
+	var lr legacyRouter
+	for _, rt := range routes {
+		r.AddRoute("", "GET", rt, fn)
+		lr.AddRoute(rt, fn)
+	}
+
+	for _, path := range []string{"/svc099/list", "/svc099/items/42/history/7", "/svc099/reports/1/2020-01-01/2020-02-01/report.csv", "/svc099/files/a/b/c.txt"} {
+		b.Run("trie"+path, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, h, p := r.match("GET", path)
+				if h == nil {
+					b.Fatal("no match")
+				}
+				r.putParams(p)
+			}
+		})
+
+		b.Run("legacy"+path, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h, p := lr.Match(r, path)
+				if h == nil {
+					b.Fatal("no match")
+				}
+				r.putParams(p)
+			}
+		})
+	}
+}
@@ -1,5 +1,12 @@
 package router
 
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
 // Param is a key/value pair
 type Param struct {
 	Name  string
@@ -21,6 +28,7 @@ func (p Params) Get(name string) string {
 
 // GetExt returns the value split at the last extension available, for example:
 //	if :filename == "report.json", GetExt("filename") returns "report", "json"
+// Routes can also do the split while matching with a catch-all like *name.ext, see Ext.
 func (p Params) GetExt(name string) (val, ext string) {
 	val = p.Get(name)
 	for i := len(val) - 1; i > -1; i-- {
@@ -31,6 +39,15 @@ func (p Params) GetExt(name string) (val, ext string) {
 	return
 }
 
+// ExtParam is the name of the param holding the extension matched by a catch-all with an extension,
+// ex: for "/reports/*path.json" or "/files/*path.*", see Params.Ext.
+const ExtParam = ".ext"
+
+// Ext returns the extension (without the dot) matched by a catch-all with an extension.
+func (p Params) Ext() string {
+	return p.Get(ExtParam)
+}
+
 // Copy returns a copy of p, required if you want to store it somewhere or use it outside of your handler.
 func (p Params) Copy() Params {
 	op := make(Params, len(p))
@@ -49,3 +66,137 @@ func (pw *paramsWrapper) Params() (p Params) {
 	}
 	return
 }
+
+// ParamError is returned by the typed Params getters if a param is missing or can't be parsed.
+type ParamError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	if e.Value == "" {
+		return "missing param " + e.Name
+	}
+	return "invalid param " + e.Name + " (" + e.Value + "): " + e.Err.Error()
+}
+
+func (e *ParamError) Unwrap() error { return e.Err }
+
+// ErrMissingParam is the ParamError.Err for empty params.
+var ErrMissingParam = errors.New("missing param")
+
+func (p Params) get(name string) (string, error) {
+	if v := p.Get(name); v != "" {
+		return v, nil
+	}
+	return "", &ParamError{Name: name, Err: ErrMissingParam}
+}
+
+// Int returns the param as an int, values that don't fit in an int on the current platform
+// return a ParamError wrapping strconv.ErrRange.
+func (p Params) Int(name string) (int, error) {
+	n, err := p.parseInt(name, strconv.IntSize)
+	return int(n), err
+}
+
+// Int64 returns the param as an int64, values that don't fit return a ParamError wrapping strconv.ErrRange.
+func (p Params) Int64(name string) (int64, error) {
+	return p.parseInt(name, 64)
+}
+
+// Uint returns the param as a uint, negative values return a ParamError wrapping strconv.ErrSyntax
+// and values that don't fit in a uint on the current platform one wrapping strconv.ErrRange.
+func (p Params) Uint(name string) (uint, error) {
+	n, err := p.parseUint(name, strconv.IntSize)
+	return uint(n), err
+}
+
+// Uint64 returns the param as a uint64, negative values return a ParamError wrapping strconv.ErrSyntax
+// and values that don't fit one wrapping strconv.ErrRange.
+func (p Params) Uint64(name string) (uint64, error) {
+	return p.parseUint(name, 64)
+}
+
+func (p Params) parseInt(name string, bits int) (int64, error) {
+	v, err := p.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseInt(v, 10, bits)
+	if err != nil {
+		return 0, &ParamError{name, v, err.(*strconv.NumError).Err}
+	}
+	return n, nil
+}
+
+func (p Params) parseUint(name string, bits int) (uint64, error) {
+	v, err := p.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseUint(v, 10, bits)
+	if err != nil {
+		return 0, &ParamError{name, v, err.(*strconv.NumError).Err}
+	}
+	return n, nil
+}
+
+// Bool returns the param as a bool, it accepts the same values as strconv.ParseBool.
+func (p Params) Bool(name string) (bool, error) {
+	v, err := p.get(name)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &ParamError{name, v, err.(*strconv.NumError).Err}
+	}
+	return b, nil
+}
+
+var errInvalidUUID = errors.New("invalid uuid")
+
+// UUID parses the param as a uuid in the canonical (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx) form,
+// the result can be converted directly to most uuid types (ex: uuid.UUID(v)).
+func (p Params) UUID(name string) (id [16]byte, err error) {
+	v, err := p.get(name)
+	if err != nil {
+		return id, err
+	}
+
+	if len(v) != 36 || v[8] != '-' || v[13] != '-' || v[18] != '-' || v[23] != '-' {
+		return id, &ParamError{name, v, errInvalidUUID}
+	}
+
+	b := []byte(v[:8] + v[9:13] + v[14:18] + v[19:23] + v[24:])
+	if _, err := hex.Decode(id[:], b); err != nil {
+		return id, &ParamError{name, v, errInvalidUUID}
+	}
+
+	return id, nil
+}
+
+// Time parses the param using layout, if layout is empty it accepts unix timestamps or RFC 3339.
+func (p Params) Time(name, layout string) (time.Time, error) {
+	v, err := p.get(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if layout == "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(n, 0), nil
+		}
+		layout = time.RFC3339
+	}
+
+	t, err := time.Parse(layout, v)
+	if err != nil {
+		return t, &ParamError{name, v, err}
+	}
+	return t, nil
+}
@@ -6,7 +6,9 @@ package router
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"runtime/pprof"
+	"strings"
 	"time"
 )
 
@@ -40,19 +42,36 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	u, method := req.URL.Path, req.Method
+	if r.opts.UnescapeParams {
+		u = req.URL.EscapedPath()
+	}
 
 	if !r.opts.NoAutoCleanURL {
 		var ok bool
 		if u, ok = cleanPath(u); ok {
-			req.URL.Path = u
+			setPath(req.URL, u, r.opts.UnescapeParams)
 		}
 	}
 
-	if method == http.MethodHead && !r.opts.NoAutoHeadToGet {
+	g, h, p := r.match(method, pathNoQuery(u))
+
+	// explicit HEAD routes take priority over the GET fallback, same as Match.
+	if h == nil && method == http.MethodHead && !r.opts.NoAutoHeadToGet {
 		w, method = &headRW{ResponseWriter: w}, http.MethodGet
+		g, h, p = r.match(method, pathNoQuery(u))
+	}
+
+	if h != nil && r.opts.UnescapeParams && !unescapeParams(p) {
+		r.putParams(p)
+		if r.BadRequestHandler != nil {
+			r.BadRequestHandler(w, req, nil)
+		} else {
+			http.Error(w, "400 bad request", http.StatusBadRequest)
+		}
+		return
 	}
 
-	if g, h, p := r.match(method, pathNoQuery(u)); h != nil {
+	if h != nil {
 		if r.opts.ProfileLabels {
 			labels := pprof.Labels("group", g, "method", req.Method, "uri", req.RequestURI)
 			ctx := pprof.WithLabels(req.Context(), labels)
@@ -84,3 +103,42 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 }
+
+// setPath sets the cleaned path on u, if it's escaped the unescaped version is used for Path.
+func setPath(u *url.URL, p string, escaped bool) {
+	if !escaped {
+		u.Path = p
+		return
+	}
+
+	if up, err := url.PathUnescape(p); err == nil {
+		u.Path, u.RawPath = up, p
+	}
+}
+
+// unescapeParams unescapes the param values in place, it returns false if any of them has an invalid escape,
+// or an escaped ".." segment, since cleanPath can't see those.
+func unescapeParams(pw *paramsWrapper) bool {
+	p := pw.Params()
+	for i := range p {
+		if strings.IndexByte(p[i].Value, '%') == -1 {
+			continue
+		}
+
+		v, err := url.PathUnescape(p[i].Value)
+		if err != nil || hasDotDot(v) {
+			return false
+		}
+		p[i].Value = v
+	}
+	return true
+}
+
+func hasDotDot(v string) bool {
+	for _, seg := range strings.FieldsFunc(v, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package router
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -35,6 +37,35 @@ func TestRouterStar(t *testing.T) {
 	}
 }
 
+func TestRouterStarExt(t *testing.T) {
+	r := New(nil)
+	route := func(name string) Handler {
+		return func(w http.ResponseWriter, _ *http.Request, p Params) {
+			w.Write([]byte(name + "|" + p.Get("path") + "|" + p.Ext()))
+		}
+	}
+
+	for _, rt := range []string{"/reports/*path", "/reports/*path.*", "/reports/*path.json"} {
+		if err := r.AddRoute("", "GET", rt, route(rt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, exp := range map[string]string{
+		"/reports/2020/jan.json":  "/reports/*path.json|2020/jan|json",
+		"/reports/2020/jan.csv":   "/reports/*path.*|2020/jan|csv",
+		"/reports/2020.x/jan":     "/reports/*path|2020.x/jan|",
+		"/reports/2020/.json":     "/reports/*path|2020/.json|",
+		"/reports/2020/jan.json.": "/reports/*path|2020/jan.json.|",
+	} {
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, httptest.NewRequest("GET", path, nil))
+		if rw.Body.String() != exp {
+			t.Fatalf("%s: expected %q, got %q", path, exp, rw.Body.String())
+		}
+	}
+}
+
 func BenchmarkRouter5Params(b *testing.B) {
 	req, _ := http.NewRequest("GET", "/campaignReport/:id/:cid/:start-date/:end-date/:filename", nil)
 	r := buildMeteoraAPIRouter(b, false)
@@ -82,3 +113,93 @@ func buildMeteoraAPIRouter(l testing.TB, print bool) (r *Router) {
 	}
 	return
 }
+
+func TestRouterPriority(t *testing.T) {
+	r := New(nil)
+	route := func(name string) Handler {
+		return func(w http.ResponseWriter, _ *http.Request, _ Params) { w.Header().Set("route", name) }
+	}
+
+	for _, rt := range []string{
+		"/users/:id",
+		"/users/new",
+		"/users/:id/edit",
+		"/users/:uid/posts/:pid",
+		"/users/new/*rest",
+		"/reports/:period/report.csv",
+		"/files/latest",
+		"/files/:id/meta",
+	} {
+		if err := r.AddRoute("", "GET", rt, route(rt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, exp := range map[string]string{
+		"/users/1":                 "/users/:id",
+		"/users/new":               "/users/new",
+		"/users/1/edit":            "/users/:id/edit",
+		"/users/new/edit":          "/users/new/*rest",
+		"/files/latest/meta":       "/files/:id/meta", // backtracks from the static node
+		"/users/new/x/y":           "/users/new/*rest",
+		"/users/1/posts/2":         "/users/:uid/posts/:pid",
+		"/reports/2020/report.csv": "/reports/:period/report.csv",
+		"/reports/2020/other.csv":  "",
+		"/users/1/nope":            "",
+	} {
+		_, h, p := r.Match("GET", path)
+		var got string
+		if h != nil {
+			rw := httptest.NewRecorder()
+			h(rw, nil, p)
+			got = rw.Header().Get("route")
+		}
+		if got != exp {
+			t.Fatalf("%s: expected %q, got %q", path, exp, got)
+		}
+	}
+
+	if _, _, p := r.Match("GET", "/users/1/posts/2"); p.Get("uid") != "1" || p.Get("pid") != "2" {
+		t.Fatalf("unexpected params: %v", p)
+	}
+}
+
+func TestRouterStaticFastPath(t *testing.T) {
+	r := buildMeteoraAPIRouter(t, false)
+	if _, h, p := r.match("GET", "/dashboard"); h == nil || p != nil {
+		t.Fatalf("expected a static match without params, got %v", p)
+	}
+
+	if n := testing.AllocsPerRun(100, func() { r.match("GET", "/signUp/advertiser") }); n != 0 {
+		t.Fatalf("expected 0 allocs, got %v", n)
+	}
+}
+
+func BenchmarkRouterParamsPool(b *testing.B) {
+	r := buildMeteoraAPIRouter(b, false)
+	for _, path := range []string{"/dashboard/:id", "/reporting/:id/:period/:offset", "/campaignReport/:id/:cid/:start-date/:end-date/:filename"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		b.Run(strconv.Itoa(strings.Count(path, ":"))+"-params", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.ServeHTTP(nil, req)
+			}
+		})
+	}
+}
+
+func TestRouterParamsPool(t *testing.T) {
+	r := buildMeteoraAPIRouter(t, false)
+	req, _ := http.NewRequest("GET", "/dashboard/:id", nil)
+	r.ServeHTTP(nil, req)
+
+	if n := testing.AllocsPerRun(100, func() { r.ServeHTTP(nil, req) }); n != 0 {
+		t.Fatalf("expected 0 allocs, got %v", n)
+	}
+
+	// the buffer is sized for the routes under the matched node, not the whole router
+	_, _, p := r.match("GET", "/dashboard/1")
+	if cap(p.p) != 1 {
+		t.Fatalf("expected a buffer for a single param, got %d", cap(p.p))
+	}
+}
@@ -0,0 +1,226 @@
+package router
+
+import "strings"
+
+// leaf is a route stored in the trie, names are the route's param names in order.
+// ext is set for catch-alls with an extension (*name.ext), "*" matches any extension.
+type leaf struct {
+	g     string
+	h     Handler
+	path  string
+	names []string
+	ext   string
+}
+
+// trieNode is a node in a per-method trie of path segments,
+// children are tried in order of priority: static, then :param, then *catchAll.
+// Catch-alls with a specific extension are tried first, then ones with any extension and finally plain ones.
+// maxParams is the most params any route going through the node has, it's used to size the params buffer.
+type trieNode struct {
+	static map[string]*trieNode
+	param  *trieNode
+	stars  []*leaf
+	route  *leaf
+
+	maxParams int
+}
+
+// add inserts rt at the node for segs, it returns false if the route already exists.
+func (n *trieNode) add(segs []string, rt *leaf) bool {
+	for i, seg := range segs {
+		switch seg[0] {
+		case ':':
+			if n.param == nil {
+				n.param = &trieNode{}
+			}
+			n = n.param
+			if len(rt.names) > n.maxParams {
+				n.maxParams = len(rt.names)
+			}
+		case '*':
+			if i != len(segs)-1 {
+				return false
+			}
+			return n.addStar(rt)
+		default:
+			c := n.static[seg]
+			if c == nil {
+				if n.static == nil {
+					n.static = map[string]*trieNode{}
+				}
+				c = &trieNode{}
+				n.static[seg] = c
+			}
+			n = c
+		}
+	}
+
+	if n.route != nil {
+		return false
+	}
+
+	n.route = rt
+	return true
+}
+
+func (n *trieNode) addStar(rt *leaf) bool {
+	prio := func(l *leaf) int {
+		switch l.ext {
+		case "":
+			return 2
+		case "*":
+			return 1
+		}
+		return 0
+	}
+
+	for i, l := range n.stars {
+		if l.ext == rt.ext {
+			return false
+		}
+
+		if prio(rt) < prio(l) {
+			n.stars = append(n.stars[:i], append([]*leaf{rt}, n.stars[i:]...)...)
+			return true
+		}
+	}
+
+	n.stars = append(n.stars, rt)
+	return true
+}
+
+// matchState holds the param values found while matching, the params are only taken from the pool once needed.
+type matchState struct {
+	r  *Router
+	pw *paramsWrapper
+}
+
+// push adds a param value, need is the most params the routes that can still match have.
+func (ms *matchState) push(v string, need int) {
+	if ms.pw == nil {
+		ms.pw = ms.r.getParams(need)
+	}
+	ms.pw.p = append(ms.pw.p, Param{Value: v})
+}
+
+func (ms *matchState) pop() {
+	ms.pw.p = ms.pw.p[:len(ms.pw.p)-1]
+}
+
+// match returns the route for path, which is either empty or starts with a '/', the param values are added to ms.
+// On a dead end it backtracks, which makes static segments take priority over params, and params over catch-alls.
+func (n *trieNode) match(path string, ms *matchState) *leaf {
+	if path == "" {
+		if n.route != nil {
+			return n.route
+		}
+
+		if l := len(n.stars); l > 0 && n.stars[l-1].ext == "" { // plain catch-alls match an empty path as well
+			rt := n.stars[l-1]
+			ms.push("", len(rt.names))
+			return rt
+		}
+
+		return nil
+	}
+
+	seg, rest := path[1:], ""
+	if i := strings.IndexByte(seg, '/'); i != -1 {
+		seg, rest = seg[:i], seg[i:]
+	}
+
+	if c := n.static[seg]; c != nil {
+		if rt := c.match(rest, ms); rt != nil {
+			return rt
+		}
+	}
+
+	if c := n.param; c != nil && seg != "" {
+		ms.push(seg, c.maxParams)
+		if rt := c.match(rest, ms); rt != nil {
+			return rt
+		}
+		ms.pop()
+	}
+
+	for _, rt := range n.stars {
+		if rt.ext == "" {
+			ms.push(path[1:], len(rt.names))
+			return rt
+		}
+
+		if v, ext, ok := splitExt(path[1:], rt.ext); ok {
+			ms.push(v, len(rt.names))
+			ms.push(ext, len(rt.names))
+			return rt
+		}
+	}
+
+	return nil
+}
+
+// splitExt splits p at want's extension, or at the last extension of its last segment if want is "*",
+// ok is false if it doesn't match or the name before the extension is empty.
+func splitExt(p, want string) (v, ext string, ok bool) {
+	if want != "*" {
+		n := len(p) - len(want) - 1
+		if n > 0 && p[n] == '.' && p[n+1:] == want && p[n-1] != '/' {
+			return p[:n], want, true
+		}
+		return
+	}
+
+	i := strings.LastIndexByte(p, '.')
+	if i < 1 || i == len(p)-1 || p[i-1] == '/' || strings.IndexByte(p[i:], '/') != -1 {
+		return
+	}
+
+	return p[:i], p[i+1:], true
+}
+
+// splitRoute splits a route into its segments and returns them along with the param names and the catch-all's extension.
+func splitRoute(p string) (segs, names []string, ext string, stars int) {
+	for _, seg := range strings.Split(strings.Trim(p, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+
+		switch seg[0] {
+		case '*':
+			stars++
+			name := seg[1:]
+			if i := strings.IndexByte(name, '.'); i != -1 {
+				name, ext = name[:i], name[i+1:]
+			}
+
+			names = append(names, name)
+			if ext != "" {
+				names = append(names, ExtParam)
+			}
+		case ':':
+			names = append(names, seg[1:])
+		}
+
+		segs = append(segs, seg)
+	}
+	return
+}
+
+// walk calls fn for every route under n, in no particular order.
+func (n *trieNode) walk(fn func(rt *leaf)) {
+	if n.route != nil {
+		fn(n.route)
+	}
+
+	for _, c := range n.static {
+		c.walk(fn)
+	}
+
+	if n.param != nil {
+		n.param.walk(fn)
+	}
+
+	for _, rt := range n.stars {
+		fn(rt)
+	}
+}
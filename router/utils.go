@@ -1,95 +1,11 @@
 package router
 
 import (
-	"fmt"
 	"io/ioutil"
 	"net/http"
-	"regexp"
 	"strings"
 )
 
-type nodePart string
-
-func (np nodePart) Name() string { return string(np[1:]) }
-func (np nodePart) Type() uint8  { return np[0] }
-func (np nodePart) String() string {
-	if np.Type() == '/' {
-		return fmt.Sprintf("{%s}", np.Name())
-	}
-	return fmt.Sprintf("{%s '%c'}", np.Name(), np.Type())
-}
-
-var re = regexp.MustCompile(`([:*/]?[^:*]+)`)
-
-// splitPathToParts takes in a path (ex: /api/v1/someEndpoint/:id/*any) and returns:
-//	pp -> the longest part before the first param (/api/v1/someEndpoint/:)
-//	rest -> all the params (id, any)
-//	num -> number of params (probably not needed...)
-//	stars -> number of stars, basically a sanity check, if it's not 0 or 1 then it's an invalid path
-func splitPathToParts(p string) (pp string, rest []nodePart, num, stars int) {
-	parts := re.FindAllString(p, -1)
-	if len(parts) < 2 {
-		pp = p
-		return
-	}
-
-	pp = parts[0]
-	for _, part := range parts[1:] {
-		splitPathFn(part, '/', func(sp string, _, _ int) bool {
-			switch c := sp[0]; c {
-			case '*':
-				stars++
-				fallthrough
-			case ':':
-				num++
-				fallthrough
-			case '/':
-				rest = append(rest, nodePart(sp))
-			}
-			return false
-		})
-	}
-	return
-}
-
-func splitPathFn(s string, sep uint8, fn func(p string, pidx, idx int) bool) bool {
-	for i, pi, last := 0, 0, 0; i < len(s); i++ {
-		if s[i] != sep {
-			if i < len(s)-1 {
-				continue
-			}
-			i = len(s)
-		}
-
-		if ss := s[last:i]; ss != "" {
-			if fn(ss, pi, i) {
-				return true
-			}
-			last = i
-			pi++
-		}
-	}
-
-	return false
-}
-
-func revSplitPathFn(s string, sep uint8, fn func(p string, pidx, idx int) bool) bool {
-	for i, pi, last := len(s)-1, 0, len(s); i > -1; i-- {
-		if s[i] != sep {
-			continue
-		}
-		if ss := s[i:last]; ss != "" {
-			if fn(ss, pi, last) {
-				return true
-			}
-			last = i
-			pi++
-		}
-	}
-
-	return false
-}
-
 type headRW struct {
 	http.ResponseWriter
 }
@@ -103,6 +19,12 @@ func pathNoQuery(p string) string {
 	return p
 }
 
+// CleanPath returns the canonical path the router matches p against, unless Options.NoAutoCleanURL is set.
+func CleanPath(p string) string {
+	p, _ = cleanPath(p)
+	return p
+}
+
 // based on https://github.com/gin-gonic/gin/blob/a8fa424ae529397d4a0f2a1f9fda8031851a3269/path.go#L21
 // cleanPath is the URL version of path.Clean, it returns a canonical URL path
 // for p, eliminating . and .. elements.
@@ -20,6 +20,11 @@ type Options struct {
 	NoCatchPanics            bool // don't catch panics
 	NoAutoHeadToGet          bool // disable automatically handling HEAD requests
 	ProfileLabels            bool
+
+	// UnescapeParams makes ServeHTTP match the escaped path and unescape the param values,
+	// so a param can contain an escaped slash, invalid escapes and escaped ".." segments are passed to BadRequestHandler.
+	// Static parts of the routes are matched as-is against the escaped path.
+	UnescapeParams bool
 }
 
 var (
@@ -29,38 +34,22 @@ var (
 	ErrStarNotLast = errors.New("star param must be the last part of the path")
 )
 
-type node struct {
-	g     string
-	h     Handler
-	parts []nodePart
-}
-
-func (n node) hasStar() bool {
-	return len(n.parts) > 0 && n.parts[len(n.parts)-1].Type() == '*'
-}
-
-type routeMap map[string][]node
-
-func (rm routeMap) get(path string) []node {
-	return rm[path]
-}
-
-func (rm routeMap) append(path string, n node) {
-	rm[path] = append(rm[path], n)
-}
-
 // Router is an efficient routing library
 type Router struct {
-	methods [10]routeMap
+	methods [10]*trieNode
+
+	// statics holds the routes without params per method, so they're found with a single lookup.
+	statics [10]map[string]*leaf
 
-	pp sync.Pool
+	// pools holds the params by capacity, pools[i] has buffers with a capacity of 1<<i.
+	pools [numParamPools]sync.Pool
 
 	NotFoundHandler         Handler
 	MethodNotAllowedHandler Handler
+	BadRequestHandler       Handler
 	PanicHandler            PanicHandler
 
-	opts      Options
-	maxParams int
+	opts Options
 }
 
 // New returns a new Router
@@ -71,10 +60,6 @@ func New(opts *Options) *Router {
 		r.opts = *opts
 	}
 
-	r.pp.New = func() interface{} {
-		return &paramsWrapper{make(Params, 0, r.maxParams)}
-	}
-
 	if !r.opts.NoDefaultPanicHandler {
 		r.PanicHandler = DefaultPanicHandler
 	}
@@ -82,20 +67,13 @@ func New(opts *Options) *Router {
 	return &r
 }
 
+// GetRoutes returns the group, method and path of every route.
 func (r *Router) GetRoutes() [][3]string {
-	rms := r.getAllMaps()
-	routes := make([][3]string, 0, len(rms))
-	for method, rm := range rms {
-		for p, ns := range rm {
-			base := p
-			for _, n := range ns {
-				route := base
-				for _, np := range n.parts {
-					route += "/" + string(np)
-				}
-				routes = append(routes, [3]string{n.g, method, route})
-			}
-		}
+	var routes [][3]string
+	for method, root := range r.getAllTrees() {
+		root.walk(func(rt *leaf) {
+			routes = append(routes, [3]string{rt.g, method, rt.path})
+		})
 	}
 	return routes
 }
@@ -103,30 +81,36 @@ func (r *Router) GetRoutes() [][3]string {
 // AddRoute adds a Handler to the specific method and route.
 // Calling AddRoute after starting the http server is racy and not supported.
 func (r *Router) AddRoute(group, method, route string, h Handler) error {
-	p, rest, num, stars := splitPathToParts(route)
-	if stars > 1 {
-		if r.opts.NoPanicOnInvalidAddRoute {
-			return ErrTooManyStars
-		}
-		panic(ErrTooManyStars)
+	segs, names, ext, stars := splitRoute(route)
+
+	var err error
+	switch {
+	case stars > 1:
+		err = ErrTooManyStars
+	case stars == 1 && segs[len(segs)-1][0] != '*':
+		err = ErrStarNotLast
 	}
 
-	if stars == 1 && rest[len(rest)-1].Type() != '*' {
+	if err != nil {
 		if r.opts.NoPanicOnInvalidAddRoute {
-			return ErrStarNotLast
+			return err
 		}
-		panic(ErrStarNotLast)
+		panic(err)
 	}
 
-	if n := len(p) - 1; len(p) > 1 && p[n] == '/' {
-		p = p[:n]
+	if n := len(route) - 1; n > 0 && route[n] == '/' {
+		route = route[:n]
 	}
 
-	m := r.getMap(method, true)
-	m.append(p, node{g: group, h: h, parts: rest})
+	rt := &leaf{g: group, h: h, path: route, names: names, ext: ext}
 
-	if num > r.maxParams {
-		r.maxParams = num
+	// the first route added for a path wins
+	if r.getTree(method, true).add(segs, rt) && len(names) == 0 {
+		m := &r.statics[methodIndex(method)]
+		if *m == nil {
+			*m = map[string]*leaf{}
+		}
+		(*m)["/"+strings.Join(segs, "/")] = rt
 	}
 
 	return nil
@@ -145,123 +129,127 @@ func (r *Router) Match(method, path string) (group string, handler Handler, para
 }
 
 func (r *Router) match(method, path string) (group string, handler Handler, params *paramsWrapper) {
-	m := r.getMap(method, false)
-	var (
-		nn   []node
-		rn   node
-		nsep int
-	)
-
-	if !revSplitPathFn(path, '/', func(p string, pidx, idx int) bool {
-		if nn = m.get(path[:idx]); nn != nil {
-			path, nsep = path[idx:], pidx
-			return true
-		}
+	i := methodIndex(method)
+	if i == -1 || r.methods[i] == nil {
+		return
+	}
 
-		return false
-	}) {
-		if nn = m.get("/"); nn != nil {
-			nsep = strings.Count(path, "/")
-		} else {
-			return
-		}
+	if rt := r.statics[i][path]; rt != nil {
+		return rt.g, rt.h, nil
 	}
 
-	for _, n := range nn {
-		if len(n.parts) == nsep || n.hasStar() {
-			rn = n
-			group, handler = n.g, n.h
-			break
-		}
+	root := r.methods[i]
+	if path == "/" {
+		path = ""
 	}
 
-	if len(rn.parts) == 0 {
-		return
+	ms := matchState{r: r}
+	rt := root.match(path, &ms)
+	if rt == nil {
+		r.putParams(ms.pw)
+		return "", nil, nil
 	}
 
-	params = r.getParams()
-	splitPathFn(path, '/', func(p string, pidx, idx int) bool {
-		np := rn.parts[pidx]
-		switch np.Type() {
-		case ':':
-			params.p = append(params.p, Param{np.Name(), p[1:]})
-		case '*':
-			params.p = append(params.p, Param{np.Name(), path[1:]})
-			return true
-		}
-		return false
-	})
+	for i, name := range rt.names {
+		ms.pw.p[i].Name = name
+	}
 
-	return
+	return rt.g, rt.h, ms.pw
 }
 
-func (r *Router) getAllMaps() map[string]routeMap {
-	out := make(map[string]routeMap)
-	for i, rm := range &r.methods {
-		switch i {
-		case 0:
-			out[http.MethodGet] = rm
-		case 1:
-			out[http.MethodHead] = rm
-		case 2:
-			out[http.MethodPost] = rm
-		case 3:
-			out[http.MethodPut] = rm
-		case 4:
-			out[http.MethodPatch] = rm
-		case 5:
-			out[http.MethodDelete] = rm
-		case 6:
-			out[http.MethodConnect] = rm
-		case 7:
-			out[http.MethodOptions] = rm
-		case 8:
-			out[http.MethodTrace] = rm
-		}
-	}
-	return out
+var methodNames = [...]string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
 }
 
-func (r *Router) getMap(method string, create bool) routeMap {
-	var rm *routeMap
+func methodIndex(method string) int {
 	switch method {
 	case http.MethodGet:
-		rm = &r.methods[0]
+		return 0
 	case http.MethodHead:
-		rm = &r.methods[1]
+		return 1
 	case http.MethodPost:
-		rm = &r.methods[2]
+		return 2
 	case http.MethodPut:
-		rm = &r.methods[3]
+		return 3
 	case http.MethodPatch:
-		rm = &r.methods[4]
+		return 4
 	case http.MethodDelete:
-		rm = &r.methods[5]
+		return 5
 	case http.MethodConnect:
-		rm = &r.methods[6]
+		return 6
 	case http.MethodOptions:
-		rm = &r.methods[7]
+		return 7
 	case http.MethodTrace:
-		rm = &r.methods[8]
+		return 8
 	default:
+		return -1
+	}
+}
+
+func (r *Router) getAllTrees() map[string]*trieNode {
+	out := make(map[string]*trieNode)
+	for i, root := range &r.methods {
+		if root != nil && i < len(methodNames) {
+			out[methodNames[i]] = root
+		}
+	}
+	return out
+}
+
+func (r *Router) getTree(method string, create bool) *trieNode {
+	i := methodIndex(method)
+	if i == -1 {
 		return nil
 	}
-	if create && *rm == nil {
-		*rm = routeMap{}
+
+	if create && r.methods[i] == nil {
+		r.methods[i] = &trieNode{}
 	}
 
-	return *rm
+	return r.methods[i]
 }
 
-func (r *Router) getParams() *paramsWrapper {
-	// this should never ever panic, if it does then there's something extremely wrong and *it should* panic
-	return r.pp.Get().(*paramsWrapper)
+// numParamPools is the number of params pools, routes with more than 1<<(numParamPools-1) params aren't pooled.
+const numParamPools = 6
+
+func paramsBucket(n int) (b int) {
+	for 1<<b < n {
+		b++
+	}
+	return
+}
+
+// getParams returns a pooled buffer with room for at least n params.
+func (r *Router) getParams(n int) *paramsWrapper {
+	b := paramsBucket(n)
+	if b >= numParamPools {
+		return &paramsWrapper{make(Params, 0, n)}
+	}
+
+	if pw, _ := r.pools[b].Get().(*paramsWrapper); pw != nil {
+		return pw
+	}
+
+	return &paramsWrapper{make(Params, 0, 1<<b)}
 }
 
+// putParams returns p to the pool matching its capacity, buffers that grew past it are dropped.
 func (r *Router) putParams(p *paramsWrapper) {
-	if p == nil || cap(p.p) != r.maxParams {
+	if p == nil {
 		return
 	}
+
+	c := cap(p.p)
+	b := paramsBucket(c)
+	if b >= numParamPools || 1<<b != c {
+		return
+	}
+
+	for i := range p.p { // don't keep the request's strings alive
+		p.p[i] = Param{}
+	}
+
 	p.p = p.p[:0]
-	r.pp.Put(p)
+	r.pools[b].Put(p)
 }
@@ -0,0 +1,113 @@
+package apiserv
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+var (
+	_ http.Flusher       = (*Context)(nil)
+	_ http.Hijacker      = (*Context)(nil)
+	_ http.CloseNotifier = (*Context)(nil)
+	_ io.ReaderFrom      = (*Context)(nil)
+)
+
+// rwUnwrapper is implemented by the ResponseWriter wrappers (Gzip, CaptureBodies, ResponseCache),
+// the same interface is used by http.ResponseController in go1.20+.
+type rwUnwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// findRW walks the wrapped writers starting at rw and returns the first one fn returns true for.
+func findRW(rw http.ResponseWriter, fn func(rw http.ResponseWriter) bool) http.ResponseWriter {
+	for rw != nil {
+		if fn(rw) {
+			return rw
+		}
+
+		u, ok := rw.(rwUnwrapper)
+		if !ok {
+			return nil
+		}
+		rw = u.Unwrap()
+	}
+	return nil
+}
+
+// Unwrap returns the current ResponseWriter, which might be wrapped by middleware like Gzip.
+func (ctx *Context) Unwrap() http.ResponseWriter { return ctx.ResponseWriter }
+
+// Flush implements http.Flusher, it is a no-op if the underlying writer doesn't support flushing.
+func (ctx *Context) Flush() {
+	if f, ok := ctx.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker by finding the first writer that supports it, even if the response is wrapped,
+// so websocket upgrades work with compression and logging enabled.
+func (ctx *Context) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	var gz *gzRW
+	rw := findRW(ctx.ResponseWriter, func(rw http.ResponseWriter) bool {
+		if g, ok := rw.(*gzRW); ok {
+			gz = g
+		}
+		_, ok := rw.(http.Hijacker)
+		return ok
+	})
+
+	if rw == nil {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	if gz != nil { // nothing can be flushed once the connection is taken over
+		gz.hijacked = true
+	}
+
+	ctx.done = true
+	return rw.(http.Hijacker).Hijack()
+}
+
+// CloseNotify implements http.CloseNotifier for older libraries, new code should use ctx.Req.Context().Done().
+//
+// Deprecated: use ctx.Req.Context().Done().
+func (ctx *Context) CloseNotify() <-chan bool {
+	rw := findRW(ctx.ResponseWriter, func(rw http.ResponseWriter) bool {
+		_, ok := rw.(http.CloseNotifier)
+		return ok
+	})
+
+	if rw != nil {
+		return rw.(http.CloseNotifier).CloseNotify()
+	}
+
+	ch := make(chan bool, 1)
+	go func() {
+		<-ctx.Req.Context().Done()
+		ch <- true
+	}()
+	return ch
+}
+
+// ReadFrom implements io.ReaderFrom, if the response isn't wrapped it uses the underlying writer's ReadFrom,
+// which allows net/http to use sendfile for files, otherwise it copies r through ctx.Write.
+func (ctx *Context) ReadFrom(r io.Reader) (n int64, err error) {
+	if rf, ok := ctx.ResponseWriter.(io.ReaderFrom); ok && !(ctx.hijackServeContent && ctx.status >= http.StatusBadRequest) {
+		ctx.done = true
+		n, err = rf.ReadFrom(r)
+		ctx.written += n
+		if err != nil && ctx.writeErr == nil {
+			ctx.writeErr = err
+		}
+		return
+	}
+
+	return io.Copy(writerOnly{ctx}, r)
+}
+
+// writerOnly hides ReadFrom so io.Copy doesn't call back into it.
+type writerOnly struct {
+	io.Writer
+}
@@ -1,18 +1,21 @@
 package apiserv
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/missionMeteora/apiserv/health"
 	"github.com/missionMeteora/apiserv/router"
 )
 
@@ -25,6 +28,10 @@ var DefaultOpts = Options{
 
 	KeepAlivePeriod: 3 * time.Minute, // default value in net/http
 
+	ShutdownTimeout: 30 * time.Second,
+
+	SessionTicketRotation: 12 * time.Hour,
+
 	Logger: log.New(os.Stderr, "apiserv: ", 0),
 }
 
@@ -53,39 +60,28 @@ func NewWithOpts(opts *Options) *Server {
 	ro := srv.opts.RouterOptions
 	srv.r = router.New(ro)
 
-	if ro == nil || !ro.NoCatchPanics {
-		srv.r.PanicHandler = func(w http.ResponseWriter, req *http.Request, v interface{}) {
-			srv.Logf("PANIC (%T): %v", v, v)
-			if h := srv.PanicHandler; h != nil {
-				ctx := getCtx(w, req, nil, srv)
-				h(ctx, v)
-				putCtx(ctx)
-				return
-			}
-
-			resp := NewJSONErrorResponse(http.StatusInternalServerError, fmt.Sprintf("PANIC (%T): %v", v, v))
-			resp.WriteToCtx(&Context{
-				Req:            req,
-				ResponseWriter: w,
-			})
-		}
+	if !srv.noCatchPanics() {
+		srv.r.PanicHandler = srv.handlePanic
 	}
 
+	srv.NotFoundHandler = srv.opts.NotFoundHandler
+	srv.MethodNotAllowedHandler = srv.opts.MethodNotAllowedHandler
+
 	srv.r.NotFoundHandler = func(w http.ResponseWriter, req *http.Request, p router.Params) {
-		if h := srv.NotFoundHandler; h != nil {
-			ctx := getCtx(w, req, p, srv)
-			srv.NotFoundHandler(ctx)
-			putCtx(ctx)
-			return
-		}
+		srv.handleNoRoute(w, req, p, srv.NotFoundHandler, RespNotFound)
+	}
 
-		RespNotFound.WriteToCtx(&Context{
-			Req:            req,
-			ResponseWriter: w,
-		})
+	srv.r.MethodNotAllowedHandler = func(w http.ResponseWriter, req *http.Request, p router.Params) {
+		srv.handleNoRoute(w, req, p, srv.MethodNotAllowedHandler, RespMethodNotAllowed)
+	}
+
+	srv.r.BadRequestHandler = func(w http.ResponseWriter, req *http.Request, p router.Params) {
+		srv.handleNoRoute(w, req, p, nil, errInvalidPathEscape)
 	}
 
 	srv.group = &group{s: srv}
+	srv.hc = health.New()
+	srv.started = time.Now()
 
 	return srv
 }
@@ -93,19 +89,65 @@ func NewWithOpts(opts *Options) *Server {
 // Server is the main server
 type Server struct {
 	*group
-	r *router.Router
+	r  *router.Router
+	hc *health.Checks
+
+	PanicHandler            func(ctx *Context, v interface{})
+	NotFoundHandler         func(ctx *Context)
+	MethodNotAllowedHandler func(ctx *Context)
 
-	PanicHandler    func(ctx *Context, v interface{})
-	NotFoundHandler func(ctx *Context)
+	codecs     map[string]Codec
+	routes     []RouteInfo
+	panicHooks []PanicHook
+	errorHooks []ErrorHook
 
 	servers    []*http.Server
+	conns      []*connCounters
 	opts       Options
 	serversMux sync.Mutex
+	stop       chan struct{} // closed by Close and Shutdown, see stopped
+	inFlight   int64
 	closed     int32
+	draining   int32
+	statsOn    int32
+	logLevel   int32
+
+	adminPrefixes []string
+	started       time.Time
+
+	warmups    []func(ctx context.Context) error
+	warmupOnce sync.Once
+	warmupErr  error
+	warm       int32
+
+	logLimits logLimiter
+	certs     certRegistry
+	adminOnly adminOnly
 }
 
 // ServeHTTP allows using the server in custom scenarios that expects an http.Handler.
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// reject requests that slip in while Shutdown/Drain is waiting on the in-flight ones.
+	if s.Closed() || (s.Draining() && !s.isAdminRequest(req)) {
+		w.Header().Set("Connection", "close")
+		RespServiceUnavailable.WriteToCtx(&Context{
+			Req:            req,
+			ResponseWriter: w,
+		})
+		return
+	}
+
+	if s.hiddenRoute(req) {
+		RespNotFound.WriteToCtx(&Context{
+			Req:            req,
+			ResponseWriter: w,
+		})
+		return
+	}
+
+	atomic.AddInt64(&s.inFlight, 1)
+	defer atomic.AddInt64(&s.inFlight, -1)
+
 	s.r.ServeHTTP(w, req)
 }
 
@@ -113,36 +155,170 @@ func (s *Server) newHTTPServer(addr string) *http.Server {
 	opts := &s.opts
 	return &http.Server{
 		Addr:           addr,
-		Handler:        s.r,
+		Handler:        s,
 		ReadTimeout:    opts.ReadTimeout,
 		WriteTimeout:   opts.WriteTimeout,
 		MaxHeaderBytes: opts.MaxHeaderBytes,
-		ErrorLog:       opts.Logger,
+		ErrorLog:       s.httpErrorLog(),
+		ConnState:      s.newConnCounters(addr).track,
 	}
 }
 
+// PanicHook gets called with the recovered value and the goroutine's stack when a handler panics.
+type PanicHook = func(ctx *Context, v interface{}, stack []byte)
+
+// OnPanic adds a hook that gets called when a handler panics, useful for reporting panics to external services.
+// Hooks are called before the PanicHandler, it is NOT safe to call this once you call one of the run functions.
+func (s *Server) OnPanic(fn PanicHook) {
+	s.panicHooks = append(s.panicHooks, fn)
+}
+
+// ErrorHook gets called with the response after a handler returns an error response (status >= 400).
+// resp is nil for panics handled by a custom Server.PanicHandler.
+type ErrorHook = func(ctx *Context, resp Response)
+
+// OnError adds a hook that gets called whenever a handler returns a 4xx/5xx response, including panics.
+// Useful for centralizing error metrics and alerting, it is NOT safe to call this once you call one of the run functions.
+func (s *Server) OnError(fn ErrorHook) {
+	s.errorHooks = append(s.errorHooks, fn)
+}
+
+func (s *Server) handleNoRoute(w http.ResponseWriter, req *http.Request, p router.Params, h func(ctx *Context), def Response) {
+	if h != nil {
+		ctx := getCtx(w, req, p, s)
+		h(ctx)
+		putCtx(ctx)
+		return
+	}
+
+	def.WriteToCtx(&Context{
+		Req:            req,
+		ResponseWriter: w,
+	})
+}
+
+func (s *Server) callErrorHooks(ctx *Context, resp Response) {
+	for _, fn := range s.errorHooks {
+		fn(ctx, resp)
+	}
+}
+
+func (s *Server) handlePanic(w http.ResponseWriter, req *http.Request, v interface{}) {
+	ctx := getCtx(w, req, nil, s)
+	defer putCtx(ctx)
+
+	s.recoverPanic(ctx, v, debug.Stack(), s.PanicHandler)
+}
+
+func (s *Server) noCatchPanics() bool {
+	ro := s.opts.RouterOptions
+	return ro != nil && ro.NoCatchPanics
+}
+
+// recoverPanic logs the panic, runs the panic hooks then calls h, or writes the default JSON 500 if h is nil.
+func (s *Server) recoverPanic(ctx *Context, v interface{}, stack []byte, h func(ctx *Context, v interface{})) {
+	reqID := ctx.RequestID()
+
+	s.Errorf("PANIC (%T) [reqID:%s]: %v\n%s", v, reqID, v, stack)
+
+	for _, fn := range s.panicHooks {
+		fn(ctx, v, stack)
+	}
+
+	var resp Response
+	if h != nil {
+		h(ctx, v)
+	} else {
+		jr := NewJSONErrorResponse(http.StatusInternalServerError, fmt.Sprintf("PANIC (%T): %v", v, v))
+		jr.RequestID = reqID
+		jr.WriteToCtx(ctx)
+		resp = jr
+	}
+
+	s.callErrorHooks(ctx, resp)
+}
+
+var errInvalidPathEscape = NewJSONErrorResponse(http.StatusBadRequest, "invalid path param")
+
 // Run starts the server on the specific address
 func (s *Server) Run(addr string) error {
 	if addr == "" {
 		addr = ":http"
 	}
 
+	if err := s.Warmup(context.Background()); err != nil {
+		return err
+	}
+
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
 
-	srv := s.newHTTPServer(ln.Addr().String())
+	return s.serve(s.newHTTPServer(ln.Addr().String()), ln)
+}
 
+func (s *Server) serve(srv *http.Server, ln net.Listener) error {
 	s.serversMux.Lock()
+	if s.Closed() { // Shutdown was called while warming up or listening
+		s.serversMux.Unlock()
+		ln.Close()
+		return http.ErrServerClosed
+	}
 	s.servers = append(s.servers, srv)
 	s.serversMux.Unlock()
 
-	if s.opts.KeepAlivePeriod < 1 {
-		return srv.Serve(ln)
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(s.wrapListener(ln), "", "")
 	}
 
-	return srv.Serve(&tcpKeepAliveListener{ln.(*net.TCPListener), s.opts.KeepAlivePeriod})
+	return srv.Serve(s.wrapListener(ln))
+}
+
+// RunRedirector starts an http server on addr (defaults to ":http") that permanently redirects every request to https,
+// except for ACME http-01 challenges which get a 404 since they must be served by an autocert handler.
+// It gets closed by Close/Shutdown like the other servers.
+func (s *Server) RunRedirector(addr string) error {
+	if addr == "" {
+		addr = ":http"
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := s.newHTTPServer(ln.Addr().String())
+	srv.Handler = http.HandlerFunc(redirectToHTTPS)
+
+	return s.serve(srv, ln)
+}
+
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+func redirectToHTTPS(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, acmeChallengePrefix) {
+		http.NotFound(w, req)
+		return
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if host == "" {
+		http.Error(w, "missing host", http.StatusBadRequest)
+		return
+	}
+
+	// only GET and HEAD can be safely redirected with a 301
+	code := http.StatusMovedPermanently
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+
+	http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), code)
 }
 
 // CertPair is a pair of (cert, key) files to listen on TLS
@@ -172,14 +348,39 @@ func (s *Server) Addrs() (out []string) {
 	return
 }
 
+// stopped returns a channel that is closed by Close and Shutdown, used to stop the background goroutines.
+func (s *Server) stopped() <-chan struct{} {
+	s.serversMux.Lock()
+	defer s.serversMux.Unlock()
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	return s.stop
+}
+
+// closeStopped closes the stopped channel, serversMux must be held.
+func (s *Server) closeStopped() {
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
 // Closed returns true if the server is already shutdown/closed
 func (s *Server) Closed() bool {
 	return atomic.LoadInt32(&s.closed) == 1
 }
 
-// Logf logs to the default server logger if set
+// Logf logs to the default server logger if set and the log level is LogInfo or lower.
+//
+// Deprecated: use Infof or one of the other leveled funcs.
 func (s *Server) Logf(f string, args ...interface{}) {
-	s.logfStack(3, f, args...)
+	s.logf(LogInfo, f, args...)
 }
 
 func (s *Server) logfStack(n int, f string, args ...interface{}) {
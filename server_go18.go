@@ -23,6 +23,7 @@ func (s *Server) Close() error {
 	}
 
 	s.servers = nil
+	s.closeStopped()
 	s.serversMux.Unlock()
 
 	return me.Err()
@@ -52,6 +53,7 @@ func (s *Server) Shutdown(timeout time.Duration) error {
 		me.Push(srv.Shutdown(ctx))
 	}
 	s.servers = nil
+	s.closeStopped()
 	s.serversMux.Unlock()
 
 	return me.Err()
@@ -2,12 +2,24 @@ package apiserv
 
 import (
 	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gorilla/securecookie"
+	"github.com/missionMeteora/apiserv/router"
 )
 
 func TestSecureCookie(t *testing.T) {
@@ -57,3 +69,1243 @@ func TestSecureCookie(t *testing.T) {
 		t.Fatalf("unexpected response: %#+v", respValue)
 	}
 }
+
+func TestRewrite(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+
+	v1 := srv.Group("", "/v1", Rewrite(RewriteRule{
+		Path:         RewritePrefix("/v1/", "/v2/"),
+		SetHeaders:   map[string]string{"X-Api-Version": "2"},
+		StripHeaders: []string{"X-Secret"},
+		Rematch:      true,
+	}))
+	v1.GET("/*any", func(ctx *Context) Response {
+		return NewJSONErrorResponse(http.StatusGone)
+	})
+
+	srv.GET("/v2/users/:id", func(ctx *Context) Response {
+		h := ctx.ReqHeader()
+		return NewJSONResponse(ctx.Param("id") + ":" + h.Get("X-Api-Version") + ":" + h.Get("X-Secret"))
+	})
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/42", nil)
+	req.Header.Set("X-Secret", "shh")
+	srv.ServeHTTP(rw, req)
+
+	var s string
+	if _, err := ReadJSONResponse(ioutil.NopCloser(rw.Body), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s != "42:2:" {
+		t.Fatalf("unexpected response: %q", s)
+	}
+}
+
+func TestCache(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	rc := NewResponseCache(time.Minute, nil)
+
+	var hits int
+	srv.Group("", "/c", rc.Handler).GET("/:id", func(ctx *Context) Response {
+		hits++
+		ctx.Header().Set("X-Hits", strconv.Itoa(hits))
+		return NewJSONResponse(ctx.Param("id"))
+	})
+
+	get := func(p string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, p, nil))
+		return rw
+	}
+
+	first := get("/c/1")
+	second := get("/c/1")
+
+	if hits != 1 || second.Header().Get("X-Cache") != "HIT" || second.Header().Get("X-Hits") != "1" {
+		t.Fatalf("expected a cache hit, got %d hits, %v", hits, second.Header())
+	}
+
+	if first.Body.String() != second.Body.String() {
+		t.Fatalf("body mismatch: %q vs %q", first.Body.String(), second.Body.String())
+	}
+
+	get("/c/2")
+	rc.InvalidatePrefix("/c/")
+	get("/c/1")
+
+	if hits != 3 {
+		t.Fatalf("expected 3 hits, got %d", hits)
+	}
+}
+
+func TestCachePrivate(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	rc := NewResponseCache(time.Minute, nil)
+
+	var hits int
+	g := srv.Group("", "/c", rc.Handler)
+	g.GET("/me", func(ctx *Context) Response {
+		hits++
+		return NewJSONResponse(ctx.ReqHeader().Get("Authorization"))
+	})
+	g.GET("/private", func(ctx *Context) Response {
+		hits++
+		ctx.Header().Set("Cache-Control", "private, max-age=60")
+		return RespOK
+	})
+	g.GET("/lang", func(ctx *Context) Response {
+		hits++
+		ctx.Header().Set("Vary", "Accept-Language")
+		return NewJSONResponse(ctx.ReqHeader().Get("Accept-Language"))
+	})
+
+	get := func(p string, hdr ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	get("/c/me", "Authorization", "Bearer alice")
+	if rw := get("/c/me", "Authorization", "Bearer bob"); rw.Header().Get("X-Cache") != "MISS" || !strings.Contains(rw.Body.String(), "bob") {
+		t.Fatalf("cached response shared between users: %v %s", rw.Header(), rw.Body.String())
+	}
+
+	if rw := get("/c/me"); rw.Header().Get("X-Cache") != "MISS" || strings.Contains(rw.Body.String(), "Bearer") {
+		t.Fatalf("cached response shared with an anonymous request: %v %s", rw.Header(), rw.Body.String())
+	}
+
+	if rw := get("/c/me", "Authorization", "Bearer alice"); rw.Header().Get("X-Cache") != "HIT" || !strings.Contains(rw.Body.String(), "alice") {
+		t.Fatalf("expected a hit for the same user: %v %s", rw.Header(), rw.Body.String())
+	}
+
+	get("/c/private")
+	if rw := get("/c/private"); rw.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("private responses shouldn't be cached: %v", rw.Header())
+	}
+
+	get("/c/lang", "Accept-Language", "fr")
+	if rw := get("/c/lang", "Accept-Language", "en"); rw.Header().Get("X-Cache") != "MISS" || !strings.Contains(rw.Body.String(), "en") {
+		t.Fatalf("vary wasn't honored: %v %s", rw.Header(), rw.Body.String())
+	}
+
+	if rw := get("/c/lang", "Accept-Language", "en"); rw.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("expected a hit: %v", rw.Header())
+	}
+
+	if hits != 7 {
+		t.Fatalf("expected 7 hits, got %d", hits)
+	}
+}
+
+func TestCacheMaxBodySize(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	rc := NewResponseCache(time.Minute, nil)
+	rc.MaxBodySize = 16
+	rc.StaleIfError = time.Minute
+
+	var hits int
+	g := srv.Group("", "/c", rc.Handler)
+	g.GET("/small", func(ctx *Context) Response {
+		hits++
+		ctx.Write([]byte("small"))
+		return nil
+	})
+	g.GET("/big", func(ctx *Context) Response {
+		hits++
+		for i := 0; i < 4; i++ {
+			ctx.Write([]byte("0123456789"))
+		}
+		return nil
+	})
+
+	get := func(p string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, p, nil))
+		return rw
+	}
+
+	get("/c/small")
+	if rw := get("/c/small"); rw.Header().Get("X-Cache") != "HIT" || rw.Body.String() != "small" || hits != 1 {
+		t.Fatalf("expected a cache hit: %v %q %d", rw.Header(), rw.Body.String(), hits)
+	}
+
+	for i := 0; i < 2; i++ {
+		if rw := get("/c/big"); rw.Header().Get("X-Cache") != "MISS" || rw.Body.Len() != 40 {
+			t.Fatalf("big responses shouldn't be cached: %v %d", rw.Header(), rw.Body.Len())
+		}
+	}
+
+	if hits != 3 {
+		t.Fatalf("expected 3 hits, got %d", hits)
+	}
+}
+
+func TestCacheStale(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	rc := NewResponseCache(50*time.Millisecond, nil)
+	rc.StaleWhileRevalidate = 100 * time.Millisecond
+	rc.StaleIfError = time.Minute
+
+	var (
+		hits int32
+		fail int32
+	)
+
+	srv.Group("", "/c", rc.Handler).GET("/x", func(ctx *Context) Response {
+		n := atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			return NewJSONErrorResponse(http.StatusBadGateway)
+		}
+		return NewJSONResponse(n)
+	})
+
+	get := func() (string, string) {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/c/x", nil))
+		var n int
+		if _, err := ReadJSONResponse(ioutil.NopCloser(rw.Body), &n); err != nil {
+			return rw.Header().Get("X-Cache"), err.Error()
+		}
+		return rw.Header().Get("X-Cache"), strconv.Itoa(n)
+	}
+
+	if xc, v := get(); xc != "MISS" || v != "1" {
+		t.Fatalf("expected MISS/1, got %s/%s", xc, v)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// expired, but within the swr window, served stale while the background request refreshes it
+	if xc, v := get(); xc != "STALE" || v != "1" {
+		t.Fatalf("expected STALE/1, got %s/%s", xc, v)
+	}
+
+	for i := 0; i < 100; i++ { // wait for the revalidation to finish
+		rc.mux.Lock()
+		n := len(rc.revalidating)
+		rc.mux.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if xc, v := get(); xc != "HIT" || v != "2" {
+		t.Fatalf("expected HIT/2, got %s/%s", xc, v)
+	}
+
+	// past the swr window, errors get the stale copy
+	time.Sleep(200 * time.Millisecond)
+	atomic.StoreInt32(&fail, 1)
+
+	if xc, v := get(); xc != "STALE" || v != "2" {
+		t.Fatalf("expected STALE/2, got %s/%s", xc, v)
+	}
+}
+
+func TestLocalizer(t *testing.T) {
+	b := NewBundle("en")
+	b.Add("en", map[string]string{"hello": "hello %s"})
+	b.Add("fr", map[string]string{"hello": "bonjour %s"})
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(Localizer(b))
+	srv.GET("/hello/:name", func(ctx *Context) Response {
+		return NewJSONResponse(ctx.T("hello", ctx.Param("name")))
+	})
+
+	for al, exp := range map[string]string{
+		"":                          "hello bob",
+		"fr-CA, en;q=0.8":           "bonjour bob",
+		"de;q=0.9, en-GB;q=0.8":     "hello bob",
+		"en;q=0.5, fr;q=0.9, *;q=1": "bonjour bob",
+		"fr;q=0, de":                "hello bob",
+	} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/hello/bob", nil)
+		req.Header.Set("Accept-Language", al)
+		srv.ServeHTTP(rw, req)
+
+		var s string
+		if _, err := ReadJSONResponse(ioutil.NopCloser(rw.Body), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if s != exp {
+			t.Fatalf("%q: expected %q, got %q", al, exp, s)
+		}
+	}
+}
+
+func TestDecompressBody(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.Use(DecompressBody(64))
+	srv.POST("/echo", func(ctx *Context) Response {
+		var m M
+		if err := ctx.BindJSON(&m); err != nil {
+			return NewJSONErrorResponse(http.StatusRequestEntityTooLarge, err)
+		}
+		return NewJSONResponse(m)
+	})
+
+	post := func(enc, body string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte(body))
+		gw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/echo", &buf)
+		req.Header.Set("Content-Encoding", enc)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := post("gzip", `{"a": "b"}`); rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), `"a":"b"`) {
+		t.Fatalf("unexpected response: %d %s", rw.Code, rw.Body.String())
+	}
+
+	if rw := post("gzip", `{"a": "`+strings.Repeat("b", 100)+`"}`); rw.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected response: %d %s", rw.Code, rw.Body.String())
+	}
+
+	if rw := post("zstd", `{}`); rw.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("unexpected response: %d %s", rw.Code, rw.Body.String())
+	}
+}
+
+func TestGzipPolicy(t *testing.T) {
+	body := strings.Repeat("hello world ", 100)
+	srv := New(SetErrLogger(nil))
+	srv.Use(GzipWithOptions(GzipOptions{Level: 6, ExcludePaths: []string{"/raw/"}}))
+	srv.GET("/text", func(ctx *Context) Response {
+		return PlainResponse("text/plain", body)
+	})
+	srv.GET("/img", func(ctx *Context) Response {
+		return PlainResponse("image/png", body)
+	})
+	srv.GET("/proxied", func(ctx *Context) Response {
+		ctx.Header().Set("Content-Encoding", "br")
+		return PlainResponse("text/plain", body)
+	})
+	srv.GET("/raw/text", func(ctx *Context) Response {
+		return PlainResponse("text/plain", body)
+	})
+	srv.GET("/empty", func(ctx *Context) Response {
+		ctx.WriteHeader(http.StatusNoContent)
+		return Break
+	})
+	srv.Group("files", "/files", NoGzip).GET("/text", func(ctx *Context) Response {
+		return PlainResponse("text/plain", body)
+	})
+
+	for path, enc := range map[string]string{
+		"/text":       "gzip",
+		"/img":        "",
+		"/proxied":    "br",
+		"/raw/text":   "",
+		"/empty":      "",
+		"/files/text": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if got := rw.Header().Get("Content-Encoding"); got != enc {
+			t.Errorf("%s: expected encoding %q, got %q", path, enc, got)
+			continue
+		}
+
+		if v := rw.Header().Values("Vary"); path != "/raw/text" && (len(v) != 1 || v[0] != "Accept-Encoding") {
+			t.Errorf("%s: unexpected Vary: %q", path, v)
+		}
+
+		switch {
+		case path == "/empty":
+			if rw.Body.Len() != 0 {
+				t.Errorf("%s: expected an empty body, got %q", path, rw.Body.Bytes())
+			}
+		case enc == "gzip":
+			gr, err := gzip.NewReader(rw.Body)
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			if b, _ := ioutil.ReadAll(gr); string(b) != body {
+				t.Errorf("%s: unexpected body: %q", path, b)
+			}
+		default:
+			if rw.Body.String() != body {
+				t.Errorf("%s: unexpected body: %q", path, rw.Body.Bytes())
+			}
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/text", nil))
+	if rw.Header().Get("Content-Encoding") != "" || rw.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("unexpected headers without gzip: %v", rw.Header())
+	}
+}
+
+func TestCanary(t *testing.T) {
+	cw := NewCanaryWeight(50, "canary")
+	srv := New(SetErrLogger(nil))
+	srv.GET("/", Canary(
+		func(ctx *Context) Response { return PlainResponse(MimePlain, "primary") },
+		func(ctx *Context) Response { return PlainResponse(MimePlain, "canary") },
+		cw.Pick,
+	))
+
+	get := func(cookie *http.Cookie) (string, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		var c *http.Cookie
+		if cs := rw.Result().Cookies(); len(cs) == 1 {
+			c = cs[0]
+		}
+		return rw.Body.String(), c
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 200; i++ {
+		body, c := get(nil)
+		if c == nil {
+			t.Fatal("expected a bucket cookie")
+		}
+		counts[body]++
+
+		// sticky
+		for j := 0; j < 3; j++ {
+			if b, nc := get(c); b != body || nc != nil {
+				t.Fatalf("expected %q without a new cookie, got %q (%v)", body, b, nc)
+			}
+		}
+	}
+
+	if counts["canary"] < 50 || counts["primary"] < 50 {
+		t.Fatalf("unexpected distribution: %v", counts)
+	}
+
+	cw.Set(0)
+	if body, _ := get(&http.Cookie{Name: "canary", Value: "0"}); body != "primary" {
+		t.Fatalf("expected primary after rolling back, got %q", body)
+	}
+
+	cw.Set(100)
+	if body, _ := get(nil); body != "canary" || cw.Percent() != 100 {
+		t.Fatalf("expected canary at 100%%, got %q", body)
+	}
+}
+
+func TestFeatureFlags(t *testing.T) {
+	var calls int32
+	srv := New(SetErrLogger(nil), SetFeatureFlags(FeatureFlagsFunc(func(ctx *Context, flag string) bool {
+		atomic.AddInt32(&calls, 1)
+		return flag == "beta" && ctx.ReqHeader().Get("X-Beta") == "1"
+	})))
+
+	srv.GET("/beta", EvalFlags("beta", "other"), RequireFlag("beta"), func(ctx *Context) Response {
+		return NewJSONResponse(ctx.Flags())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/beta", nil)
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rw.Code)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	req.Header.Set("X-Beta", "1")
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), `"beta":true`) || !strings.Contains(rw.Body.String(), `"other":false`) {
+		t.Fatalf("unexpected response: %d %s", rw.Code, rw.Body.String())
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("flags should be evaluated once per request, got %d calls", n)
+	}
+
+	if ctx, _ := NewTestContext(http.MethodGet, "/", nil); ctx.FlagEnabled("beta") {
+		t.Fatal("flags should be disabled without FeatureFlags")
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	srv.Group("", "/limited", MaxConcurrent(1, 10*time.Millisecond)).GET("/", func(ctx *Context) Response {
+		if ctx.Query("block") != "" {
+			close(started)
+			<-release
+		}
+		return RespOK
+	})
+
+	done := make(chan int)
+	go func() {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/limited?block=1", nil))
+		done <- rw.Code
+	}()
+	<-started
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/limited", nil))
+	if rw.Code != http.StatusServiceUnavailable || rw.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a 503 with Retry-After, got %d %v", rw.Code, rw.Header())
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("unexpected code: %d", code)
+	}
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/limited", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected code: %d", rw.Code)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic for n <= 0")
+		}
+	}()
+	MaxConcurrent(0, 0)
+}
+
+func TestNewTestContext(t *testing.T) {
+	ctx, rec := NewTestContext(http.MethodGet, "/users/1?lang=fr", nil)
+	ctx.Params = router.Params{{Name: "id", Value: "1"}}
+
+	b := NewBundle("en")
+	b.Add("fr", map[string]string{"hi": "salut %s"})
+
+	ctx.SetTestNext(func(ctx *Context) Response {
+		return NewJSONResponse(ctx.T("hi", ctx.Param("id")))
+	})
+
+	if r := Localizer(b)(ctx); r != nil {
+		t.Fatalf("unexpected response: %v", r)
+	}
+	ctx.Next()
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "salut 1") || rec.Header().Get("Content-Language") != "fr" {
+		t.Fatalf("unexpected response: %d %v %s", rec.Code, rec.Header(), rec.Body.String())
+	}
+}
+
+func TestBind(t *testing.T) {
+	type bindReq struct {
+		Name  string        `json:"name" xml:"name" form:"name"`
+		Tags  []string      `json:"tags" xml:"tags" form:"tag"`
+		Age   int           `json:"age" xml:"age" form:"age"`
+		Wait  time.Duration `json:"-" xml:"-" form:"wait"`
+		Since time.Time     `json:"-" xml:"-" form:"since"`
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.RegisterCodec("text/plain", FormCodec) // not really, but any codec works
+	srv.POST("/", func(ctx *Context) Response {
+		var r bindReq
+		if err := ctx.Bind(&r); err != nil {
+			code := http.StatusBadRequest
+			if err == ErrUnsupportedContentType {
+				code = http.StatusUnsupportedMediaType
+			}
+			return NewJSONErrorResponse(code, err)
+		}
+		return NewJSONResponse(M{"name": r.Name, "tags": r.Tags, "age": r.Age, "wait": r.Wait.String(), "since": r.Since.Unix()})
+	})
+
+	form := "name=x&tag=a&tag=b&age=5&wait=1s&since=10"
+	for ct, body := range map[string]string{
+		"":                                  `{"name":"x","tags":["a","b"],"age":5}`,
+		"application/json; charset=utf-8":   `{"name":"x","tags":["a","b"],"age":5}`,
+		"application/xml":                   `<req><name>x</name><tags>a</tags><tags>b</tags><age>5</age></req>`,
+		"application/x-www-form-urlencoded": form,
+		"text/plain":                        form,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		b := rw.Body.String()
+		if rw.Code != http.StatusOK || !strings.Contains(b, `"name":"x"`) || !strings.Contains(b, `"tags":["a","b"]`) || !strings.Contains(b, `"age":5`) {
+			t.Fatalf("%q: unexpected response: %d %s", ct, rw.Code, b)
+		}
+
+		if body == form && (!strings.Contains(b, `"wait":"1s"`) || !strings.Contains(b, `"since":10`)) {
+			t.Fatalf("%q: unexpected response: %s", ct, b)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("x"))
+	req.Header.Set("Content-Type", "application/msgpack")
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+	if rw.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rw.Code)
+	}
+}
+
+type testID [2]byte
+
+func (id *testID) UnmarshalText(b []byte) error {
+	if len(b) != 2 {
+		return strconv.ErrSyntax
+	}
+	copy(id[:], b)
+	return nil
+}
+
+func TestBindAll(t *testing.T) {
+	type bindReq struct {
+		ID    testID    `param:"id"`
+		N     int       `param:"n" json:"n"`
+		At    time.Time `param:"at"`
+		Limit uint      `query:"limit" json:"limit"`
+		Name  string    `json:"name"`
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.POST("/:id/:n/:at", func(ctx *Context) Response {
+		var r bindReq
+		if err := ctx.BindAll(&r); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return NewJSONResponse(M{"id": string(r.ID[:]), "n": r.N, "at": r.At.UTC().Year(), "limit": r.Limit, "name": r.Name})
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/ab/7/2020-01-02T00:00:00Z?limit=3", strings.NewReader(`{"n":1,"limit":1,"name":"x"}`)))
+	if b := rw.Body.String(); rw.Code != http.StatusOK || !strings.Contains(b, `{"at":2020,"id":"ab","limit":3,"n":7,"name":"x"}`) {
+		t.Fatalf("unexpected response: %d %s", rw.Code, b)
+	}
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/abc/x/0", nil))
+	if b := rw.Body.String(); rw.Code != http.StatusBadRequest || !strings.Contains(b, `"field":"id"`) {
+		t.Fatalf("unexpected response: %d %s", rw.Code, b)
+	}
+}
+
+type (
+	bindInt   int
+	bindInner struct {
+		Name string `query:"name"`
+	}
+	bindPtr struct {
+		Other string `query:"other"`
+	}
+)
+
+func TestBindUnexported(t *testing.T) {
+	var out struct {
+		bindInt
+		*bindPtr
+		bindInner
+		private string
+		Limit   int `query:"limit"`
+	}
+
+	vals := url.Values{"bindInt": {"1"}, "bindInner": {"x"}, "private": {"x"}, "bindPtr": {"x"}, "other": {"x"}, "name": {"n"}, "limit": {"5"}}
+	if err := bindValues(&out, "query", true, func(k string) []string { return vals[k] }); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.bindInt != 0 || out.private != "" || out.bindPtr != nil || out.Name != "n" || out.Limit != 5 {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	var ran []string
+	srv := New(SetErrLogger(nil))
+	g := srv.Group("", "/", func(ctx *Context) Response {
+		ran = append(ran, "outer")
+		ctx.Next()
+		if !ctx.IsAborted() {
+			t.Error("expected the chain to be aborted")
+		}
+		return nil
+	}, func(ctx *Context) Response {
+		ran = append(ran, "auth")
+		if ctx.Query("deny") != "" {
+			ctx.AbortWithResponse(RespForbidden)
+			return nil // aborted chains stop even when returning nil
+		}
+		ctx.Abort()
+		return nil
+	}, func(ctx *Context) Response {
+		ran = append(ran, "never")
+		return nil
+	})
+	g.GET("/x", func(ctx *Context) Response {
+		ran = append(ran, "handler")
+		return RespOK
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/x?deny=1", nil))
+	if rw.Code != http.StatusForbidden || strings.Join(ran, ",") != "outer,auth" {
+		t.Fatalf("unexpected response: %d %v", rw.Code, ran)
+	}
+
+	ran = nil
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if rw.Body.Len() != 0 || strings.Join(ran, ",") != "outer,auth" {
+		t.Fatalf("unexpected response: %d %q %v", rw.Code, rw.Body.String(), ran)
+	}
+}
+
+func TestOnFinish(t *testing.T) {
+	type result struct {
+		status int
+		bytes  int64
+		err    error
+	}
+
+	var res []result
+	srv := New(SetErrLogger(nil))
+	srv.Use(func(ctx *Context) Response {
+		ctx.OnFinish(func(status int, bytes int64, err error) {
+			res = append(res, result{status, bytes, err})
+		})
+		return nil
+	})
+	srv.GET("/ok", func(ctx *Context) Response { return NewJSONResponse("ok") })
+	srv.GET("/panic", func(ctx *Context) Response { panic("boom") })
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if len(res) != 2 {
+		t.Fatalf("expected 2 results, got %+v", res)
+	}
+
+	if r := res[0]; r.status != http.StatusOK || r.bytes != int64(rw.Body.Len()) || r.err != nil {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	if r := res[1]; r.status != http.StatusInternalServerError || r.bytes == 0 || r.err == nil {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	spec := &ListQuerySpec{
+		Sort:        []string{"created_at", "name"},
+		Filter:      []string{"status"},
+		DefaultSort: "-created_at",
+	}
+
+	q, r := spec.Parse(url.Values{"sort": {"-created_at,+name"}, "filter[status]": {"active", "new"}})
+	if r != nil {
+		t.Fatalf("unexpected errors: %+v", r.Errors)
+	}
+
+	if len(q.Sort) != 2 || !q.Sort[0].Desc || q.Sort[1] != (SortField{Field: "name"}) || len(q.Filters["status"]) != 2 || q.Filter("status") != "active" {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+
+	if q, _ = spec.Parse(url.Values{}); len(q.Sort) != 1 || q.Sort[0] != (SortField{"created_at", true}) {
+		t.Fatalf("default sort wasn't used: %+v", q)
+	}
+
+	_, r = spec.Parse(url.Values{"sort": {"age,name,name"}, "filter[role]": {"x"}, "filter[status": {"x"}})
+	if r == nil || r.Code != http.StatusBadRequest || len(r.Errors) != 4 || r.Errors[2].Field != "filter[role]" {
+		t.Fatalf("unexpected response: %+v", r)
+	}
+}
+
+func TestCookiePrefixes(t *testing.T) {
+	ctx, rw := NewTestContext(http.MethodGet, "/", nil)
+
+	if err := ctx.SetCookie("__Host-sid", "x", "example.com", false, 0); err != ErrCookiePrefix {
+		t.Fatalf("expected ErrCookiePrefix, got %v", err)
+	}
+
+	if err := ctx.SetCookie("__Host-sid", "x", "", false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.SetCookie("__Secure-pref", "y", "example.com", false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := rw.Result().Cookies()
+	if len(cs) != 2 {
+		t.Fatalf("expected 2 cookies, got %v", cs)
+	}
+
+	for _, c := range cs {
+		if !c.Secure || c.Path != "/" {
+			t.Fatalf("prefixed cookie without the required attributes: %+v", c)
+		}
+	}
+
+	if cs[0].Domain != "" || cs[1].Domain != "example.com" {
+		t.Fatalf("unexpected domains: %q %q", cs[0].Domain, cs[1].Domain)
+	}
+}
+
+func TestSaveMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("title", "pics")
+	fw, _ := mw.CreateFormFile("img", "a.png")
+	fw.Write([]byte("\x89PNG\r\n\x1a\n" + strings.Repeat("x", 1000)))
+	fw, _ = mw.CreateFormFile("doc", "b.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+
+	newCtx := func() *Context {
+		ctx, _ := NewTestContext(http.MethodPost, "/", bytes.NewReader(buf.Bytes()))
+		ctx.Req.Header.Set("Content-Type", mw.FormDataContentType())
+		return ctx
+	}
+
+	dir := t.TempDir()
+
+	var progress int64
+	m, err := newCtx().SaveMultipart(&MultipartOptions{
+		Dir:      dir,
+		Progress: func(field, fn string, n int64) { progress = n },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Values.Get("title") != "pics" || len(m.Files) != 2 || m.Files[0].ContentType != "image/png" ||
+		m.Files[0].Size != 1008 || !strings.HasSuffix(m.Files[0].Path, ".png") || progress != 5 {
+		t.Fatalf("unexpected manifest: %+v %+v", m, m.Files[0])
+	}
+
+	if b, _ := ioutil.ReadFile(m.Files[1].Path); string(b) != "hello" {
+		t.Fatalf("unexpected file content: %q", b)
+	}
+
+	if err = m.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = newCtx().SaveMultipart(&MultipartOptions{Dir: dir, AllowedTypes: []string{"image/"}}); !errors.Is(err, ErrMimeNotAllowed) {
+		t.Fatalf("expected ErrMimeNotAllowed, got %v", err)
+	}
+
+	if _, err = newCtx().SaveMultipart(&MultipartOptions{Dir: dir, MaxPartSize: 100}); !errors.Is(err, ErrPartTooLarge) {
+		t.Fatalf("expected ErrPartTooLarge, got %v", err)
+	}
+
+	if fis, _ := ioutil.ReadDir(dir); len(fis) != 0 {
+		t.Fatalf("files weren't cleaned up: %d", len(fis))
+	}
+
+	var vbuf bytes.Buffer
+	vw := multipart.NewWriter(&vbuf)
+	for i := 0; i < 5; i++ {
+		vw.WriteField("v", strings.Repeat("x", 10))
+	}
+	vw.Close()
+
+	values := func(opts *MultipartOptions) error {
+		ctx, _ := NewTestContext(http.MethodPost, "/", bytes.NewReader(vbuf.Bytes()))
+		ctx.Req.Header.Set("Content-Type", vw.FormDataContentType())
+		_, err := ctx.SaveMultipart(opts)
+		return err
+	}
+
+	if err = values(&MultipartOptions{MaxValues: 5, MaxMemory: 50}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = values(&MultipartOptions{MaxValues: 4}); !errors.Is(err, ErrTooManyValues) {
+		t.Fatalf("expected ErrTooManyValues, got %v", err)
+	}
+
+	if err = values(&MultipartOptions{MaxMemory: 45}); !errors.Is(err, ErrFormTooLarge) {
+		t.Fatalf("expected ErrFormTooLarge, got %v", err)
+	}
+}
+
+func TestStaticDirWithLimit(t *testing.T) {
+	dir := t.TempDir()
+	data := strings.Repeat("0123456789", 100)
+	if err := ioutil.WriteFile(dir+"/video.mp4", []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/s/*fp", StaticDirWithLimit(dir, "fp", 2))
+
+	do := func(method, path string, hdrs ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i < len(hdrs); i += 2 {
+			req.Header.Set(hdrs[i], hdrs[i+1])
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := do(http.MethodGet, "/s/video.mp4")
+	if rw.Code != http.StatusOK || rw.Body.String() != data || rw.Header().Get("Content-Length") != "1000" {
+		t.Fatalf("unexpected response %d (%d bytes): %v", rw.Code, rw.Body.Len(), rw.Header())
+	}
+	lastMod := rw.Header().Get("Last-Modified")
+
+	rw = do(http.MethodGet, "/s/video.mp4", "Range", "bytes=10-19")
+	if rw.Code != http.StatusPartialContent || rw.Body.String() != "0123456789" || rw.Header().Get("Content-Range") != "bytes 10-19/1000" {
+		t.Fatalf("unexpected range response %d: %q %v", rw.Code, rw.Body.String(), rw.Header())
+	}
+
+	rw = do(http.MethodHead, "/s/video.mp4")
+	if rw.Code != http.StatusOK || rw.Body.Len() != 0 || rw.Header().Get("Content-Length") != "1000" {
+		t.Fatalf("unexpected head response %d: %v", rw.Code, rw.Header())
+	}
+
+	if rw = do(http.MethodGet, "/s/video.mp4", "Range", "bytes=0-4", "If-Range", lastMod); rw.Code != http.StatusPartialContent {
+		t.Fatalf("expected a 206 for a matching If-Range, got %d", rw.Code)
+	}
+
+	if rw = do(http.MethodGet, "/s/video.mp4", "Range", "bytes=0-4", "If-Range", "Mon, 02 Jan 2006 15:04:05 GMT"); rw.Code != http.StatusOK || rw.Body.Len() != 1000 {
+		t.Fatalf("expected the full file for a stale If-Range, got %d", rw.Code)
+	}
+
+	if rw = do(http.MethodGet, "/s/video.mp4", "Range", "bytes=5000-"); rw.Code != http.StatusRequestedRangeNotSatisfiable || !strings.Contains(rw.Body.String(), `"success":false`) {
+		t.Fatalf("expected a json 416, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	if rw = do(http.MethodGet, "/s/../../etc/passwd"); rw.Code != http.StatusNotFound {
+		t.Fatalf("expected a 404, got %d", rw.Code)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		events []*AuditEvent
+	)
+
+	sink := AuditSinkFunc(func(e *AuditEvent) error {
+		events = append(events, e)
+		return NewAuditWriterSink(&buf).Audit(e)
+	})
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/public", func(ctx *Context) Response { return RespOK })
+
+	g := srv.Group("admin", "/admin", func(ctx *Context) Response {
+		ctx.Set(AuditSubjectKey, "user-1")
+		return nil
+	}, Audit(sink, nil))
+	g.DELETE("/users/:id", func(ctx *Context) Response { return NewJSONErrorResponse(http.StatusForbidden) })
+
+	for _, r := range [][2]string{{http.MethodGet, "/public"}, {http.MethodDelete, "/admin/users/42"}} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r[0], r[1], nil))
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.Subject != "user-1" || e.Route != "/admin/users/:id" || e.Params["id"] != "42" || e.Status != http.StatusForbidden || e.RequestID == "" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	if !strings.Contains(buf.String(), `"route":"/admin/users/:id"`) {
+		t.Fatalf("unexpected json: %s", buf.String())
+	}
+}
+
+func TestCaptureBodies(t *testing.T) {
+	var e *AuditEvent
+
+	srv := New(SetErrLogger(nil))
+	g := srv.Group("hooks", "/hooks", CaptureBodies(5, 8), Audit(AuditSinkFunc(func(ev *AuditEvent) error { e = ev; return nil }), nil))
+	g.POST("/x", func(ctx *Context) Response {
+		b, _ := ioutil.ReadAll(ctx.Req.Body)
+		return NewJSONResponse(string(b))
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/hooks/x", strings.NewReader("hello world")))
+
+	if !strings.Contains(rw.Body.String(), `"hello world"`) {
+		t.Fatalf("the handler didn't get the full body: %s", rw.Body.String())
+	}
+
+	if e == nil || e.RequestBody != "hello" || e.ResponseBody != `{"data":` {
+		t.Fatalf("unexpected captured bodies: %+v", e)
+	}
+}
+
+func TestGeoIP(t *testing.T) {
+	lookups := 0
+	r := GeoResolverFunc(func(ip net.IP) (*GeoInfo, error) {
+		lookups++
+		return &GeoInfo{Country: "DE", City: "Berlin"}, nil
+	})
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(GeoIP(r, 10))
+	srv.GET("/x", func(ctx *Context) Response {
+		if gi := ctx.Geo(); gi != nil {
+			return NewJSONResponse(gi.Country)
+		}
+		return NewJSONResponse("")
+	})
+
+	for i, c := range []struct{ ip, exp string }{{"8.8.8.8", `"DE"`}, {"8.8.8.8", `"DE"`}, {"10.1.2.3", `""`}} {
+		req := httptest.NewRequest(http.MethodGet, "/x", nil)
+		req.Header.Set("X-Real-Ip", c.ip)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		if !strings.Contains(rw.Body.String(), `"data":`+c.exp) {
+			t.Fatalf("%d: unexpected response: %s", i, rw.Body.String())
+		}
+	}
+
+	if lookups != 1 {
+		t.Fatalf("expected 1 lookup, got %d", lookups)
+	}
+}
+
+func TestBotFilter(t *testing.T) {
+	for ua, exp := range map[string]string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":                          DeviceBot,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148":         DeviceMobile,
+		"Mozilla/5.0 (iPad; CPU OS 16_0 like Mac OS X) AppleWebKit/605.1.15":                                DeviceTablet,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0": DeviceDesktop,
+		"curl/8.0.1": DeviceBot,
+		"":           DeviceUnknown,
+	} {
+		if d := ParseUserAgent(ua).Device; d != exp {
+			t.Fatalf("%q: expected %s, got %s", ua, exp, d)
+		}
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(BotFilter(BotPolicy{Allow: []string{"Googlebot"}, RateLimit: 1, Window: time.Hour}))
+	srv.GET("/x", func(ctx *Context) Response { return RespOK })
+
+	do := func(ua string) int {
+		req := httptest.NewRequest(http.MethodGet, "/x", nil)
+		req.Header.Set("User-Agent", ua)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	for i, c := range []struct {
+		ua   string
+		code int
+	}{
+		{"AhrefsBot/7.0", http.StatusOK},
+		{"AhrefsBot/7.0", http.StatusTooManyRequests},
+		{"Googlebot/2.1", http.StatusOK},
+		{"Googlebot/2.1", http.StatusOK},
+		{"Mozilla/5.0 (Windows NT 10.0)", http.StatusOK},
+	} {
+		if code := do(c.ua); code != c.code {
+			t.Fatalf("%d (%s): expected %d, got %d", i, c.ua, c.code, code)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.Use(RateLimit(RateLimitOptions{Limit: 2, Window: time.Hour, Key: func(ctx *Context) string { return ctx.Query("k") }}))
+	srv.GET("/x", func(ctx *Context) Response { return RespOK })
+
+	do := func(k string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/x?k="+k, nil))
+		return rw
+	}
+
+	for i, c := range []struct {
+		k    string
+		code int
+		rem  string
+	}{
+		{"a", http.StatusOK, "1"},
+		{"a", http.StatusOK, "0"},
+		{"a", http.StatusTooManyRequests, "0"},
+		{"b", http.StatusOK, "1"},
+		{"", http.StatusOK, ""},
+	} {
+		rw := do(c.k)
+		if rw.Code != c.code || rw.Header().Get("X-RateLimit-Remaining") != c.rem {
+			t.Fatalf("%d: expected %d (%s), got %d (%s)", i, c.code, c.rem, rw.Code, rw.Header().Get("X-RateLimit-Remaining"))
+		}
+
+		if c.code == http.StatusTooManyRequests && rw.Header().Get("Retry-After") == "" {
+			t.Fatalf("%d: missing Retry-After", i)
+		}
+	}
+
+	// the previous window's count is weighted by how much of it overlaps the sliding window
+	opts := RateLimitOptions{Store: NewMemoryLimitStore(), Limit: 10, Window: time.Minute, Sliding: true}
+	start := time.Unix(0, 0).Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		opts.hit("k", start)
+	}
+
+	if n, _, _ := opts.hit("k", start.Add(time.Minute+15*time.Second)); n != 8 { // 1 + 10 * 0.75
+		t.Fatalf("expected 8, got %d", n)
+	}
+}
+
+func TestTrustedProxyIP(t *testing.T) {
+	ip := TrustedProxyIP("10.0.0.0/8", "192.0.2.1/32")
+
+	for _, tc := range []struct {
+		remote string
+		xff    []string
+		ip     string
+	}{
+		{"198.51.100.1:1", []string{"203.0.113.1"}, "198.51.100.1"},
+		{"10.0.0.1:1", nil, "10.0.0.1"},
+		{"10.0.0.1:1", []string{"203.0.113.1"}, "203.0.113.1"},
+		{"10.0.0.1:1", []string{"6.6.6.6, 203.0.113.1, 10.1.1.1"}, "203.0.113.1"},
+		{"10.0.0.1:1", []string{"6.6.6.6", "203.0.113.1, 192.0.2.1"}, "203.0.113.1"},
+		{"10.0.0.1:1", []string{"10.1.1.1"}, "10.0.0.1"},
+	} {
+		ctx, _ := NewTestContext(http.MethodGet, "/", nil)
+		ctx.Req.RemoteAddr = tc.remote
+		for _, v := range tc.xff {
+			ctx.Req.Header.Add("X-Forwarded-For", v)
+		}
+
+		if got := ip(ctx); got != tc.ip {
+			t.Fatalf("%s %v: expected %s, got %s", tc.remote, tc.xff, tc.ip, got)
+		}
+
+		if host, _, _ := net.SplitHostPort(tc.remote); ctx.RemoteIP() != host {
+			t.Fatalf("unexpected RemoteIP: %s", ctx.RemoteIP())
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	var (
+		calls   int32
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(Coalesce(nil))
+	srv.GET("/x", func(ctx *Context) Response {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return NewJSONResponse("ok")
+	})
+
+	const n = 5
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, n)
+
+	do := func(i int) {
+		defer wg.Done()
+		recs[i] = httptest.NewRecorder()
+		srv.ServeHTTP(recs[i], httptest.NewRequest(http.MethodGet, "/x", nil))
+	}
+
+	wg.Add(1)
+	go do(0)
+	<-started
+
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go do(i)
+	}
+
+	time.Sleep(50 * time.Millisecond) // let the other requests reach the middleware
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+
+	coalesced := 0
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok"`) {
+			t.Fatalf("%d: unexpected response: %d %s", i, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get(CoalescedHeader) == "true" {
+			coalesced++
+		}
+	}
+
+	if coalesced != n-1 {
+		t.Fatalf("expected %d coalesced responses, got %d", n-1, coalesced)
+	}
+}
+
+func TestCoalesceStream(t *testing.T) {
+	var (
+		calls   int32
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(Coalesce(nil))
+	srv.GET("/events", func(ctx *Context) Response {
+		ctx.Header().Set("Content-Type", "text/event-stream")
+		ctx.Write([]byte("data: hi\n\n"))
+		ctx.Flush()
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+	defer close(release)
+
+	go srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	<-started
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+		done <- rec
+	}()
+
+	select {
+	case rec := <-done:
+		if rec.Header().Get(CoalescedHeader) != "" || rec.Body.String() != "data: hi\n\n" {
+			t.Fatalf("streams shouldn't be coalesced: %v %q", rec.Header(), rec.Body.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the follower is waiting on a streaming leader")
+	}
+}
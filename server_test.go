@@ -2,15 +2,32 @@ package apiserv
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"go.oneofone.dev/otk"
+	"golang.org/x/crypto/ocsp"
 )
 
 var testData = []struct {
@@ -261,6 +278,9 @@ func TestServer(t *testing.T) {
 		if resp.Header.Get("Access-Control-Allow-Methods") != "GET" {
 			t.Fatalf("unexpected headers: %+v", resp.Header)
 		}
+		if v := resp.Header.Values("Vary"); len(v) != 2 || v[0] != "Origin" || v[1] != "Access-Control-Request-Headers" {
+			t.Fatalf("unexpected Vary: %q", v)
+		}
 	})
 
 	t.Run("POST", func(t *testing.T) {
@@ -284,3 +304,1304 @@ func TestListenZero(t *testing.T) {
 	s := newServerAndWait(t, "")
 	defer s.Shutdown(0)
 }
+
+func TestEnableDebug(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.EnableDebug("/_debug", func(ctx *Context) Response {
+		if ctx.ReqHeader().Get("X-Debug") != "1" {
+			return RespForbidden
+		}
+		return nil
+	})
+
+	for path, code := range map[string]int{
+		"/_debug/pprof":           http.StatusFound,
+		"/_debug/pprof/":          http.StatusOK,
+		"/_debug/pprof/goroutine": http.StatusOK,
+		"/_debug/pprof/cmdline":   http.StatusOK,
+		"/_debug/vars":            http.StatusOK,
+		"/_debug/routes":          http.StatusOK,
+	} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		srv.ServeHTTP(rw, req)
+		if rw.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d", path, rw.Code)
+		}
+
+		rw = httptest.NewRecorder()
+		req.Header.Set("X-Debug", "1")
+		srv.ServeHTTP(rw, req)
+		if rw.Code != code {
+			t.Fatalf("%s: expected %d, got %d: %s", path, code, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	if err := srv.EnableAdmin("/_admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	srv.GET("/slow", func(ctx *Context) Response {
+		close(started)
+		<-release
+		return RespOK
+	})
+	srv.GET("/fast", func(ctx *Context) Response {
+		return RespOK
+	})
+
+	go srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-started
+
+	if n := srv.InFlight(); n != 1 {
+		t.Fatalf("expected 1 in-flight request, got %d", n)
+	}
+
+	if err := srv.Drain(20 * time.Millisecond); err != ErrDrainTimeout {
+		t.Fatalf("expected ErrDrainTimeout, got %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rw.Code != http.StatusServiceUnavailable || rw.Header().Get("Connection") != "close" {
+		t.Fatalf("unexpected response while draining: %d %v", rw.Code, rw.Header())
+	}
+
+	for path, code := range map[string]int{
+		"/_admin/drain":     http.StatusOK,
+		"//_admin/drain":    http.StatusOK,
+		"/_admin/../fast":   http.StatusServiceUnavailable,
+		"/_admin/./../fast": http.StatusServiceUnavailable,
+	} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+		if rw.Code != code {
+			t.Fatalf("%s: expected %d while draining, got %d", path, code, rw.Code)
+		}
+	}
+
+	close(release)
+
+	if err := srv.Drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Resume()
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("unexpected response after resume: %d", rw.Code)
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+
+	var (
+		pv    interface{}
+		stack []byte
+	)
+	srv.OnPanic(func(ctx *Context, v interface{}, st []byte) {
+		pv, stack = v, st
+	})
+
+	srv.GET("/panic", func(ctx *Context) Response {
+		panic("boom")
+	})
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	srv.ServeHTTP(rw, req)
+
+	if pv != "boom" || !bytes.Contains(stack, []byte("TestOnPanic")) {
+		t.Fatalf("unexpected hook values: %v\n%s", pv, stack)
+	}
+
+	var resp JSONResponse
+	if err := json.NewDecoder(rw.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Code != http.StatusInternalServerError || resp.RequestID != "req-1" || rw.Header().Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+
+	var codes []int
+	srv.OnError(func(ctx *Context, resp Response) {
+		codes = append(codes, ctx.Status())
+	})
+
+	srv.GET("/ok", func(ctx *Context) Response { return RespOK })
+	srv.GET("/bad", func(ctx *Context) Response { return RespBadRequest })
+	srv.GET("/panic", func(ctx *Context) Response { panic("poo") })
+
+	for _, p := range []string{"/ok", "/bad", "/panic"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	if len(codes) != 2 || codes[0] != http.StatusBadRequest || codes[1] != http.StatusInternalServerError {
+		t.Fatalf("unexpected error hook calls: %v", codes)
+	}
+}
+
+func TestRouteMeta(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+
+	var seen *RouteMeta
+	h := func(ctx *Context) Response {
+		seen = ctx.RouteMeta()
+		return RespOK
+	}
+
+	srv.GET("/plain", h)
+	srv.Group("api", "/api").WithMeta(RouteMeta{Description: "get a user", Tags: []string{"users"}}).GET("/user/:id", h)
+
+	ri := srv.RoutesInfo()
+	if len(ri) != 2 || ri[0].Meta != nil || ri[1].Path != "/api/user/:id" || ri[1].Group != "api" || !ri[1].Meta.HasTag("users") {
+		t.Fatalf("unexpected routes: %+v", ri)
+	}
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user/1", nil))
+	if seen == nil || seen.Description != "get a user" {
+		t.Fatalf("unexpected meta: %+v", seen)
+	}
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/plain", nil))
+	if seen != nil {
+		t.Fatalf("unexpected meta: %+v", seen)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, tc := range []struct {
+		method, target string
+		code           int
+		loc            string
+	}{
+		{http.MethodGet, "http://example.com:8080/a/b?c=d", http.StatusMovedPermanently, "https://example.com/a/b?c=d"},
+		{http.MethodPost, "http://example.com/form", http.StatusPermanentRedirect, "https://example.com/form"},
+		{http.MethodGet, "http://example.com/.well-known/acme-challenge/token", http.StatusNotFound, ""},
+	} {
+		rw := httptest.NewRecorder()
+		redirectToHTTPS(rw, httptest.NewRequest(tc.method, tc.target, nil))
+		if rw.Code != tc.code || rw.Header().Get("Location") != tc.loc {
+			t.Fatalf("%s %s: unexpected response: %d %q", tc.method, tc.target, rw.Code, rw.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRunUntilSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("can't send os.Interrupt on windows")
+	}
+
+	srv := New(SetErrLogger(nil), SetShutdownTimeout(time.Second))
+	srv.GET("/", func(ctx *Context) Response { return RespOK })
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.RunUntilSignal("127.0.0.1:0", os.Interrupt) }()
+
+	for i := 0; len(srv.Addrs()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("server didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunUntilSignal didn't return")
+	}
+
+	if !srv.Closed() {
+		t.Fatal("expected the server to be closed")
+	}
+}
+
+func TestRunUntilSignalWarmup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("can't send os.Interrupt on windows")
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := New(SetErrLogger(nil), SetShutdownTimeout(time.Second))
+	srv.WarmupFuncs(func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.RunUntilSignal("127.0.0.1:0", os.Interrupt) }()
+	<-started
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; !srv.Closed(); i++ {
+		if i == 100 {
+			t.Fatal("server didn't shut down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunUntilSignal didn't return after a signal during warmup")
+	}
+
+	if addrs := srv.Addrs(); len(addrs) != 0 {
+		t.Fatalf("the server shouldn't be listening: %v", addrs)
+	}
+}
+
+func TestShutdownRejects(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/", func(ctx *Context) Response { return RespOK })
+
+	if err := srv.Shutdown(0); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rw.Code != http.StatusServiceUnavailable || rw.Header().Get("Connection") != "close" {
+		t.Fatalf("unexpected response after shutdown: %d %v", rw.Code, rw.Header())
+	}
+
+	if !strings.Contains(rw.Body.String(), `"success":false`) {
+		t.Fatalf("expected a json response, got %s", rw.Body.String())
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	var cfg tls.Config
+	New().applyTLSOptions(&cfg)
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.CipherSuites != nil || cfg.CurvePreferences != nil {
+		t.Fatalf("unexpected defaults: %v %v %v", cfg.MinVersion, cfg.CipherSuites, cfg.CurvePreferences)
+	}
+
+	srv := New(SetTLSMinVersion(tls.VersionTLS13),
+		SetTLSCipherSuites(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256),
+		SetTLSCurvePreferences(tls.X25519, tls.CurveP256))
+	cfg = tls.Config{}
+	srv.applyTLSOptions(&cfg)
+	if cfg.MinVersion != tls.VersionTLS13 || len(cfg.CipherSuites) != 1 || len(cfg.CurvePreferences) != 2 {
+		t.Fatalf("options weren't applied: %v %v %v", cfg.MinVersion, cfg.CipherSuites, cfg.CurvePreferences)
+	}
+}
+
+func TestSessionTicketRotation(t *testing.T) {
+	cert, err := NewSelfSignedCert("a.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := &tls.Config{Certificates: []tls.Certificate{cert}}
+	defSrv := New(SetErrLogger(nil))
+	defSrv.rotateTicketKeys(def)
+	defSrv.Shutdown(0)
+	if def.GetConfigForClient == nil {
+		t.Fatal("ticket rotation should be on by default")
+	}
+
+	off := &tls.Config{Certificates: []tls.Certificate{cert}}
+	New(SetErrLogger(nil), SetSessionTicketKeys(0, nil)).rotateTicketKeys(off)
+	if off.GetConfigForClient != nil {
+		t.Fatal("ticket rotation should be disabled with 0")
+	}
+
+	var gen int32
+	srv := New(SetErrLogger(nil), SetSessionTicketKeys(20*time.Millisecond, func() ([][32]byte, error) {
+		return [][32]byte{{byte(atomic.AddInt32(&gen, 1))}}, nil
+	}))
+	defer srv.Shutdown(0)
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.rotateTicketKeys(cfg)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	ts.TLS = cfg
+	ts.StartTLS()
+	defer ts.Close()
+
+	hc := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ClientSessionCache: tls.NewLRUClientSessionCache(8)},
+		DisableKeepAlives: true,
+	}}
+
+	get := func() (resumed bool, g int32) {
+		g = atomic.LoadInt32(&gen)
+		resp, err := hc.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.DidResume, g
+	}
+
+	// retry in case a rotation happens between the two requests
+	for i := 0; ; i++ {
+		get()
+		if ok, g := get(); ok {
+			break
+		} else if i == 10 || g == atomic.LoadInt32(&gen) {
+			t.Fatal("expected the session to be resumed")
+		}
+	}
+
+	get()
+	for g := atomic.LoadInt32(&gen); atomic.LoadInt32(&gen) == g; {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if ok, _ := get(); ok {
+		t.Fatal("the session shouldn't resume after the keys were replaced")
+	}
+}
+
+func TestNoRouteHandlers(t *testing.T) {
+	srv := New()
+	srv.GET("/", func(ctx *Context) Response { return RespOK })
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/x", nil))
+	if rw.Code != http.StatusMethodNotAllowed || !strings.Contains(rw.Body.String(), `"success":false`) {
+		t.Fatalf("expected a json 405, got %d %s", rw.Code, rw.Body.String())
+	}
+
+	srv = New(SetNotFoundHandler(func(ctx *Context) {
+		ctx.JSON(http.StatusNotFound, false, "nope")
+	}), SetMethodNotAllowedHandler(func(ctx *Context) {
+		ctx.JSON(http.StatusMethodNotAllowed, false, "not here")
+	}))
+
+	for m, exp := range map[string]string{http.MethodGet: "nope", http.MethodDelete: "not here"} {
+		rw = httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(m, "/x", nil))
+		if !strings.Contains(rw.Body.String(), exp) {
+			t.Fatalf("%s: expected %q, got %s", m, exp, rw.Body.String())
+		}
+	}
+}
+
+func TestMountServer(t *testing.T) {
+	users := New()
+	ug := users.Group("users", "/users", func(ctx *Context) Response {
+		ctx.Header().Add("X-MW", "sub")
+		return nil
+	})
+	ug.GET("/:id", func(ctx *Context) Response { return NewJSONResponse(ctx.Param("id")) })
+	users.WithMeta(RouteMeta{Name: "stats"}).GET("/stats", func(ctx *Context) Response { return RespOK })
+
+	srv := New()
+	api := srv.Group("api", "/api", func(ctx *Context) Response {
+		ctx.Header().Add("X-MW", "parent")
+		return nil
+	})
+	if err := api.MountServer("/v1", users); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/api/v1/users/42", nil))
+	if rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), `"42"`) {
+		t.Fatalf("unexpected response: %d %s", rw.Code, rw.Body.String())
+	}
+
+	if mw := strings.Join(rw.Header()["X-Mw"], ","); mw != "parent,sub" {
+		t.Fatalf("unexpected middleware order: %s", mw)
+	}
+
+	ri := srv.RoutesInfo()
+	if len(ri) != 2 || ri[0].Group != "users" || ri[1].Group != "api" || ri[1].Path != "/api/v1/stats" || ri[1].Meta.Name != "stats" {
+		t.Fatalf("unexpected routes: %+v", ri)
+	}
+}
+
+func TestGroupPanicHandler(t *testing.T) {
+	var hooks int
+	srv := New(SetErrLogger(nil))
+	srv.OnPanic(func(ctx *Context, v interface{}, stack []byte) { hooks++ })
+
+	pub := srv.Group("public", "/pub")
+	admin := srv.Group("admin", "/admin")
+	admin.SetPanicHandler(func(ctx *Context, v interface{}) {
+		ctx.Printf(http.StatusInternalServerError, MimePlain, "admin: %v", v)
+	})
+	sub := admin.Group("sub", "/sub")
+
+	h := func(ctx *Context) Response { panic("boom") }
+	pub.GET("/x", h)
+	admin.GET("/x", h)
+	sub.GET("/x", h)
+
+	for path, exp := range map[string]string{"/pub/x": `PANIC (string): boom`, "/admin/x": "admin: boom", "/admin/sub/x": "admin: boom"} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+		if rw.Code != http.StatusInternalServerError || !strings.Contains(rw.Body.String(), exp) {
+			t.Fatalf("%s: unexpected response: %d %s", path, rw.Code, rw.Body.String())
+		}
+	}
+
+	if hooks != 3 {
+		t.Fatalf("expected 3 panic hook calls, got %d", hooks)
+	}
+}
+
+func TestOnRequestDone(t *testing.T) {
+	var done []string
+	srv := New(SetProfileLabels(true), SetOnRequestDone(func(_ context.Context, group, method, uri string, _ time.Duration) {
+		done = append(done, group+" "+method+" "+uri)
+	}))
+	srv.Group("api", "/api").GET("/x", func(ctx *Context) Response { return RespOK })
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/x", nil))
+	if len(done) != 1 || done[0] != "api GET /api/x" {
+		t.Fatalf("unexpected calls: %q", done)
+	}
+}
+
+func TestStats(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/ok", func(ctx *Context) Response { return RespOK })
+	srv.GET("/bad", func(ctx *Context) Response { return RespBadRequest })
+	srv.GET("/unused", func(ctx *Context) Response { return RespOK })
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if st := srv.Stats(); len(st) != 0 {
+		t.Fatalf("stats shouldn't be collected before EnableStats: %+v", st)
+	}
+
+	srv.EnableStats("apiserv-test-stats")
+	for _, p := range []string{"/ok", "/ok", "/bad"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	st := srv.Stats()
+	if len(st) != 2 || st[0].Path != "/ok" || st[0].Count != 2 || st[0].Status["2xx"] != 2 ||
+		st[1].Path != "/bad" || st[1].Status["4xx"] != 1 || st[1].MaxLatency <= 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	if v := expvar.Get("apiserv-test-stats"); v == nil || !strings.Contains(v.String(), `"path":"/bad"`) {
+		t.Fatalf("unexpected expvar: %v", v)
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/ok", func(ctx *Context) Response { return RespOK })
+
+	go srv.Run("127.0.0.1:0")
+	for i := 0; len(srv.Addrs()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("server didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tr := &http.Transport{}
+	hc := &http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		resp, err := hc.Get("http://" + srv.Addrs()[0] + "/ok")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	wait := func(fn func(cs ConnStats) bool) ConnStats {
+		for i := 0; ; i++ {
+			cs := srv.ConnStats()
+			if len(cs) == 1 && fn(cs[0]) {
+				return cs[0]
+			}
+			if i == 100 {
+				t.Fatalf("unexpected stats: %+v", cs)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	wait(func(cs ConnStats) bool { return cs.Accepted == 1 && cs.Open == 1 && cs.Idle == 1 && cs.Active == 0 })
+
+	tr.CloseIdleConnections()
+	wait(func(cs ConnStats) bool { return cs.Closed == 1 && cs.Open == 0 && cs.Idle == 0 })
+
+	srv.Close()
+}
+
+func TestMaxConns(t *testing.T) {
+	srv := New(SetErrLogger(nil), SetMaxConns(1), SetTCPDelay(true))
+
+	go srv.Run("127.0.0.1:0")
+	for i := 0; len(srv.Addrs()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("server didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer srv.Close()
+
+	accepted := func(n int64) bool {
+		for i := 0; i < 20; i++ {
+			if srv.ConnStats()[0].Accepted == n {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	c1, err := net.Dial("tcp", srv.Addrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !accepted(1) {
+		t.Fatal("the first connection wasn't accepted")
+	}
+
+	c2, err := net.Dial("tcp", srv.Addrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	if accepted(2) {
+		t.Fatal("the second connection shouldn't be accepted while the first is open")
+	}
+
+	c1.Close()
+	if !accepted(2) {
+		t.Fatal("the second connection wasn't accepted after closing the first")
+	}
+}
+
+func TestRunTLSAndAutoListener(t *testing.T) {
+	srv := New(SetErrLogger(nil), SetMaxConns(1), SetAutoCertAddrs("-", "127.0.0.1:0"))
+
+	go srv.RunTLSAndAuto(t.TempDir(), nil, NewAutoCertHosts("a.com"))
+	for i := 0; len(srv.Addrs()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("server didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	accepted := func(n int64) bool {
+		for i := 0; i < 20; i++ {
+			if cs := srv.ConnStats(); len(cs) > 0 && cs[0].Accepted == n {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	c1, err := net.Dial("tcp", srv.Addrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+
+	if !accepted(1) {
+		t.Fatal("the first connection wasn't accepted")
+	}
+
+	c2, err := net.Dial("tcp", srv.Addrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	if accepted(2) {
+		t.Fatal("MaxConns wasn't applied to the autocert listener")
+	}
+
+	srv.Close()
+
+	closed := New(SetErrLogger(nil), SetAutoCertAddrs("-", "127.0.0.1:0"))
+	closed.Shutdown(0)
+	if err := closed.RunAutoCert(t.TempDir()); err != http.ErrServerClosed {
+		t.Fatalf("expected ErrServerClosed, got %v", err)
+	}
+}
+
+func testRouteDumpHandler(ctx *Context) Response { return RespOK }
+
+func TestEnableRouteDump(t *testing.T) {
+	srv := New()
+	srv.WithMeta(RouteMeta{Tags: []string{"users"}}).GET("/users", testRouteDumpHandler)
+
+	var calledMW bool
+	if err := srv.EnableRouteDump("/_routes", func(ctx *Context) Response {
+		calledMW = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/_routes", nil))
+
+	var routes []RouteInfo
+	if _, err := ReadJSONResponse(ioutil.NopCloser(rw.Body), &routes); err != nil {
+		t.Fatal(err)
+	}
+
+	if !calledMW || len(routes) != 2 || routes[0].Path != "/users" || !strings.HasSuffix(routes[0].Handler, ".testRouteDumpHandler") ||
+		!routes[0].Meta.HasTag("users") || routes[1].Group != "debug" {
+		t.Fatalf("unexpected routes (mw: %v): %+v", calledMW, routes)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/x", func(ctx *Context) Response { return RespOK })
+	if err := srv.EnableAdmin("/_admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, body string) (int, string) {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rw.Code, rw.Body.String()
+	}
+
+	if code, b := do(http.MethodPut, "/_admin/log-level", `{"level":"error"}`); code != http.StatusOK || !strings.Contains(b, `"error"`) || srv.LogLevel() != LogError {
+		t.Fatalf("unexpected response: %d %s", code, b)
+	}
+
+	if code, _ := do(http.MethodPut, "/_admin/log-level?level=nope", ""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+
+	if code, b := do(http.MethodPost, "/_admin/drain", ""); code != http.StatusOK || !strings.Contains(b, `"draining":true`) {
+		t.Fatalf("unexpected response: %d %s", code, b)
+	}
+
+	if code, _ := do(http.MethodGet, "/x", ""); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", code)
+	}
+
+	if code, b := do(http.MethodGet, "/_admin/stats", ""); code != http.StatusOK || !strings.Contains(b, `"logLevel":"error"`) {
+		t.Fatalf("unexpected response: %d %s", code, b)
+	}
+
+	if code, b := do(http.MethodDelete, "/_admin/drain", ""); code != http.StatusOK || !strings.Contains(b, `"draining":false`) {
+		t.Fatalf("unexpected response: %d %s", code, b)
+	}
+
+	if code, _ := do(http.MethodGet, "/x", ""); code != http.StatusOK {
+		t.Fatalf("expected 200 after resuming, got %d", code)
+	}
+
+	ts := httptest.NewTLSServer(srv)
+	ts.Close()
+	srv.trackCertPairs([]CertPair{{CertFile: "cert.pem"}}, ts.TLS.Certificates)
+	srv.trackCertPairs([]CertPair{{CertFile: "cert.pem"}}, ts.TLS.Certificates)
+
+	if certs := srv.Certificates(); len(certs) != 1 || certs[0].Source != "file" || certs[0].ExpiresIn() <= 0 || len(certs[0].Domains) == 0 {
+		t.Fatalf("unexpected certs: %+v", certs)
+	}
+
+	if code, b := do(http.MethodGet, "/_admin/certs", ""); code != http.StatusOK || !strings.Contains(b, `"file":"cert.pem"`) {
+		t.Fatalf("unexpected response: %d %s", code, b)
+	}
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	cert, err := NewSelfSignedCert("a.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cert.Leaf.VerifyHostname("a.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{ServerName: "b.com", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if cs := conn.ConnectionState(); len(cs.PeerCertificates) != 1 || cs.PeerCertificates[0].Subject.CommonName != "apiserv fallback" {
+		t.Fatalf("unexpected certs: %+v", cs.PeerCertificates)
+	}
+}
+
+func TestOCSPStapling(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	ca, _ := x509.ParseCertificate(caDER)
+
+	var hits int32
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		b, _ := ioutil.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, _ := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(4 * time.Hour),
+		}, caKey)
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		DNSNames:     []string{"a.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{responder.URL},
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if New(SetErrLogger(nil)).newOCSPStapler([]tls.Certificate{{Certificate: [][]byte{leafDER, caDER}, PrivateKey: key}}) != nil {
+		t.Fatal("stapling should be off by default")
+	}
+
+	srv := New(SetErrLogger(nil), SetOCSPStapling(true))
+	st := srv.newOCSPStapler([]tls.Certificate{{Certificate: [][]byte{leafDER, caDER}, PrivateKey: key}})
+	if st == nil {
+		t.Fatal("expected a stapler")
+	}
+
+	now := time.Now()
+	if next := st.refresh(now); next.Sub(now) < time.Hour+59*time.Minute || next.Sub(now) > 2*time.Hour+time.Minute {
+		t.Fatalf("unexpected next refresh: %v", next.Sub(now))
+	}
+
+	if crt, _ := st.getCertificate(&tls.ClientHelloInfo{}); len(crt.OCSPStaple) == 0 || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("expected a staple (hits: %d)", hits)
+	}
+
+	ran := make(chan struct{})
+	go func() { st.run(); close(ran) }()
+	srv.Close()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("the stapler kept running after Close")
+	}
+
+	if New(SetOCSPStapling(false)).newOCSPStapler(st.certs) != nil {
+		t.Fatal("stapling should be disabled")
+	}
+}
+
+func TestAutoCertHostsWatch(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "hosts")
+	if err := ioutil.WriteFile(fp, []byte("# customers\na.com\n\nB.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := NewAutoCertHosts()
+	if err := hosts.Watch(ctx, FileHostProvider(fp), 10*time.Millisecond, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := hosts.Hosts(); len(h) != 2 || h[0] != "a.com" || h[1] != "b.com" {
+		t.Fatalf("unexpected hosts: %q", h)
+	}
+
+	if err := ioutil.WriteFile(fp, []byte("c.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; !hosts.Contains("c.com"); i++ {
+		if i == 100 {
+			t.Fatalf("hosts weren't refreshed: %q", hosts.Hosts())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if hosts.Contains("a.com") {
+		t.Fatal("a.com should've been removed")
+	}
+}
+
+func TestRunAdmin(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/x", func(ctx *Context) Response { return RespOK })
+
+	admin := srv.Group("admin", "/_admin")
+	if err := srv.RegisterAdmin(admin); err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.RunAdmin("127.0.0.1:0", admin)
+	defer srv.Close()
+
+	for i := 0; len(srv.Addrs()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("server didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, path := range []string{"/_admin/log-level", "//_admin/log-level", "/./_admin/log-level", "/x/../_admin/log-level"} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+		if rw.Code != http.StatusNotFound {
+			t.Fatalf("%s: admin routes should be hidden from the public listener, got %d", path, rw.Code)
+		}
+	}
+
+	get := func(path string) int {
+		resp, err := http.Get("http://" + srv.Addrs()[0] + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get("/_admin/log-level"); code != http.StatusOK {
+		t.Fatalf("expected 200 from the admin listener, got %d", code)
+	}
+
+	if code := get("/x"); code != http.StatusNotFound {
+		t.Fatalf("public routes shouldn't be served by the admin listener, got %d", code)
+	}
+
+	if code := get("/_admin/../x"); code != http.StatusNotFound {
+		t.Fatalf("public routes shouldn't be served by the admin listener, got %d", code)
+	}
+
+	srv.startDrain()
+	if code := get("/_admin/drain"); code != http.StatusOK {
+		t.Fatalf("expected 200 while draining, got %d", code)
+	}
+}
+
+func TestInternalRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		opts   []Option
+		remote string
+		code   int
+	}{
+		{nil, "192.0.2.1:1234", http.StatusNotFound},
+		{nil, "127.0.0.1:1234", http.StatusOK},
+		{nil, "[::1]:1234", http.StatusOK},
+		{[]Option{SetInternalNets("192.0.2.0/24")}, "192.0.2.1:1234", http.StatusOK},
+	} {
+		srv := New(tc.opts...)
+		srv.Group("debug", "/_debug").Internal().GET("/state", func(ctx *Context) Response { return RespOK })
+
+		req := httptest.NewRequest(http.MethodGet, "/_debug/state", nil)
+		req.RemoteAddr = tc.remote
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		if rw.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.remote, tc.code, rw.Code)
+		}
+	}
+
+	srv := New()
+	srv.Internal().GET("/state", func(ctx *Context) Response { return RespOK })
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !srv.RoutesInfo()[0].Meta.Internal {
+		t.Fatalf("expected 200 on loopback, got %d", resp.StatusCode)
+	}
+}
+
+func TestLoadOptions(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "cfg.json")
+	if err := ioutil.WriteFile(fp, []byte(`{
+		"addr": ":8080",
+		"readTimeout": "5s",
+		"writeTimeout": 10,
+		"maxHeaderBytes": 1024,
+		"tlsMinVersion": "1.3",
+		"logLevel": "warn",
+		"gzip": 5,
+		"router": {"noAutoHeadToGet": true}
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadOptions(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := FromConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := srv.opts
+	if o.ReadTimeout != 5*time.Second || o.WriteTimeout != 10*time.Second || o.MaxHeaderBytes != 1024 ||
+		o.TLSMinVersion != tls.VersionTLS13 || !o.RouterOptions.NoAutoHeadToGet || srv.LogLevel() != LogWarn || len(srv.mw) != 1 {
+		t.Fatalf("unexpected options: %+v", o)
+	}
+
+	if _, err = LoadOptions(filepath.Join(t.TempDir(), "cfg.toml")); err == nil {
+		t.Fatal("expected an error for an unknown extension")
+	}
+
+	if err = ioutil.WriteFile(fp, []byte(`{"tlsMinVersion": "9"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = LoadOptions(fp); err == nil {
+		t.Fatal("expected an error for an invalid tls version")
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	for k, v := range map[string]string{
+		"APITEST_PORT":               "8081",
+		"APITEST_READ_TIMEOUT":       "3s",
+		"APITEST_WRITE_TIMEOUT":      "2.5",
+		"APITEST_TLS_CERT_FILE":      "cert.pem",
+		"APITEST_TLS_KEY_FILE":       "key.pem",
+		"APITEST_AUTOCERT_HOSTS":     "a.com, b.com",
+		"APITEST_AUTOCERT_HTTP_ADDR": "-",
+	} {
+		t.Setenv(k, v)
+	}
+
+	var c Config
+	if err := c.LoadEnv("APITEST_"); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Addr != ":8081" || c.ReadTimeout != Duration(3*time.Second) || c.WriteTimeout != Duration(2500*time.Millisecond) ||
+		len(c.CertPairs) != 1 || c.CertPairs[0].KeyFile != "key.pem" || len(c.AutoCert.Hosts) != 2 || c.AutoCert.HTTPAddr != "-" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	opt, err := EnvOptions("APITEST_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New(opt)
+	if srv.opts.ReadTimeout != 3*time.Second {
+		t.Fatalf("env option wasn't applied: %v", srv.opts.ReadTimeout)
+	}
+
+	if h, tls := srv.autoCertAddrs(); h != "" || tls != ":https" {
+		t.Fatalf("unexpected autocert addrs: %q %q", h, tls)
+	}
+
+	t.Setenv("APITEST_MAX_HEADER_BYTES", "lots")
+	t.Setenv("APITEST_TLS_KEY_FILE", "")
+	err = c.LoadEnv("APITEST_")
+	if me, ok := err.(MultiError); !ok || len(me) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+}
+
+func TestGroupScopes(t *testing.T) {
+	srv := New()
+	g := srv.Group("api", "/api").WithMeta(RouteMeta{Tags: []string{"reports"}})
+	g.Scopes("reports:read").GET("/reports", func(ctx *Context) Response { return RespOK })
+	g.Scopes("reports:read").Scopes("reports:write").POST("/reports", func(ctx *Context) Response { return RespOK })
+
+	ris := srv.RoutesInfo()
+	if len(ris) != 2 {
+		t.Fatalf("unexpected routes: %+v", ris)
+	}
+
+	if m := ris[0].Meta; m == nil || !m.HasTag("reports") || len(m.Scopes) != 1 || m.Scopes[0] != "reports:read" {
+		t.Fatalf("unexpected meta: %+v", m)
+	}
+
+	if m := ris[1].Meta; len(m.Scopes) != 2 || m.Scopes[1] != "reports:write" {
+		t.Fatalf("unexpected meta: %+v", m)
+	}
+}
+
+func TestGroupMetaMiddleware(t *testing.T) {
+	srv := New()
+	api := srv.Group("api", "/api", func(ctx *Context) Response {
+		ctx.Header().Add("X-MW", "group")
+		return nil
+	})
+
+	h := func(ctx *Context) Response { return RespOK }
+	api.GET("/plain", h)
+	api.Scopes("x").GET("/scoped", h)
+	api.WithMeta(RouteMeta{Name: "state"}).Scopes("y").GET("/state", h)
+
+	view := api.WithMeta(RouteMeta{Tags: []string{"view"}})
+	view.GET("/view", h)
+
+	api.Use(func(ctx *Context) Response {
+		ctx.Header().Add("X-MW", "late")
+		return nil
+	})
+	view.Use(func(ctx *Context) Response {
+		ctx.Header().Add("X-MW", "view")
+		return nil
+	})
+
+	for _, p := range []string{"/api/plain", "/api/scoped", "/api/state", "/api/view"} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, p, nil))
+		if mw := rw.Header()["X-Mw"]; rw.Code != http.StatusOK || strings.Join(mw, ",") != "group,late,view" {
+			t.Fatalf("%s: unexpected middleware: %d %v", p, rw.Code, mw)
+		}
+	}
+}
+
+func TestHijackPassthrough(t *testing.T) {
+	srv := New()
+	srv.Use(Gzip(6), CaptureBodies(0, 1024))
+	srv.GET("/ws", func(ctx *Context) Response {
+		var w http.ResponseWriter = ctx
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("ctx should implement http.Flusher")
+		}
+
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return Break
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\nhello")
+		brw.Flush()
+		return Break
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "hello" {
+		t.Fatalf("unexpected body: %q", b)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	if err := srv.EnableHealth("/"); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	srv.WarmupFuncs(func(context.Context) error {
+		calls++
+		return nil
+	})
+
+	ready := func() int {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rw.Code
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before warmup, got %d", code)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := srv.Warmup(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls != 1 || !srv.Warm() {
+		t.Fatalf("expected 1 warmup call, got %d", calls)
+	}
+
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("expected 200 after warmup, got %d", code)
+	}
+
+	srv = New(SetErrLogger(nil))
+	srv.WarmupFuncs(func(context.Context) error { return context.DeadlineExceeded })
+	if err := srv.Run("127.0.0.1:0"); !errors.Is(err, context.DeadlineExceeded) || srv.Warm() {
+		t.Fatalf("expected the warmup error, got %v", err)
+	}
+}
+
+func TestRequestContextValues(t *testing.T) {
+	inner := New(SetRequestContextValues(true))
+	inner.GET("/inner", func(ctx *Context) Response {
+		return NewJSONResponse(ctx.Get("user"))
+	})
+
+	srv := New(SetRequestContextValues(true))
+	srv.Use(func(ctx *Context) Response {
+		ctx.Set("user", "bob")
+		return nil
+	})
+	srv.GET("/std", FromHTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, _ := ContextValue(r.Context(), "user").(string)
+		w.Write([]byte(v))
+	}))
+	srv.GET("/inner", FromHTTPHandler(inner))
+
+	for path, exp := range map[string]string{"/std": "bob", "/inner": `"data":"bob"`} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+		if !strings.Contains(rw.Body.String(), exp) {
+			t.Fatalf("%s: unexpected body: %s", path, rw.Body.String())
+		}
+	}
+}
+
+func TestLeveledLogs(t *testing.T) {
+	var buf bytes.Buffer
+	srv := New(SetErrLogger(log.New(&buf, "", 0)))
+	srv.SetLogLevel(LogWarn)
+
+	srv.Debugf("debug")
+	srv.Infof("info")
+	srv.Warnf("warn %d", 1)
+	srv.Errorf("error %d", 2)
+	srv.newHTTPServer("").ErrorLog.Print("http: TLS handshake error")
+
+	out := buf.String()
+	if strings.Contains(out, "debug") || strings.Contains(out, "info") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	for _, exp := range []string{"server_test.go", "[WARN] warn 1", "[ERROR] error 2", "[ERROR] http: TLS handshake error"} {
+		if !strings.Contains(out, exp) {
+			t.Fatalf("expected %q in: %s", exp, out)
+		}
+	}
+
+	buf.Reset()
+	srv.SetLogLevel(LogOff)
+	srv.Errorf("error")
+	srv.newHTTPServer("").ErrorLog.Print("http: error")
+	if buf.Len() > 0 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	srv := New(SetErrLogger(log.New(&buf, "", 0)), SetLogSampling(10, time.Minute))
+	srv.Use(LogRequests(false))
+	srv.GET("/ok", func(ctx *Context) Response { return RespOK })
+	srv.GET("/fail", func(ctx *Context) Response { return RespBadRequest })
+
+	for i := 0; i < 20; i++ {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	}
+
+	if ok, fail := strings.Count(buf.String(), " /ok "), strings.Count(buf.String(), " /fail "); ok != 2 || fail != 20 {
+		t.Fatalf("expected 2 sampled and 20 error logs, got %d and %d", ok, fail)
+	}
+
+	buf.Reset()
+	for i := 0; i < 5; i++ {
+		srv.Errorf("db down")
+	}
+	srv.Errorf("other")
+
+	if n := strings.Count(buf.String(), "db down"); n != 1 || !strings.Contains(buf.String(), "other") {
+		t.Fatalf("expected the repeated error to be logged once, got %d: %s", n, buf.String())
+	}
+}
+
+func TestLazyContextData(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/plain", func(ctx *Context) Response {
+		if ctx.data != nil || ctx.Get("x") != nil {
+			t.Error("the data map shouldn't be allocated before Set")
+		}
+		return RespOK
+	})
+	srv.GET("/set", func(ctx *Context) Response {
+		ctx.Set("x", 1)
+		return NewJSONResponse(ctx.Get("x"))
+	})
+
+	for path, exp := range map[string]string{"/plain": `"OK"`, "/set": `"data":1`} {
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+		if !strings.Contains(rw.Body.String(), exp) {
+			t.Fatalf("%s: unexpected body: %s", path, rw.Body.String())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package apiserv
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// RunUntilSignal runs the server on addr until it receives one of sig (defaults to SIGINT and SIGTERM),
+// then drains the active requests and shuts down, waiting up to Options.ShutdownTimeout in total.
+// It returns nil on a clean shutdown, ErrDrainTimeout if requests were still active after the timeout,
+// or the error Run returned if it failed before any signal.
+func (s *Server) RunUntilSignal(addr string, sig ...os.Signal) error {
+	if len(sig) == 0 {
+		sig = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sig...)
+	defer signal.Stop(sigCh)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run(addr) }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case v := <-sigCh:
+		s.Infof("received %v, shutting down", v)
+	}
+
+	err := s.stopGracefully(s.opts.ShutdownTimeout)
+	if rerr := <-errCh; rerr != nil && rerr != http.ErrServerClosed && err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// stopGracefully drains and shuts down the server, timeout is shared between both, 0 means no timeout.
+func (s *Server) stopGracefully(timeout time.Duration) error {
+	start := time.Now()
+
+	if err := s.Drain(timeout); err != nil {
+		s.Warnf("%d requests still active after %v, closing", s.InFlight(), timeout)
+		s.Close()
+		return err
+	}
+
+	if timeout > 0 {
+		if timeout -= time.Since(start); timeout <= 0 {
+			timeout = time.Millisecond
+		}
+	}
+
+	return s.Shutdown(timeout)
+}
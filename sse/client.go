@@ -0,0 +1,205 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultClientRetry is the delay before reconnecting if the server didn't send a retry.
+	DefaultClientRetry = 3 * time.Second
+
+	// DefaultClientMaxRetry caps the reconnect backoff.
+	DefaultClientMaxRetry = 30 * time.Second
+)
+
+// Event is an event received by Client.
+type Event struct {
+	ID    string
+	Event string
+	Data  []byte
+}
+
+// NewClient returns a new Client for the stream at url.
+func NewClient(url string) *Client {
+	return &Client{
+		URL:    url,
+		Header: http.Header{},
+	}
+}
+
+// Client consumes a server-sent events stream, reconnecting automatically with backoff
+// and resuming from the last received event id.
+type Client struct {
+	// HTTPClient is used for the requests, defaults to http.DefaultClient, it shouldn't have a Timeout.
+	HTTPClient *http.Client
+
+	// Header is added to every request.
+	Header http.Header
+
+	URL string
+
+	// LastEventID is sent as the Last-Event-ID header and is updated as events are received.
+	LastEventID string
+
+	// Retry is the initial reconnect delay, defaults to DefaultClientRetry, the server can change it with a retry field.
+	// It doubles on every failed attempt up to MaxRetry (defaults to DefaultClientMaxRetry).
+	Retry    time.Duration
+	MaxRetry time.Duration
+
+	// OnError is called with connection errors before reconnecting if set.
+	OnError func(err error)
+}
+
+// Subscribe connects to the stream and delivers the events on the returned channel,
+// which gets closed once ctx is done or the server replies with a 204, which means the client should stop.
+// Subscribe must not be called again until the channel is closed.
+func (c *Client) Subscribe(ctx context.Context) <-chan *Event {
+	ch := make(chan *Event, 16)
+	go c.run(ctx, ch)
+	return ch
+}
+
+func (c *Client) run(ctx context.Context, ch chan<- *Event) {
+	defer close(ch)
+
+	if c.Retry <= 0 {
+		c.Retry = DefaultClientRetry
+	}
+
+	if c.MaxRetry <= 0 {
+		c.MaxRetry = DefaultClientMaxRetry
+	}
+
+	for attempt := 0; ; attempt++ {
+		connected, stop, err := c.connect(ctx, ch)
+		if stop || ctx.Err() != nil {
+			return
+		}
+
+		if connected {
+			attempt = 0
+		}
+
+		if err != nil && c.OnError != nil {
+			c.OnError(err)
+		}
+
+		d := c.MaxRetry
+		if attempt < 16 { // avoid overflowing
+			if d = c.Retry << uint(attempt); d > c.MaxRetry {
+				d = c.MaxRetry
+			}
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// connect reads events until the connection drops, connected is true if the server accepted the request.
+func (c *Client) connect(ctx context.Context, ch chan<- *Event) (connected, stop bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return false, true, err
+	}
+
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if c.LastEventID != "" {
+		req.Header.Set("Last-Event-ID", c.LastEventID)
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return false, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return false, true, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, false, fmt.Errorf("sse: %s: unexpected status %d", c.URL, resp.StatusCode)
+	}
+
+	var (
+		sc   = bufio.NewScanner(resp.Body)
+		evt  Event
+		data bytes.Buffer
+	)
+
+	sc.Buffer(make([]byte, 4096), 1<<20)
+
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" { // dispatch
+			if data.Len() > 0 {
+				evt.ID = c.LastEventID
+				evt.Data = append([]byte(nil), bytes.TrimSuffix(data.Bytes(), nl)...)
+
+				e := evt
+				select {
+				case ch <- &e:
+				case <-ctx.Done():
+					return true, true, nil
+				}
+			}
+
+			evt = Event{}
+			data.Reset()
+			continue
+		}
+
+		if line[0] == ':' { // comment
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			evt.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				c.LastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				c.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	if err = sc.Err(); err == nil {
+		err = fmt.Errorf("sse: %s: connection closed", c.URL)
+	}
+
+	return true, false, err
+}
@@ -0,0 +1,42 @@
+package sse
+
+import (
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// LongPollEvent is the data of the responses returned by Router.LongPoll.
+type LongPollEvent struct {
+	Data  interface{} `json:"data,omitempty"`
+	ID    string      `json:"id,omitempty"`
+	Event string      `json:"event,omitempty"`
+}
+
+// LongPoll parks the request until an event is sent to id with Send, or timeout elapses,
+// it shares the same listeners as Handle, so legacy clients that can't use sse can be served by the same Router.
+// The event is returned as a LongPollEvent, timeouts return a 204 and the client is expected to poll again.
+func (r *Router) LongPoll(id string, timeout time.Duration, ctx *apiserv.Context) apiserv.Response {
+	var (
+		ch = make(dataChan, 1)
+		ms = r.getOrMake(id)
+		t  = time.NewTimer(timeout)
+	)
+
+	ms.add(ch)
+
+	defer func() {
+		t.Stop()
+		r.removeIfEmpty(ms, ch, id)
+	}()
+
+	select {
+	case m := <-ch:
+		ctx.Header().Set("Cache-Control", "no-cache")
+		return apiserv.NewJSONResponse(&LongPollEvent{Data: m.data, ID: m.id, Event: m.event})
+	case <-t.C:
+		return apiserv.RespEmpty
+	case <-ctx.Req.Context().Done():
+		return apiserv.Break
+	}
+}
@@ -14,12 +14,21 @@ var (
 	ErrNoListener = errors.New("no registered listener")
 )
 
-type dataChan chan []byte
+// message is an event sent through a Router, frame is the encoded sse event,
+// the other fields are kept for LongPoll.
+type message struct {
+	data  interface{}
+	id    string
+	event string
+	frame []byte
+}
+
+type dataChan chan *message
 
 type multiStream struct {
 	clients map[dataChan]struct{}
 	mux     sync.Mutex
-	data    chan []byte
+	data    chan *message
 }
 
 func (ms *multiStream) add(ch dataChan) {
@@ -43,14 +52,14 @@ func (ms *multiStream) close() {
 }
 
 func (ms *multiStream) process() {
-	for b := range ms.data {
-		if b == nil {
+	for m := range ms.data {
+		if m == nil {
 			return
 		}
 
 		ms.mux.Lock()
 		for ch := range ms.clients {
-			trySend(ch, b)
+			trySend(ch, m)
 		}
 		ms.mux.Unlock()
 	}
@@ -72,7 +81,7 @@ func (r *Router) getOrMake(id string) (ms *multiStream) {
 	if ms = r.mss[id]; ms == nil {
 		ms = &multiStream{
 			clients: make(map[dataChan]struct{}, 8),
-			data:    make(chan []byte),
+			data:    make(chan *message),
 		}
 		go ms.process()
 		r.mss[id] = ms
@@ -119,8 +128,8 @@ func (r *Router) Handle(id string, bufSize int, ctx *apiserv.Context) (_ apiserv
 
 	for {
 		select {
-		case data := <-ch:
-			if _, err := ctx.Write(data); err != nil {
+		case m := <-ch:
+			if _, err := ctx.Write(m.frame); err != nil {
 				return nil
 			}
 			f.Flush()
@@ -144,12 +153,12 @@ func (r *Router) Send(id, eventID, event string, data interface{}) (err error) {
 	if b, err = makeData(eventID, event, data); err != nil {
 		return
 	}
-	ms.data <- b
+	ms.data <- &message{data: data, id: eventID, event: event, frame: b}
 
 	return
 }
 
-func trySend(ch dataChan, evt []byte) bool {
+func trySend(ch dataChan, evt *message) bool {
 	select {
 	case ch <- evt:
 		return true
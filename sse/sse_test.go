@@ -1,8 +1,11 @@
 package sse_test
 
 import (
+	"context"
+	"io/ioutil"
 	"log"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -71,3 +74,85 @@ const page = `
 </body>
 </html>
 `
+
+func TestLongPoll(t *testing.T) {
+	srv := apiserv.New()
+	sr := sse.NewRouter()
+
+	srv.GET("/poll/:id", func(ctx *apiserv.Context) apiserv.Response {
+		return sr.LongPoll(ctx.Param("id"), 100*time.Millisecond, ctx)
+	})
+
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest("GET", "/poll/a", nil))
+	if rw.Code != 204 {
+		t.Fatalf("expected a 204 on timeout, got %d", rw.Code)
+	}
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			if sr.Send("a", "1", "msg", "hello") == nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, httptest.NewRequest("GET", "/poll/a", nil))
+
+	var evt sse.LongPollEvent
+	if _, err := apiserv.ReadJSONResponse(ioutil.NopCloser(rw.Body), &evt); err != nil {
+		t.Fatal(err)
+	}
+
+	if evt.ID != "1" || evt.Event != "msg" || evt.Data != "hello" {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+}
+
+func TestClient(t *testing.T) {
+	var conns int32
+	srv := apiserv.New()
+	srv.GET("/events", func(ctx *apiserv.Context) apiserv.Response {
+		n := atomic.AddInt32(&conns, 1)
+		if n == 3 {
+			return apiserv.RespEmpty // ask the client to stop
+		}
+
+		ctx.Header().Set("Content-Type", "text/event-stream")
+		if n == 1 {
+			ctx.Write([]byte("retry: 10\n: comment\n\nid: 1\nevent: a\ndata: hello\ndata: world\n\n"))
+			return nil
+		}
+
+		if id := sse.LastEventID(ctx); id != "1" {
+			t.Errorf("expected Last-Event-ID 1, got %q", id)
+		}
+		ctx.Write([]byte("id: 2\r\ndata: {\"x\":1}\r\n\r\n"))
+		return nil
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var evts []*sse.Event
+	for e := range sse.NewClient(ts.URL + "/events").Subscribe(ctx) {
+		evts = append(evts, e)
+	}
+
+	if len(evts) != 2 || conns != 3 {
+		t.Fatalf("unexpected events (%d conns): %+v", conns, evts)
+	}
+
+	if e := evts[0]; e.ID != "1" || e.Event != "a" || string(e.Data) != "hello\nworld" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	if e := evts[1]; e.ID != "2" || e.Event != "" || string(e.Data) != `{"x":1}` {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
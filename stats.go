@@ -0,0 +1,98 @@
+package apiserv
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// RouteStats are the aggregated stats of a single route, see Server.EnableStats.
+type RouteStats struct {
+	Group  string `json:"group,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	// Status is the number of responses by status class (1xx, 2xx, 3xx, 4xx and 5xx).
+	Status map[string]int64 `json:"status"`
+
+	Count      int64         `json:"count"`
+	AvgLatency time.Duration `json:"avgLatency"`
+	MaxLatency time.Duration `json:"maxLatency"`
+}
+
+type routeStats struct {
+	status [5]int64
+	count  int64
+	total  int64
+	max    int64
+}
+
+func (rs *routeStats) record(status int, d time.Duration) {
+	if idx := status/100 - 1; idx >= 0 && idx < len(rs.status) {
+		atomic.AddInt64(&rs.status[idx], 1)
+	}
+
+	atomic.AddInt64(&rs.count, 1)
+	atomic.AddInt64(&rs.total, int64(d))
+
+	for {
+		max := atomic.LoadInt64(&rs.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&rs.max, max, int64(d)) {
+			return
+		}
+	}
+}
+
+var statusClasses = [...]string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// EnableStats starts collecting per-route request counts, latencies and status classes,
+// if expvarName isn't empty, the stats are also published with expvar (and served by EnableDebug's /vars),
+// along with the connection stats as expvarName + ".conns".
+// Note that expvar names must be unique, expvar.Publish panics otherwise.
+func (s *Server) EnableStats(expvarName string) {
+	atomic.StoreInt32(&s.statsOn, 1)
+
+	if expvarName != "" {
+		expvar.Publish(expvarName, expvar.Func(func() interface{} { return s.Stats() }))
+		expvar.Publish(expvarName+".conns", expvar.Func(func() interface{} { return s.ConnStats() }))
+	}
+}
+
+func (s *Server) statsEnabled() bool {
+	return atomic.LoadInt32(&s.statsOn) == 1
+}
+
+// Stats returns the stats of all the routes that served at least one request since EnableStats was called,
+// in the order the routes were added.
+func (s *Server) Stats() []RouteStats {
+	out := make([]RouteStats, 0, len(s.routes))
+	for _, ri := range s.routes {
+		rs := &ri.chain.stats
+
+		n := atomic.LoadInt64(&rs.count)
+		if n == 0 {
+			continue
+		}
+
+		st := RouteStats{
+			Group:  ri.Group,
+			Method: ri.Method,
+			Path:   ri.Path,
+			Status: make(map[string]int64, len(rs.status)),
+
+			Count:      n,
+			AvgLatency: time.Duration(atomic.LoadInt64(&rs.total) / n),
+			MaxLatency: time.Duration(atomic.LoadInt64(&rs.max)),
+		}
+
+		for i := range rs.status {
+			if v := atomic.LoadInt64(&rs.status[i]); v > 0 {
+				st.Status[statusClasses[i]] = v
+			}
+		}
+
+		out = append(out, st)
+	}
+
+	return out
+}
@@ -0,0 +1,100 @@
+package apiserv
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// JSONArrayFlushEvery is how many elements StreamJSONArray writes between flushes.
+const JSONArrayFlushEvery = 64
+
+var (
+	jsonArrayOpen  = []byte("[")
+	jsonArrayComma = []byte(",")
+	jsonArrayClose = []byte("]\n")
+)
+
+// StreamJSONArray returns a response that writes every value passed to send as an element of a json array,
+// for result sets too big to buffer, for clients that can't read ndjson.
+// send returns an error if the element couldn't be encoded or the client went away, returning it from fn stops the stream.
+// Once the first byte is written the status can't change, so if fn returns an error the closing bracket isn't written,
+// which lets clients detect the truncated array.
+func StreamJSONArray(fn func(send func(v interface{}) error) error) Response {
+	return jsonArrayResp(fn)
+}
+
+// StreamJSONArrayChan returns a StreamJSONArray response that sends every value received from ch until it's closed,
+// ch must be a receivable channel of any type.
+func StreamJSONArrayChan(ch interface{}) Response {
+	cv := reflect.ValueOf(ch)
+	if cv.Kind() != reflect.Chan || cv.Type().ChanDir()&reflect.RecvDir == 0 {
+		panic(fmt.Sprintf("apiserv: StreamJSONArrayChan: %T is not a receivable channel", ch))
+	}
+
+	return jsonArrayResp(func(send func(v interface{}) error) error {
+		for {
+			v, ok := cv.Recv()
+			if !ok {
+				return nil
+			}
+
+			if err := send(v.Interface()); err != nil {
+				// drain it so the producer doesn't block forever
+				go func() {
+					for _, ok := cv.Recv(); ok; _, ok = cv.Recv() {
+					}
+				}()
+				return err
+			}
+		}
+	})
+}
+
+type jsonArrayResp func(send func(v interface{}) error) error
+
+func (fn jsonArrayResp) WriteToCtx(ctx *Context) error {
+	ctx.SetContentType(MimeJSON)
+	ctx.WriteHeader(http.StatusOK)
+
+	if _, err := ctx.Write(jsonArrayOpen); err != nil {
+		return err
+	}
+
+	c, n := ctx.jsonCodec(), 0
+	err := fn(func(v interface{}) error {
+		if err := ctx.Req.Context().Err(); err != nil {
+			return err
+		}
+
+		b, err := c.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			if _, err = ctx.Write(jsonArrayComma); err != nil {
+				return err
+			}
+		}
+
+		if _, err = ctx.Write(b); err != nil {
+			return err
+		}
+
+		if n++; n%JSONArrayFlushEvery == 0 {
+			ctx.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		ctx.s.Errorf("json array stream (%s): %v", ctx.Req.URL.Path, err)
+		return err
+	}
+
+	_, err = ctx.Write(jsonArrayClose)
+	ctx.Flush()
+	return err
+}
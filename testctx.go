@@ -0,0 +1,47 @@
+package apiserv
+
+import (
+	"io"
+	"net/http/httptest"
+	"sync"
+)
+
+var (
+	testSrv     *Server
+	testSrvOnce sync.Once
+)
+
+// NewTestContext returns a Context for unit testing handlers and middleware without a Server or router,
+// along with the recorder it writes to.
+// Route params can be set with ctx.Params, and ctx.Next is a no-op until the chain is set with SetTestNext.
+func NewTestContext(method, path string, body io.Reader) (*Context, *httptest.ResponseRecorder) {
+	testSrvOnce.Do(func() { testSrv = New(SetErrLogger(nil)) })
+
+	rec := httptest.NewRecorder()
+	ctx := &Context{
+		ResponseWriter: rec,
+		Req:            httptest.NewRequest(method, path, body),
+		s:              testSrv,
+	}
+
+	return ctx, rec
+}
+
+// SetTestNext sets the handlers called by ctx.Next, only meant to be used with NewTestContext.
+// The first handler to return a non-nil Response stops the chain, and its response is written like in a real route.
+func (ctx *Context) SetTestNext(handlers ...Handler) {
+	var idx int
+	ctx.nextMW = nil
+	ctx.next = func() (r Response) {
+		for idx < len(handlers) && !ctx.aborted {
+			h := handlers[idx]
+			idx++
+			if r = h(ctx); r != nil {
+				ctx.writeResponse(r)
+				break
+			}
+		}
+		ctx.next = nil
+		return
+	}
+}
@@ -0,0 +1,118 @@
+package apiserv
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+)
+
+// TicketKeysFunc returns the TLS session ticket keys, the first one encrypts new tickets and all of them can decrypt.
+// Instances behind the same load balancer should return the same keys (ex: from a shared store) so sessions resume across them.
+type TicketKeysFunc = func() ([][32]byte, error)
+
+// NewTicketKeys returns a TicketKeysFunc that generates a new random key on every call,
+// keeping the last n-1 ones so tickets issued before a rotation can still be resumed.
+func NewTicketKeys(n int) TicketKeysFunc {
+	if n < 1 {
+		n = 1
+	}
+
+	var (
+		mux  sync.Mutex
+		keys [][32]byte
+	)
+
+	return func() ([][32]byte, error) {
+		var k [32]byte
+		if _, err := rand.Read(k[:]); err != nil {
+			return nil, err
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+
+		if keys = append([][32]byte{k}, keys...); len(keys) > n {
+			keys = keys[:n]
+		}
+
+		return append([][32]byte(nil), keys...), nil
+	}
+}
+
+// ticketRotator serves the handshakes with a copy of base that has the current keys.
+// http.Server clones its TLSConfig, so calling SetSessionTicketKeys on base after it started serving has no effect.
+type ticketRotator struct {
+	base *tls.Config
+
+	mux  sync.Mutex
+	keys [][32]byte
+	cfg  *tls.Config
+}
+
+func (tr *ticketRotator) set(keys [][32]byte) {
+	tr.mux.Lock()
+	tr.keys, tr.cfg = keys, nil
+	tr.mux.Unlock()
+}
+
+func (tr *ticketRotator) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	// built lazily so it picks up the NextProtos http.Server adds to base
+	if tr.cfg == nil && len(tr.keys) > 0 {
+		cfg := tr.base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.SetSessionTicketKeys(tr.keys)
+		tr.cfg = cfg
+	}
+
+	return tr.cfg, nil
+}
+
+var errNoTicketKeys = errors.New("no keys returned")
+
+// rotateTicketKeys sets the session ticket keys on cfg and refreshes them every Options.SessionTicketRotation until the server is closed.
+func (s *Server) rotateTicketKeys(cfg *tls.Config) {
+	every := s.opts.SessionTicketRotation
+	if every <= 0 || cfg.SessionTicketsDisabled || cfg.GetConfigForClient != nil {
+		return
+	}
+
+	fn := s.opts.SessionTicketKeys
+	if fn == nil {
+		fn = NewTicketKeys(3)
+	}
+
+	tr := &ticketRotator{base: cfg}
+	rotate := func() {
+		keys, err := fn()
+		if err == nil && len(keys) == 0 {
+			err = errNoTicketKeys
+		}
+
+		if err != nil {
+			s.Warnf("session ticket keys: %v", err)
+			return
+		}
+
+		tr.set(keys)
+	}
+
+	rotate()
+	cfg.GetConfigForClient = tr.getConfigForClient
+
+	go func() {
+		tk := time.NewTicker(every)
+		defer tk.Stop()
+
+		for range tk.C {
+			if s.Closed() {
+				return
+			}
+			rotate()
+		}
+	}()
+}
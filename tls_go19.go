@@ -3,6 +3,7 @@
 package apiserv
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -11,6 +12,10 @@ import (
 
 // RunTLS starts the server on the specific address, using tls
 func (s *Server) RunTLS(addr string, certPairs []CertPair) error {
+	if err := s.Warmup(context.Background()); err != nil {
+		return err
+	}
+
 	cfg := tls.Config{RootCAs: x509.NewCertPool()}
 	cfg.Certificates = make([]tls.Certificate, 0, len(certPairs))
 
@@ -21,8 +26,15 @@ func (s *Server) RunTLS(addr string, certPairs []CertPair) error {
 		}
 		cfg.Certificates = append(cfg.Certificates, cert)
 	}
+	s.trackCertPairs(certPairs, cfg.Certificates)
 
 	cfg.BuildNameToCertificate()
+	s.applyTLSOptions(&cfg)
+
+	if st := s.newOCSPStapler(cfg.Certificates); st != nil {
+		cfg.GetCertificate = st.getCertificate
+		go st.run()
+	}
 
 	if addr == "" {
 		addr = ":https"
@@ -35,14 +47,23 @@ func (s *Server) RunTLS(addr string, certPairs []CertPair) error {
 
 	srv := s.newHTTPServer(ln.Addr().String())
 	srv.TLSConfig = &cfg
+	s.rotateTicketKeys(&cfg)
 
-	s.serversMux.Lock()
-	s.servers = append(s.servers, srv)
-	s.serversMux.Unlock()
+	return s.serve(srv, ln)
+}
+
+// applyTLSOptions sets the TLS related Options on cfg.
+func (s *Server) applyTLSOptions(cfg *tls.Config) {
+	cfg.MinVersion = s.opts.TLSMinVersion
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
 
-	if s.opts.KeepAlivePeriod == -1 {
-		return srv.ServeTLS(ln, "", "")
+	if len(s.opts.TLSCipherSuites) > 0 {
+		cfg.CipherSuites = s.opts.TLSCipherSuites
 	}
 
-	return srv.ServeTLS(&tcpKeepAliveListener{ln.(*net.TCPListener), s.opts.KeepAlivePeriod}, "", "")
+	if len(s.opts.TLSCurvePreferences) > 0 {
+		cfg.CurvePreferences = s.opts.TLSCurvePreferences
+	}
 }
@@ -0,0 +1,165 @@
+package uploads
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound is returned by stores for unknown upload ids.
+var ErrNotFound = errors.New("upload not found")
+
+// Info is the state of an upload.
+type Info struct {
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ID        string            `json:"id"`
+	Size      int64             `json:"size"`
+
+	// Offset is the number of bytes received so far, it isn't persisted by FileStore.
+	Offset int64 `json:"-"`
+}
+
+// Done returns true once all the bytes were received.
+func (i *Info) Done() bool {
+	return i.Offset >= i.Size
+}
+
+// Store is a storage backend for uploads, it doesn't need to handle locking, the handler makes sure
+// there's only one Write per upload at a time.
+type Store interface {
+	// Create stores a new, empty upload.
+	Create(ctx context.Context, info *Info) error
+
+	// Info returns the upload's info with an up to date Offset, or ErrNotFound.
+	Info(ctx context.Context, id string) (*Info, error)
+
+	// Write appends r to the upload at offset and returns the number of bytes written,
+	// which must be kept even if r returns an error, since that's where the client resumes from.
+	Write(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+
+	// Delete removes the upload and its data.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewFileStore returns a Store that saves uploads in dir, it's created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// FileStore stores each upload as 2 files in a local directory, <id> with the data and <id>.info.
+type FileStore struct {
+	dir string
+}
+
+// Path returns the path of the upload's data file, use it to move the file once the upload is done.
+func (fs *FileStore) Path(id string) string {
+	return filepath.Join(fs.dir, id)
+}
+
+// Create implements Store.
+func (fs *FileStore) Create(_ context.Context, info *Info) error {
+	if !validID(info.ID) {
+		return ErrNotFound
+	}
+
+	j, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fs.Path(info.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return ioutil.WriteFile(fs.Path(info.ID)+".info", j, 0o644)
+}
+
+// Info implements Store.
+func (fs *FileStore) Info(_ context.Context, id string) (*Info, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	j, err := ioutil.ReadFile(fs.Path(id) + ".info")
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var info Info
+	if err = json.Unmarshal(j, &info); err != nil {
+		return nil, err
+	}
+
+	st, err := os.Stat(fs.Path(id))
+	if err != nil {
+		return nil, err
+	}
+	info.Offset = st.Size()
+
+	return &info, nil
+}
+
+// Write implements Store.
+func (fs *FileStore) Write(_ context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	if !validID(id) {
+		return 0, ErrNotFound
+	}
+
+	f, err := os.OpenFile(fs.Path(id), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return io.Copy(f, r)
+}
+
+// Delete implements Store.
+func (fs *FileStore) Delete(_ context.Context, id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+
+	err := os.Remove(fs.Path(id) + ".info")
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	if rerr := os.Remove(fs.Path(id)); err == nil && !os.IsNotExist(rerr) {
+		err = rerr
+	}
+
+	return err
+}
+
+// validID makes sure ids can't be used to escape the store's directory.
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,263 @@
+// Package uploads implements resumable uploads based on the tus 1.0 protocol (https://tus.io/protocols/resumable-upload),
+// with the creation and termination extensions, so big uploads over flaky connections can resume where they stopped.
+//
+//	fs, _ := uploads.NewFileStore("/var/uploads")
+//	up := uploads.New(fs, uploads.Options{MaxSize: 1 << 30, OnComplete: moveToS3})
+//	up.Mount(srv.Group("uploads", "/uploads", authMW))
+package uploads
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+// Version is the supported tus protocol version.
+const Version = "1.0.0"
+
+const offsetContentType = "application/offset+octet-stream"
+
+// Options configures the uploads handler.
+type Options struct {
+	// OnComplete is called once all the bytes of an upload were received, a non-nil response is returned
+	// to the client instead of the default 204.
+	OnComplete func(ctx *apiserv.Context, info *Info) apiserv.Response
+
+	// MaxSize is the max size of a single upload if > 0.
+	MaxSize int64
+}
+
+// New returns a new Uploads handler using store as its backend.
+func New(store Store, opts Options) *Uploads {
+	return &Uploads{
+		store: store,
+		opts:  opts,
+	}
+}
+
+// Uploads handles the tus endpoints for a Store.
+type Uploads struct {
+	store Store
+	locks sync.Map
+	opts  Options
+}
+
+// Mount adds the upload routes to g:
+//
+//	OPTIONS /        server capabilities
+//	POST    /        create an upload, requires Upload-Length
+//	HEAD    /:id     get the current offset
+//	PATCH   /:id     append data at Upload-Offset
+//	DELETE  /:id     terminate an upload
+func (up *Uploads) Mount(g apiserv.Group) error {
+	for _, r := range []struct {
+		method, path string
+		h            apiserv.Handler
+	}{
+		{http.MethodOptions, "", up.options},
+		{http.MethodPost, "", up.create},
+		{http.MethodHead, ":id", up.head},
+		{http.MethodPatch, ":id", up.patch},
+		{http.MethodDelete, ":id", up.delete},
+	} {
+		if err := g.AddRoute(r.method, r.path, up.checkVersion, r.h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (up *Uploads) checkVersion(ctx *apiserv.Context) apiserv.Response {
+	h := ctx.Header()
+	h.Set("Tus-Resumable", Version)
+	h.Set("Cache-Control", "no-store")
+
+	if ctx.Req.Method == http.MethodOptions {
+		return nil
+	}
+
+	if v := ctx.Req.Header.Get("Tus-Resumable"); v != Version {
+		h.Set("Tus-Version", Version)
+		return apiserv.NewJSONErrorResponse(http.StatusPreconditionFailed, "unsupported Tus-Resumable version: "+v)
+	}
+
+	return nil
+}
+
+func (up *Uploads) options(ctx *apiserv.Context) apiserv.Response {
+	h := ctx.Header()
+	h.Set("Tus-Version", Version)
+	h.Set("Tus-Extension", "creation,termination")
+	if up.opts.MaxSize > 0 {
+		h.Set("Tus-Max-Size", strconv.FormatInt(up.opts.MaxSize, 10))
+	}
+	return apiserv.RespEmpty
+}
+
+func (up *Uploads) create(ctx *apiserv.Context) apiserv.Response {
+	size, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		return apiserv.NewJSONErrorResponse(http.StatusBadRequest, &apiserv.Error{Field: "Upload-Length", Message: "missing or invalid"})
+	}
+
+	if up.opts.MaxSize > 0 && size > up.opts.MaxSize {
+		return apiserv.NewJSONErrorResponse(http.StatusRequestEntityTooLarge)
+	}
+
+	md, err := parseMetadata(ctx.Req.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusBadRequest, &apiserv.Error{Field: "Upload-Metadata", Message: err.Error()})
+	}
+
+	info := &Info{
+		ID:        newID(),
+		Size:      size,
+		Metadata:  md,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err = up.store.Create(ctx.Req.Context(), info); err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+	}
+
+	ctx.Header().Set("Location", strings.TrimSuffix(ctx.Req.URL.Path, "/")+"/"+info.ID)
+	ctx.Header().Set("Upload-Offset", "0")
+
+	if size == 0 && up.opts.OnComplete != nil {
+		if r := up.opts.OnComplete(ctx, info); r != nil {
+			return r
+		}
+	}
+
+	r := apiserv.NewJSONResponse(info)
+	r.Code = http.StatusCreated
+	return r
+}
+
+func (up *Uploads) head(ctx *apiserv.Context) apiserv.Response {
+	info, r := up.info(ctx)
+	if r != nil {
+		return r
+	}
+
+	h := ctx.Header()
+	h.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(info.Size, 10))
+	return apiserv.RespPlainOK
+}
+
+func (up *Uploads) patch(ctx *apiserv.Context) apiserv.Response {
+	defer ctx.CloseBody()
+
+	if ct := ctx.Req.Header.Get("Content-Type"); ct != offsetContentType {
+		return apiserv.NewJSONErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be "+offsetContentType)
+	}
+
+	offset, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return apiserv.NewJSONErrorResponse(http.StatusBadRequest, &apiserv.Error{Field: "Upload-Offset", Message: "missing or invalid"})
+	}
+
+	id := ctx.Param("id")
+	if _, locked := up.locks.LoadOrStore(id, struct{}{}); locked {
+		return apiserv.NewJSONErrorResponse(http.StatusLocked, "the upload is in progress")
+	}
+	defer up.locks.Delete(id)
+
+	info, r := up.info(ctx)
+	if r != nil {
+		return r
+	}
+
+	if offset != info.Offset {
+		ctx.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+		return apiserv.NewJSONErrorResponse(http.StatusConflict, &apiserv.Error{Field: "Upload-Offset", Message: "doesn't match the current offset"})
+	}
+
+	left := info.Size - info.Offset
+	if ctx.Req.ContentLength > left {
+		return apiserv.NewJSONErrorResponse(http.StatusRequestEntityTooLarge)
+	}
+
+	n, err := up.store.Write(ctx.Req.Context(), id, offset, io.LimitReader(ctx.Req.Body, left))
+	info.Offset += n
+	ctx.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+
+	if err != nil {
+		return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+	}
+
+	if info.Done() && up.opts.OnComplete != nil {
+		if r := up.opts.OnComplete(ctx, info); r != nil {
+			return r
+		}
+	}
+
+	return apiserv.RespEmpty
+}
+
+func (up *Uploads) delete(ctx *apiserv.Context) apiserv.Response {
+	if err := up.store.Delete(ctx.Req.Context(), ctx.Param("id")); err != nil {
+		return storeError(err)
+	}
+	return apiserv.RespEmpty
+}
+
+func (up *Uploads) info(ctx *apiserv.Context) (*Info, apiserv.Response) {
+	info, err := up.store.Info(ctx.Req.Context(), ctx.Param("id"))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return info, nil
+}
+
+func storeError(err error) apiserv.Response {
+	if errors.Is(err, ErrNotFound) {
+		return apiserv.RespNotFound
+	}
+	return apiserv.NewJSONErrorResponse(http.StatusInternalServerError, err)
+}
+
+// parseMetadata parses the Upload-Metadata header, "key base64value,key2 base64value".
+func parseMetadata(v string) (map[string]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	md := map[string]string{}
+	for _, kv := range strings.Split(v, ",") {
+		parts := strings.Fields(kv)
+		switch len(parts) {
+		case 1:
+			md[parts[0]] = ""
+		case 2:
+			b, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, errors.New("invalid value for " + parts[0])
+			}
+			md[parts[0]] = string(b)
+		default:
+			return nil, errors.New("malformed pair: " + kv)
+		}
+	}
+
+	return md, nil
+}
+
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,93 @@
+package uploads
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/missionMeteora/apiserv"
+)
+
+func TestUploads(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var done *Info
+	up := New(fs, Options{
+		MaxSize:    100,
+		OnComplete: func(ctx *apiserv.Context, info *Info) apiserv.Response { done = info; return nil },
+	})
+
+	srv := apiserv.New(apiserv.SetErrLogger(nil))
+	if err = up.Mount(srv.Group("uploads", "/files")); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path string, body string, hdrs ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", Version)
+		for i := 0; i < len(hdrs); i += 2 {
+			req.Header.Set(hdrs[i], hdrs[i+1])
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	if rw := do(http.MethodPost, "/files", "", "Upload-Length", "101"); rw.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected a 413, got %d", rw.Code)
+	}
+
+	rw := do(http.MethodPost, "/files", "", "Upload-Length", "11", "Upload-Metadata", "filename aGVsbG8udHh0,private")
+	loc := rw.Header().Get("Location")
+	if rw.Code != http.StatusCreated || !strings.HasPrefix(loc, "/files/") {
+		t.Fatalf("unexpected create response %d (%s): %s", rw.Code, loc, rw.Body.Bytes())
+	}
+
+	if rw = do(http.MethodPatch, loc, "hello", "Upload-Offset", "0", "Content-Type", offsetContentType); rw.Code != http.StatusNoContent {
+		t.Fatalf("unexpected patch response %d: %s", rw.Code, rw.Body.Bytes())
+	}
+
+	if rw = do(http.MethodPatch, loc, "hello", "Upload-Offset", "0", "Content-Type", offsetContentType); rw.Code != http.StatusConflict {
+		t.Fatalf("expected a 409 for a stale offset, got %d", rw.Code)
+	}
+
+	if rw = do(http.MethodHead, loc, ""); rw.Header().Get("Upload-Offset") != "5" || rw.Header().Get("Upload-Length") != "11" {
+		t.Fatalf("unexpected head response: %v", rw.Header())
+	}
+
+	if done != nil {
+		t.Fatal("OnComplete called early")
+	}
+
+	if rw = do(http.MethodPatch, loc, " world", "Upload-Offset", "5", "Content-Type", offsetContentType); rw.Code != http.StatusNoContent {
+		t.Fatalf("unexpected patch response %d: %s", rw.Code, rw.Body.Bytes())
+	}
+
+	if done == nil || done.Metadata["filename"] != "hello.txt" || done.Offset != 11 {
+		t.Fatalf("unexpected info: %+v", done)
+	}
+
+	if b, _ := ioutil.ReadFile(fs.Path(done.ID)); string(b) != "hello world" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+
+	if rw = do(http.MethodDelete, loc, ""); rw.Code != http.StatusNoContent {
+		t.Fatalf("unexpected delete response %d", rw.Code)
+	}
+
+	if rw = do(http.MethodHead, loc, ""); rw.Code != http.StatusNotFound {
+		t.Fatalf("expected a 404 after delete, got %d", rw.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodHead, loc, nil)
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+	if rw.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected a 412 without Tus-Resumable, got %d", rw.Code)
+	}
+}
@@ -0,0 +1,158 @@
+package apiserv
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const userAgentKey = ":UA:"
+
+// Device classes returned by ParseUserAgent.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgent is a coarse classification of a User-Agent header, it's meant for policies and analytics,
+// not for detecting specific browser versions.
+type UserAgent struct {
+	Raw    string `json:"raw"`
+	Device string `json:"device"`
+
+	// BotName is set for known crawlers, ex: "Googlebot".
+	BotName string `json:"botName,omitempty"`
+	Bot     bool   `json:"bot"`
+}
+
+// known bots, checked in order, the first matching token names the bot.
+var knownBots = []string{
+	"Googlebot", "bingbot", "Slurp", "DuckDuckBot", "Baiduspider", "YandexBot", "facebookexternalhit",
+	"Twitterbot", "LinkedInBot", "Slackbot", "Discordbot", "AhrefsBot", "SemrushBot", "MJ12bot", "PetalBot",
+	"Applebot", "GPTBot", "CCBot",
+}
+
+// generic tokens used by other bots, scripts and http libraries.
+var botTokens = []string{
+	"bot", "crawler", "spider", "scraper", "curl/", "wget/", "python-requests", "go-http-client", "httpclient",
+	"okhttp", "headless",
+}
+
+// ParseUserAgent classifies ua into a device type and detects bots.
+func ParseUserAgent(ua string) *UserAgent {
+	u := &UserAgent{Raw: ua, Device: DeviceUnknown}
+	if ua == "" {
+		return u
+	}
+
+	for _, b := range knownBots {
+		if strings.Contains(ua, b) {
+			u.Bot, u.BotName, u.Device = true, b, DeviceBot
+			return u
+		}
+	}
+
+	lua := strings.ToLower(ua)
+	for _, t := range botTokens {
+		if strings.Contains(lua, t) {
+			u.Bot, u.Device = true, DeviceBot
+			return u
+		}
+	}
+
+	switch {
+	case strings.Contains(lua, "ipad"), strings.Contains(lua, "tablet"),
+		strings.Contains(lua, "android") && !strings.Contains(lua, "mobile"):
+		u.Device = DeviceTablet
+	case strings.Contains(lua, "mobi"), strings.Contains(lua, "iphone"), strings.Contains(lua, "android"):
+		u.Device = DeviceMobile
+	case strings.Contains(lua, "mozilla/"):
+		u.Device = DeviceDesktop
+	}
+
+	return u
+}
+
+// UserAgent returns the parsed User-Agent of the request, it's only parsed once per request.
+func (ctx *Context) UserAgent() *UserAgent {
+	if u, ok := ctx.Get(userAgentKey).(*UserAgent); ok {
+		return u
+	}
+
+	u := ParseUserAgent(ctx.Req.UserAgent())
+	ctx.Set(userAgentKey, u)
+	return u
+}
+
+// BotPolicy controls the BotFilter middleware.
+type BotPolicy struct {
+	// Allow lists bot names (as returned in UserAgent.BotName) that are never blocked or limited, ex: "Googlebot".
+	Allow []string
+
+	// Block rejects all the other bots with a 403.
+	Block bool
+
+	// RateLimit is the max number of requests per Window for each bot (by name, or user-agent for unnamed bots) if > 0.
+	RateLimit int
+	Window    time.Duration
+}
+
+// BotFilter returns a middleware that applies p to requests from bots, each call has its own rate limit counters,
+// so it can be used per group.
+func BotFilter(p BotPolicy) Handler {
+	allow := make(map[string]bool, len(p.Allow))
+	for _, n := range p.Allow {
+		allow[n] = true
+	}
+
+	if p.Window <= 0 {
+		p.Window = time.Minute
+	}
+
+	var (
+		mux         sync.Mutex
+		counts      = map[string]int{}
+		windowStart = time.Now()
+	)
+
+	return func(ctx *Context) Response {
+		u := ctx.UserAgent()
+		if !u.Bot || allow[u.BotName] {
+			return nil
+		}
+
+		if p.Block {
+			return RespForbidden
+		}
+
+		if p.RateLimit <= 0 {
+			return nil
+		}
+
+		key := u.BotName
+		if key == "" {
+			key = u.Raw
+		}
+
+		mux.Lock()
+		now := time.Now()
+		if now.Sub(windowStart) >= p.Window {
+			counts, windowStart = map[string]int{}, now
+		}
+		counts[key]++
+		n, reset := counts[key], windowStart.Add(p.Window).Sub(now)
+		mux.Unlock()
+
+		if n > p.RateLimit {
+			ctx.Header().Set("Retry-After", strconv.Itoa(int(reset/time.Second)+1))
+			return NewJSONErrorResponse(http.StatusTooManyRequests)
+		}
+
+		return nil
+	}
+}
@@ -1,9 +1,15 @@
 package apiserv
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,7 +51,8 @@ func StaticDir(dir, paramName string) Handler {
 // StaticDirWithLimit returns a handler that handles serving static files.
 // paramName is the path param, for example: s.GET("/s/*fp", StaticDirWithLimit("./static/", "fp", 1000)).
 // if limit is > 0, it will only ever serve N files at a time.
-// BUG: returns 0 size for some reason
+// Files are served with http.ServeContent, so Range, HEAD and conditional requests (If-Range, If-Modified-Since, etc) work,
+// directories are served using their index.html if they have one.
 func StaticDirWithLimit(dir, paramName string, limit int) Handler {
 	var (
 		sem chan struct{}
@@ -57,21 +64,52 @@ func StaticDirWithLimit(dir, paramName string, limit int) Handler {
 	}
 
 	return func(ctx *Context) Response {
-		path := ctx.Param(paramName)
+		// path.Clean on a rooted path makes sure we never go above dir
+		fp := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+ctx.Param(paramName))))
+
 		if sem != nil {
 			sem <- e
 			defer func() { <-sem }()
 		}
 
-		if err := ctx.File(filepath.Join(dir, path)); err != nil {
+		f, st, err := openStatic(fp)
+		if err != nil {
 			if os.IsNotExist(err) {
 				return RespNotFound
 			}
 			return NewJSONErrorResponse(http.StatusInternalServerError, err)
 		}
+		defer f.Close()
 
-		return nil
+		ctx.ServeContent(st.Name(), st.ModTime(), f)
+
+		return Break
+	}
+}
+
+// openStatic opens fp, or its index.html if it's a directory.
+func openStatic(fp string) (*os.File, os.FileInfo, error) {
+	for i := 0; i < 2; i++ {
+		f, err := os.Open(fp)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+
+		if !st.IsDir() {
+			return f, st, nil
+		}
+
+		f.Close()
+		fp = filepath.Join(fp, "index.html")
 	}
+
+	return nil, nil, os.ErrNotExist
 }
 
 type noListingDir string
@@ -111,6 +149,15 @@ func AllowCORS(methods, headers, origins []string, groups ...Group) Handler {
 		rh, wh := ctx.Req.Header, ctx.Header()
 		origin := rh.Get("Origin")
 
+		// the response depends on these even when they're missing, so caches must not share it
+		addVary(wh, "Origin")
+		if len(ms) == 0 {
+			addVary(wh, "Access-Control-Request-Method")
+		}
+		if len(hs) == 0 {
+			addVary(wh, "Access-Control-Request-Headers")
+		}
+
 		if origin == "" { // return early if it's not a browser request
 			return
 		}
@@ -146,6 +193,37 @@ func AllowCORS(methods, headers, origins []string, groups ...Group) Handler {
 	return fn
 }
 
+// addVary adds the values to h's Vary header, unless they're already there or it is "*".
+func addVary(h http.Header, values ...string) {
+	cur := h.Values("Vary")
+
+	for _, v := range values {
+		if !varyHas(cur, v) {
+			h.Add("Vary", v)
+			cur = h.Values("Vary")
+		}
+	}
+}
+
+func varyHas(cur []string, v string) bool {
+	for _, line := range cur {
+		for _, f := range strings.Split(line, ",") {
+			if f = strings.TrimSpace(f); f == "*" || strings.EqualFold(f, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newRequestID() string {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
+
 type M map[string]interface{}
 
 // ToJSON returns a string json representation of M, mostly for debugging.
@@ -194,3 +272,32 @@ func (me MultiError) Error() string {
 
 	return "multiple errors returned:\n\t" + strings.Join(errs, "\n\t")
 }
+
+// funcName returns the full name of the function h points to, ex: github.com/user/api.(*Users).Get-fm.
+func funcName(h Handler) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(h).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
+
+// preloadLink returns a Link header value for l, full values (ex: `</app.js>; rel=preload; as=script`) are returned as is,
+// bare paths are turned into preload links with the destination guessed from the extension.
+func preloadLink(l string) string {
+	if strings.HasPrefix(l, "<") {
+		return l
+	}
+
+	v := "<" + l + ">; rel=preload"
+	switch ext := strings.ToLower(path.Ext(l)); ext {
+	case ".css":
+		v += "; as=style"
+	case ".js", ".mjs":
+		v += "; as=script"
+	case ".woff", ".woff2", ".ttf", ".otf":
+		v += "; as=font; crossorigin" // fonts are always fetched in cors mode
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".ico":
+		v += "; as=image"
+	}
+	return v
+}
@@ -0,0 +1,38 @@
+package apiserv
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// errWarmingUp is returned in readiness reports until the warmup funcs finished.
+const errWarmingUp = "server is warming up"
+
+// WarmupFuncs adds funcs that get called once, in order, before the server starts serving,
+// useful to load caches, templates or keys before the first real request instead of paying the cost on it.
+// It is NOT safe to call this once you call one of the run functions.
+func (s *Server) WarmupFuncs(fns ...func(ctx context.Context) error) {
+	s.warmups = append(s.warmups, fns...)
+}
+
+// Warmup runs the warmup funcs, the run functions call it before listening and return its error.
+// Only the first call runs them, later calls wait for it and return the same error.
+// Call it manually when using the server as an http.Handler, readyz reports the server as not ready until it's done.
+func (s *Server) Warmup(ctx context.Context) error {
+	s.warmupOnce.Do(func() {
+		for i, fn := range s.warmups {
+			if err := fn(ctx); err != nil {
+				s.warmupErr = fmt.Errorf("apiserv: warmup #%d: %w", i, err)
+				return
+			}
+		}
+		atomic.StoreInt32(&s.warm, 1)
+	})
+	return s.warmupErr
+}
+
+// Warm returns true if there are no warmup funcs or they all finished successfully.
+func (s *Server) Warm() bool {
+	return len(s.warmups) == 0 || atomic.LoadInt32(&s.warm) == 1
+}